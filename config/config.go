@@ -16,6 +16,7 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"reflect"
 	"regexp"
 	"strings"
@@ -28,23 +29,46 @@ import (
 // directly to YAML. Fields that cannot be set in the cloud-config (fields
 // used for internal use) have the YAML tag '-' so that they aren't marshalled.
 type CloudConfig struct {
-	SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
-	CoreOS            CoreOS   `yaml:"coreos"`
-	WriteFiles        []File   `yaml:"write_files"`
-	Hostname          string   `yaml:"hostname"`
-	Users             []User   `yaml:"users"`
-	ManageEtcHosts    EtcHosts `yaml:"manage_etc_hosts"`
+	SSHAuthorizedKeys []string          `yaml:"ssh_authorized_keys"`
+	SSHKeysExclusive  bool              `yaml:"ssh_authorized_keys_exclusive"`
+	SSHImportGithub   []string          `yaml:"ssh_import_github"`
+	SSHImportGitlab   []string          `yaml:"ssh_import_gitlab"`
+	CoreOS            CoreOS            `yaml:"coreos"`
+	WriteFiles        []File            `yaml:"write_files" merge:"path"`
+	Directories       []Directory       `yaml:"directories" merge:"path"`
+	Hostname          string            `yaml:"hostname"`
+	Groups            []Group           `yaml:"groups" merge:"name"`
+	Users             []User            `yaml:"users" merge:"name"`
+	ManageEtcHosts    EtcHosts          `yaml:"manage_etc_hosts"`
+	EtcHostsEntries   []EtcHostsEntry   `yaml:"etc_hosts" merge:"ip"`
+	Swap              Swap              `yaml:"swap"`
+	DiskSetup         DiskSetup         `yaml:"disk_setup"`
+	FsSetup           FsSetup           `yaml:"fs_setup" merge:"device"`
+	Growpart          Growpart          `yaml:"growpart"`
+	Mounts            []Mount           `yaml:"mounts" merge:"where"`
+	Timezone          string            `yaml:"timezone"`
+	Locale            string            `yaml:"locale"`
+	NTP               NTP               `yaml:"ntp"`
+	Packages          Packages          `yaml:"packages"`
+	Sysctl            Sysctl            `yaml:"sysctl"`
+	Modules           Modules           `yaml:"modules" merge:"name"`
+	CACerts           CACerts           `yaml:"ca_certs"`
+	BootCmd           RunCmd            `yaml:"bootcmd"`
+	RunCmd            RunCmd            `yaml:"runcmd"`
+	PowerState        PowerState        `yaml:"power_state"`
+	Substitutions     map[string]string `yaml:"substitutions"`
 }
 
 type CoreOS struct {
 	Etcd      Etcd      `yaml:"etcd"`
 	Etcd2     Etcd2     `yaml:"etcd2"`
+	Etcd3     Etcd3     `yaml:"etcd3"`
 	Flannel   Flannel   `yaml:"flannel"`
 	Fleet     Fleet     `yaml:"fleet"`
 	Locksmith Locksmith `yaml:"locksmith"`
 	OEM       OEM       `yaml:"oem"`
 	Update    Update    `yaml:"update"`
-	Units     []Unit    `yaml:"units"`
+	Units     []Unit    `yaml:"units" merge:"name"`
 }
 
 func IsCloudConfig(userdata string) bool {
@@ -60,6 +84,12 @@ func IsCloudConfig(userdata string) bool {
 // string of YAML), returning any error encountered. It will ignore unknown
 // fields but log encountering them.
 func NewCloudConfig(contents string) (*CloudConfig, error) {
+	if keys, err := UnknownKeys(contents); err == nil {
+		for _, key := range keys {
+			log.Printf("Warning: ignoring unrecognized cloud-config key %q\n", key)
+		}
+	}
+
 	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
 		return strings.Replace(nameIn, "-", "_", -1)
 	}
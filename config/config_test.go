@@ -448,6 +448,64 @@ users:
 	}
 }
 
+func TestCloudConfigUsersLockPasswd(t *testing.T) {
+	contents := `
+users:
+  - name: elroy
+    plain_text_passwd: secret
+    lock_passwd: true
+    expiredate: 2020-12-31
+    inactive: 30
+`
+	cfg, err := NewCloudConfig(contents)
+	if err != nil {
+		t.Fatalf("Encountered unexpected error: %v", err)
+	}
+
+	if len(cfg.Users) != 1 {
+		t.Fatalf("Parsed %d users, expected 1", len(cfg.Users))
+	}
+
+	user := cfg.Users[0]
+	if user.PlainTextPasswd != "secret" {
+		t.Errorf("User plain_text_passwd is %q, expected 'secret'", user.PlainTextPasswd)
+	}
+	if !user.LockPasswd {
+		t.Errorf("User lock_passwd is false, expected true")
+	}
+	if user.ExpireDate != "2020-12-31" {
+		t.Errorf("User expiredate is %q, expected '2020-12-31'", user.ExpireDate)
+	}
+	if user.Inactive != "30" {
+		t.Errorf("User inactive is %q, expected '30'", user.Inactive)
+	}
+	if err := AssertStructValid(user); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
+func TestCloudConfigPowerState(t *testing.T) {
+	contents := `
+power_state:
+  mode: reboot
+  delay: +5
+  message: Rebooting to apply the kernel arguments
+  condition: test -f /run/reboot-needed
+`
+	cfg, err := NewCloudConfig(contents)
+	if err != nil {
+		t.Fatalf("Encountered unexpected error: %v", err)
+	}
+
+	want := PowerState{Mode: "reboot", Delay: "+5", Message: "Rebooting to apply the kernel arguments", Condition: "test -f /run/reboot-needed"}
+	if cfg.PowerState != want {
+		t.Errorf("bad power state: want %+v, got %+v", want, cfg.PowerState)
+	}
+	if err := AssertStructValid(cfg.PowerState); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+}
+
 func TestCloudConfigUsersGithubUser(t *testing.T) {
 
 	contents := `
@@ -0,0 +1,34 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// AppliesTo reports whether an item with the given only_on and skip_on lists
+// of datasource types (see Datasource.Type) applies when the config comes from
+// a datasource of the given type. Items with an only_on list don't apply if
+// the type is unknown, i.e. empty.
+func AppliesTo(onlyOn, skipOn []string, datasource string) bool {
+	contains := func(types []string) bool {
+		for _, t := range types {
+			if t == datasource {
+				return true
+			}
+		}
+		return false
+	}
+	if len(onlyOn) > 0 && !contains(onlyOn) {
+		return false
+	}
+	return !contains(skipOn)
+}
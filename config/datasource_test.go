@@ -0,0 +1,50 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestAppliesTo(t *testing.T) {
+	for _, tt := range []struct {
+		onlyOn     []string
+		skipOn     []string
+		datasource string
+
+		applies bool
+	}{
+		{datasource: "ec2-metadata-service", applies: true},
+		{datasource: "", applies: true},
+		{onlyOn: []string{"ec2-metadata-service"}, datasource: "ec2-metadata-service", applies: true},
+		{onlyOn: []string{"ec2-metadata-service", "nocloud"}, datasource: "nocloud", applies: true},
+		{onlyOn: []string{"ec2-metadata-service"}, datasource: "nocloud", applies: false},
+		{onlyOn: []string{"ec2-metadata-service"}, datasource: "", applies: false},
+		{skipOn: []string{"vmware"}, datasource: "nocloud", applies: true},
+		{skipOn: []string{"vmware"}, datasource: "vmware", applies: false},
+		{skipOn: []string{"vmware"}, datasource: "", applies: true},
+		{onlyOn: []string{"vmware"}, skipOn: []string{"vmware"}, datasource: "vmware", applies: false},
+	} {
+		if applies := AppliesTo(tt.onlyOn, tt.skipOn, tt.datasource); applies != tt.applies {
+			t.Errorf("bad result (%q, %q, %q): want %t, got %t", tt.onlyOn, tt.skipOn, tt.datasource, tt.applies, applies)
+		}
+		if applies := (Unit{OnlyOn: tt.onlyOn, SkipOn: tt.skipOn}).AppliesTo(tt.datasource); applies != tt.applies {
+			t.Errorf("bad unit result (%q, %q, %q): want %t, got %t", tt.onlyOn, tt.skipOn, tt.datasource, tt.applies, applies)
+		}
+		if applies := (File{OnlyOn: tt.onlyOn, SkipOn: tt.skipOn}).AppliesTo(tt.datasource); applies != tt.applies {
+			t.Errorf("bad file result (%q, %q, %q): want %t, got %t", tt.onlyOn, tt.skipOn, tt.datasource, tt.applies, applies)
+		}
+	}
+}
@@ -5,8 +5,17 @@ import (
 	"compress/gzip"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"strings"
 )
 
+const gzipMagicBytes = "\x1f\x8b"
+
+// IsGzip reports whether the content starts with the gzip magic number.
+func IsGzip(content string) bool {
+	return strings.HasPrefix(content, gzipMagicBytes)
+}
+
 func DecodeBase64Content(content string) ([]byte, error) {
 	output, err := base64.StdEncoding.DecodeString(content)
 
@@ -26,7 +35,12 @@ func DecodeGzipContent(content string) ([]byte, error) {
 	defer gzr.Close()
 
 	buf := new(bytes.Buffer)
-	buf.ReadFrom(gzr)
+	if _, err := buf.ReadFrom(gzr); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("Unable to decode gzip: stream is truncated")
+		}
+		return nil, fmt.Errorf("Unable to decode gzip: %q", err)
+	}
 
 	return buf.Bytes(), nil
 }
@@ -0,0 +1,97 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func gzipContent(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	if _, err := gzw.Write(content); err != nil {
+		t.Fatalf("unable to compress content: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("unable to compress content: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeContent(t *testing.T) {
+	// larger than 64KB and not trivially compressible
+	large := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(large)
+
+	for _, content := range [][]byte{[]byte("hello world"), large} {
+		gz := gzipContent(t, content)
+		b64 := base64.StdEncoding.EncodeToString(content)
+		gzb64 := base64.StdEncoding.EncodeToString(gz)
+
+		for _, tt := range []struct {
+			encoding string
+			encoded  string
+		}{
+			{"", string(content)},
+			{"base64", b64},
+			{"b64", b64},
+			{"gzip", string(gz)},
+			{"gz", string(gz)},
+			{"gzip+base64", gzb64},
+			{"gz+base64", gzb64},
+			{"gzip+b64", gzb64},
+			{"gz+b64", gzb64},
+		} {
+			decoded, err := DecodeContent(tt.encoded, tt.encoding)
+			if err != nil {
+				t.Errorf("bad error (%q, %d bytes): want %v, got %v", tt.encoding, len(content), nil, err)
+				continue
+			}
+			if !bytes.Equal(content, decoded) {
+				t.Errorf("bad content (%q, %d bytes): got %d bytes", tt.encoding, len(content), len(decoded))
+			}
+		}
+	}
+}
+
+func TestDecodeContentErrors(t *testing.T) {
+	content := make([]byte, 128*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+	gz := gzipContent(t, content)
+	truncated := gz[:len(gz)/2]
+
+	for _, tt := range []struct {
+		encoding string
+		encoded  string
+
+		err string
+	}{
+		{"bzip2", "", `Unsupported encoding "bzip2"`},
+		{"base64", "not base64!", "Unable to decode base64"},
+		{"gzip", "not gzip", "Unable to decode gzip"},
+		{"gzip", string(truncated), "Unable to decode gzip: stream is truncated"},
+		{"gzip+base64", base64.StdEncoding.EncodeToString(truncated), "Unable to decode gzip: stream is truncated"},
+	} {
+		_, err := DecodeContent(tt.encoded, tt.encoding)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Errorf("bad error (%q): want %q, got %v", tt.encoding, tt.err, err)
+		}
+	}
+}
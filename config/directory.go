@@ -0,0 +1,28 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Directory is a directory which is created (along with its parents) if it
+// doesn't exist yet and whose mode and owner are set either way.
+type Directory struct {
+	Path               string `yaml:"path"`
+	Owner              string `yaml:"owner"`
+	RawFilePermissions string `yaml:"permissions" valid:"^0?[0-7]{3,4}$"`
+}
+
+// CheckPath verifies the path of the directory like File.CheckPath does.
+func (d Directory) CheckPath() error {
+	return File{Path: d.Path}.CheckPath()
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DiskSetup maps block devices (e.g. /dev/sdb) to the partition table which
+// is created on them.
+type DiskSetup map[string]Disk
+
+// Disk describes the partition table of a block device. Since partitioning
+// destroys the data on the device, a device which already holds a partition
+// table or a filesystem is only repartitioned if Overwrite is set.
+type Disk struct {
+	TableType string `yaml:"table_type" valid:"^(mbr|gpt)$"`
+	Layout    Layout `yaml:"layout"`
+	Overwrite bool   `yaml:"overwrite"`
+}
+
+// Layout is the list of partitions of a disk. In YAML it is given either as
+// true, for a single partition spanning the whole disk, or as a list of
+// partitions, each given as its size in percent of the disk or as a list of
+// its size and partition type (e.g. 82 or 8200 for swap), e.g.:
+//
+//	layout:
+//	  - 25
+//	  - [25, 82]
+//	  - 50
+type Layout []Partition
+
+// Partition is a single partition of a Layout. Type is the partition type
+// passed to sfdisk, or the default Linux filesystem type if empty.
+type Partition struct {
+	Size int
+	Type string
+}
+
+// SetYAML accepts true, false or a list of partitions.
+func (l *Layout) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		*l = nil
+		if v {
+			*l = Layout{{Size: 100}}
+		}
+	case []interface{}:
+		layout := make(Layout, 0, len(v))
+		for _, p := range v {
+			var part Partition
+			switch pv := p.(type) {
+			case int:
+				part.Size = pv
+			case []interface{}:
+				if len(pv) != 2 {
+					return false
+				}
+				size, ok := pv[0].(int)
+				if !ok {
+					return false
+				}
+				part = Partition{Size: size, Type: fmt.Sprint(pv[1])}
+			default:
+				return false
+			}
+			layout = append(layout, part)
+		}
+		*l = layout
+	default:
+		return false
+	}
+	return true
+}
+
+// GetYAML marshals the layout back into a list of partitions, or false if
+// there are none.
+func (l Layout) GetYAML() (tag string, value interface{}) {
+	if len(l) == 0 {
+		return "", false
+	}
+	parts := make([]interface{}, 0, len(l))
+	for _, p := range l {
+		if p.Type == "" {
+			parts = append(parts, p.Size)
+		} else {
+			parts = append(parts, []interface{}{p.Size, p.Type})
+		}
+	}
+	return "", parts
+}
+
+var partitionType = regexp.MustCompile(`^[0-9a-zA-Z-]+$`)
+
+// Check verifies that the device is given by its path and that the
+// partitions fit onto it.
+func (d Disk) Check(device string) error {
+	if !strings.HasPrefix(path.Clean(device), "/dev/") {
+		return fmt.Errorf("invalid device %q for disk_setup", device)
+	}
+	if err := AssertStructValid(d); err != nil {
+		return err
+	}
+	total := 0
+	for _, p := range d.Layout {
+		if p.Size <= 0 || p.Size > 100 {
+			return fmt.Errorf("invalid size %d%% of partition on %s", p.Size, device)
+		}
+		if p.Type != "" && !partitionType.MatchString(p.Type) {
+			return fmt.Errorf("invalid type %q of partition on %s", p.Type, device)
+		}
+		total += p.Size
+	}
+	if d.TableType != "gpt" && len(d.Layout) > 4 {
+		return fmt.Errorf("too many partitions on %s for an mbr partition table", device)
+	}
+	if total > 100 {
+		return fmt.Errorf("partitions on %s add up to %d%% of the disk", device, total)
+	}
+	return nil
+}
+
+// FsSetup is a list of filesystems which are created on block devices.
+type FsSetup []Filesystem
+
+// Filesystem describes a filesystem created on a block device (usually a
+// partition created through DiskSetup). A device which already holds a
+// different filesystem or a partition table is only formatted if Overwrite
+// is set.
+type Filesystem struct {
+	Device    string   `yaml:"device"`
+	Type      string   `yaml:"filesystem" valid:"^(ext2|ext3|ext4|xfs|btrfs|vfat|swap)$"`
+	Label     string   `yaml:"label"`
+	Overwrite bool     `yaml:"overwrite"`
+	ExtraOpts []string `yaml:"extra_opts"`
+}
+
+var filesystemLabel = regexp.MustCompile(`^[a-zA-Z0-9_.-]*$`)
+
+// Check verifies that the device is given by its path and that the
+// filesystem and label are supported.
+func (f Filesystem) Check() error {
+	if !strings.HasPrefix(path.Clean(f.Device), "/dev/") {
+		return fmt.Errorf("invalid device %q for fs_setup", f.Device)
+	}
+	if f.Type == "" {
+		return fmt.Errorf("no filesystem given for %s", f.Device)
+	}
+	if err := AssertStructValid(f); err != nil {
+		return err
+	}
+	if !filesystemLabel.MatchString(f.Label) {
+		return fmt.Errorf("invalid label %q for %s", f.Label, f.Device)
+	}
+	return nil
+}
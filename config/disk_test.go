@@ -0,0 +1,140 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiskSetupYAML(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+
+		disks DiskSetup
+	}{
+		{
+			contents: "hostname: foo\n",
+		},
+		{
+			contents: "disk_setup:\n  /dev/sdb:\n    table_type: gpt\n    layout: true\n",
+			disks:    DiskSetup{"/dev/sdb": {TableType: "gpt", Layout: Layout{{Size: 100}}}},
+		},
+		{
+			contents: "disk_setup:\n  /dev/sdb:\n    layout: false\n",
+			disks:    DiskSetup{"/dev/sdb": {}},
+		},
+		{
+			contents: "disk_setup:\n  /dev/vdb:\n    table_type: mbr\n    layout:\n      - 25\n      - [25, 82]\n      - 50\n    overwrite: true\n",
+			disks: DiskSetup{"/dev/vdb": {
+				TableType: "mbr",
+				Layout:    Layout{{Size: 25}, {Size: 25, Type: "82"}, {Size: 50}},
+				Overwrite: true,
+			}},
+		},
+	} {
+		cfg, err := NewCloudConfig(tt.contents)
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", tt.contents, err)
+		}
+		if !reflect.DeepEqual(tt.disks, cfg.DiskSetup) {
+			t.Errorf("bad disk_setup (%q): want %#v, got %#v", tt.contents, tt.disks, cfg.DiskSetup)
+		}
+
+		// The layouts survive a round trip through String.
+		if tt.disks == nil {
+			continue
+		}
+		again, err := NewCloudConfig(cfg.String())
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", cfg.String(), err)
+		}
+		if !reflect.DeepEqual(tt.disks, again.DiskSetup) {
+			t.Errorf("bad disk_setup after round trip (%q): want %#v, got %#v", cfg.String(), tt.disks, again.DiskSetup)
+		}
+	}
+}
+
+func TestFsSetupYAML(t *testing.T) {
+	contents := "fs_setup:\n  - device: /dev/sdb1\n    filesystem: ext4\n    label: data\n    extra_opts: [-m, \"0\"]\n"
+	cfg, err := NewCloudConfig(contents)
+	if err != nil {
+		t.Fatalf("bad error (%q): want nil, got %v", contents, err)
+	}
+	want := FsSetup{{Device: "/dev/sdb1", Type: "ext4", Label: "data", ExtraOpts: []string{"-m", "0"}}}
+	if !reflect.DeepEqual(want, cfg.FsSetup) {
+		t.Errorf("bad fs_setup (%q): want %#v, got %#v", contents, want, cfg.FsSetup)
+	}
+}
+
+func TestDiskCheck(t *testing.T) {
+	for _, tt := range []struct {
+		device string
+		disk   Disk
+
+		valid bool
+	}{
+		{"/dev/sdb", Disk{}, true},
+		{"/dev/sdb", Disk{TableType: "gpt", Layout: Layout{{Size: 50}, {Size: 50, Type: "8200"}}}, true},
+		{"/dev/disk/by-id/virtio-data", Disk{Layout: Layout{{Size: 100}}}, true},
+		{"sdb", Disk{Layout: Layout{{Size: 100}}}, false},
+		{"/dev/../etc/passwd", Disk{Layout: Layout{{Size: 100}}}, false},
+		{"/dev/sdb", Disk{TableType: "msdos"}, false},
+		{"/dev/sdb", Disk{Layout: Layout{{Size: 0}}}, false},
+		{"/dev/sdb", Disk{Layout: Layout{{Size: 60}, {Size: 60}}}, false},
+		{"/dev/sdb", Disk{Layout: Layout{{Size: 50, Type: "8200; rm"}}}, false},
+		{"/dev/sdb", Disk{Layout: Layout{{Size: 20}, {Size: 20}, {Size: 20}, {Size: 20}, {Size: 20}}}, false},
+		{"/dev/sdb", Disk{TableType: "gpt", Layout: Layout{{Size: 20}, {Size: 20}, {Size: 20}, {Size: 20}, {Size: 20}}}, true},
+	} {
+		if err := tt.disk.Check(tt.device); tt.valid != (err == nil) {
+			t.Errorf("bad error (%q, %#v): want valid %t, got %v", tt.device, tt.disk, tt.valid, err)
+		}
+	}
+}
+
+func TestFilesystemCheck(t *testing.T) {
+	for _, tt := range []struct {
+		fs Filesystem
+
+		valid bool
+	}{
+		{Filesystem{Device: "/dev/sdb1", Type: "ext4", Label: "data"}, true},
+		{Filesystem{Device: "/dev/sdb2", Type: "swap"}, true},
+		{Filesystem{Device: "/dev/sdb1"}, false},
+		{Filesystem{Device: "sdb1", Type: "ext4"}, false},
+		{Filesystem{Device: "/dev/sdb1", Type: "ntfs"}, false},
+		{Filesystem{Device: "/dev/sdb1", Type: "ext4", Label: "my data"}, false},
+	} {
+		if err := tt.fs.Check(); tt.valid != (err == nil) {
+			t.Errorf("bad error (%#v): want valid %t, got %v", tt.fs, tt.valid, err)
+		}
+	}
+}
+
+func TestGrowpartCheck(t *testing.T) {
+	for _, tt := range []struct {
+		growpart Growpart
+
+		valid bool
+	}{
+		{Growpart{}, true},
+		{Growpart{Devices: []string{"/", "/dev/vda9", "/var/lib/data"}}, true},
+		{Growpart{Devices: []string{"/", "vda9"}}, false},
+	} {
+		if err := tt.growpart.Check(); tt.valid != (err == nil) {
+			t.Errorf("bad error (%#v): want valid %t, got %v", tt.growpart, tt.valid, err)
+		}
+	}
+}
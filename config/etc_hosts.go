@@ -14,4 +14,55 @@
 
 package config
 
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
 type EtcHosts string
+
+// EtcHostsEntry is a static entry of /etc/hosts, mapping an IP address to one
+// or more hostnames.
+type EtcHostsEntry struct {
+	IP        string   `yaml:"ip"`
+	Hostnames []string `yaml:"hostnames"`
+}
+
+const hostnameLabel = `[[:alnum:]]([[:alnum:]-]{0,61}[[:alnum:]])?`
+
+var hostname = regexp.MustCompile(`^` + hostnameLabel + `(\.` + hostnameLabel + `)*$`)
+
+// CheckIP verifies that the IP address of the entry can be parsed.
+func (e EtcHostsEntry) CheckIP() error {
+	if net.ParseIP(e.IP) == nil {
+		return fmt.Errorf("invalid IP address %q in etc_hosts", e.IP)
+	}
+	return nil
+}
+
+// CheckHostname verifies that the given name is a valid hostname as defined
+// by RFC 1123.
+func (e EtcHostsEntry) CheckHostname(name string) error {
+	if len(name) > 253 || !hostname.MatchString(name) {
+		return fmt.Errorf("invalid hostname %q in etc_hosts", name)
+	}
+	return nil
+}
+
+// Check verifies the IP address and that there is at least one valid
+// hostname.
+func (e EtcHostsEntry) Check() error {
+	if err := e.CheckIP(); err != nil {
+		return err
+	}
+	if len(e.Hostnames) == 0 {
+		return fmt.Errorf("no hostnames for IP address %q in etc_hosts", e.IP)
+	}
+	for _, name := range e.Hostnames {
+		if err := e.CheckHostname(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
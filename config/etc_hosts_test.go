@@ -0,0 +1,42 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEtcHostsEntryCheck(t *testing.T) {
+	for _, tt := range []struct {
+		entry EtcHostsEntry
+		err   bool
+	}{
+		{entry: EtcHostsEntry{IP: "10.0.0.5", Hostnames: []string{"registry.internal", "registry"}}},
+		{entry: EtcHostsEntry{IP: "fd00::1", Hostnames: []string{"gateway"}}},
+		{entry: EtcHostsEntry{IP: "10.0.0.5", Hostnames: []string{"1-2.example.com"}}},
+		{entry: EtcHostsEntry{IP: "10.0.0.5"}, err: true},
+		{entry: EtcHostsEntry{Hostnames: []string{"registry"}}, err: true},
+		{entry: EtcHostsEntry{IP: "registry", Hostnames: []string{"registry"}}, err: true},
+		{entry: EtcHostsEntry{IP: "10.0.0.5", Hostnames: []string{"registry-"}}, err: true},
+		{entry: EtcHostsEntry{IP: "10.0.0.5", Hostnames: []string{"registry..internal"}}, err: true},
+		{entry: EtcHostsEntry{IP: "10.0.0.5", Hostnames: []string{"registry internal"}}, err: true},
+		{entry: EtcHostsEntry{IP: "10.0.0.5", Hostnames: []string{strings.Repeat("a", 64)}}, err: true},
+	} {
+		if err := tt.entry.Check(); tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want %t, got %v", tt.entry, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Etcd3 holds the options of etcd v3, which runs as etcd-member.service. The
+// options which etcd3 no longer accepts are kept so that they can be mapped
+// onto their replacements (or reported and ignored); they have no env tag.
+type Etcd3 struct {
+	AdvertiseClientURLs      string `yaml:"advertise_client_urls"         env:"ETCD_ADVERTISE_CLIENT_URLS"`
+	AutoCompactionMode       string `yaml:"auto_compaction_mode"          env:"ETCD_AUTO_COMPACTION_MODE"        valid:"^(periodic|revision)$"`
+	AutoCompactionRetention  string `yaml:"auto_compaction_retention"     env:"ETCD_AUTO_COMPACTION_RETENTION"`
+	AutoTLS                  bool   `yaml:"auto_tls"                      env:"ETCD_AUTO_TLS"`
+	CertFile                 string `yaml:"cert_file"                     env:"ETCD_CERT_FILE"`
+	CipherSuites             string `yaml:"cipher_suites"                 env:"ETCD_CIPHER_SUITES"`
+	ClientCertAuth           bool   `yaml:"client_cert_auth"              env:"ETCD_CLIENT_CERT_AUTH"`
+	ClientCRLFile            string `yaml:"client_crl_file"               env:"ETCD_CLIENT_CRL_FILE"`
+	CorsOrigins              string `yaml:"cors"                          env:"ETCD_CORS"`
+	DataDir                  string `yaml:"data_dir"                      env:"ETCD_DATA_DIR"`
+	Discovery                string `yaml:"discovery"                     env:"ETCD_DISCOVERY"`
+	DiscoveryFallback        string `yaml:"discovery_fallback"            env:"ETCD_DISCOVERY_FALLBACK"`
+	DiscoverySRV             string `yaml:"discovery_srv"                 env:"ETCD_DISCOVERY_SRV"`
+	DiscoveryProxy           string `yaml:"discovery_proxy"               env:"ETCD_DISCOVERY_PROXY"`
+	ElectionTimeout          int    `yaml:"election_timeout"              env:"ETCD_ELECTION_TIMEOUT"`
+	EnablePprof              bool   `yaml:"enable_pprof"                  env:"ETCD_ENABLE_PPROF"`
+	EnableV2                 bool   `yaml:"enable_v2"                     env:"ETCD_ENABLE_V2"`
+	ForceNewCluster          bool   `yaml:"force_new_cluster"             env:"ETCD_FORCE_NEW_CLUSTER"`
+	GRPCKeepaliveInterval    string `yaml:"grpc_keepalive_interval"       env:"ETCD_GRPC_KEEPALIVE_INTERVAL"`
+	GRPCKeepaliveMinTime     string `yaml:"grpc_keepalive_min_time"       env:"ETCD_GRPC_KEEPALIVE_MIN_TIME"`
+	GRPCKeepaliveTimeout     string `yaml:"grpc_keepalive_timeout"        env:"ETCD_GRPC_KEEPALIVE_TIMEOUT"`
+	HeartbeatInterval        int    `yaml:"heartbeat_interval"            env:"ETCD_HEARTBEAT_INTERVAL"`
+	InitialAdvertisePeerURLs string `yaml:"initial_advertise_peer_urls"   env:"ETCD_INITIAL_ADVERTISE_PEER_URLS"`
+	InitialCluster           string `yaml:"initial_cluster"               env:"ETCD_INITIAL_CLUSTER"`
+	InitialClusterState      string `yaml:"initial_cluster_state"         env:"ETCD_INITIAL_CLUSTER_STATE"       valid:"^(new|existing)$"`
+	InitialClusterToken      string `yaml:"initial_cluster_token"         env:"ETCD_INITIAL_CLUSTER_TOKEN"`
+	KeyFile                  string `yaml:"key_file"                      env:"ETCD_KEY_FILE"`
+	ListenClientURLs         string `yaml:"listen_client_urls"            env:"ETCD_LISTEN_CLIENT_URLS"`
+	ListenMetricsURLs        string `yaml:"listen_metrics_urls"           env:"ETCD_LISTEN_METRICS_URLS"`
+	ListenPeerURLs           string `yaml:"listen_peer_urls"              env:"ETCD_LISTEN_PEER_URLS"`
+	LogLevel                 string `yaml:"log_level"                     env:"ETCD_LOG_LEVEL"                   valid:"^(debug|info|warn|error|panic|fatal)$"`
+	LogOutputs               string `yaml:"log_outputs"                   env:"ETCD_LOG_OUTPUTS"`
+	Logger                   string `yaml:"logger"                        env:"ETCD_LOGGER"                      valid:"^(capnslog|zap)$"`
+	MaxRequestBytes          int    `yaml:"max_request_bytes"             env:"ETCD_MAX_REQUEST_BYTES"`
+	MaxSnapshots             int    `yaml:"max_snapshots"                 env:"ETCD_MAX_SNAPSHOTS"`
+	MaxTxnOps                int    `yaml:"max_txn_ops"                   env:"ETCD_MAX_TXN_OPS"`
+	MaxWALs                  int    `yaml:"max_wals"                      env:"ETCD_MAX_WALS"`
+	Metrics                  string `yaml:"metrics"                       env:"ETCD_METRICS"                     valid:"^(basic|extensive)$"`
+	Name                     string `yaml:"name"                          env:"ETCD_NAME"`
+	PeerAutoTLS              bool   `yaml:"peer_auto_tls"                 env:"ETCD_PEER_AUTO_TLS"`
+	PeerCertFile             string `yaml:"peer_cert_file"                env:"ETCD_PEER_CERT_FILE"`
+	PeerClientCertAuth       bool   `yaml:"peer_client_cert_auth"         env:"ETCD_PEER_CLIENT_CERT_AUTH"`
+	PeerCRLFile              string `yaml:"peer_crl_file"                 env:"ETCD_PEER_CRL_FILE"`
+	PeerKeyFile              string `yaml:"peer_key_file"                 env:"ETCD_PEER_KEY_FILE"`
+	PeerTrustedCAFile        string `yaml:"peer_trusted_ca_file"          env:"ETCD_PEER_TRUSTED_CA_FILE"`
+	QuotaBackendBytes        int    `yaml:"quota_backend_bytes"           env:"ETCD_QUOTA_BACKEND_BYTES"`
+	SnapshotCount            int    `yaml:"snapshot_count"                env:"ETCD_SNAPSHOT_COUNT"`
+	StrictReconfigCheck      bool   `yaml:"strict_reconfig_check"         env:"ETCD_STRICT_RECONFIG_CHECK"`
+	TrustedCAFile            string `yaml:"trusted_ca_file"               env:"ETCD_TRUSTED_CA_FILE"`
+	WalDir                   string `yaml:"wal_dir"                       env:"ETCD_WAL_DIR"`
+
+	CAFile               string `yaml:"ca_file"                deprecated:"ca_file obsoleted by trusted_ca_file and client_cert_auth"`
+	Debug                bool   `yaml:"debug"                  deprecated:"debug obsoleted by log_level"`
+	LogPackageLevels     string `yaml:"log_package_levels"     deprecated:"log_package_levels is not supported by etcd3, use log_level"`
+	PeerCAFile           string `yaml:"peer_ca_file"           deprecated:"peer_ca_file obsoleted by peer_trusted_ca_file and peer_client_cert_auth"`
+	Proxy                string `yaml:"proxy"                  deprecated:"the v2 proxy is not supported by etcd3, use the gRPC proxy"`
+	ProxyDialTimeout     int    `yaml:"proxy_dial_timeout"     deprecated:"the v2 proxy is not supported by etcd3, use the gRPC proxy"`
+	ProxyFailureWait     int    `yaml:"proxy_failure_wait"     deprecated:"the v2 proxy is not supported by etcd3, use the gRPC proxy"`
+	ProxyReadTimeout     int    `yaml:"proxy_read_timeout"     deprecated:"the v2 proxy is not supported by etcd3, use the gRPC proxy"`
+	ProxyRefreshInterval int    `yaml:"proxy_refresh_interval" deprecated:"the v2 proxy is not supported by etcd3, use the gRPC proxy"`
+	ProxyWriteTimeout    int    `yaml:"proxy_write_timeout"    deprecated:"the v2 proxy is not supported by etcd3, use the gRPC proxy"`
+}
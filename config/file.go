@@ -14,10 +14,50 @@
 
 package config
 
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
 type File struct {
-	Encoding           string `yaml:"encoding" valid:"^(base64|b64|gz|gzip|gz\\+base64|gzip\\+base64|gz\\+b64|gzip\\+b64)$"`
-	Content            string `yaml:"content"`
-	Owner              string `yaml:"owner"`
-	Path               string `yaml:"path"`
-	RawFilePermissions string `yaml:"permissions" valid:"^0?[0-7]{3,4}$"`
+	Encoding           string   `yaml:"encoding" valid:"^(base64|b64|gz|gzip|gz\\+base64|gzip\\+base64|gz\\+b64|gzip\\+b64)$"`
+	Content            string   `yaml:"content"`
+	Owner              string   `yaml:"owner"`
+	Path               string   `yaml:"path"`
+	RawFilePermissions string   `yaml:"permissions" valid:"^0?[0-7]{3,4}$"`
+	Append             bool     `yaml:"append"`
+	Template           bool     `yaml:"template"`
+	ExpandEnv          bool     `yaml:"expand_env"`
+	SELinuxContext     string   `yaml:"selinux_context" valid:"^[^:[:space:]]+:[^:[:space:]]+:[^:[:space:]]+(:[^[:space:]]+)?$"`
+	OnlyOn             []string `yaml:"only_on"`
+	SkipOn             []string `yaml:"skip_on"`
+}
+
+// AppliesTo reports whether the file applies on the datasource of the given
+// type, according to its only_on and skip_on lists.
+func (f File) AppliesTo(datasource string) bool {
+	return AppliesTo(f.OnlyOn, f.SkipOn, datasource)
+}
+
+// CheckPath verifies that the path of the file is absolute and that it does
+// not use ".." segments to climb above the root directory it will be written to.
+func (f File) CheckPath() error {
+	if !path.IsAbs(f.Path) {
+		return fmt.Errorf("path %q is not absolute", f.Path)
+	}
+
+	depth := 0
+	for _, s := range strings.Split(f.Path, "/") {
+		switch s {
+		case "", ".":
+		case "..":
+			if depth--; depth < 0 {
+				return fmt.Errorf("path %q escapes the root directory", f.Path)
+			}
+		default:
+			depth++
+		}
+	}
+	return nil
 }
@@ -67,3 +67,27 @@ func TestRawFilePermissionsValid(t *testing.T) {
 		}
 	}
 }
+
+func TestFileCheckPath(t *testing.T) {
+	tests := []struct {
+		value string
+
+		isValid bool
+	}{
+		{value: "/etc/hosts.allow", isValid: true},
+		{value: "/tmp/../etc/hosts", isValid: true},
+		{value: "/etc/./hosts", isValid: true},
+		{value: "", isValid: false},
+		{value: "etc/hosts", isValid: false},
+		{value: "./etc/hosts", isValid: false},
+		{value: "/../etc/hosts", isValid: false},
+		{value: "/tmp/../../etc/hosts", isValid: false},
+	}
+
+	for _, tt := range tests {
+		isValid := (nil == File{Path: tt.value}.CheckPath())
+		if tt.isValid != isValid {
+			t.Errorf("bad assert (%s): want %t, got %t", tt.value, tt.isValid, isValid)
+		}
+	}
+}
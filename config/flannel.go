@@ -15,13 +15,26 @@
 package config
 
 type Flannel struct {
-	EtcdEndpoints string `yaml:"etcd_endpoints" env:"FLANNELD_ETCD_ENDPOINTS"`
-	EtcdCAFile    string `yaml:"etcd_cafile"    env:"FLANNELD_ETCD_CAFILE"`
-	EtcdCertFile  string `yaml:"etcd_certfile"  env:"FLANNELD_ETCD_CERTFILE"`
-	EtcdKeyFile   string `yaml:"etcd_keyfile"   env:"FLANNELD_ETCD_KEYFILE"`
-	EtcdPrefix    string `yaml:"etcd_prefix"    env:"FLANNELD_ETCD_PREFIX"`
-	IPMasq        string `yaml:"ip_masq"        env:"FLANNELD_IP_MASQ"`
-	SubnetFile    string `yaml:"subnet_file"    env:"FLANNELD_SUBNET_FILE"`
-	Iface         string `yaml:"interface"      env:"FLANNELD_IFACE"`
-	PublicIP      string `yaml:"public_ip"      env:"FLANNELD_PUBLIC_IP"`
+	EtcdEndpoints          string `yaml:"etcd_endpoints"            env:"FLANNELD_ETCD_ENDPOINTS"`
+	EtcdCAFile             string `yaml:"etcd_cafile"               env:"FLANNELD_ETCD_CAFILE"`
+	EtcdCertFile           string `yaml:"etcd_certfile"             env:"FLANNELD_ETCD_CERTFILE"`
+	EtcdKeyFile            string `yaml:"etcd_keyfile"              env:"FLANNELD_ETCD_KEYFILE"`
+	EtcdPrefix             string `yaml:"etcd_prefix"               env:"FLANNELD_ETCD_PREFIX"`
+	IPMasq                 string `yaml:"ip_masq"                   env:"FLANNELD_IP_MASQ"`
+	SubnetFile             string `yaml:"subnet_file"               env:"FLANNELD_SUBNET_FILE"`
+	SubnetLeaseRenewMargin int    `yaml:"subnet_lease_renew_margin" env:"FLANNELD_SUBNET_LEASE_RENEW_MARGIN"`
+	Iface                  string `yaml:"interface"                 env:"FLANNELD_IFACE"`
+	PublicIP               string `yaml:"public_ip"                 env:"FLANNELD_PUBLIC_IP"`
+
+	// The network configuration is stored in etcd (under etcd_prefix)
+	// rather than passed to flanneld.
+	Network   string         `yaml:"network"`
+	SubnetLen int            `yaml:"subnet_len"`
+	Backend   FlannelBackend `yaml:"backend"`
+}
+
+type FlannelBackend struct {
+	Type string `yaml:"type" valid:"^(udp|vxlan|host-gw|aws-vpc|gce|alloc)$"`
+	VNI  int    `yaml:"vni"`
+	Port int    `yaml:"port"`
 }
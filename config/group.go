@@ -0,0 +1,91 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Group is a group which is created on the system. In YAML it is given either
+// as the name of the group or as a map from the name to its members (a single
+// member or a list of members), e.g.:
+//
+//	groups:
+//	  - cloud-users
+//	  - admins: [root, core]
+type Group struct {
+	Name    string   `yaml:"name"`
+	Members []string `yaml:"members"`
+}
+
+var groupName = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*\$?$`)
+
+// SetYAML accepts either a group name or a map from the name of a single group
+// to its members.
+func (g *Group) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*g = Group{Name: v}
+	case map[interface{}]interface{}:
+		if len(v) != 1 {
+			return false
+		}
+		for n, m := range v {
+			name, ok := n.(string)
+			if !ok {
+				return false
+			}
+			members, ok := groupMembers(m)
+			if !ok {
+				return false
+			}
+			*g = Group{Name: name, Members: members}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func groupMembers(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		members := make([]string, 0, len(v))
+		for _, m := range v {
+			member, ok := m.(string)
+			if !ok {
+				return nil, false
+			}
+			members = append(members, member)
+		}
+		return members, true
+	default:
+		return nil, false
+	}
+}
+
+// CheckName verifies that the given name can be used as the name of a group
+// (or of one of its members).
+func (g Group) CheckName(name string) error {
+	if !groupName.MatchString(name) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	return nil
+}
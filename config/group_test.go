@@ -0,0 +1,75 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	tests := []struct {
+		contents string
+
+		groups []Group
+	}{
+		{},
+		{
+			contents: "groups:\n  - cloud-users",
+			groups:   []Group{{Name: "cloud-users"}},
+		},
+		{
+			contents: "groups:\n  - admins: [root, core]\n  - docker: core\n  - empty:",
+			groups: []Group{
+				{Name: "admins", Members: []string{"root", "core"}},
+				{Name: "docker", Members: []string{"core"}},
+				{Name: "empty"},
+			},
+		},
+		{
+			contents: "groups:\n  - admins: [root]\n    docker: [core]",
+		},
+	}
+
+	for i, tt := range tests {
+		cfg, err := NewCloudConfig(tt.contents)
+		if err != nil {
+			t.Fatalf("bad error (%d): %v", i, err)
+		}
+		if !reflect.DeepEqual(tt.groups, cfg.Groups) {
+			t.Errorf("bad groups (%d): want %#v, got %#v", i, tt.groups, cfg.Groups)
+		}
+	}
+}
+
+func TestGroupCheckName(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  bool
+	}{
+		{name: "admins"},
+		{name: "cloud-users"},
+		{name: "_ssh"},
+		{name: "machine$"},
+		{name: "", err: true},
+		{name: "Admins", err: true},
+		{name: "cloud users", err: true},
+		{name: "-admins", err: true},
+	} {
+		if err := (Group{}).CheckName(tt.name); tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.name, tt.err, err)
+		}
+	}
+}
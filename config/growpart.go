@@ -0,0 +1,38 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// Growpart lists the partitions which are grown to fill the rest of their
+// disk, along with their filesystems. Each device is given either as the
+// path of the partition (e.g. /dev/vda9) or as the mount point of its
+// filesystem (e.g. /).
+type Growpart struct {
+	Devices []string `yaml:"devices"`
+}
+
+// Check verifies that each device is given by an absolute path.
+func (g Growpart) Check() error {
+	for _, d := range g.Devices {
+		if !path.IsAbs(d) {
+			return fmt.Errorf("invalid growpart device %q", d)
+		}
+	}
+	return nil
+}
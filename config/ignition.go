@@ -16,14 +16,52 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
 )
 
+// ignitionVersionString matches the semantic version used by the
+// ignition.version field of v2 and later Ignition configs.
+var ignitionVersionString = regexp.MustCompile(`^[[:digit:]]+\.[[:digit:]]+\.[[:digit:]]+(-experimental)?$`)
+
+type ignitionHeader struct {
+	Version  *int `json:"ignitionVersion"`
+	Ignition struct {
+		Version *string `json:"version"`
+	} `json:"ignition"`
+}
+
+// Ignition is an Ignition config found in place of a cloud-config. It is not
+// applied by coreos-cloudinit but left to Ignition.
+type Ignition struct {
+	Version  string
+	Contents string
+}
+
 func IsIgnitionConfig(userdata string) bool {
-	var cfg struct {
-		Version  *int `json:"ignitionVersion"`
-		Ignition struct {
-			Version *string `json:"version"`
-		} `json:"ignition"`
-	}
+	var cfg ignitionHeader
 	return (json.Unmarshal([]byte(userdata), &cfg) == nil && (cfg.Version != nil || cfg.Ignition.Version != nil))
 }
+
+// NewIgnition parses the version marker of the given Ignition config. v1
+// configs are identified by the integer ignitionVersion field, v2 and later
+// by the ignition.version string.
+func NewIgnition(contents string) (*Ignition, error) {
+	var cfg ignitionHeader
+	if err := json.Unmarshal([]byte(contents), &cfg); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cfg.Ignition.Version != nil:
+		if !ignitionVersionString.MatchString(*cfg.Ignition.Version) {
+			return nil, fmt.Errorf("invalid Ignition config version %q", *cfg.Ignition.Version)
+		}
+		return &Ignition{Version: *cfg.Ignition.Version, Contents: contents}, nil
+	case cfg.Version != nil:
+		return &Ignition{Version: strconv.Itoa(*cfg.Version), Contents: contents}, nil
+	default:
+		return nil, fmt.Errorf("not an Ignition config")
+	}
+}
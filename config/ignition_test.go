@@ -0,0 +1,85 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsIgnitionConfig(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+		ignition bool
+	}{
+		{`{"ignitionVersion":1}`, true},
+		{`{"ignition":{"version":"2.2.0"}}`, true},
+		{`{"ignition":{"version":"3.0.0"},"storage":{}}`, true},
+		{`{"ignition":{}}`, false},
+		{`{"version":"2.2.0"}`, false},
+		{"#cloud-config\nhostname: foo", false},
+		{`{"ignitionVersion":`, false},
+	} {
+		if ignition := IsIgnitionConfig(tt.contents); ignition != tt.ignition {
+			t.Errorf("bad result (%q): want %t, got %t", tt.contents, tt.ignition, ignition)
+		}
+	}
+}
+
+func TestNewIgnition(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+
+		ignition *Ignition
+		err      bool
+	}{
+		{
+			contents: `{"ignitionVersion":1}`,
+			ignition: &Ignition{Version: "1", Contents: `{"ignitionVersion":1}`},
+		},
+		{
+			contents: `{"ignition":{"version":"2.2.0"},"systemd":{"units":[{"name":"example.service","enabled":true}]}}`,
+			ignition: &Ignition{Version: "2.2.0", Contents: `{"ignition":{"version":"2.2.0"},"systemd":{"units":[{"name":"example.service","enabled":true}]}}`},
+		},
+		{
+			contents: `{"ignition":{"version":"3.1.0-experimental"}}`,
+			ignition: &Ignition{Version: "3.1.0-experimental", Contents: `{"ignition":{"version":"3.1.0-experimental"}}`},
+		},
+		{
+			contents: `{"ignition":{"version":"3"}}`,
+			err:      true,
+		},
+		{
+			contents: `{"ignition":{"version":""}}`,
+			err:      true,
+		},
+		{
+			contents: `{"storage":{}}`,
+			err:      true,
+		},
+		{
+			contents: `{"ignition":`,
+			err:      true,
+		},
+	} {
+		ignition, err := NewIgnition(tt.contents)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.contents, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.ignition, ignition) {
+			t.Errorf("bad ignition (%q): want %#v, got %#v", tt.contents, tt.ignition, ignition)
+		}
+	}
+}
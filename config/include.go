@@ -0,0 +1,49 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Include is a list of URLs whose contents make up the user-data, given as an
+// "#include" (or "#include-once") document with one URL per line.
+type Include []string
+
+func IsInclude(userdata string) bool {
+	header := strings.TrimRightFunc(strings.SplitN(userdata, "\n", 2)[0], unicode.IsSpace)
+	return header == "#include" || header == "#include-once"
+}
+
+// NewInclude returns the URLs listed in the given "#include" document. Blank
+// lines and comments are skipped; only http and https URLs are allowed.
+func NewInclude(userdata string) (Include, error) {
+	var include Include
+	for i, line := range strings.Split(userdata, "\n")[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid #include URL %q on line %d", line, i+2)
+		}
+		include = append(include, line)
+	}
+	return include, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsInclude(t *testing.T) {
+	for _, tt := range []struct {
+		userdata string
+		include  bool
+	}{
+		{"#include\nhttp://example.com/foo", true},
+		{"#include-once\r\nhttp://example.com/foo", true},
+		{"#include \n", true},
+		{"#included\nhttp://example.com/foo", false},
+		{"#cloud-config\n#include", false},
+		{"", false},
+	} {
+		if include := IsInclude(tt.userdata); include != tt.include {
+			t.Errorf("bad result (%q): want %t, got %t", tt.userdata, tt.include, include)
+		}
+	}
+}
+
+func TestNewInclude(t *testing.T) {
+	for _, tt := range []struct {
+		userdata string
+
+		include Include
+		err     bool
+	}{
+		{
+			userdata: "#include",
+		},
+		{
+			userdata: "#include\r\nhttp://example.com/a\r\n\r\n# comment\r\n  https://example.com/b  \r\n",
+			include:  Include{"http://example.com/a", "https://example.com/b"},
+		},
+		{
+			userdata: "#include\nhttp://example.com/a\nfile:///etc/passwd\n",
+			err:      true,
+		},
+		{
+			userdata: "#include\nexample.com/a\n",
+			err:      true,
+		},
+	} {
+		include, err := NewInclude(tt.userdata)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.userdata, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.include, include) {
+			t.Errorf("bad include (%q): want %#v, got %#v", tt.userdata, tt.include, include)
+		}
+	}
+}
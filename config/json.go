@@ -0,0 +1,95 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/coreos/yaml"
+)
+
+const cloudConfigJSONHeader = "#cloud-config-json"
+
+// IsCloudConfigJSON reports whether userdata is a cloud-config in JSON, i.e.
+// whether it begins with the "#cloud-config-json" header or is a JSON object
+// which isn't an Ignition config.
+func IsCloudConfigJSON(userdata string) bool {
+	header := strings.SplitN(userdata, "\n", 2)[0]
+	if strings.TrimRightFunc(header, unicode.IsSpace) == cloudConfigJSONHeader {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimLeftFunc(userdata, unicode.IsSpace), "{") && !IsIgnitionConfig(userdata)
+}
+
+// CloudConfigFromJSON converts the given cloud-config in JSON into the
+// equivalent YAML cloud-config, so that it is decoded with the same field
+// names and rules as any other cloud-config.
+func CloudConfigFromJSON(contents string) (string, error) {
+	if strings.HasPrefix(contents, cloudConfigJSONHeader) {
+		contents = strings.TrimPrefix(contents, strings.SplitN(contents, "\n", 2)[0])
+	}
+
+	var cfg interface{}
+	decoder := json.NewDecoder(strings.NewReader(contents))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cfg); err != nil {
+		return "", err
+	}
+	if _, ok := cfg.(map[string]interface{}); !ok {
+		return "", errors.New("JSON cloud-config must be an object")
+	}
+
+	out, err := yaml.Marshal(jsonNumbers(cfg))
+	if err != nil {
+		return "", err
+	}
+	return "#cloud-config\n" + string(out), nil
+}
+
+// NewCloudConfigJSON instantiates a new CloudConfig from the given contents
+// (a string of JSON), like NewCloudConfig.
+func NewCloudConfigJSON(contents string) (*CloudConfig, error) {
+	converted, err := CloudConfigFromJSON(contents)
+	if err != nil {
+		return &CloudConfig{}, err
+	}
+	return NewCloudConfig(converted)
+}
+
+// jsonNumbers replaces the json.Numbers in the decoded JSON value v with
+// integers where possible and floats otherwise, which is how YAML decodes
+// them.
+func jsonNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = jsonNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonNumbers(e)
+		}
+	}
+	return v
+}
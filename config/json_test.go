@@ -0,0 +1,107 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsCloudConfigJSON(t *testing.T) {
+	for _, tt := range []struct {
+		userdata string
+
+		json bool
+	}{
+		{userdata: "#cloud-config-json\n{}", json: true},
+		{userdata: "#cloud-config-json  \n{}", json: true},
+		{userdata: `{"hostname": "node1"}`, json: true},
+		{userdata: "\n  {\"hostname\": \"node1\"}", json: true},
+		{userdata: `{"ignition": {"version": "2.2.0"}}`},
+		{userdata: `{"ignitionVersion": 1}`},
+		{userdata: "#cloud-config\nhostname: node1"},
+		{userdata: "#!/bin/bash\necho {}"},
+	} {
+		if json := IsCloudConfigJSON(tt.userdata); json != tt.json {
+			t.Errorf("bad result (%q): want %t, got %t", tt.userdata, tt.json, json)
+		}
+	}
+}
+
+func TestNewCloudConfigJSON(t *testing.T) {
+	yaml := `#cloud-config
+hostname: node1
+ssh_authorized_keys:
+  - ssh-rsa AAAA
+write_files:
+  - path: /etc/motd
+    permissions: "0644"
+    content: |
+      hello
+      world
+coreos:
+  etcd:
+    max_retry_attempts: 3
+    http_read_timeout: 1.5
+  units:
+    - name: hello.service
+      command: start
+      content: |
+        [Service]
+        ExecStart=/bin/echo "hello"
+users:
+  - name: core
+    groups: [sudo, docker]
+`
+	want, err := NewCloudConfig(yaml)
+	if err != nil {
+		t.Fatalf("bad error parsing the YAML: %v", err)
+	}
+
+	for _, json := range []string{
+		`#cloud-config-json
+{
+	"hostname": "node1",
+	"ssh_authorized_keys": ["ssh-rsa AAAA"],
+	"write_files": [{"path": "\/etc\/motd", "permissions": "0644", "content": "hello\nworld\n"}],
+	"coreos": {
+		"etcd": {"max_retry_attempts": 3, "http_read_timeout": 1.5},
+		"units": [{"name": "hello.service", "command": "start", "content": "[Service]\nExecStart=/bin/echo \"hello\"\n"}]
+	},
+	"users": [{"name": "core", "groups": ["sudo", "docker"]}]
+}`,
+		`{"hostname":"node1","ssh_authorized_keys":["ssh-rsa AAAA"],"write_files":[{"path":"/etc/motd","permissions":"0644","content":"hello\nworld\n"}],"coreos":{"etcd":{"max_retry_attempts":3,"http_read_timeout":1.5},"units":[{"name":"hello.service","command":"start","content":"[Service]\nExecStart=/bin/echo \"hello\"\n"}]},"users":[{"name":"core","groups":["sudo","docker"]}]}`,
+	} {
+		got, err := NewCloudConfigJSON(json)
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", json, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("bad cloud-config (%q): want %#v, got %#v", json, want, got)
+		}
+	}
+}
+
+func TestNewCloudConfigJSONInvalid(t *testing.T) {
+	for _, json := range []string{
+		"#cloud-config-json\n[]",
+		"#cloud-config-json\n{\"hostname\": ",
+		`{"hostname": "node1",}`,
+	} {
+		if _, err := NewCloudConfigJSON(json); err == nil {
+			t.Errorf("bad error (%q): want non-nil, got nil", json)
+		}
+	}
+}
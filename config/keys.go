@@ -0,0 +1,126 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/coreos/yaml"
+)
+
+// UnknownKeys returns the path (e.g. "coreos.etcd.discvery") of each key in
+// the given cloud-config which doesn't map onto a field of CloudConfig,
+// sorted by name at each level. Elements of lists are identified by their
+// index (e.g. "users[1].nmae").
+func UnknownKeys(contents string) ([]string, error) {
+	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
+		return strings.Replace(nameIn, "-", "_", -1)
+	}
+	var weak map[interface{}]interface{}
+	if err := yaml.Unmarshal([]byte(contents), &weak); err != nil {
+		return nil, err
+	}
+	return unknownKeys("", weak, reflect.TypeOf(CloudConfig{})), nil
+}
+
+func unknownKeys(path string, value interface{}, t reflect.Type) []string {
+	// Types which do their own unmarshalling don't map keys onto fields.
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*yaml.Setter)(nil)).Elem()) {
+		return nil
+	}
+
+	var keys []string
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		fields := yamlFields(t)
+		values := stringKeys(m)
+		for _, name := range sortedNames(values) {
+			kpath := name
+			if path != "" {
+				kpath = path + "." + name
+			}
+			if f, ok := fields[name]; ok {
+				keys = append(keys, unknownKeys(kpath, values[name], f.Type)...)
+			} else {
+				keys = append(keys, kpath)
+			}
+		}
+	case reflect.Map:
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		values := stringKeys(m)
+		for _, name := range sortedNames(values) {
+			keys = append(keys, unknownKeys(path+"."+name, values[name], t.Elem())...)
+		}
+	case reflect.Slice:
+		s, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, e := range s {
+			keys = append(keys, unknownKeys(fmt.Sprintf("%s[%d]", path, i), e, t.Elem())...)
+		}
+	}
+	return keys
+}
+
+// yamlFields returns the exported fields of the given struct type which can be
+// set in YAML, keyed by their YAML name.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !isFieldExported(f) {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// stringKeys returns a copy of the given map keyed by the string
+// representation of its keys.
+func stringKeys(m map[interface{}]interface{}) map[string]interface{} {
+	s := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		s[fmt.Sprintf("%v", k)] = v
+	}
+	return s
+}
+
+func sortedNames(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
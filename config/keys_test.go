@@ -0,0 +1,71 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+
+		keys []string
+		err  bool
+	}{
+		{
+			contents: "#cloud-config\nhostname: foo\nwrite-files:\n  - path: /etc/motd\n",
+		},
+		{
+			contents: "#cloud-config\nwrite_file:\n  - path: /etc/motd\n",
+			keys:     []string{"write_file"},
+		},
+		{
+			contents: "#cloud-config\ncoreos:\n  etcd:\n    discvery: https://discovery.etcd.io/xxx\n  fleet:\n    metadata: region=us\n",
+			keys:     []string{"coreos.etcd.discvery"},
+		},
+		{
+			contents: "#cloud-config\nusers:\n  - name: core\n  - nmae: elroy\n    groups: [sudo]\n",
+			keys:     []string{"users[1].nmae"},
+		},
+		{
+			contents: "#cloud-config\ncoreos:\n  units:\n    - name: a.service\n      drop-ins:\n        - name: b.conf\n          contnet: x\n",
+			keys:     []string{"coreos.units[0].drop_ins[0].contnet"},
+		},
+		{
+			contents: "#cloud-config\ngroups:\n  - admins: [root]\n  - cloud-users\n",
+		},
+		{
+			contents: "#cloud-config\nsubstitutions:\n  anything: goes\nhostnme: foo\nsssh_authorized_keys: []\n",
+			keys:     []string{"hostnme", "sssh_authorized_keys"},
+		},
+		{
+			contents: "#cloud-config\ncoreos: true\nusers: foo\n",
+		},
+		{
+			contents: "#cloud-config\nhostname: [foo\n",
+			err:      true,
+		},
+	} {
+		keys, err := UnknownKeys(tt.contents)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.contents, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.keys, keys) {
+			t.Errorf("bad keys (%q): want %q, got %q", tt.contents, tt.keys, keys)
+		}
+	}
+}
@@ -14,12 +14,56 @@
 
 package config
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
 type Locksmith struct {
 	Endpoint           string `yaml:"endpoint"      env:"LOCKSMITHD_ENDPOINT"`
 	EtcdCAFile         string `yaml:"etcd_cafile"   env:"LOCKSMITHD_ETCD_CAFILE"`
 	EtcdCertFile       string `yaml:"etcd_certfile" env:"LOCKSMITHD_ETCD_CERTFILE"`
 	EtcdKeyFile        string `yaml:"etcd_keyfile"  env:"LOCKSMITHD_ETCD_KEYFILE"`
 	Group              string `yaml:"group"         env:"LOCKSMITHD_GROUP"`
-	RebootWindowStart  string `yaml:"window_start"  env:"REBOOT_WINDOW_START"  valid:"^((?i:sun|mon|tue|wed|thu|fri|sat|sun) )?0*([0-9]|1[0-9]|2[0-3]):0*([0-9]|[1-5][0-9])$"`
-	RebootWindowLength string `yaml:"window_length" env:"REBOOT_WINDOW_LENGTH" valid:"^[-+]?([0-9]*(\\.[0-9]*)?[a-z]+)+$"`
+	RebootWindowStart  string `yaml:"window_start"  env:"REBOOT_WINDOW_START"`
+	RebootWindowLength string `yaml:"window_length" env:"REBOOT_WINDOW_LENGTH"`
+}
+
+var rebootWindowStart = regexp.MustCompile(`^((?i:sun|mon|tue|wed|thu|fri|sat) )?0*([0-9]|1[0-9]|2[0-3]):0*([0-9]|[1-5][0-9])$`)
+
+// CheckWindowStart verifies that window_start is a time of day (hh:mm),
+// optionally preceded by a day of the week.
+func (l Locksmith) CheckWindowStart() error {
+	if !rebootWindowStart.MatchString(l.RebootWindowStart) {
+		return fmt.Errorf("invalid value %q for window_start (want e.g. \"Thu 04:00\" or \"04:00\")", l.RebootWindowStart)
+	}
+	return nil
+}
+
+// CheckWindowLength verifies that window_length is a positive duration, as
+// parsed by locksmithd.
+func (l Locksmith) CheckWindowLength() error {
+	if d, err := time.ParseDuration(l.RebootWindowLength); err != nil || d <= 0 {
+		return fmt.Errorf("invalid value %q for window_length (want a positive duration, e.g. \"1h30m\")", l.RebootWindowLength)
+	}
+	return nil
+}
+
+// CheckWindow verifies the reboot window. Either both its start and its
+// length are given or neither is.
+func (l Locksmith) CheckWindow() error {
+	switch {
+	case l.RebootWindowStart == "" && l.RebootWindowLength == "":
+		return nil
+	case l.RebootWindowLength == "":
+		return errors.New("window_start requires window_length")
+	case l.RebootWindowStart == "":
+		return errors.New("window_length requires window_start")
+	}
+	if err := l.CheckWindowStart(); err != nil {
+		return err
+	}
+	return l.CheckWindowLength()
 }
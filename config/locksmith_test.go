@@ -47,7 +47,7 @@ func TestRebootWindowStart(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		isValid := (nil == AssertStructValid(Locksmith{RebootWindowStart: tt.value}))
+		isValid := (nil == Locksmith{RebootWindowStart: tt.value}.CheckWindowStart())
 		if tt.isValid != isValid {
 			t.Errorf("bad assert (%s): want %t, got %t", tt.value, tt.isValid, isValid)
 		}
@@ -61,16 +61,39 @@ func TestRebootWindowLength(t *testing.T) {
 		isValid bool
 	}{
 		{value: "1h", isValid: true},
-		{value: "1d", isValid: true},
-		{value: "0d", isValid: true},
+		{value: "1h30m", isValid: true},
 		{value: "0.5h", isValid: true},
 		{value: "0.5.0h", isValid: false},
+		{value: "1d", isValid: false},
+		{value: "0h", isValid: false},
+		{value: "-1h", isValid: false},
+		{value: "1 hour", isValid: false},
 	}
 
 	for _, tt := range tests {
-		isValid := (nil == AssertStructValid(Locksmith{RebootWindowLength: tt.value}))
+		isValid := (nil == Locksmith{RebootWindowLength: tt.value}.CheckWindowLength())
 		if tt.isValid != isValid {
 			t.Errorf("bad assert (%s): want %t, got %t", tt.value, tt.isValid, isValid)
 		}
 	}
 }
+
+func TestRebootWindow(t *testing.T) {
+	for _, tt := range []struct {
+		config Locksmith
+
+		err string
+	}{
+		{config: Locksmith{}},
+		{config: Locksmith{RebootWindowStart: "Thu 04:00", RebootWindowLength: "1h"}},
+		{config: Locksmith{RebootWindowStart: "04:00"}, err: "window_start requires window_length"},
+		{config: Locksmith{RebootWindowLength: "1h"}, err: "window_length requires window_start"},
+		{config: Locksmith{RebootWindowStart: "Thursday 04:00", RebootWindowLength: "1h"}, err: `invalid value "Thursday 04:00" for window_start (want e.g. "Thu 04:00" or "04:00")`},
+		{config: Locksmith{RebootWindowStart: "Thu 04:00", RebootWindowLength: "1d"}, err: `invalid value "1d" for window_length (want a positive duration, e.g. "1h30m")`},
+	} {
+		err := tt.config.CheckWindow()
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("bad error (%+v): want %q, got %v", tt.config, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Merge returns the result of merging override onto base. Neither of the
+// given configs is modified. The rules are applied recursively:
+//
+//   - scalars are overridden unless the override is the zero value (so a
+//     value can't be reset to false or "" through an override)
+//   - maps are merged, with the entries of override taking precedence
+//   - lists whose field has a merge tag (e.g. write_files, keyed by path, or
+//     coreos.units, keyed by name) are merged by key: an entry of override
+//     replaces the entry of base with the same key, other entries are
+//     appended
+//   - all other lists are appended, skipping entries which are already
+//     present
+func Merge(base, override CloudConfig) CloudConfig {
+	merged := base
+	mergeValue(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(override), "")
+	return merged
+}
+
+// mergeValue merges src onto dst, which is a (shallow) copy of the base
+// value. Maps and lists are copied before being modified so that the base
+// isn't touched. key is the YAML name of the field identifying the elements
+// of a list.
+func mergeValue(dst, src reflect.Value, key string) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		t := dst.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !isFieldExported(f) || f.Tag.Get("yaml") == "-" {
+				continue
+			}
+			mergeValue(dst.Field(i), src.Field(i), f.Tag.Get("merge"))
+		}
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		m := reflect.MakeMap(dst.Type())
+		for _, k := range dst.MapKeys() {
+			m.SetMapIndex(k, dst.MapIndex(k))
+		}
+		for _, k := range src.MapKeys() {
+			m.SetMapIndex(k, src.MapIndex(k))
+		}
+		dst.Set(m)
+	case reflect.Slice:
+		if src.Len() == 0 {
+			return
+		}
+		s := reflect.AppendSlice(reflect.MakeSlice(dst.Type(), 0, dst.Len()+src.Len()), dst)
+		for i := 0; i < src.Len(); i++ {
+			e := src.Index(i)
+			switch j := indexOf(s, e, key); {
+			case j < 0:
+				s = reflect.Append(s, e)
+			case key != "":
+				s.Index(j).Set(e)
+			}
+		}
+		dst.Set(s)
+	default:
+		if !isZero(src) {
+			dst.Set(src)
+		}
+	}
+}
+
+// indexOf returns the index of the element of s which has the same key as e
+// (or is equal to e, if there is no key), or -1 if there is none.
+func indexOf(s, e reflect.Value, key string) int {
+	for i := 0; i < s.Len(); i++ {
+		if key == "" {
+			if reflect.DeepEqual(s.Index(i).Interface(), e.Interface()) {
+				return i
+			}
+		} else if k := fieldByYAMLName(e, key); k.IsValid() && k.Interface() == fieldByYAMLName(s.Index(i), key).Interface() {
+			return i
+		}
+	}
+	return -1
+}
+
+// fieldByYAMLName returns the field of the struct v with the given YAML name.
+func fieldByYAMLName(v reflect.Value, name string) reflect.Value {
+	for i := 0; i < v.NumField(); i++ {
+		if strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0] == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
@@ -0,0 +1,98 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	for i, tt := range []struct {
+		base     string
+		override string
+
+		merged CloudConfig
+	}{
+		{
+			base:     "hostname: base\nlocale: en_US.UTF-8\n",
+			override: "hostname: override\ntimezone: UTC\n",
+			merged:   CloudConfig{Hostname: "override", Locale: "en_US.UTF-8", Timezone: "UTC"},
+		},
+		{
+			base:     "ssh_authorized_keys_exclusive: true\n",
+			override: "ssh_authorized_keys_exclusive: false\n",
+			merged:   CloudConfig{SSHKeysExclusive: true},
+		},
+		{
+			base: `write_files:
+  - path: /etc/motd
+    content: base
+  - path: /etc/issue
+    content: base
+`,
+			override: `write_files:
+  - path: /etc/hosts
+    content: override
+  - path: /etc/motd
+    content: override
+    permissions: "0600"
+`,
+			merged: CloudConfig{WriteFiles: []File{
+				{Path: "/etc/motd", Content: "override", RawFilePermissions: "0600"},
+				{Path: "/etc/issue", Content: "base"},
+				{Path: "/etc/hosts", Content: "override"},
+			}},
+		},
+		{
+			base:     "coreos:\n  etcd2:\n    name: base\n    discovery: https://discovery.etcd.io/base\n  units:\n    - name: a.service\n      command: start\n    - name: b.service\n      mask: true\n",
+			override: "coreos:\n  etcd2:\n    discovery: https://discovery.etcd.io/override\n  units:\n    - name: b.service\n      command: start\n",
+			merged: CloudConfig{CoreOS: CoreOS{
+				Etcd2: Etcd2{Name: "base", Discovery: "https://discovery.etcd.io/override"},
+				Units: []Unit{{Name: "a.service", Command: "start"}, {Name: "b.service", Command: "start"}},
+			}},
+		},
+		{
+			base:     "ssh_authorized_keys:\n  - key1\n  - key2\nsysctl:\n  a: \"1\"\n  b: \"2\"\n",
+			override: "ssh_authorized_keys:\n  - key2\n  - key3\nsysctl:\n  b: \"3\"\n  c: \"4\"\n",
+			merged: CloudConfig{
+				SSHAuthorizedKeys: []string{"key1", "key2", "key3"},
+				Sysctl:            Sysctl{"a": "1", "b": "3", "c": "4"},
+			},
+		},
+		{
+			base:     "users:\n  - name: core\n    groups: [sudo]\n",
+			override: "users:\n  - name: core\n    groups: [docker]\n  - name: elroy\n",
+			merged:   CloudConfig{Users: []User{{Name: "core", Groups: []string{"docker"}}, {Name: "elroy"}}},
+		},
+	} {
+		base, err := NewCloudConfig(tt.base)
+		if err != nil {
+			t.Fatalf("bad error (%d): want nil, got %v", i, err)
+		}
+		override, err := NewCloudConfig(tt.override)
+		if err != nil {
+			t.Fatalf("bad error (%d): want nil, got %v", i, err)
+		}
+		baseCopy, _ := NewCloudConfig(tt.base)
+
+		if merged := Merge(*base, *override); !reflect.DeepEqual(tt.merged, merged) {
+			t.Errorf("bad merged config (%d): want %#v, got %#v", i, tt.merged, merged)
+		}
+		if !reflect.DeepEqual(baseCopy, base) {
+			t.Errorf("bad base config (%d): modified by merge to %#v", i, base)
+		}
+	}
+}
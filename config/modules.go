@@ -0,0 +1,70 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Modules is a list of kernel modules to be loaded at boot.
+type Modules []Module
+
+type Module struct {
+	Name    string `yaml:"name"`
+	Options string `yaml:"options"`
+}
+
+var moduleName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Check verifies that the module name is valid and that its options fit on a
+// single line.
+func (m Module) Check() error {
+	if !moduleName.MatchString(m.Name) {
+		return fmt.Errorf("invalid module name %q", m.Name)
+	}
+	if strings.ContainsAny(m.Options, "\r\n") {
+		return fmt.Errorf("options of module %q span multiple lines", m.Name)
+	}
+	return nil
+}
+
+// Deduped returns the modules with duplicates removed, preserving their
+// order. Since modprobe treats dashes and underscores in module names alike,
+// so does Deduped. It is an error if a module is invalid or listed more than
+// once with conflicting options.
+func (ms Modules) Deduped() (Modules, error) {
+	var unique Modules
+	seen := map[string]int{}
+	for _, m := range ms {
+		if err := m.Check(); err != nil {
+			return nil, err
+		}
+
+		name := strings.Replace(m.Name, "-", "_", -1)
+		if i, ok := seen[name]; ok {
+			if unique[i].Options == "" {
+				unique[i].Options = m.Options
+			} else if m.Options != "" && m.Options != unique[i].Options {
+				return nil, fmt.Errorf("module %q is listed with conflicting options %q and %q", m.Name, unique[i].Options, m.Options)
+			}
+			continue
+		}
+		seen[name] = len(unique)
+		unique = append(unique, m)
+	}
+	return unique, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModulesDeduped(t *testing.T) {
+	tests := []struct {
+		modules Modules
+
+		unique Modules
+		err    bool
+	}{
+		{},
+		{
+			modules: Modules{{Name: "overlay"}, {Name: "br_netfilter"}},
+			unique:  Modules{{Name: "overlay"}, {Name: "br_netfilter"}},
+		},
+		{
+			modules: Modules{{Name: "br_netfilter"}, {Name: "overlay"}, {Name: "br-netfilter"}},
+			unique:  Modules{{Name: "br_netfilter"}, {Name: "overlay"}},
+		},
+		{
+			modules: Modules{{Name: "bonding"}, {Name: "bonding", Options: "mode=4"}, {Name: "bonding", Options: "mode=4"}},
+			unique:  Modules{{Name: "bonding", Options: "mode=4"}},
+		},
+		{
+			modules: Modules{{Name: "bonding", Options: "mode=4"}, {Name: "bonding", Options: "mode=1"}},
+			err:     true,
+		},
+		{
+			modules: Modules{{Name: "overlay; reboot"}},
+			err:     true,
+		},
+		{
+			modules: Modules{{Name: ""}},
+			err:     true,
+		},
+		{
+			modules: Modules{{Name: "bonding", Options: "mode=4\ninstall bonding /bin/sh"}},
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		unique, err := tt.modules.Deduped()
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want %t, got %v", tt.modules, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.unique, unique) {
+			t.Errorf("bad modules (%+v): want %+v, got %+v", tt.modules, tt.unique, unique)
+		}
+	}
+}
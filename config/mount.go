@@ -0,0 +1,63 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Mount is a filesystem to be mounted by a systemd mount unit. DumpFreq is
+// accepted for compatibility with fstab entries but ignored, since only dump(8)
+// uses it and mount units have no equivalent setting.
+type Mount struct {
+	What     string `yaml:"what"`
+	Where    string `yaml:"where"`
+	Type     string `yaml:"type"`
+	Options  string `yaml:"options"`
+	DumpFreq int    `yaml:"dump_freq"`
+}
+
+// CheckMounts verifies the given mounts entries. Each of them needs what and
+// an absolute where, no mount point may be declared more than once and a mount
+// point nested under another one has to be declared after it.
+func CheckMounts(mounts []Mount) error {
+	wheres := make([]string, len(mounts))
+	for i, m := range mounts {
+		if m.What == "" || !path.IsAbs(m.Where) {
+			return fmt.Errorf("invalid mounts entry %d: what and an absolute where are required", i)
+		}
+		wheres[i] = path.Clean(m.Where)
+		for j, where := range wheres[:i] {
+			if where == wheres[i] {
+				return fmt.Errorf("invalid mounts entry %d: mount point %q is declared more than once", i, where)
+			}
+			if isNestedPath(where, wheres[i]) {
+				return fmt.Errorf("invalid mounts entry %d: mount point %q is nested under %q and has to be declared after entry %d", j, where, wheres[i], i)
+			}
+		}
+	}
+	return nil
+}
+
+// isNestedPath reports whether the cleaned path p lies below the cleaned path
+// parent.
+func isNestedPath(p, parent string) bool {
+	if parent == "/" {
+		return p != "/"
+	}
+	return strings.HasPrefix(p, parent+"/")
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestCheckMounts(t *testing.T) {
+	for _, tt := range []struct {
+		mounts []Mount
+
+		err string
+	}{
+		{},
+		{
+			mounts: []Mount{{What: "/dev/sdb1", Where: "/var/lib/docker"}, {What: "/dev/sdc1", Where: "/var/lib/docker/volumes"}},
+		},
+		{
+			mounts: []Mount{{What: "/dev/sdb1", Where: "/var/lib/docker"}, {What: "/dev/sdc1", Where: "/var/lib/dockerd"}},
+		},
+		{
+			mounts: []Mount{{What: "/dev/sdb1", Where: "/"}, {What: "/dev/sdc1", Where: "/home"}},
+		},
+		{
+			mounts: []Mount{{Where: "/var/lib/docker"}},
+			err:    "invalid mounts entry 0: what and an absolute where are required",
+		},
+		{
+			mounts: []Mount{{What: "/dev/sdb1", Where: "var/lib/docker"}},
+			err:    "invalid mounts entry 0: what and an absolute where are required",
+		},
+		{
+			mounts: []Mount{{What: "/dev/sdb1", Where: "/var/lib/docker"}, {What: "/dev/sdc1", Where: "/var/lib/docker/"}},
+			err:    `invalid mounts entry 1: mount point "/var/lib/docker" is declared more than once`,
+		},
+		{
+			mounts: []Mount{{What: "/dev/sdc1", Where: "/var/lib/docker/volumes"}, {What: "/dev/sdb1", Where: "/var/lib/docker"}},
+			err:    `invalid mounts entry 0: mount point "/var/lib/docker/volumes" is nested under "/var/lib/docker" and has to be declared after entry 1`,
+		},
+		{
+			mounts: []Mount{{What: "/dev/sdc1", Where: "/home"}, {What: "/dev/sdb1", Where: "/"}},
+			err:    `invalid mounts entry 0: mount point "/home" is nested under "/" and has to be declared after entry 1`,
+		},
+	} {
+		err := CheckMounts(tt.mounts)
+		if (err == nil) != (tt.err == "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("bad error (%+v): want %q, got %v", tt.mounts, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+)
+
+const (
+	ContentTypeCloudConfig = "text/cloud-config"
+	ContentTypeShellScript = "text/x-shellscript"
+)
+
+// Part is a single, decoded part of a multipart MIME user-data message.
+type Part struct {
+	ContentType string
+	Content     string
+}
+
+// Multipart is user-data made up of a cloud-config and any number of scripts,
+// delivered as a multipart MIME message.
+type Multipart struct {
+	CloudConfig *CloudConfig
+	Scripts     []Script
+}
+
+// IsMultipart reports whether the userdata is a MIME message with a multipart
+// Content-Type header.
+func IsMultipart(userdata string) bool {
+	msg, err := mail.ReadMessage(strings.NewReader(userdata))
+	if err != nil {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
+
+// NewMultipart parses the parts of the given multipart MIME message. At most
+// one cloud-config part is allowed; scripts are kept in the order in which
+// they appear.
+func NewMultipart(userdata string) (*Multipart, error) {
+	parts, err := MultipartParts(userdata)
+	if err != nil {
+		return nil, err
+	}
+	return NewMultipartFromParts(parts)
+}
+
+// NewMultipartFromParts parses the given parts (see MultipartParts) like
+// NewMultipart.
+func NewMultipartFromParts(parts []Part) (*Multipart, error) {
+	m := &Multipart{}
+	for _, part := range parts {
+		switch part.ContentType {
+		case ContentTypeCloudConfig:
+			if m.CloudConfig != nil {
+				return nil, fmt.Errorf("multiple cloud-config parts are not supported")
+			}
+			var err error
+			if m.CloudConfig, err = NewCloudConfig(part.Content); err != nil {
+				return nil, err
+			}
+		case ContentTypeShellScript:
+			m.Scripts = append(m.Scripts, Script(part.Content))
+		}
+	}
+	return m, nil
+}
+
+// MultipartParts splits the given multipart MIME message into its parts,
+// descending into nested multipart messages. Each part is decoded according
+// to its Content-Transfer-Encoding and decompressed if it is gzipped. Parts
+// without a known Content-Type are identified by their header line and parts
+// which are neither a cloud-config nor a script are dropped.
+func MultipartParts(userdata string) ([]Part, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(userdata))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MIME message: %v", err)
+	}
+	return readParts(msg.Header.Get("Content-Type"), msg.Body)
+}
+
+func readParts(contentType string, body io.Reader) ([]Part, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Type %q: %v", contentType, err)
+	}
+	if params["boundary"] == "" {
+		return nil, fmt.Errorf("missing boundary in Content-Type %q", mediaType)
+	}
+
+	var parts []Part
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid MIME part: %v", err)
+		}
+
+		partType := p.Header.Get("Content-Type")
+		if strings.HasPrefix(partType, "multipart/") {
+			nested, err := readParts(partType, p)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, nested...)
+			continue
+		}
+
+		content, err := readPart(p)
+		if err != nil {
+			return nil, err
+		}
+		if part, ok := newPart(partType, content); ok {
+			parts = append(parts, part)
+		} else {
+			log.Printf("Ignoring MIME part with unsupported Content-Type %q", partType)
+		}
+	}
+}
+
+// readPart returns the decoded and decompressed content of the given part.
+// Quoted-printable parts are already decoded by the multipart reader.
+func readPart(p *multipart.Part) ([]byte, error) {
+	content, err := ioutil.ReadAll(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MIME part: %v", err)
+	}
+
+	switch encoding := strings.ToLower(p.Header.Get("Content-Transfer-Encoding")); encoding {
+	case "", "7bit", "8bit", "binary":
+	case "base64":
+		stripped := strings.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, string(content))
+		if content, err = base64.StdEncoding.DecodeString(stripped); err != nil {
+			return nil, fmt.Errorf("Unable to decode base64: %q", err)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported Content-Transfer-Encoding %q", encoding)
+	}
+
+	if IsGzip(string(content)) {
+		return DecodeGzipContent(string(content))
+	}
+	return content, nil
+}
+
+func newPart(contentType string, content []byte) (Part, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case ContentTypeCloudConfig, ContentTypeShellScript:
+		return Part{ContentType: mediaType, Content: string(content)}, true
+	}
+
+	switch {
+	case IsCloudConfig(string(content)):
+		return Part{ContentType: ContentTypeCloudConfig, Content: string(content)}, true
+	case IsScript(string(content)):
+		return Part{ContentType: ContentTypeShellScript, Content: string(content)}, true
+	default:
+		return Part{}, false
+	}
+}
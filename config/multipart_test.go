@@ -0,0 +1,145 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+const twoPartMultipart = `Content-Type: multipart/mixed; boundary="//"
+MIME-Version: 1.0
+
+--//
+Content-Type: text/cloud-config; charset="us-ascii"
+MIME-Version: 1.0
+Content-Transfer-Encoding: 7bit
+Content-Disposition: attachment; filename="cloud-config.txt"
+
+#cloud-config
+hostname: foo
+
+--//
+Content-Type: text/x-shellscript; charset="us-ascii"
+MIME-Version: 1.0
+Content-Transfer-Encoding: 7bit
+Content-Disposition: attachment; filename="userdata.txt"
+
+#!/bin/bash
+echo hello
+--//--
+`
+
+func TestIsMultipart(t *testing.T) {
+	for _, tt := range []struct {
+		userdata  string
+		multipart bool
+	}{
+		{twoPartMultipart, true},
+		{"MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=abc\r\n\r\n--abc--\r\n", true},
+		{"Content-Type: text/plain\n\nhello", false},
+		{"#cloud-config\nhostname: foo", false},
+		{"#!/bin/bash\necho hello", false},
+		{"", false},
+	} {
+		if multipart := IsMultipart(tt.userdata); multipart != tt.multipart {
+			t.Errorf("bad result (%q): want %t, got %t", tt.userdata, tt.multipart, multipart)
+		}
+	}
+}
+
+func TestMultipartParts(t *testing.T) {
+	for _, tt := range []struct {
+		userdata string
+
+		parts []Part
+		err   bool
+	}{
+		{
+			userdata: twoPartMultipart,
+			parts: []Part{
+				{ContentType: ContentTypeCloudConfig, Content: "#cloud-config\nhostname: foo\n"},
+				{ContentType: ContentTypeShellScript, Content: "#!/bin/bash\necho hello"},
+			},
+		},
+		{
+			userdata: `Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/cloud-config
+Content-Transfer-Encoding: base64
+
+I2Nsb3VkLWNvbmZpZwpob3N0bmFtZTog
+YjY0Cg==
+--inner--
+--outer
+Content-Type: application/x-gzip
+Content-Transfer-Encoding: base64
+
+H4sIAAAAAAAC/1NW1E/KzNNPSizO4EpNzshXSK/iAgAfkzh/FAAAAA==
+--outer
+Content-Type: text/plain
+
+just some text
+--outer--
+`,
+			parts: []Part{
+				{ContentType: ContentTypeCloudConfig, Content: "#cloud-config\nhostname: b64\n"},
+				{ContentType: ContentTypeShellScript, Content: "#!/bin/bash\necho gz\n"},
+			},
+		},
+		{
+			userdata: "Content-Type: multipart/mixed\n\n--abc--\n",
+			err:      true,
+		},
+		{
+			userdata: "Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Transfer-Encoding: base64\n\n!!!\n--abc--\n",
+			err:      true,
+		},
+		{
+			userdata: "Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Transfer-Encoding: uuencode\n\nfoo\n--abc--\n",
+			err:      true,
+		},
+	} {
+		parts, err := MultipartParts(tt.userdata)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.userdata, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.parts, parts) {
+			t.Errorf("bad parts (%q): want %#v, got %#v", tt.userdata, tt.parts, parts)
+		}
+	}
+}
+
+func TestNewMultipart(t *testing.T) {
+	m, err := NewMultipart(twoPartMultipart)
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	if m.CloudConfig == nil || m.CloudConfig.Hostname != "foo" {
+		t.Errorf("bad cloud-config: want hostname %q, got %#v", "foo", m.CloudConfig)
+	}
+	if scripts := []Script{Script("#!/bin/bash\necho hello")}; !reflect.DeepEqual(scripts, m.Scripts) {
+		t.Errorf("bad scripts: want %q, got %q", scripts, m.Scripts)
+	}
+
+	twoConfigs := "Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Type: text/cloud-config\n\n#cloud-config\n--abc\nContent-Type: text/cloud-config\n\n#cloud-config\n--abc--\n"
+	if _, err := NewMultipart(twoConfigs); err == nil {
+		t.Errorf("bad error: want non-nil for multiple cloud-config parts, got nil")
+	}
+}
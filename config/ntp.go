@@ -0,0 +1,52 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+type NTP struct {
+	Servers         []string `yaml:"servers"`
+	FallbackServers []string `yaml:"fallback_servers"`
+}
+
+var ntpHostname = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.?$`)
+
+// CheckServer verifies that the given NTP server is either a hostname or an
+// IP address.
+func (n NTP) CheckServer(server string) error {
+	if net.ParseIP(server) != nil {
+		return nil
+	}
+	if len(server) > 253 || !ntpHostname.MatchString(server) {
+		return fmt.Errorf("NTP server %q is neither a hostname nor an IP address", server)
+	}
+	return nil
+}
+
+// CheckServers verifies all of the servers and fallback servers.
+func (n NTP) CheckServers() error {
+	for _, servers := range [][]string{n.Servers, n.FallbackServers} {
+		for _, s := range servers {
+			if err := n.CheckServer(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
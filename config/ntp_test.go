@@ -0,0 +1,42 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestNTPCheckServers(t *testing.T) {
+	tests := []struct {
+		ntp NTP
+
+		err bool
+	}{
+		{ntp: NTP{}},
+		{ntp: NTP{Servers: []string{"ntp.example.com", "10.0.0.1", "fe80::1"}, FallbackServers: []string{"0.pool.ntp.org."}}},
+		{ntp: NTP{Servers: []string{"localhost"}}},
+		{ntp: NTP{Servers: []string{""}}, err: true},
+		{ntp: NTP{Servers: []string{"ntp.example.com", "not a host"}}, err: true},
+		{ntp: NTP{FallbackServers: []string{"-bad.example.com"}}, err: true},
+		{ntp: NTP{FallbackServers: []string{"bad..example.com"}}, err: true},
+		{ntp: NTP{Servers: []string{"ntp.example.com:123"}}, err: true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.ntp.CheckServers(); tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want %t, got %v", tt.ntp, tt.err, err)
+		}
+	}
+}
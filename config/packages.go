@@ -0,0 +1,45 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Packages is a list of packages to be layered onto the image with
+// rpm-ostree.
+type Packages []string
+
+var packageName = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._+-]*$`)
+
+// CheckName verifies that the given package name is safe to be passed to
+// rpm-ostree.
+func (p Packages) CheckName(name string) error {
+	if !packageName.MatchString(name) {
+		return fmt.Errorf("invalid package name %q", name)
+	}
+	return nil
+}
+
+// CheckNames verifies all of the package names.
+func (p Packages) CheckNames() error {
+	for _, name := range p {
+		if err := p.CheckName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// PowerState is a power transition (e.g. a reboot) which is performed once
+// everything else has been applied successfully.
+type PowerState struct {
+	Mode      string `yaml:"mode"      valid:"^(reboot|poweroff|halt)$"`
+	Delay     string `yaml:"delay"     valid:"^(now|\\+?[0-9]+)$"`
+	Message   string `yaml:"message"`
+	Condition string `yaml:"condition"`
+}
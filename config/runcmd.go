@@ -0,0 +1,132 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+)
+
+// RunCmd is a list of commands which are run in order, either before
+// (bootcmd) or after (runcmd) everything else has been applied. In YAML each command is given either as a string, which
+// is run by the shell, as a list of arguments, which is executed directly,
+// or as a map holding either form as "command" along with "ignore_errors",
+// e.g.:
+//
+//	runcmd:
+//	  - echo "$(hostname)" > /etc/motd
+//	  - [systemctl, restart, sshd.service]
+//	  - command: [rm, /var/lib/stale]
+//	    ignore_errors: true
+type RunCmd []Command
+
+// Command is a single command of RunCmd. Exactly one of Shell and Args is set.
+type Command struct {
+	Shell        string
+	Args         []string
+	IgnoreErrors bool
+}
+
+// SetYAML accepts a string, a list of arguments or a map with the command
+// and whether to ignore its errors.
+func (c *Command) SetYAML(tag string, value interface{}) bool {
+	if m, ok := value.(map[interface{}]interface{}); ok {
+		var cmd Command
+		for k, v := range m {
+			switch k {
+			case "command":
+				if !cmd.set(v) {
+					return false
+				}
+			case "ignore_errors", "ignore-errors":
+				ignore, ok := v.(bool)
+				if !ok {
+					return false
+				}
+				cmd.IgnoreErrors = ignore
+			default:
+				return false
+			}
+		}
+		*c = cmd
+		return true
+	}
+
+	var cmd Command
+	if !cmd.set(value) {
+		return false
+	}
+	*c = cmd
+	return true
+}
+
+// set sets either Shell or Args from the given string or list of arguments.
+func (c *Command) set(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		c.Shell = v
+	case []interface{}:
+		args := make([]string, 0, len(v))
+		for _, a := range v {
+			switch a.(type) {
+			case string, int, float64, bool:
+				args = append(args, fmt.Sprint(a))
+			default:
+				return false
+			}
+		}
+		c.Args = args
+	default:
+		return false
+	}
+	return true
+}
+
+// GetYAML marshals the command back into the form it was given in.
+func (c Command) GetYAML() (tag string, value interface{}) {
+	var cmd interface{} = c.Shell
+	if c.Args != nil {
+		cmd = c.Args
+	}
+	if !c.IgnoreErrors {
+		return "", cmd
+	}
+	return "", map[string]interface{}{"command": cmd, "ignore_errors": true}
+}
+
+// Check verifies that the command isn't empty.
+func (c Command) Check() error {
+	if c.Shell == "" && len(c.Args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	return nil
+}
+
+// Check verifies all of the commands.
+func (r RunCmd) Check() error {
+	for i, c := range r {
+		if err := c.Check(); err != nil {
+			return fmt.Errorf("entry %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// String returns the command as it is logged.
+func (c Command) String() string {
+	if c.Args != nil {
+		return fmt.Sprintf("%q", c.Args)
+	}
+	return c.Shell
+}
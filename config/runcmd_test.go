@@ -0,0 +1,105 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunCmdYAML(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+
+		runcmd RunCmd
+	}{
+		{
+			contents: "hostname: foo\n",
+		},
+		{
+			contents: "runcmd:\n  - echo hello > /tmp/hello\n",
+			runcmd:   RunCmd{{Shell: "echo hello > /tmp/hello"}},
+		},
+		{
+			contents: "runcmd:\n  - [systemctl, restart, sshd.service]\n  - [sleep, 1]\n",
+			runcmd:   RunCmd{{Args: []string{"systemctl", "restart", "sshd.service"}}, {Args: []string{"sleep", "1"}}},
+		},
+		{
+			contents: "runcmd:\n  - command: [rm, /var/lib/stale]\n    ignore_errors: true\n  - command: \"false\"\n    ignore-errors: true\n  - command: \"true\"\n",
+			runcmd: RunCmd{
+				{Args: []string{"rm", "/var/lib/stale"}, IgnoreErrors: true},
+				{Shell: "false", IgnoreErrors: true},
+				{Shell: "true"},
+			},
+		},
+	} {
+		cfg, err := NewCloudConfig(tt.contents)
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", tt.contents, err)
+		}
+		if !reflect.DeepEqual(tt.runcmd, cfg.RunCmd) {
+			t.Errorf("bad runcmd (%q): want %#v, got %#v", tt.contents, tt.runcmd, cfg.RunCmd)
+		}
+
+		// The commands survive a round trip through String.
+		again, err := NewCloudConfig(cfg.String())
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", cfg.String(), err)
+		}
+		if !reflect.DeepEqual(tt.runcmd, again.RunCmd) {
+			t.Errorf("bad runcmd after round trip (%q): want %#v, got %#v", cfg.String(), tt.runcmd, again.RunCmd)
+		}
+	}
+}
+
+func TestBootCmdYAML(t *testing.T) {
+	contents := "bootcmd:\n  - [modprobe, dm_crypt]\nruncmd:\n  - echo done\n"
+	cfg, err := NewCloudConfig(contents)
+	if err != nil {
+		t.Fatalf("bad error (%q): want nil, got %v", contents, err)
+	}
+	if want := (RunCmd{{Args: []string{"modprobe", "dm_crypt"}}}); !reflect.DeepEqual(want, cfg.BootCmd) {
+		t.Errorf("bad bootcmd (%q): want %#v, got %#v", contents, want, cfg.BootCmd)
+	}
+	if want := (RunCmd{{Shell: "echo done"}}); !reflect.DeepEqual(want, cfg.RunCmd) {
+		t.Errorf("bad runcmd (%q): want %#v, got %#v", contents, want, cfg.RunCmd)
+	}
+}
+
+func TestCommandCheck(t *testing.T) {
+	for _, tt := range []struct {
+		cmd   Command
+		valid bool
+	}{
+		{Command{Shell: "echo hello"}, true},
+		{Command{Args: []string{"true"}}, true},
+		{Command{}, false},
+		{Command{Args: []string{}}, false},
+		{Command{IgnoreErrors: true}, false},
+	} {
+		if err := tt.cmd.Check(); tt.valid != (err == nil) {
+			t.Errorf("bad error (%#v): want valid %t, got %v", tt.cmd, tt.valid, err)
+		}
+	}
+}
+
+func TestRunCmdCheck(t *testing.T) {
+	if err := (RunCmd{{Shell: "true"}, {Args: []string{"true"}}}).Check(); err != nil {
+		t.Errorf("bad error: want nil, got %v", err)
+	}
+	if err := (RunCmd{{Shell: "true"}, {}}).Check(); err == nil || err.Error() != "entry 1: empty command" {
+		t.Errorf("bad error: want %q, got %v", "entry 1: empty command", err)
+	}
+}
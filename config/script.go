@@ -29,3 +29,19 @@ func NewScript(userdata string) (*Script, error) {
 	s := Script(userdata)
 	return &s, nil
 }
+
+// Interpreter returns the interpreter named by the "#!" line of the script,
+// followed by its arguments (e.g. ["/usr/bin/env", "python3"]). Unlike the
+// kernel, which passes everything after the interpreter as a single argument,
+// the arguments are split on whitespace. Scripts without an interpreter are
+// run by /bin/bash.
+func (s Script) Interpreter() []string {
+	header := strings.SplitN(string(s), "\n", 2)[0]
+	if !strings.HasPrefix(header, "#!") {
+		return []string{"/bin/bash"}
+	}
+	if fields := strings.Fields(strings.TrimPrefix(header, "#!")); len(fields) > 0 {
+		return fields
+	}
+	return []string{"/bin/bash"}
+}
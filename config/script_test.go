@@ -0,0 +1,57 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScriptInterpreter(t *testing.T) {
+	for _, tt := range []struct {
+		script string
+
+		interpreter []string
+	}{
+		{
+			script:      "#!/bin/bash\necho hello",
+			interpreter: []string{"/bin/bash"},
+		},
+		{
+			script:      "#!/bin/sh\necho hello",
+			interpreter: []string{"/bin/sh"},
+		},
+		{
+			script:      "#!/usr/bin/env python3\nprint('hello')",
+			interpreter: []string{"/usr/bin/env", "python3"},
+		},
+		{
+			script:      "#! /usr/bin/python3 -u  -B \nprint('hello')",
+			interpreter: []string{"/usr/bin/python3", "-u", "-B"},
+		},
+		{
+			script:      "#!\necho hello",
+			interpreter: []string{"/bin/bash"},
+		},
+		{
+			script:      "echo hello",
+			interpreter: []string{"/bin/bash"},
+		},
+	} {
+		if interpreter := Script(tt.script).Interpreter(); !reflect.DeepEqual(tt.interpreter, interpreter) {
+			t.Errorf("bad interpreter (%q): want %q, got %q", tt.script, tt.interpreter, interpreter)
+		}
+	}
+}
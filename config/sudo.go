@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SudoRules is the list of sudoers rules granted to a user (e.g.
+// "ALL=(ALL) NOPASSWD:ALL"). In YAML it can be given either as a single rule
+// or as a list of rules.
+type SudoRules []string
+
+var (
+	sudoUser = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*\$?$`)
+	sudoRule = regexp.MustCompile(`^` +
+		`!?[[:alnum:]_.-]+(\s*,\s*!?[[:alnum:]_.-]+)*` + // hosts
+		`\s*=\s*` +
+		`(\([^()\n]*\)\s*)?` + // run as
+		`((NO)?(PASSWD|EXEC|SETENV|LOG_INPUT|LOG_OUTPUT|MAIL|FOLLOW|INTERCEPT)\s*:\s*)*` + // tags
+		`[!/[:alpha:]][^\n]*$`) // commands
+)
+
+// SetYAML accepts either a single rule or a list of rules.
+func (s *SudoRules) SetYAML(tag string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		*s = SudoRules{v}
+	case []interface{}:
+		rules := make(SudoRules, 0, len(v))
+		for _, r := range v {
+			rule, ok := r.(string)
+			if !ok {
+				return false
+			}
+			rules = append(rules, rule)
+		}
+		*s = rules
+	default:
+		return false
+	}
+	return true
+}
+
+// CheckUser verifies that the given user name can be used in a sudoers rule
+// without quoting.
+func (s SudoRules) CheckUser(name string) error {
+	if !sudoUser.MatchString(name) {
+		return fmt.Errorf("invalid user name %q for sudo rules", name)
+	}
+	return nil
+}
+
+// CheckRule verifies that the given rule is a single, well-formed sudoers
+// user specification minus the user (i.e. "hosts = (runas) tags: commands").
+func (s SudoRules) CheckRule(rule string) error {
+	trimmed := strings.TrimSpace(rule)
+	if !sudoRule.MatchString(rule) || strings.ContainsAny(rule, "\r\n") ||
+		strings.HasSuffix(trimmed, `\`) || strings.HasSuffix(trimmed, ":") {
+		return fmt.Errorf("invalid sudo rule %q", rule)
+	}
+	return nil
+}
+
+// CheckRules verifies all of the rules.
+func (s SudoRules) CheckRules() error {
+	for _, rule := range s {
+		if err := s.CheckRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
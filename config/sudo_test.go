@@ -0,0 +1,89 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSudoRulesYAML(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+
+		rules SudoRules
+	}{
+		{
+			contents: "users:\n  - name: core\n",
+		},
+		{
+			contents: "users:\n  - name: core\n    sudo: ALL=(ALL) NOPASSWD:ALL\n",
+			rules:    SudoRules{"ALL=(ALL) NOPASSWD:ALL"},
+		},
+		{
+			contents: "users:\n  - name: core\n    sudo:\n      - ALL=(ALL) NOPASSWD:/usr/bin/systemctl\n      - ALL=(root) /usr/bin/journalctl\n",
+			rules:    SudoRules{"ALL=(ALL) NOPASSWD:/usr/bin/systemctl", "ALL=(root) /usr/bin/journalctl"},
+		},
+	} {
+		cfg, err := NewCloudConfig(tt.contents)
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", tt.contents, err)
+		}
+		if rules := cfg.Users[0].Sudo; !reflect.DeepEqual(tt.rules, rules) {
+			t.Errorf("bad sudo rules (%q): want %#v, got %#v", tt.contents, tt.rules, rules)
+		}
+	}
+}
+
+func TestSudoRulesCheckRule(t *testing.T) {
+	for _, tt := range []struct {
+		rule  string
+		valid bool
+	}{
+		{"ALL=(ALL) NOPASSWD:ALL", true},
+		{"ALL=(ALL:ALL) ALL", true},
+		{"ALL = (root) NOPASSWD: /usr/bin/systemctl restart docker, /usr/bin/journalctl", true},
+		{"host1, !host2=/bin/ls", true},
+		{"ALL=NOPASSWD:SETENV: ALL", true},
+		{"ALL", false},
+		{"ALL=(ALL", false},
+		{"ALL=(ALL) NOPASSWD:", false},
+		{"ALL=(ALL) ALL\ncore ALL=(ALL) ALL", false},
+		{"ALL=(ALL) ALL \\", false},
+		{"", false},
+	} {
+		if err := (SudoRules{}).CheckRule(tt.rule); tt.valid != (err == nil) {
+			t.Errorf("bad result (%q): want valid %t, got %v", tt.rule, tt.valid, err)
+		}
+	}
+}
+
+func TestSudoRulesCheckUser(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		valid bool
+	}{
+		{"core", true},
+		{"john.doe", true},
+		{"_svc-1", true},
+		{"", false},
+		{"ALL", false},
+		{"core ALL=(ALL) ALL\nevil", false},
+	} {
+		if err := (SudoRules{}).CheckUser(tt.name); tt.valid != (err == nil) {
+			t.Errorf("bad result (%q): want valid %t, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
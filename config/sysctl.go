@@ -0,0 +1,58 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Sysctl maps kernel parameters (e.g. net.ipv4.ip_forward) to their values.
+type Sysctl map[string]string
+
+var sysctlKey = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_./-]*$`)
+
+// CheckKey verifies that the given parameter name is safe to be written to a
+// sysctl.d file.
+func (s Sysctl) CheckKey(key string) error {
+	if !sysctlKey.MatchString(key) {
+		return fmt.Errorf("invalid sysctl parameter %q", key)
+	}
+	return nil
+}
+
+// Normalized returns the parameters with their names in the dotted form
+// (i.e. net/ipv4/ip_forward becomes net.ipv4.ip_forward). It is an error if
+// a parameter is invalid, its value spans multiple lines or it is set to
+// conflicting values.
+func (s Sysctl) Normalized() (map[string]string, error) {
+	params := map[string]string{}
+	for key, value := range s {
+		if err := s.CheckKey(key); err != nil {
+			return nil, err
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("value of sysctl parameter %q spans multiple lines", key)
+		}
+
+		name := strings.Replace(key, "/", ".", -1)
+		if v, ok := params[name]; ok && v != value {
+			return nil, fmt.Errorf("sysctl parameter %q is set to conflicting values %q and %q", name, v, value)
+		}
+		params[name] = value
+	}
+	return params, nil
+}
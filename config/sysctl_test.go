@@ -0,0 +1,68 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSysctlNormalized(t *testing.T) {
+	tests := []struct {
+		sysctl Sysctl
+
+		params map[string]string
+		err    bool
+	}{
+		{
+			sysctl: Sysctl{},
+			params: map[string]string{},
+		},
+		{
+			sysctl: Sysctl{"net.ipv4.ip_forward": "1", "vm/swappiness": "10"},
+			params: map[string]string{"net.ipv4.ip_forward": "1", "vm.swappiness": "10"},
+		},
+		{
+			sysctl: Sysctl{"net.ipv4.ip_forward": "1", "net/ipv4/ip_forward": "1"},
+			params: map[string]string{"net.ipv4.ip_forward": "1"},
+		},
+		{
+			sysctl: Sysctl{"net.ipv4.ip_forward": "1", "net/ipv4/ip_forward": "0"},
+			err:    true,
+		},
+		{
+			sysctl: Sysctl{"kernel.panic; reboot": "1"},
+			err:    true,
+		},
+		{
+			sysctl: Sysctl{"kernel.panic\nvm.swappiness": "1"},
+			err:    true,
+		},
+		{
+			sysctl: Sysctl{"kernel.panic": "1\nvm.swappiness = 100"},
+			err:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		params, err := tt.sysctl.Normalized()
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.sysctl, tt.err, err)
+		}
+		if !tt.err && !reflect.DeepEqual(tt.params, params) {
+			t.Errorf("bad parameters (%q): want %q, got %q", tt.sysctl, tt.params, params)
+		}
+	}
+}
@@ -14,17 +14,55 @@
 
 package config
 
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
 type Unit struct {
-	Name    string       `yaml:"name"`
-	Mask    bool         `yaml:"mask"`
-	Enable  bool         `yaml:"enable"`
-	Runtime bool         `yaml:"runtime"`
-	Content string       `yaml:"content"`
-	Command string       `yaml:"command" valid:"^(start|stop|restart|reload|try-restart|reload-or-restart|reload-or-try-restart)$"`
-	DropIns []UnitDropIn `yaml:"drop_ins"`
+	Name      string       `yaml:"name" valid:"^[^/]+\\.(service|socket|timer|mount|path|target|device|swap|automount|slice|scope|network|netdev|link)$"`
+	Mask      bool         `yaml:"mask"`
+	Enable    bool         `yaml:"enable"`
+	Runtime   bool         `yaml:"runtime"`
+	Content   string       `yaml:"content"`
+	Command   string       `yaml:"command" valid:"^(start|stop|restart|reload|try-restart|reload-or-restart|reload-or-try-restart)$"`
+	DropIns   []UnitDropIn `yaml:"drop_ins" merge:"name"`
+	Instances []string     `yaml:"instances"`
+	OnlyOn    []string     `yaml:"only_on"`
+	SkipOn    []string     `yaml:"skip_on"`
+}
+
+// AppliesTo reports whether the unit applies on the datasource of the given
+// type, according to its only_on and skip_on lists.
+func (u Unit) AppliesTo(datasource string) bool {
+	return AppliesTo(u.OnlyOn, u.SkipOn, datasource)
+}
+
+// IsTemplate returns whether the unit is a template unit (e.g. foo@.service)
+// from which instances can be created.
+func (u Unit) IsTemplate() bool {
+	ext := path.Ext(u.Name)
+	return ext != "" && strings.HasSuffix(strings.TrimSuffix(u.Name, ext), "@")
 }
 
 type UnitDropIn struct {
 	Name    string `yaml:"name"`
 	Content string `yaml:"content"`
 }
+
+// Check verifies that the name of the drop-in is a plain file name ending in
+// .conf, so that the drop-in is written to (and read by systemd from) the .d
+// directory of its unit. Drop-ins without a name are skipped, so they are not
+// rejected.
+func (d UnitDropIn) Check() error {
+	switch {
+	case d.Name == "":
+		return nil
+	case strings.Contains(d.Name, "/"):
+		return fmt.Errorf("drop-in name %q must not contain a path separator", d.Name)
+	case !strings.HasSuffix(d.Name, ".conf") || d.Name == ".conf":
+		return fmt.Errorf("drop-in name %q must end in .conf", d.Name)
+	}
+	return nil
+}
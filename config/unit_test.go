@@ -44,3 +44,47 @@ func TestCommandValid(t *testing.T) {
 		}
 	}
 }
+
+func TestIsTemplate(t *testing.T) {
+	tests := []struct {
+		value string
+
+		isTemplate bool
+	}{
+		{value: "foo@.service", isTemplate: true},
+		{value: "foo@.socket", isTemplate: true},
+		{value: "foo@bar.service", isTemplate: false},
+		{value: "foo.service", isTemplate: false},
+		{value: "foo@", isTemplate: false},
+	}
+
+	for _, tt := range tests {
+		if isTemplate := (Unit{Name: tt.value}).IsTemplate(); tt.isTemplate != isTemplate {
+			t.Errorf("bad template (%s): want %t, got %t", tt.value, tt.isTemplate, isTemplate)
+		}
+	}
+}
+
+func TestUnitDropInCheck(t *testing.T) {
+	tests := []struct {
+		name string
+
+		err bool
+	}{
+		{name: "50-opts.conf"},
+		{name: ""},
+		{name: "..conf"},
+		{name: "../escape.conf", err: true},
+		{name: "foo/50-opts.conf", err: true},
+		{name: "/etc/systemd/system/foo.conf", err: true},
+		{name: "50-opts", err: true},
+		{name: "50-opts.conf.bak", err: true},
+		{name: ".conf", err: true},
+	}
+
+	for _, tt := range tests {
+		if err := (UnitDropIn{Name: tt.name}).Check(); tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.name, tt.err, err)
+		}
+	}
+}
@@ -14,20 +14,50 @@
 
 package config
 
+import (
+	"fmt"
+	"regexp"
+)
+
 type User struct {
-	Name                 string   `yaml:"name"`
-	PasswordHash         string   `yaml:"passwd"`
-	SSHAuthorizedKeys    []string `yaml:"ssh_authorized_keys"`
-	SSHImportGithubUser  string   `yaml:"coreos_ssh_import_github"       deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
-	SSHImportGithubUsers []string `yaml:"coreos_ssh_import_github_users" deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
-	SSHImportURL         string   `yaml:"coreos_ssh_import_url"          deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
-	GECOS                string   `yaml:"gecos"`
-	Homedir              string   `yaml:"homedir"`
-	NoCreateHome         bool     `yaml:"no_create_home"`
-	PrimaryGroup         string   `yaml:"primary_group"`
-	Groups               []string `yaml:"groups"`
-	NoUserGroup          bool     `yaml:"no_user_group"`
-	System               bool     `yaml:"system"`
-	NoLogInit            bool     `yaml:"no_log_init"`
-	Shell                string   `yaml:"shell"`
+	Name                 string    `yaml:"name"`
+	PasswordHash         string    `yaml:"passwd"`
+	PlainTextPasswd      string    `yaml:"plain_text_passwd"`
+	LockPasswd           bool      `yaml:"lock_passwd"`
+	ExpireDate           string    `yaml:"expiredate"                     valid:"^[0-9]{4}-[0-9]{2}-[0-9]{2}$"`
+	Inactive             string    `yaml:"inactive"                       valid:"^-?[0-9]+$"`
+	SSHAuthorizedKeys    []string  `yaml:"ssh_authorized_keys"`
+	SSHKeysExclusive     bool      `yaml:"ssh_authorized_keys_exclusive"`
+	SSHImportGithubUser  string    `yaml:"coreos_ssh_import_github"       deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
+	SSHImportGithubUsers []string  `yaml:"coreos_ssh_import_github_users" deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
+	SSHImportURL         string    `yaml:"coreos_ssh_import_url"          deprecated:"trying to fetch from a remote endpoint introduces too many intermittent errors"`
+	SSHImportGithub      []string  `yaml:"ssh_import_github"`
+	SSHImportGitlab      []string  `yaml:"ssh_import_gitlab"`
+	GECOS                string    `yaml:"gecos"`
+	Homedir              string    `yaml:"homedir"`
+	NoCreateHome         bool      `yaml:"no_create_home"`
+	UID                  int       `yaml:"uid"                            valid:"^[1-9][0-9]*$"`
+	GID                  int       `yaml:"gid"                            valid:"^[1-9][0-9]*$"`
+	PrimaryGroup         string    `yaml:"primary_group"`
+	Groups               []string  `yaml:"groups"`
+	NoUserGroup          bool      `yaml:"no_user_group"`
+	System               bool      `yaml:"system"`
+	NoLogInit            bool      `yaml:"no_log_init"`
+	Shell                string    `yaml:"shell"`
+	Sudo                 SudoRules `yaml:"sudo"`
+}
+
+// passwordHash matches the hashes accepted by crypt(3) (both the modular
+// "$id$..." format and the traditional DES one), optionally prefixed by the
+// "!" or "*" markers of locked and disabled passwords.
+var passwordHash = regexp.MustCompile(`^[!*]*(\$[0-9a-z]+\$[^\s:]+|[./0-9A-Za-z]{13})?$`)
+
+// CheckPasswordHash verifies that the given value of passwd looks like a
+// password hash rather than a plaintext password, which belongs into
+// plain_text_passwd instead.
+func (u User) CheckPasswordHash(hash string) error {
+	if !passwordHash.MatchString(hash) {
+		return fmt.Errorf("passwd of user %q does not look like a password hash (use plain_text_passwd for a plaintext password)", u.Name)
+	}
+	return nil
 }
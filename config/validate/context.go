@@ -21,10 +21,15 @@ import (
 // context represents the current position within a newline-delimited string.
 // Each line is loaded, one by one, into currentLine (newline omitted) and
 // lineNumber keeps track of its position within the original string.
+// parentColumn is the (1-based) column of the key or array element whose
+// block is being searched, or zero at the top level; inElem is set if that
+// is an array element.
 type context struct {
 	currentLine    string
 	remainingLines string
 	lineNumber     int
+	parentColumn   int
+	inElem         bool
 }
 
 // Increment moves the context to the next line (if available).
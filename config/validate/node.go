@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 )
 
 var (
@@ -31,6 +33,10 @@ type node struct {
 	children []node
 	field    reflect.StructField
 	reflect.Value
+
+	// duplicates holds the repeated occurrences of the keys of a mapping,
+	// which the yaml library silently drops in favor of the last one.
+	duplicates []node
 }
 
 // Child attempts to find the child with the given name in the node's list of
@@ -51,6 +57,10 @@ func (n node) HumanType() string {
 	case reflect.Slice:
 		c := n.Type().Elem()
 		return "[]" + node{Value: reflect.New(c).Elem()}.HumanType()
+	case reflect.Map:
+		k := n.Type().Key()
+		e := n.Type().Elem()
+		return "map[" + node{Value: reflect.New(k).Elem()}.HumanType() + "]" + node{Value: reflect.New(e).Elem()}.HumanType()
 	default:
 		return k.String()
 	}
@@ -93,15 +103,19 @@ func toNode(v interface{}, c context, n *node) {
 			n.children = append(n.children, cn)
 		}
 	case reflect.Map:
-		// Walk over each key in the map and create a node for it.
-		v := v.(map[interface{}]interface{})
-		for k, cv := range v {
-			cn := node{name: fmt.Sprintf("%s", k)}
+		n.duplicates = findDuplicateKeys(c)
+
+		// Walk over each key in the map and create a node for it. The keys
+		// are sorted so that the report doesn't depend on the map's order.
+		keys := vv.MapKeys()
+		sort.Sort(byName(keys))
+		for _, k := range keys {
+			cn := node{name: fmt.Sprintf("%v", k.Interface())}
 			c, ok := findKey(cn.name, c)
 			if ok {
 				cn.line = c.lineNumber
 			}
-			toNode(cv, c, &cn)
+			toNode(vv.MapIndex(k).Interface(), c, &cn)
 			n.children = append(n.children, cn)
 		}
 	case reflect.Slice:
@@ -116,10 +130,13 @@ func toNode(v interface{}, c context, n *node) {
 			}
 			var ok bool
 			c, ok = findElem(c)
+			ec := c
 			if ok {
 				cn.line = c.lineNumber
+				ec.parentColumn = strings.Index(c.currentLine, "-") + 1
+				ec.inElem = true
 			}
-			toNode(vv.Index(i).Interface(), c, &cn)
+			toNode(vv.Index(i).Interface(), ec, &cn)
 			n.children = append(n.children, cn)
 			c.Increment()
 		}
@@ -129,29 +146,139 @@ func toNode(v interface{}, c context, n *node) {
 	}
 }
 
+type byName []reflect.Value
+
+func (s byName) Len() int { return len(s) }
+func (s byName) Less(i, j int) bool {
+	return fmt.Sprint(s[i].Interface()) < fmt.Sprint(s[j].Interface())
+}
+func (s byName) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
 // findKey attempts to find the requested key within the provided context.
 // A modified copy of the context is returned with every line up to the key
 // incremented past. A boolean, true if the key was found, is also returned.
+// The search is confined to the block of the context's parent and, since
+// the same key may also appear further down in nested blocks, the least
+// indented occurrence wins. The returned context is set up to search the
+// block of the key.
 func findKey(key string, context context) (context, bool) {
-	return find(yamlKey, key, context)
+	c, column, ok := find(yamlKey, key, context)
+	if ok {
+		c.parentColumn = column
+		c.inElem = false
+	}
+	return c, ok
+}
+
+// findDuplicateKeys returns a node (with only its name and line set) for each
+// key within the block of the context's parent which repeats a previous key
+// of the same mapping, i.e. at the same column.
+func findDuplicateKeys(c context) []node {
+	type key struct {
+		name   string
+		column int
+	}
+	var keys []key
+	var lines []int
+	minColumn := 0
+	for first := true; len(c.currentLine) > 0 || len(c.remainingLines) > 0; first = false {
+		if !first && endsBlock(c) {
+			break
+		}
+
+		trimmed := strings.TrimSpace(c.currentLine)
+		if m := yamlKey.FindStringSubmatchIndex(c.currentLine); m != nil && trimmed[0] != '#' {
+			column := m[2] + 1
+			if inBlock(c, column) {
+				keys = append(keys, key{strings.Trim(c.currentLine[m[2]:m[3]], `"'`), column})
+				lines = append(lines, c.lineNumber)
+				if minColumn == 0 || column < minColumn {
+					minColumn = column
+				}
+			}
+		}
+
+		c.Increment()
+	}
+
+	var duplicates []node
+	seen := map[string]bool{}
+	for i, k := range keys {
+		if k.column != minColumn {
+			continue
+		}
+		if seen[k.name] {
+			duplicates = append(duplicates, node{name: k.name, line: lines[i]})
+		}
+		seen[k.name] = true
+	}
+	return duplicates
 }
 
 // findElem attempts to find an array element within the provided context.
 // A modified copy of the context is returned with every line up to the array
 // element incremented past. A boolean, true if the key was found, is also
-// returned.
+// returned. As with findKey, the least indented element wins so that elements
+// of nested arrays are skipped.
 func findElem(context context) (context, bool) {
-	return find(yamlElem, "", context)
+	c, _, ok := find(yamlElem, "", context)
+	return c, ok
 }
 
-func find(exp *regexp.Regexp, key string, context context) (context, bool) {
-	for len(context.currentLine) > 0 || len(context.remainingLines) > 0 {
-		matches := exp.FindStringSubmatch(context.currentLine)
-		if len(matches) > 0 && (key == "" || matches[1] == key) {
-			return context, true
+// find returns the context at the least indented line within the block of
+// the context's parent which matches exp (and whose first submatch is key,
+// if given), along with the 1-based column of that match.
+func find(exp *regexp.Regexp, key string, c context) (context, int, bool) {
+	var best context
+	var bestColumn int
+	for first := true; len(c.currentLine) > 0 || len(c.remainingLines) > 0; first = false {
+		if !first && endsBlock(c) {
+			break
+		}
+
+		if m := exp.FindStringSubmatchIndex(c.currentLine); m != nil {
+			column := m[1]
+			if len(m) > 2 {
+				column = m[2] + 1
+			}
+			if (key == "" || c.currentLine[m[2]:m[3]] == key) &&
+				inBlock(c, column) &&
+				(bestColumn == 0 || column < bestColumn) {
+				best = c
+				bestColumn = column
+			}
 		}
 
-		context.Increment()
+		c.Increment()
+	}
+	if bestColumn == 0 {
+		return context{}, 0, false
+	}
+	return best, bestColumn, true
+}
+
+// inBlock reports whether a key or array element at the given column is
+// within the block of the context's parent. Arrays may be indented at the
+// same level as the key they belong to.
+func inBlock(c context, column int) bool {
+	if c.inElem || strings.TrimSpace(c.currentLine)[0] != '-' {
+		return column > c.parentColumn
+	}
+	return column >= c.parentColumn
+}
+
+// endsBlock reports whether the current line of the context is outside of
+// the block of the context's parent (i.e. it is indented no further than the
+// parent). Blank lines and comments never end a block.
+func endsBlock(c context) bool {
+	trimmed := strings.TrimSpace(c.currentLine)
+	if c.parentColumn == 0 || trimmed == "" || trimmed[0] == '#' {
+		return false
+	}
+
+	column := len(c.currentLine) - len(strings.TrimLeft(c.currentLine, " ")) + 1
+	if c.inElem || trimmed[0] != '-' {
+		return column <= c.parentColumn
 	}
-	return context, false
+	return column < c.parentColumn
 }
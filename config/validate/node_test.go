@@ -81,6 +81,10 @@ func TestHumanType(t *testing.T) {
 				}},
 			humanType: "[]int",
 		},
+		{
+			node:      node{Value: reflect.ValueOf(map[string]string{"hello": "world"})},
+			humanType: "map[string]string",
+		},
 	}
 
 	for _, tt := range tests {
@@ -268,6 +272,33 @@ func TestFindElem(t *testing.T) {
 	}
 }
 
+func TestFindDuplicateKeys(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+
+		duplicates []node
+	}{
+		{config: "a: 1\nb: 2"},
+		{config: "a:\n  b: 1\nc:\n  b: 2"},
+		{config: "# a: 1\na: 2"},
+		{
+			config:     "a: 1\nb: 2\n\"a\": 3",
+			duplicates: []node{{name: "a", line: 3}},
+		},
+		{config: "a:\n  - b: 1\n    b: 2\n  - b: 3"},
+	} {
+		c := NewContext([]byte(tt.config))
+		if duplicates := findDuplicateKeys(c); !reflect.DeepEqual(tt.duplicates, duplicates) {
+			t.Errorf("bad duplicates (%q): want %#v, got %#v", tt.config, tt.duplicates, duplicates)
+		}
+	}
+
+	n := NewNode(map[interface{}]interface{}{"a": map[interface{}]interface{}{"b": 2}}, NewContext([]byte("a:\n  b: 1\n  c: 3\n  b: 2")))
+	if want := []node{{name: "b", line: 4}}; !reflect.DeepEqual(want, n.Child("a").duplicates) {
+		t.Errorf("bad duplicates of child: want %#v, got %#v", want, n.Child("a").duplicates)
+	}
+}
+
 func nodesEqual(a, b node) bool {
 	if a.name != b.name ||
 		a.line != b.line ||
@@ -53,9 +53,28 @@ type Entry struct {
 
 // String returns a human-readable representation of the entry.
 func (e Entry) String() string {
+	if e.line == 0 {
+		return fmt.Sprintf("%s: %s", e.kind, e.message)
+	}
 	return fmt.Sprintf("line %d: %s: %s", e.line, e.kind, e.message)
 }
 
+// Line returns the line of the userdata the entry refers to, or 0 if it
+// doesn't refer to any line.
+func (e Entry) Line() int {
+	return e.line
+}
+
+// IsError reports whether the entry is an error.
+func (e Entry) IsError() bool {
+	return e.kind == entryError
+}
+
+// IsWarning reports whether the entry is a warning.
+func (e Entry) IsWarning() bool {
+	return e.kind == entryWarning
+}
+
 // MarshalJSON satisfies the json.Marshaler interface, returning the entry
 // encoded as a JSON object.
 func (e Entry) MarshalJSON() ([]byte, error) {
@@ -22,20 +22,102 @@ import (
 	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
+
+	"github.com/coreos/yaml"
 )
 
 type rule func(config node, report *Report)
 
 // Rules contains all of the validation rules.
 var Rules []rule = []rule{
+	checkCACerts,
+	checkDirectories,
+	checkDisks,
 	checkDiscoveryUrl,
 	checkEncoding,
+	checkEtcHosts,
+	checkGroups,
+	checkLocksmith,
+	checkModules,
+	checkNTPServers,
+	checkPackages,
+	checkPasswords,
+	checkCommands,
 	checkStructure,
+	checkSudo,
+	checkSysctl,
+	checkUnitCommand,
+	checkUnitDropIns,
+	checkUnitDropInNames,
+	checkUnitInstances,
 	checkValidity,
 	checkWriteFiles,
 	checkWriteFilesUnderCoreos,
 }
 
+// checkCACerts verifies that each trusted CA certificate can be parsed.
+// Certificates which can't are skipped, so this is only a warning.
+func checkCACerts(cfg node, report *Report) {
+	for _, c := range cfg.Child("ca_certs").Child("trusted").children {
+		if err := (config.CACerts{}).CheckCertificate(c.String()); err != nil {
+			report.Warning(c.line, fmt.Sprintf("trusted CA certificate cannot be parsed: %v", err))
+		}
+	}
+}
+
+// checkDirectories verifies that each directory has a path like the files in
+// 'write_files'.
+func checkDirectories(cfg node, report *Report) {
+	for _, d := range cfg.Child("directories").children {
+		c := d.Child("path")
+		if !c.IsValid() || c.Kind() != reflect.String {
+			report.Error(d.line, "missing path in directories")
+			continue
+		}
+
+		if err := (config.Directory{Path: c.String()}).CheckPath(); err != nil {
+			report.Error(c.line, err.Error())
+		} else if strings.HasPrefix(c.String(), "/usr") {
+			report.Error(c.line, "directory cannot be created on a read-only filesystem")
+		}
+	}
+}
+
+// checkDisks verifies that the disks of disk_setup and the filesystems of
+// fs_setup are given by the paths of their devices and that the partitions
+// fit onto the disks.
+func checkDisks(cfg node, report *Report) {
+	for _, d := range cfg.Child("disk_setup").children {
+		var disk config.Disk
+		if t := d.Child("table_type"); t.IsValid() && t.Kind() == reflect.String && t.String() == "gpt" {
+			disk.TableType = "gpt"
+		}
+		for _, p := range d.Child("layout").children {
+			size := p
+			if p.Kind() == reflect.Slice && len(p.children) > 0 {
+				size = p.children[0]
+			}
+			if size.Kind() != reflect.Int {
+				report.Error(p.line, "a partition must be given as its size in percent or as a list of its size and type")
+				continue
+			}
+			disk.Layout = append(disk.Layout, config.Partition{Size: int(size.Int())})
+		}
+		if err := disk.Check(d.name); err != nil {
+			report.Error(d.line, err.Error())
+		}
+	}
+	for _, f := range cfg.Child("fs_setup").children {
+		if d := f.Child("device"); d.IsValid() {
+			if !strings.HasPrefix(path.Clean(d.String()), "/dev/") {
+				report.Error(d.line, fmt.Sprintf("invalid device %q for fs_setup", d.String()))
+			}
+		} else {
+			report.Error(f.line, "no device given for filesystem")
+		}
+	}
+}
+
 // checkDiscoveryUrl verifies that the string is a valid url.
 func checkDiscoveryUrl(cfg node, report *Report) {
 	c := cfg.Child("coreos").Child("etcd").Child("discovery")
@@ -64,6 +146,254 @@ func checkEncoding(cfg node, report *Report) {
 	}
 }
 
+// checkEtcHosts verifies that each static /etc/hosts entry has a valid IP
+// address and at least one valid hostname.
+func checkEtcHosts(cfg node, report *Report) {
+	for _, e := range cfg.Child("etc_hosts").children {
+		ip := e.Child("ip")
+		if ip.IsValid() && ip.Kind() == reflect.String {
+			if err := (config.EtcHostsEntry{IP: ip.String()}).CheckIP(); err != nil {
+				report.Error(ip.line, err.Error())
+			}
+		} else {
+			report.Error(e.line, "missing IP address in etc_hosts")
+		}
+
+		hostnames := e.Child("hostnames")
+		if !hostnames.IsValid() || len(hostnames.children) == 0 {
+			report.Error(e.line, "missing hostnames in etc_hosts")
+		}
+		for _, h := range hostnames.children {
+			if h.Kind() != reflect.String {
+				continue
+			}
+			if err := (config.EtcHostsEntry{}).CheckHostname(h.String()); err != nil {
+				report.Error(h.line, err.Error())
+			}
+		}
+	}
+}
+
+// checkLocksmith verifies that the reboot window is given by both its start
+// and its length and that both can be parsed by locksmithd.
+func checkLocksmith(cfg node, report *Report) {
+	c := cfg.Child("coreos")
+	ls := c.Child("locksmith")
+	start := ls.Child("window_start")
+	length := ls.Child("window_length")
+
+	if start.IsValid() && start.Kind() == reflect.String {
+		if err := (config.Locksmith{RebootWindowStart: start.String()}).CheckWindowStart(); err != nil {
+			report.Error(start.line, err.Error())
+		}
+		if !length.IsValid() {
+			report.Error(start.line, "window_start requires window_length")
+		}
+	}
+	if length.IsValid() && length.Kind() == reflect.String {
+		if err := (config.Locksmith{RebootWindowLength: length.String()}).CheckWindowLength(); err != nil {
+			report.Error(length.line, err.Error())
+		}
+		if !start.IsValid() {
+			report.Error(length.line, "window_length requires window_start")
+		}
+	}
+
+	if strategy := c.Child("update").Child("reboot_strategy"); (start.IsValid() || length.IsValid()) &&
+		strategy.IsValid() && strategy.Kind() == reflect.String && strategy.String() == "off" {
+		report.Warning(ls.line, "the reboot window has no effect with reboot_strategy off")
+	}
+}
+
+// checkGroups verifies that each group is given either by its name or as a map
+// from its name to its members and that all of the names are valid.
+func checkGroups(cfg node, report *Report) {
+	for _, g := range cfg.Child("groups").children {
+		switch g.Kind() {
+		case reflect.String:
+			checkGroupName(g, report)
+		case reflect.Map:
+			if len(g.children) != 1 {
+				report.Error(g.line, "a group must be given by its name or as a map from its name to its members")
+				continue
+			}
+			m := g.children[0]
+			if err := (config.Group{}).CheckName(m.name); err != nil {
+				report.Error(m.line, fmt.Sprintf("%v for group", err))
+			}
+			switch m.Kind() {
+			case reflect.Invalid:
+			case reflect.String:
+				checkGroupMember(m, m.name, report)
+			case reflect.Slice:
+				for _, u := range m.children {
+					checkGroupMember(u, m.name, report)
+				}
+			default:
+				report.Error(m.line, fmt.Sprintf("members of group %q must be a name or a list of names", m.name))
+			}
+		default:
+			report.Error(g.line, "a group must be given by its name or as a map from its name to its members")
+		}
+	}
+}
+
+func checkGroupName(n node, report *Report) {
+	if err := (config.Group{}).CheckName(n.String()); err != nil {
+		report.Error(n.line, fmt.Sprintf("%v for group", err))
+	}
+}
+
+func checkGroupMember(n node, group string, report *Report) {
+	if n.Kind() != reflect.String {
+		report.Error(n.line, fmt.Sprintf("members of group %q must be a name or a list of names", group))
+	} else if err := (config.Group{}).CheckName(n.String()); err != nil {
+		report.Error(n.line, fmt.Sprintf("%v for member of group %q", err, group))
+	}
+}
+
+// checkModules verifies that each kernel module has a valid name and options.
+func checkModules(cfg node, report *Report) {
+	for _, m := range cfg.Child("modules").children {
+		var module config.Module
+		if n := m.Child("name"); n.IsValid() {
+			module.Name = n.String()
+		}
+		if o := m.Child("options"); o.IsValid() {
+			module.Options = o.String()
+		}
+		if err := module.Check(); err != nil {
+			report.Error(m.line, err.Error())
+		}
+	}
+}
+
+// checkNTPServers verifies that each NTP server is a hostname or an IP
+// address.
+func checkNTPServers(cfg node, report *Report) {
+	n := cfg.Child("ntp")
+	for _, servers := range []node{n.Child("servers"), n.Child("fallback_servers")} {
+		for _, s := range servers.children {
+			if err := (config.NTP{}).CheckServer(s.String()); err != nil {
+				report.Error(s.line, err.Error())
+			}
+		}
+	}
+}
+
+// checkPackages verifies that each package name can be passed to rpm-ostree.
+func checkPackages(cfg node, report *Report) {
+	for _, p := range cfg.Child("packages").children {
+		if err := (config.Packages{}).CheckName(p.String()); err != nil {
+			report.Error(p.line, err.Error())
+		}
+	}
+}
+
+// checkPasswords verifies that passwd holds a password hash and warns about
+// plain_text_passwd being ignored if both are given.
+func checkPasswords(cfg node, report *Report) {
+	for _, u := range cfg.Child("users").children {
+		user := config.User{}
+		if name := u.Child("name"); name.IsValid() && name.Kind() == reflect.String {
+			user.Name = name.String()
+		}
+
+		hash := u.Child("passwd")
+		if !hash.IsValid() || hash.Kind() != reflect.String {
+			continue
+		}
+		if err := user.CheckPasswordHash(hash.String()); err != nil {
+			report.Warning(hash.line, err.Error())
+		}
+		if plain := u.Child("plain_text_passwd"); plain.IsValid() {
+			report.Warning(plain.line, fmt.Sprintf("plain_text_passwd of user %q is ignored since passwd is set", user.Name))
+		}
+	}
+}
+
+// checkSudo verifies that the sudo rules of each user are well-formed and
+// that the user name can be used in a sudoers file.
+func checkSudo(cfg node, report *Report) {
+	for _, u := range cfg.Child("users").children {
+		s := u.Child("sudo")
+		if !s.IsValid() {
+			continue
+		}
+
+		name := u.Child("name")
+		if name.IsValid() && name.Kind() == reflect.String {
+			if err := (config.SudoRules{}).CheckUser(name.String()); err != nil {
+				report.Error(name.line, err.Error())
+			}
+		}
+
+		rules := s.children
+		if s.Kind() == reflect.String {
+			rules = []node{s}
+		}
+		for _, r := range rules {
+			if r.Kind() != reflect.String {
+				continue
+			}
+			if err := (config.SudoRules{}).CheckRule(r.String()); err != nil {
+				report.Error(r.line, fmt.Sprintf("%v for user %q", err, name.String()))
+			}
+		}
+	}
+}
+
+// checkCommands verifies that each command of bootcmd and runcmd is given as
+// a string, a list of arguments or a map holding either form as "command".
+func checkCommands(cfg node, report *Report) {
+	for _, cmds := range []node{cfg.Child("bootcmd"), cfg.Child("runcmd")} {
+		for _, c := range cmds.children {
+			if c.Kind() != reflect.Map {
+				checkCommand(c, report)
+				continue
+			}
+			command := false
+			for _, k := range c.children {
+				switch k.name {
+				case "command":
+					command = true
+					checkCommand(k, report)
+				case "ignore_errors":
+					if k.Kind() != reflect.Bool {
+						report.Error(k.line, "ignore_errors of a command must be a boolean")
+					}
+				default:
+					report.Error(k.line, fmt.Sprintf("unrecognized key %q for command", k.name))
+				}
+			}
+			if !command {
+				report.Error(c.line, "a command must be given as a string, a list of arguments or a map with a command")
+			}
+		}
+	}
+}
+
+func checkCommand(n node, report *Report) {
+	switch n.Kind() {
+	case reflect.String:
+		if n.String() != "" {
+			return
+		}
+	case reflect.Slice:
+		if len(n.children) == 0 {
+			break
+		}
+		for _, a := range n.children {
+			if !isCompatible(a.Kind(), reflect.String) {
+				report.Error(n.line, "arguments of a command must be strings")
+				break
+			}
+		}
+		return
+	}
+	report.Error(n.line, "a command must be given as a string, a list of arguments or a map with a command")
+}
+
 // checkStructure compares the provided config to the empty config.CloudConfig
 // structure. Each node is checked to make sure that it exists in the known
 // structure and that its type is compatible.
@@ -73,13 +403,17 @@ func checkStructure(cfg node, report *Report) {
 }
 
 func checkNodeStructure(n, g node, r *Report) {
-	if !isCompatible(n.Kind(), g.Kind()) {
+	if !isCompatible(n.Kind(), g.Kind()) && !(isSetter(g) && (isCompatible(n.Kind(), reflect.String) || n.Kind() == reflect.Slice)) {
 		r.Warning(n.line, fmt.Sprintf("incorrect type for %q (want %s)", n.name, g.HumanType()))
 		return
 	}
 
 	switch g.Kind() {
 	case reflect.Struct:
+		if isSetter(g) {
+			// The keys don't map onto the fields of the struct.
+			return
+		}
 		for _, cn := range n.children {
 			if cg := g.Child(cn.name); cg.IsValid() {
 				if msg := cg.field.Tag.Get("deprecated"); msg != "" {
@@ -90,7 +424,11 @@ func checkNodeStructure(n, g node, r *Report) {
 				r.Warning(cn.line, fmt.Sprintf("unrecognized key %q", cn.name))
 			}
 		}
-	case reflect.Slice:
+	case reflect.Slice, reflect.Map:
+		if isSetter(g) {
+			// The elements don't map onto the element type.
+			return
+		}
 		for _, cn := range n.children {
 			var cg node
 			c := g.Type().Elem()
@@ -103,6 +441,13 @@ func checkNodeStructure(n, g node, r *Report) {
 	}
 }
 
+// isSetter determines if the type of the node does its own unmarshalling, in
+// which case a scalar or a list is accepted as well (e.g. a single sudo rule
+// in place of a list, or the arguments of a command in place of a map).
+func isSetter(g node) bool {
+	return reflect.PtrTo(g.Type()).Implements(reflect.TypeOf((*yaml.Setter)(nil)).Elem())
+}
+
 // isCompatible determines if the type of kind n can be converted to the type
 // of kind g in the context of YAML. This is not an exhaustive list, but its
 // enough for the purposes of cloud-config validation.
@@ -114,13 +459,116 @@ func isCompatible(n, g reflect.Kind) bool {
 		return n == reflect.Struct || n == reflect.Map
 	case reflect.Float64:
 		return n == reflect.Float64 || n == reflect.Int
-	case reflect.Bool, reflect.Slice, reflect.Int:
+	case reflect.Bool, reflect.Slice, reflect.Int, reflect.Map:
 		return n == g
 	default:
 		panic(fmt.Sprintf("isCompatible(): unhandled kind %s", g))
 	}
 }
 
+// checkSysctl verifies that each sysctl parameter is safe to be written to a
+// sysctl.d file, that its value is a single line and that it is only set once.
+func checkSysctl(cfg node, report *Report) {
+	sysctl := cfg.Child("sysctl")
+	for _, d := range sysctl.duplicates {
+		report.Error(d.line, fmt.Sprintf("sysctl parameter %q is set more than once", d.name))
+	}
+	for _, p := range sysctl.children {
+		if err := (config.Sysctl{}).CheckKey(p.name); err != nil {
+			report.Error(p.line, err.Error())
+		} else if p.IsValid() && strings.ContainsAny(fmt.Sprint(p.Value.Interface()), "\r\n") {
+			report.Error(p.line, fmt.Sprintf("value of sysctl parameter %q spans multiple lines", p.name))
+		}
+	}
+}
+
+// checkUnitCommand verifies that masked units are not reloaded, since there
+// is nothing left to reload.
+func checkUnitCommand(cfg node, report *Report) {
+	for _, u := range cfg.Child("coreos").Child("units").children {
+		c := u.Child("command")
+		if !c.IsValid() || c.String() != "reload" {
+			continue
+		}
+
+		if isSet(u.Child("mask")) {
+			report.Error(c.line, fmt.Sprintf("unit %q cannot be reloaded because it is masked", u.Child("name").String()))
+		}
+	}
+}
+
+// checkUnitDropIns verifies that units which only consist of drop-ins (i.e.
+// have no content, command, mask, enable or instances) have at least one
+// drop-in which can be written.
+func checkUnitDropIns(cfg node, report *Report) {
+	for _, u := range cfg.Child("coreos").Child("units").children {
+		d := u.Child("drop_ins")
+		if !d.IsValid() {
+			continue
+		}
+
+		if isSet(u.Child("content")) || isSet(u.Child("command")) || isSet(u.Child("mask")) || isSet(u.Child("enable")) || isSet(u.Child("instances")) {
+			continue
+		}
+
+		valid := false
+		for _, c := range d.children {
+			if isSet(c.Child("name")) && isSet(c.Child("content")) {
+				valid = true
+			}
+		}
+		if !valid {
+			report.Error(d.line, fmt.Sprintf("unit %q has no content or command and needs at least one drop-in with a name and content", u.Child("name").String()))
+		}
+	}
+}
+
+// checkUnitDropInNames verifies that the drop-ins of the units are named like
+// files in the .d directory of the unit (see config.UnitDropIn.Check).
+func checkUnitDropInNames(cfg node, report *Report) {
+	for _, u := range cfg.Child("coreos").Child("units").children {
+		for _, d := range u.Child("drop_ins").children {
+			n := d.Child("name")
+			if !isSet(n) {
+				continue
+			}
+			if err := (config.UnitDropIn{Name: n.String()}).Check(); err != nil {
+				report.Error(n.line, err.Error())
+			}
+		}
+	}
+}
+
+// isSet returns whether the node is present and has a non-zero value.
+func isSet(n node) bool {
+	if !n.IsValid() {
+		return false
+	}
+	switch n.Kind() {
+	case reflect.Slice, reflect.Map:
+		return len(n.children) > 0
+	case reflect.Bool:
+		return n.Value.Bool()
+	default:
+		return fmt.Sprint(n.Value.Interface()) != ""
+	}
+}
+
+// checkUnitInstances verifies that instances are only listed for template
+// units (e.g. foo@.service).
+func checkUnitInstances(cfg node, report *Report) {
+	for _, u := range cfg.Child("coreos").Child("units").children {
+		i := u.Child("instances")
+		if !i.IsValid() || len(i.children) == 0 {
+			continue
+		}
+
+		if n := u.Child("name"); !(config.Unit{Name: n.String()}).IsTemplate() {
+			report.Error(i.line, fmt.Sprintf("instances can only be set on template units (i.e. foo@.service), not %q", n.String()))
+		}
+	}
+}
+
 // checkValidity checks the value of every node in the provided config by
 // running config.AssertValid() on it.
 func checkValidity(cfg node, report *Report) {
@@ -134,12 +582,19 @@ func checkNodeValidity(n, g node, r *Report) {
 	}
 	switch g.Kind() {
 	case reflect.Struct:
+		if isSetter(g) {
+			// The keys don't map onto the fields of the struct.
+			return
+		}
 		for _, cn := range n.children {
 			if cg := g.Child(cn.name); cg.IsValid() {
 				checkNodeValidity(cn, cg, r)
 			}
 		}
-	case reflect.Slice:
+	case reflect.Slice, reflect.Map:
+		if isSetter(g) {
+			return
+		}
 		for _, cn := range n.children {
 			var cg node
 			c := g.Type().Elem()
@@ -153,8 +608,8 @@ func checkNodeValidity(n, g node, r *Report) {
 }
 
 // checkWriteFiles checks to make sure that the target file can actually be
-// written. Note that this check is approximate (it only checks to see if the file
-// is under /usr).
+// written. Note that this check is approximate (it only checks to see if the
+// path is absolute, stays within the root and isn't under /usr).
 func checkWriteFiles(cfg node, report *Report) {
 	for _, f := range cfg.Child("write_files").children {
 		c := f.Child("path")
@@ -162,6 +617,11 @@ func checkWriteFiles(cfg node, report *Report) {
 			continue
 		}
 
+		if err := (config.File{Path: c.String()}).CheckPath(); err != nil {
+			report.Error(c.line, err.Error())
+			continue
+		}
+
 		d := path.Dir(c.String())
 		switch {
 		case strings.HasPrefix(d, "/usr"):
@@ -19,6 +19,74 @@ import (
 	"testing"
 )
 
+func TestCheckCACerts(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "ca_certs:\n  remove_defaults: true",
+		},
+		{
+			config:  "ca_certs:\n  trusted:\n    - not a certificate",
+			entries: []Entry{{entryWarning, "trusted CA certificate cannot be parsed: no PEM encoded certificate found", 3}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkCACerts(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckDirectories(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "directories:\n  - path: /var/lib/myapp\n    owner: myapp\n    permissions: \"0700\"",
+		},
+		{
+			config:  "directories:\n  - owner: myapp",
+			entries: []Entry{{entryError, "missing path in directories", 2}},
+		},
+		{
+			config:  "directories:\n  - path: var/lib/myapp",
+			entries: []Entry{{entryError, "path \"var/lib/myapp\" is not absolute", 2}},
+		},
+		{
+			config:  "directories:\n  - path: /usr/share/myapp",
+			entries: []Entry{{entryError, "directory cannot be created on a read-only filesystem", 2}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkDirectories(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
 func TestCheckDiscoveryUrl(t *testing.T) {
 	tests := []struct {
 		config string
@@ -98,6 +166,104 @@ func TestCheckEncoding(t *testing.T) {
 	}
 }
 
+func TestCheckModules(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "modules:\n  - name: overlay\n  - name: bonding\n    options: mode=4",
+		},
+		{
+			config:  "modules:\n  - name: overlay\n  - options: mode=4",
+			entries: []Entry{{entryError, "invalid module name \"\"", 3}},
+		},
+		{
+			config:  "modules:\n  - name: bad/name",
+			entries: []Entry{{entryError, "invalid module name \"bad/name\"", 2}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkModules(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckNTPServers(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "ntp:\n  servers: [ntp.example.com, 10.0.0.1]\n  fallback_servers: [0.pool.ntp.org]",
+		},
+		{
+			config:  "ntp:\n  servers:\n    - ntp.example.com\n    - not_valid",
+			entries: []Entry{{entryError, "NTP server \"not_valid\" is neither a hostname nor an IP address", 4}},
+		},
+		{
+			config:  "ntp:\n  fallback_servers:\n    - ntp.example.com:123",
+			entries: []Entry{{entryError, "NTP server \"ntp.example.com:123\" is neither a hostname nor an IP address", 3}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkNTPServers(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckPackages(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "packages: [htop, python3-libselinux, gcc-c++]",
+		},
+		{
+			config:  "packages:\n  - htop\n  - \"vim; reboot\"",
+			entries: []Entry{{entryError, "invalid package name \"vim; reboot\"", 3}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkPackages(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
 func TestCheckStructure(t *testing.T) {
 	tests := []struct {
 		config string
@@ -118,6 +284,34 @@ func TestCheckStructure(t *testing.T) {
 		{
 			config: "coreos:\n  etcd:\n    discovery: good",
 		},
+		{
+			config:  "coreos:\n  etcd2:\n    name: node1\n  name: node1",
+			entries: []Entry{{entryWarning, "unrecognized key \"name\"", 4}},
+		},
+		{
+			config:  "write_files:\n- path: /a\n  bad: 1\nhostname: foo",
+			entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 3}},
+		},
+		{
+			config:  "write_files:\n- path: /a\n  permissions: \"0644\"\nbad: 2",
+			entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 4}},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: a.service\n      content: |\n        bad: 1\n      bad: 2",
+			entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 6}},
+		},
+		{
+			config:  "users:\n  - name: a\n    groups:\n      - x\n  - name: b\n    bad: 1",
+			entries: []Entry{{entryWarning, "unrecognized key \"bad\"", 6}},
+		},
+
+		{
+			config: "coreos:\n  flannel:\n    network: 10.1.0.0/16\n    backend:\n      type: vxlan\n      vni: 1",
+		},
+		{
+			config:  "coreos:\n  flannel:\n    backend:\n      kind: vxlan",
+			entries: []Entry{{entryWarning, "unrecognized key \"kind\"", 4}},
+		},
 
 		// Test for deprecated keys
 		{
@@ -127,6 +321,13 @@ func TestCheckStructure(t *testing.T) {
 			config:  "coreos:\n  etcd:\n    proxy: hi",
 			entries: []Entry{{entryWarning, "deprecated key \"proxy\" (etcd2 options no longer work for etcd)", 3}},
 		},
+		{
+			config: "coreos:\n  etcd3:\n    log_level: debug",
+		},
+		{
+			config:  "coreos:\n  etcd3:\n    ca_file: /etc/ssl/ca.crt",
+			entries: []Entry{{entryWarning, "deprecated key \"ca_file\" (ca_file obsoleted by trusted_ca_file and client_cert_auth)", 3}},
+		},
 
 		// Test for error on list of nodes
 		{
@@ -213,6 +414,18 @@ func TestCheckStructure(t *testing.T) {
 			config:  "ssh_authorized_keys:\n  key: value",
 			entries: []Entry{{entryWarning, "incorrect type for \"ssh_authorized_keys\" (want []string)", 1}},
 		},
+		// Want map[string]string
+		{
+			config: "substitutions:\n  registry: registry.example.com",
+		},
+		{
+			config:  "substitutions: registry",
+			entries: []Entry{{entryWarning, "incorrect type for \"substitutions\" (want map[string]string)", 1}},
+		},
+		{
+			config:  "substitutions:\n  registry:\n    - registry.example.com",
+			entries: []Entry{{entryWarning, "incorrect type for \"registry\" (want string)", 2}},
+		},
 		{
 			config: "ssh_authorized_keys:\n  - key",
 		},
@@ -257,6 +470,22 @@ func TestCheckStructure(t *testing.T) {
 			config:  "users:\n  - bad",
 			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2}},
 		},
+		{
+			config: "users:\n  - name: core\n    sudo: ALL=(ALL) NOPASSWD:ALL",
+		},
+		{
+			config: "groups:\n  - cloud-users\n  - admins: [root, core]",
+		},
+		{
+			config: "runcmd:\n  - echo hello\n  - [systemctl, restart, sshd.service]\n  - command: \"false\"\n    ignore_errors: true",
+		},
+		{
+			config: "disk_setup:\n  /dev/sdb:\n    table_type: gpt\n    layout: true\n  /dev/sdc:\n    layout: [50, [50, 82]]\nfs_setup:\n  - device: /dev/sdb1\n    filesystem: ext4",
+		},
+		{
+			config:  "users:\n  - name: core\n    sudo: {a: b}",
+			entries: []Entry{{entryWarning, "incorrect type for \"sudo\" (want []string)", 3}},
+		},
 		{
 			config:  "users:\n  - - bad",
 			entries: []Entry{{entryWarning, "incorrect type for \"users[0]\" (want struct)", 2}},
@@ -277,48 +506,123 @@ func TestCheckStructure(t *testing.T) {
 	}
 }
 
-func TestCheckValidity(t *testing.T) {
+func TestCheckEtcHosts(t *testing.T) {
 	tests := []struct {
 		config string
 
 		entries []Entry
 	}{
-		// string
+		{},
 		{
-			config: "hostname: test",
+			config: "etc_hosts:\n  - ip: 10.0.0.5\n    hostnames: [registry.internal, registry]\n  - ip: fd00::1\n    hostnames: [gateway]",
 		},
-
-		// int
 		{
-			config: "coreos:\n  fleet:\n    verbosity: 2",
+			config:  "etc_hosts:\n  - ip: 10.0.0.256\n    hostnames: [registry]",
+			entries: []Entry{{entryError, "invalid IP address \"10.0.0.256\" in etc_hosts", 2}},
 		},
-
-		// bool
 		{
-			config: "coreos:\n  units:\n    - enable: true",
+			config:  "etc_hosts:\n  - ip: 10.0.0.5\n    hostnames:\n      - registry\n      - -registry",
+			entries: []Entry{{entryError, "invalid hostname \"-registry\" in etc_hosts", 5}},
 		},
-
-		// slice
 		{
-			config: "coreos:\n  units:\n    - command: start\n    - name: stop",
+			config:  "etc_hosts:\n  - ip: 10.0.0.5",
+			entries: []Entry{{entryError, "missing hostnames in etc_hosts", 2}},
 		},
 		{
-			config:  "coreos:\n  units:\n    - command: lol",
-			entries: []Entry{{entryError, "invalid value lol", 3}},
+			config:  "etc_hosts:\n  - hostnames: [registry]",
+			entries: []Entry{{entryError, "missing IP address in etc_hosts", 2}},
 		},
+	}
 
-		// struct
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkEtcHosts(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckGroups(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
 		{
-			config: "coreos:\n  update:\n    reboot_strategy: off",
+			config: "groups:\n  - cloud-users\n  - admins: [root, core]\n  - docker: core\n  - empty:",
 		},
 		{
-			config:  "coreos:\n  update:\n    reboot_strategy: always",
-			entries: []Entry{{entryError, "invalid value always", 3}},
+			config:  "groups:\n  - Cloud Users",
+			entries: []Entry{{entryError, "invalid name \"Cloud Users\" for group", 2}},
+		},
+		{
+			config:  "groups:\n  - admins:\n      - root\n      - Core",
+			entries: []Entry{{entryError, "invalid name \"Core\" for member of group \"admins\"", 4}},
+		},
+		{
+			config:  "groups:\n  - admins:\n      members: [root]",
+			entries: []Entry{{entryError, "members of group \"admins\" must be a name or a list of names", 2}},
+		},
+		{
+			config:  "groups:\n  - admins: [root]\n    docker: [core]",
+			entries: []Entry{{entryError, "a group must be given by its name or as a map from its name to its members", 2}},
+		},
+		{
+			config:  "groups:\n  - 5",
+			entries: []Entry{{entryError, "a group must be given by its name or as a map from its name to its members", 2}},
 		},
+	}
 
-		// unknown
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkGroups(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckCommands(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
 		{
-			config: "unknown: hi",
+			config: "runcmd:\n  - echo hello\n  - [sleep, 1]\n  - command: [rm, /tmp/foo]\n    ignore_errors: true\n  - command: \"true\"",
+		},
+		{
+			config:  "runcmd:\n  - \"\"\n  - []",
+			entries: []Entry{{entryError, "a command must be given as a string, a list of arguments or a map with a command", 2}, {entryError, "a command must be given as a string, a list of arguments or a map with a command", 3}},
+		},
+		{
+			config:  "runcmd:\n  - [echo, {a: b}]",
+			entries: []Entry{{entryError, "arguments of a command must be strings", 2}},
+		},
+		{
+			config:  "bootcmd:\n  - [modprobe, dm_crypt]\n  - []\nruncmd:\n  - \"\"",
+			entries: []Entry{{entryError, "a command must be given as a string, a list of arguments or a map with a command", 3}, {entryError, "a command must be given as a string, a list of arguments or a map with a command", 5}},
+		},
+		{
+			config:  "runcmd:\n  - ignore_errors: true",
+			entries: []Entry{{entryError, "a command must be given as a string, a list of arguments or a map with a command", 2}},
+		},
+		{
+			config:  "runcmd:\n  - command: \"true\"\n    ignore_errors: maybe\n    user: core",
+			entries: []Entry{{entryError, "ignore_errors of a command must be a boolean", 3}, {entryError, "unrecognized key \"user\" for command", 4}},
 		},
 	}
 
@@ -328,7 +632,7 @@ func TestCheckValidity(t *testing.T) {
 		if err != nil {
 			panic(err)
 		}
-		checkValidity(n, &r)
+		checkCommands(n, &r)
 
 		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
 			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
@@ -336,7 +640,7 @@ func TestCheckValidity(t *testing.T) {
 	}
 }
 
-func TestCheckWriteFiles(t *testing.T) {
+func TestCheckDisks(t *testing.T) {
 	tests := []struct {
 		config string
 
@@ -344,18 +648,484 @@ func TestCheckWriteFiles(t *testing.T) {
 	}{
 		{},
 		{
-			config: "write_files:\n  - path: /valid",
+			config: "disk_setup:\n  /dev/sdb:\n    table_type: gpt\n    layout: true\n  /dev/sdc:\n    layout:\n      - 50\n      - [50, 82]\nfs_setup:\n  - device: /dev/sdb1\n    filesystem: ext4\n    label: data",
 		},
 		{
-			config: "write_files:\n  - path: /tmp/usr/valid",
+			config:  "disk_setup:\n  sdb:\n    layout: true",
+			entries: []Entry{{entryError, "invalid device \"sdb\" for disk_setup", 2}},
 		},
 		{
-			config:  "write_files:\n  - path: /usr/invalid",
-			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2}},
+			config:  "disk_setup:\n  /dev/sdb:\n    layout:\n      - 60\n      - 60",
+			entries: []Entry{{entryError, "partitions on /dev/sdb add up to 120% of the disk", 2}},
 		},
 		{
-			config:  "write-files:\n  - path: /tmp/../usr/invalid",
-			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2}},
+			config:  "disk_setup:\n  /dev/sdb:\n    layout: [20, 20, 20, 20, 20]",
+			entries: []Entry{{entryError, "too many partitions on /dev/sdb for an mbr partition table", 2}},
+		},
+		{
+			config:  "disk_setup:\n  /dev/sdb:\n    table_type: gpt\n    layout:\n      - half",
+			entries: []Entry{{entryError, "a partition must be given as its size in percent or as a list of its size and type", 5}},
+		},
+		{
+			config:  "fs_setup:\n  - device: sdb1\n    filesystem: ext4\n  - filesystem: xfs",
+			entries: []Entry{{entryError, "invalid device \"sdb1\" for fs_setup", 2}, {entryError, "no device given for filesystem", 4}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkDisks(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckLocksmith(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "coreos:\n  update:\n    reboot_strategy: etcd-lock\n  locksmith:\n    window_start: Thu 04:00\n    window_length: 1h30m",
+		},
+		{
+			config:  "coreos:\n  locksmith:\n    window_start: Thursday 4am\n    window_length: 1h",
+			entries: []Entry{{entryError, "invalid value \"Thursday 4am\" for window_start (want e.g. \"Thu 04:00\" or \"04:00\")", 3}},
+		},
+		{
+			config:  "coreos:\n  locksmith:\n    window_start: Thu 04:00\n    window_length: 1 day",
+			entries: []Entry{{entryError, "invalid value \"1 day\" for window_length (want a positive duration, e.g. \"1h30m\")", 4}},
+		},
+		{
+			config:  "coreos:\n  locksmith:\n    window_start: Thu 04:00",
+			entries: []Entry{{entryError, "window_start requires window_length", 3}},
+		},
+		{
+			config:  "coreos:\n  locksmith:\n    window_length: 1h",
+			entries: []Entry{{entryError, "window_length requires window_start", 3}},
+		},
+		{
+			config:  "coreos:\n  update:\n    reboot_strategy: off\n  locksmith:\n    window_start: 04:00\n    window_length: 1h",
+			entries: []Entry{{entryWarning, "the reboot window has no effect with reboot_strategy off", 4}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkLocksmith(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckPasswords(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "users:\n  - name: core\n    passwd: $6$5s2u6/jR$un0AvWnqilcgaNB3Mkxd5yYv6mTlWfOoCYHZmfi3LDKVltj.E8XNKEcwWm",
+		},
+		{
+			config: "users:\n  - name: core\n    passwd: \"!$1$xyz$Jtnw8A.SaX7rmyrtHUMAh1\"",
+		},
+		{
+			config: "users:\n  - name: core\n    passwd: aB3dEf.hiJklm",
+		},
+		{
+			config: "users:\n  - name: core\n    plain_text_passwd: secret\n    lock_passwd: true",
+		},
+		{
+			config:  "users:\n  - name: core\n    passwd: secret",
+			entries: []Entry{{entryWarning, "passwd of user \"core\" does not look like a password hash (use plain_text_passwd for a plaintext password)", 3}},
+		},
+		{
+			config:  "users:\n  - name: core\n    passwd: $6$salt$hash\n    plain_text_passwd: secret",
+			entries: []Entry{{entryWarning, "plain_text_passwd of user \"core\" is ignored since passwd is set", 4}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkPasswords(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckSudo(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "users:\n  - name: core\n    sudo: ALL=(ALL) NOPASSWD:ALL",
+		},
+		{
+			config: "users:\n  - name: core\n    sudo:\n      - ALL=(ALL) NOPASSWD:/usr/bin/systemctl\n      - ALL=(root) ALL",
+		},
+		{
+			config:  "users:\n  - name: core\n    sudo: NOPASSWD ALL",
+			entries: []Entry{{entryError, "invalid sudo rule \"NOPASSWD ALL\" for user \"core\"", 3}},
+		},
+		{
+			config:  "users:\n  - name: core\n  - name: elroy\n    sudo:\n      - ALL=(ALL) ALL\n      - ALL=(ALL\n",
+			entries: []Entry{{entryError, "invalid sudo rule \"ALL=(ALL\" for user \"elroy\"", 6}},
+		},
+		{
+			config:  "users:\n  - name: Bad User\n    sudo: ALL=(ALL) ALL",
+			entries: []Entry{{entryError, "invalid user name \"Bad User\" for sudo rules", 2}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkSudo(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckValidity(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		// string
+		{
+			config: "hostname: test",
+		},
+
+		// int
+		{
+			config: "coreos:\n  fleet:\n    verbosity: 2",
+		},
+
+		// bool
+		{
+			config: "coreos:\n  units:\n    - enable: true",
+		},
+
+		// slice
+		{
+			config: "coreos:\n  units:\n    - command: start\n    - name: stop.service",
+		},
+		{
+			config:  "coreos:\n  units:\n    - command: lol",
+			entries: []Entry{{entryError, "invalid value lol", 3}},
+		},
+		{
+			config: "users:\n  - name: core\n    uid: 1500\n    gid: 1500",
+		},
+		{
+			config: "power_state:\n  mode: reboot\n  delay: +5",
+		},
+		{
+			config:  "power_state:\n  mode: restart",
+			entries: []Entry{{entryError, "invalid value restart", 2}},
+		},
+		{
+			config:  "users:\n  - name: core\n    uid: -1",
+			entries: []Entry{{entryError, "invalid value -1", 3}},
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo@.service\n    - name: foo@bar.timer\n    - name: 10-eth0.network",
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: myapp",
+			entries: []Entry{{entryError, "invalid value myapp", 3}},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: myapp.conf",
+			entries: []Entry{{entryError, "invalid value myapp.conf", 3}},
+		},
+
+		// struct
+		{
+			config: "coreos:\n  update:\n    reboot_strategy: off",
+		},
+		{
+			config:  "coreos:\n  update:\n    reboot_strategy: always",
+			entries: []Entry{{entryError, "invalid value always", 3}},
+		},
+		{
+			config: "write_files:\n  - path: /etc/motd\n    selinux_context: system_u:object_r:etc_t:s0:c0.c1023",
+		},
+		{
+			config:  "write_files:\n  - path: /etc/motd\n    selinux_context: etc_t",
+			entries: []Entry{{entryError, "invalid value etc_t", 3}},
+		},
+		{
+			config:  "coreos:\n  flannel:\n    backend:\n      type: bridge",
+			entries: []Entry{{entryError, "invalid value bridge", 4}},
+		},
+
+		// unknown
+		{
+			config: "unknown: hi",
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkValidity(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckSysctl(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "sysctl:\n  net.ipv4.ip_forward: 1\n  vm/swappiness: \"10\"\n  kernel.empty:",
+		},
+		{
+			config:  "sysctl:\n  kernel.panic$(reboot): 1",
+			entries: []Entry{{entryError, "invalid sysctl parameter \"kernel.panic$(reboot)\"", 2}},
+		},
+		{
+			config:  "sysctl:\n  kernel.panic: \"1\\nvm.swappiness = 100\"",
+			entries: []Entry{{entryError, "value of sysctl parameter \"kernel.panic\" spans multiple lines", 2}},
+		},
+		{
+			config:  "sysctl:\n  net.ipv4.ip_forward: 1\n  vm.swappiness: 10\n  net.ipv4.ip_forward: 0",
+			entries: []Entry{{entryError, "sysctl parameter \"net.ipv4.ip_forward\" is set more than once", 4}},
+		},
+		{
+			config: "sysctl:\n  net.ipv4.ip_forward: 1\nwrite_files:\n  - path: /etc/motd\n    content: |\n      net.ipv4.ip_forward: 0",
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkSysctl(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckUnitCommand(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      command: reload",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      command: reload\n      mask: false",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      command: stop\n      mask: true",
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: foo.service\n      command: reload\n      mask: true",
+			entries: []Entry{{entryError, "unit \"foo.service\" cannot be reloaded because it is masked", 4}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkUnitCommand(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckUnitDropIns(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "coreos:\n  units:\n    - name: docker.service\n      drop_ins:\n        - name: 50-opts.conf\n          content: foo",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: docker.service\n      runtime: true\n      drop_ins:\n        - name: 50-opts.conf\n          content: foo",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: docker.service\n      command: restart\n      drop_ins: []",
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: docker.service\n      enable: false\n      drop_ins: []",
+			entries: []Entry{{entryError, "unit \"docker.service\" has no content or command and needs at least one drop-in with a name and content", 5}},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: docker.service\n      drop_ins:\n        - name: 50-opts.conf",
+			entries: []Entry{{entryError, "unit \"docker.service\" has no content or command and needs at least one drop-in with a name and content", 4}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkUnitDropIns(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckUnitDropInNames(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "coreos:\n  units:\n    - name: docker.service\n      drop_ins:\n        - name: 50-opts.conf\n          content: foo",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: docker.service\n      drop_ins:\n        - content: foo",
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: docker.service\n      drop_ins:\n        - name: ../escape.conf\n          content: foo",
+			entries: []Entry{{entryError, "drop-in name \"../escape.conf\" must not contain a path separator", 5}},
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: docker.service\n      drop_ins:\n        - name: 50-opts.conf\n          content: foo\n        - name: 60-opts\n          content: bar",
+			entries: []Entry{{entryError, "drop-in name \"60-opts\" must end in .conf", 7}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkUnitDropInNames(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckUnitInstances(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "coreos:\n  units:\n    - name: foo@.service\n      instances: [a, b]",
+		},
+		{
+			config: "coreos:\n  units:\n    - name: foo.service\n      instances: []",
+		},
+		{
+			config:  "coreos:\n  units:\n    - name: foo.service\n      instances: [a, b]",
+			entries: []Entry{{entryError, "instances can only be set on template units (i.e. foo@.service), not \"foo.service\"", 4}},
+		},
+	}
+
+	for i, tt := range tests {
+		r := Report{}
+		n, err := parseCloudConfig([]byte(tt.config), &r)
+		if err != nil {
+			panic(err)
+		}
+		checkUnitInstances(n, &r)
+
+		if e := r.Entries(); !reflect.DeepEqual(tt.entries, e) {
+			t.Errorf("bad report (%d, %q): want %#v, got %#v", i, tt.config, tt.entries, e)
+		}
+	}
+}
+
+func TestCheckWriteFiles(t *testing.T) {
+	tests := []struct {
+		config string
+
+		entries []Entry
+	}{
+		{},
+		{
+			config: "write_files:\n  - path: /valid",
+		},
+		{
+			config: "write_files:\n  - path: /tmp/usr/valid",
+		},
+		{
+			config:  "write_files:\n  - path: /usr/invalid",
+			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2}},
+		},
+		{
+			config:  "write-files:\n  - path: /tmp/../usr/invalid",
+			entries: []Entry{{entryError, "file cannot be written to a read-only filesystem", 2}},
+		},
+		{
+			config:  "write_files:\n  - path: relative/invalid",
+			entries: []Entry{{entryError, "path \"relative/invalid\" is not absolute", 2}},
+		},
+		{
+			config:  "write_files:\n  - path: /tmp/../../invalid",
+			entries: []Entry{{entryError, "path \"/tmp/../../invalid\" escapes the root directory", 2}},
 		},
 	}
 
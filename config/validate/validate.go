@@ -33,7 +33,8 @@ var (
 
 // Validate runs a series of validation tests against the given userdata and
 // returns a report detailing all of the issues. Presently, only cloud-configs
-// can be validated.
+// (including those in multipart messages) can be validated; Ignition configs
+// are only checked for a well-formed version.
 func Validate(userdataBytes []byte) (Report, error) {
 	switch {
 	case len(userdataBytes) == 0:
@@ -41,9 +42,21 @@ func Validate(userdataBytes []byte) (Report, error) {
 	case config.IsScript(string(userdataBytes)):
 		return Report{}, nil
 	case config.IsIgnitionConfig(string(userdataBytes)):
+		if _, err := config.NewIgnition(string(userdataBytes)); err != nil {
+			return Report{entries: []Entry{{kind: entryError, message: err.Error(), line: 1}}}, nil
+		}
 		return Report{}, nil
 	case config.IsCloudConfig(string(userdataBytes)):
 		return validateCloudConfig(userdataBytes, Rules)
+	case config.IsCloudConfigJSON(string(userdataBytes)):
+		return validateCloudConfigJSON(userdataBytes)
+	case config.IsInclude(string(userdataBytes)):
+		if _, err := config.NewInclude(string(userdataBytes)); err != nil {
+			return Report{entries: []Entry{{kind: entryError, message: err.Error(), line: 1}}}, nil
+		}
+		return Report{}, nil
+	case config.IsMultipart(string(userdataBytes)):
+		return validateMultipart(userdataBytes)
 	default:
 		return Report{entries: []Entry{
 			{kind: entryError, message: `must be "#cloud-config" or begin with "#!"`, line: 1},
@@ -51,6 +64,43 @@ func Validate(userdataBytes []byte) (Report, error) {
 	}
 }
 
+// validateMultipart validates each of the cloud-config parts of the given
+// multipart MIME message. Line numbers are relative to the part.
+func validateMultipart(userdataBytes []byte) (Report, error) {
+	parts, err := config.MultipartParts(string(userdataBytes))
+	if err != nil {
+		return Report{entries: []Entry{{kind: entryError, message: err.Error(), line: 1}}}, nil
+	}
+
+	var report Report
+	for _, part := range parts {
+		if part.ContentType != config.ContentTypeCloudConfig {
+			continue
+		}
+		r, err := validateCloudConfig([]byte(part.Content), Rules)
+		if err != nil {
+			return report, err
+		}
+		report.entries = append(report.entries, r.entries...)
+	}
+	return report, nil
+}
+
+// validateCloudConfigJSON validates the given cloud-config in JSON by
+// converting it into YAML. Since the lines of the YAML don't correspond to
+// those of the JSON, the entries don't refer to any line.
+func validateCloudConfigJSON(userdataBytes []byte) (Report, error) {
+	converted, err := config.CloudConfigFromJSON(string(userdataBytes))
+	if err != nil {
+		return Report{entries: []Entry{{kind: entryError, message: err.Error(), line: 1}}}, nil
+	}
+	report, err := validateCloudConfig([]byte(converted), Rules)
+	for i := range report.entries {
+		report.entries[i].line = 0
+	}
+	return report, err
+}
+
 // validateCloudConfig runs all of the validation rules in Rules and returns
 // the resulting report and any errors encountered.
 func validateCloudConfig(config []byte, rules []rule) (report Report, err error) {
@@ -64,6 +114,11 @@ func validateCloudConfig(config []byte, rules []rule) (report Report, err error)
 	if err != nil {
 		return report, err
 	}
+	if !c.IsValid() {
+		// The YAML couldn't be parsed (and the error is in the report), so
+		// there is nothing to check.
+		return report, nil
+	}
 
 	for _, r := range rules {
 		r(c, &report)
@@ -17,6 +17,7 @@ package validate
 import (
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -112,15 +113,52 @@ func TestValidate(t *testing.T) {
 			config: "#!/bin/bash\necho hey",
 		},
 		{
-			config: "{}",
+			config: "hostname: foo",
 			report: Report{entries: []Entry{{entryError, `must be "#cloud-config" or begin with "#!"`, 1}}},
 		},
+		{
+			config: "{}",
+		},
+		{
+			config: "#cloud-config-json\n{\"hostname\": \"foo\", \"bad\": 1}",
+			report: Report{entries: []Entry{{entryWarning, `unrecognized key "bad"`, 0}}},
+		},
+		{
+			config: `{"hostname": "foo",}`,
+			report: Report{entries: []Entry{{entryError, `invalid character '}' looking for beginning of object key string`, 1}}},
+		},
 		{
 			config: `{"ignitionVersion":0}`,
 		},
 		{
 			config: `{"ignitionVersion":1}`,
 		},
+		{
+			config: `{"ignition":{"version":"3.0.0"}}`,
+		},
+		{
+			config: `{"ignition":{"version":"3"}}`,
+			report: Report{entries: []Entry{{entryError, `invalid Ignition config version "3"`, 1}}},
+		},
+		{
+			config: "Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Type: text/x-shellscript\n\n#!/bin/bash\n--abc\nContent-Type: text/cloud-config\n\n#cloud-config\nhostname: foo\n--abc--\n",
+		},
+		{
+			config: "Content-Type: multipart/mixed; boundary=abc\n\n--abc\nContent-Type: text/cloud-config\n\n#cloud-config\nhostname: foo\nbad:\n--abc--\n",
+			report: Report{entries: []Entry{{entryWarning, `unrecognized key "bad"`, 3}}},
+		},
+		{
+			config: "#cloud-config\n" + strings.Repeat("# filler\n", 40) + "writ_files:\n  - path: /etc/motd\n",
+			report: Report{entries: []Entry{{entryWarning, `unrecognized key "writ_files"`, 42}}},
+		},
+		{
+			config: "#cloud-config\nhostname: [foo\n",
+			report: Report{entries: []Entry{{entryError, `did not find expected ',' or ']'`, 2}}},
+		},
+		{
+			config: "Content-Type: multipart/mixed\n\n--abc--\n",
+			report: Report{entries: []Entry{{entryError, `missing boundary in Content-Type "multipart/mixed"`, 1}}},
+		},
 	}
 
 	for i, tt := range tests {
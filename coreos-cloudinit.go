@@ -15,15 +15,16 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	neturl "net/url"
 	"os"
 	"runtime"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/coreos/coreos-cloudinit/config"
@@ -31,10 +32,17 @@ import (
 	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/datasource/configdrive"
 	"github.com/coreos/coreos-cloudinit/datasource/file"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/azure"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata/cloudsigma"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/cloudstack"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata/digitalocean"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata/ec2"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/hetzner"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/openstack"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/oracle"
 	"github.com/coreos/coreos-cloudinit/datasource/metadata/packet"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/scaleway"
+	"github.com/coreos/coreos-cloudinit/datasource/nocloud"
 	"github.com/coreos/coreos-cloudinit/datasource/proc_cmdline"
 	"github.com/coreos/coreos-cloudinit/datasource/url"
 	"github.com/coreos/coreos-cloudinit/datasource/vmware"
@@ -57,23 +65,57 @@ var (
 		ignoreFailure bool
 		sources       struct {
 			file                        string
+			stdin                       bool
+			directory                   string
 			configDrive                 string
 			waagent                     string
 			metadataService             bool
 			ec2MetadataService          string
+			ec2MetadataV2Only           bool
 			cloudSigmaMetadataService   bool
 			digitalOceanMetadataService string
 			packetMetadataService       string
+			oracleMetadataService       bool
+			azureMetadataService        bool
+			hetznerMetadataService      bool
+			cloudStackMetadataService   bool
+			cloudStackMetadata          string
+			scalewayMetadataService     bool
+			openStackMetadataService    bool
 			url                         string
+			urlCAFile                   string
+			urlCertFile                 string
+			urlKeyFile                  string
 			procCmdLine                 bool
 			vmware                      bool
 			ovfEnv                      string
+			noCloudLabel                string
+			exclude                     stringSlice
 		}
-		convertNetconf string
-		workspace      string
-		sshKeyName     string
-		oem            string
-		validate       bool
+		convertNetconf   string
+		netRenderer      string
+		workspace        string
+		sshKeyName       string
+		oem              string
+		merge            stringSlice
+		validate         bool
+		validateStrict   bool
+		dryRun           bool
+		force            bool
+		localAddresses   bool
+		mergeEnvironment bool
+
+		datasourceTimeout time.Duration
+		retryAttempts     int
+		retryInterval     time.Duration
+		metadataProxy     string
+		metadataNoProxy   stringSlice
+		userAgent         string
+		reportFile        string
+
+		unitDir        string
+		runtimeUnitDir string
+		unitDropInDir  string
 	}{}
 	version = "was not built properly"
 )
@@ -82,22 +124,54 @@ func init() {
 	flag.BoolVar(&flags.printVersion, "version", false, "Print the version and exit")
 	flag.BoolVar(&flags.ignoreFailure, "ignore-failure", false, "Exits with 0 status in the event of malformed input from user-data")
 	flag.StringVar(&flags.sources.file, "from-file", "", "Read user-data from provided file")
+	flag.BoolVar(&flags.sources.stdin, "from-stdin", false, "Read user-data from stdin, if it is not a terminal")
+	flag.StringVar(&flags.sources.directory, "from-directory", "", "Read user-data by merging the cloud-config fragments (*.yaml files) in the provided directory in lexical order")
 	flag.StringVar(&flags.sources.configDrive, "from-configdrive", "", "Read data from provided cloud-drive directory")
 	flag.StringVar(&flags.sources.waagent, "from-waagent", "", "Read data from provided waagent directory")
 	flag.BoolVar(&flags.sources.metadataService, "from-metadata-service", false, "[DEPRECATED - Use -from-ec2-metadata] Download data from metadata service")
 	flag.StringVar(&flags.sources.ec2MetadataService, "from-ec2-metadata", "", "Download EC2 data from the provided url")
+	flag.BoolVar(&flags.sources.ec2MetadataV2Only, "ec2-metadata-v2-only", false, "Require IMDSv2 session tokens when downloading EC2 data instead of falling back to IMDSv1")
 	flag.BoolVar(&flags.sources.cloudSigmaMetadataService, "from-cloudsigma-metadata", false, "Download data from CloudSigma server context")
 	flag.StringVar(&flags.sources.digitalOceanMetadataService, "from-digitalocean-metadata", "", "Download DigitalOcean data from the provided url")
 	flag.StringVar(&flags.sources.packetMetadataService, "from-packet-metadata", "", "Download Packet data from metadata service")
+	flag.BoolVar(&flags.sources.oracleMetadataService, "from-oracle-metadata-service", false, "Download data from the Oracle Cloud Infrastructure metadata service")
+	flag.BoolVar(&flags.sources.azureMetadataService, "from-azure-metadata-service", false, "Download data from the Azure instance metadata service")
+	flag.BoolVar(&flags.sources.hetznerMetadataService, "from-hetzner-metadata-service", false, "Download data from the Hetzner Cloud metadata service")
+	flag.BoolVar(&flags.sources.cloudStackMetadataService, "from-cloudstack-metadata-service", false, "Download data from the CloudStack metadata service, which is the DHCP server found in the leases")
+	flag.StringVar(&flags.sources.cloudStackMetadata, "from-cloudstack-metadata", "", "Download CloudStack data from the provided url")
+	flag.BoolVar(&flags.sources.scalewayMetadataService, "from-scaleway-metadata-service", false, "Download data from the Scaleway metadata service")
+	flag.BoolVar(&flags.sources.openStackMetadataService, "from-openstack-metadata-service", false, "Download data from the OpenStack metadata service")
 	flag.StringVar(&flags.sources.url, "from-url", "", "Download user-data from provided url")
+	flag.StringVar(&flags.sources.urlCAFile, "from-url-ca-file", "", "Only trust the PEM encoded CA certificate(s) in the provided file when downloading user-data with --from-url, which then requires HTTPS")
+	flag.StringVar(&flags.sources.urlCertFile, "from-url-cert-file", "", "Present the PEM encoded client certificate in the provided file when downloading user-data with --from-url")
+	flag.StringVar(&flags.sources.urlKeyFile, "from-url-key-file", "", "Use the PEM encoded key in the provided file for the --from-url-cert-file client certificate")
 	flag.BoolVar(&flags.sources.procCmdLine, "from-proc-cmdline", false, fmt.Sprintf("Parse %s for '%s=<url>', using the cloud-config served by an HTTP GET to <url>", proc_cmdline.ProcCmdlineLocation, proc_cmdline.ProcCmdlineCloudConfigFlag))
 	flag.BoolVar(&flags.sources.vmware, "from-vmware-guestinfo", false, "Read data from VMware guestinfo")
 	flag.StringVar(&flags.sources.ovfEnv, "from-vmware-ovf-env", "", "Read data from OVF Environment")
+	flag.StringVar(&flags.sources.noCloudLabel, "from-nocloud-label", "", fmt.Sprintf("Read user-data and meta-data from the filesystem with the provided label (usually %q), mounting it read-only", nocloud.DefaultLabel))
+	flag.Var(&flags.sources.exclude, "exclude-datasource", "Never probe the datasource with the given type (i.e. ec2-metadata-service, or ec2 for short). May be given more than once")
+	flag.DurationVar(&flags.datasourceTimeout, "datasource-timeout", datasourceTimeout, "How long to wait for any of the datasources to become available")
+	flag.IntVar(&flags.retryAttempts, "retry-attempts", pkg.DefaultMaxRetries, "Number of attempts made to fetch data from a datasource before giving up")
+	flag.DurationVar(&flags.retryInterval, "retry-interval", pkg.DefaultInitialBackoff, "Initial interval between attempts to fetch data from a datasource, doubled (with jitter) after every attempt")
+	flag.StringVar(&flags.metadataProxy, "metadata-proxy", "", "Fetch data from the datasources through the provided HTTP proxy instead of the one given by HTTP_PROXY or HTTPS_PROXY. Loopback and link-local addresses are never proxied")
+	flag.Var(&flags.metadataNoProxy, "metadata-no-proxy", "Fetch data from the provided comma-separated hosts, domains, addresses or CIDR networks without a proxy. May be given more than once")
+	flag.StringVar(&flags.userAgent, "user-agent", "", "Send the provided User-Agent header when fetching data from the datasources instead of coreos-cloudinit/<version>")
 	flag.StringVar(&flags.oem, "oem", "", "Use the settings specific to the provided OEM")
 	flag.StringVar(&flags.convertNetconf, "convert-netconf", "", "Read the network config provided in cloud-drive and translate it from the specified format into networkd unit files")
+	flag.StringVar(&flags.netRenderer, "network-renderer", "networkd", "Render the converted network config as 'networkd' unit files or as a 'netplan' config")
 	flag.StringVar(&flags.workspace, "workspace", "/var/lib/coreos-cloudinit", "Base directory coreos-cloudinit should use to store data")
 	flag.StringVar(&flags.sshKeyName, "ssh-key-name", initialize.DefaultSSHKeyName, "Add SSH keys to the system with the given name")
-	flag.BoolVar(&flags.validate, "validate", false, "[EXPERIMENTAL] Validate the user-data but do not apply it to the system")
+	flag.StringVar(&flags.unitDir, "unit-dir", system.UnitDirectory, "Write the units to the \"system\" and \"network\" subdirectories of the provided directory")
+	flag.StringVar(&flags.runtimeUnitDir, "runtime-unit-dir", system.RuntimeUnitDirectory, "Write the runtime units to the \"system\" and \"network\" subdirectories of the provided directory")
+	flag.StringVar(&flags.unitDropInDir, "unit-drop-in-dir", "", "Write the drop-ins of the (non-runtime) units to the \"system\" and \"network\" subdirectories of the provided directory instead of next to their units")
+	flag.Var(&flags.merge, "merge", "Merge the cloud-config in the provided file over the one in the user-data. May be given more than once, later files taking precedence")
+	flag.BoolVar(&flags.validate, "validate", false, "[EXPERIMENTAL] Validate the user-data but do not apply it to the system. The user-data is read from the file given as argument (or stdin) unless a datasource is provided")
+	flag.BoolVar(&flags.validateStrict, "validate-strict", false, "Treat warnings as errors when validating the user-data")
+	flag.BoolVar(&flags.dryRun, "dry-run", false, "Print the actions which would be taken to apply the user-data without applying it to the system")
+	flag.StringVar(&flags.reportFile, "report-file", "", "Write a JSON report of the actions taken to apply the user-data, and whether they succeeded, to the provided file (not written with -dry-run)")
+	flag.BoolVar(&flags.force, "force", false, "Apply the user-data even if it was already applied during this boot")
+	flag.BoolVar(&flags.localAddresses, "substitute-local-addresses", false, "Use loopback and link-local addresses for the $iface_* substitutions if an interface has no other address")
+	flag.BoolVar(&flags.mergeEnvironment, "merge-environment", false, "Remove COREOS_* and IFACE_* variables which are no longer provided from /etc/environment, leaving other variables intact")
 }
 
 type oemConfig map[string]string
@@ -165,54 +239,111 @@ func main() {
 	case "":
 	case "debian":
 	case "digitalocean":
+	case "openstack":
 	case "packet":
 	case "vmware":
 	default:
-		fmt.Printf("Invalid option to -convert-netconf: '%s'. Supported options: 'debian, digitalocean, packet, vmware'\n", flags.convertNetconf)
+		fmt.Printf("Invalid option to -convert-netconf: '%s'. Supported options: 'debian, digitalocean, openstack, packet, vmware'\n", flags.convertNetconf)
 		os.Exit(2)
 	}
 
+	switch flags.netRenderer {
+	case "networkd":
+	case "netplan":
+	default:
+		fmt.Printf("Invalid option to -network-renderer: '%s'. Supported options: 'networkd, netplan'\n", flags.netRenderer)
+		os.Exit(2)
+	}
+
+	if flags.retryAttempts < 1 {
+		fmt.Printf("Invalid option to -retry-attempts: %d. It must be at least 1\n", flags.retryAttempts)
+		os.Exit(2)
+	}
+	if flags.retryInterval <= 0 {
+		fmt.Printf("Invalid option to -retry-interval: %v. It must be positive\n", flags.retryInterval)
+		os.Exit(2)
+	}
+	pkg.DefaultMaxRetries = flags.retryAttempts
+	pkg.DefaultInitialBackoff = flags.retryInterval
+
+	var proxy *neturl.URL
+	if flags.metadataProxy != "" {
+		var err error
+		if proxy, err = pkg.ParseProxy(flags.metadataProxy); err != nil {
+			fmt.Printf("Invalid option to -metadata-proxy: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	var noProxy []string
+	for _, hosts := range flags.metadataNoProxy {
+		noProxy = append(noProxy, strings.Split(hosts, ",")...)
+	}
+	pkg.DefaultProxy = pkg.NewProxy(proxy, noProxy)
+	if flags.userAgent != "" {
+		pkg.DefaultUserAgent = flags.userAgent
+	} else {
+		pkg.DefaultUserAgent = "coreos-cloudinit/" + version
+	}
+	system.UnitDirectory = flags.unitDir
+	system.RuntimeUnitDirectory = flags.runtimeUnitDir
+	system.DropInDirectory = flags.unitDropInDir
+
 	dss := getDatasources()
+	if flags.validate && (flag.NArg() > 0 || len(dss) == 0) {
+		os.Exit(validateLocalUserdata(flag.Arg(0)))
+	}
 	if len(dss) == 0 {
-		fmt.Println("Provide at least one of --from-file, --from-configdrive, --from-ec2-metadata, --from-cloudsigma-metadata, --from-packet-metadata, --from-digitalocean-metadata, --from-vmware-guestinfo, --from-waagent, --from-url or --from-proc-cmdline")
+		fmt.Println("Provide at least one of --from-file, --from-stdin, --from-directory, --from-configdrive, --from-ec2-metadata, --from-cloudsigma-metadata, --from-packet-metadata, --from-digitalocean-metadata, --from-oracle-metadata-service, --from-azure-metadata-service, --from-hetzner-metadata-service, --from-cloudstack-metadata-service, --from-cloudstack-metadata, --from-scaleway-metadata-service, --from-openstack-metadata-service, --from-vmware-guestinfo, --from-nocloud-label, --from-waagent, --from-url or --from-proc-cmdline")
+		os.Exit(2)
+	}
+
+	if dss = excludeDatasources(dss, flags.sources.exclude); len(dss) == 0 {
+		fmt.Println("All of the provided datasources are excluded by --exclude-datasource")
 		os.Exit(2)
 	}
 
-	ds := selectDatasource(dss)
+	initialize.Notify("Waiting for a datasource")
+	ds := selectDatasource(dss, flags.datasourceTimeout)
 	if ds == nil {
 		log.Println("No datasources available in time")
 		os.Exit(1)
 	}
 
 	log.Printf("Fetching user-data from datasource of type %q\n", ds.Type())
+	initialize.Notify("Fetching user-data")
+	// userdataErr is kept so that -validate doesn't report user-data which
+	// couldn't be fetched as valid.
+	var userdataErr error
 	userdataBytes, err := ds.FetchUserdata()
 	if err != nil {
-		log.Printf("Failed fetching user-data from datasource: %v. Continuing...\n", err)
+		userdataErr = fmt.Errorf("Failed fetching user-data from datasource: %v", err)
+		log.Printf("%v. Continuing...\n", userdataErr)
 		failure = true
 	}
 	userdataBytes, err = decompressIfGzip(userdataBytes)
 	if err != nil {
-		log.Printf("Failed decompressing user-data from datasource: %v. Continuing...\n", err)
+		userdataErr = fmt.Errorf("Failed decompressing user-data from datasource: %v", err)
+		log.Printf("%v. Continuing...\n", userdataErr)
 		failure = true
 	}
 
+	if flags.validate {
+		if userdataErr != nil {
+			fmt.Println(userdataErr)
+			os.Exit(1)
+		}
+		os.Exit(validateUserdata(userdataBytes, flags.validateStrict, os.Stdout))
+	}
 	if report, err := validate.Validate(userdataBytes); err == nil {
-		ret := 0
 		for _, e := range report.Entries() {
 			log.Println(e)
-			ret = 1
-		}
-		if flags.validate {
-			os.Exit(ret)
 		}
 	} else {
 		log.Printf("Failed while validating user_data (%q)\n", err)
-		if flags.validate {
-			os.Exit(1)
-		}
 	}
 
 	log.Printf("Fetching meta-data from datasource of type %q\n", ds.Type())
+	initialize.Notify("Fetching meta-data")
 	metadata, err := ds.FetchMetadata()
 	if err != nil {
 		log.Printf("Failed fetching meta-data from datasource: %v\n", err)
@@ -221,26 +352,48 @@ func main() {
 
 	// Apply environment to user-data
 	env := initialize.NewEnvironment("/", ds.ConfigRoot(), flags.workspace, flags.sshKeyName, metadata)
-	userdata := env.Apply(string(userdataBytes))
+	env.SetDatasource(ds.Type())
+	if flags.dryRun {
+		env.SetDryRun(os.Stdout)
+	} else if flags.reportFile != "" {
+		env.SetReport(initialize.NewReport())
+	}
+	env.SetNetplan(flags.netRenderer == "netplan")
+	env.SetForce(flags.force)
+	env.SetLocalAddresses(flags.localAddresses)
+	env.SetMergeEnvironment(flags.mergeEnvironment)
 
 	var ccu *config.CloudConfig
-	var script *config.Script
-	switch ud, err := initialize.ParseUserData(userdata); err {
-	case initialize.ErrIgnitionConfig:
-		fmt.Printf("Detected an Ignition config. Exiting...")
-		os.Exit(0)
+	var scripts []config.Script
+	switch ud, err := env.ParseUserData(string(userdataBytes)); err {
 	case nil:
 		switch t := ud.(type) {
+		case *config.Ignition:
+			fmt.Printf("Detected an Ignition config (version %s). Exiting...\n", t.Version)
+			os.Exit(0)
 		case *config.CloudConfig:
 			ccu = t
 		case *config.Script:
-			script = t
+			scripts = append(scripts, *t)
+		case *config.Multipart:
+			ccu = t.CloudConfig
+			scripts = t.Scripts
 		}
 	default:
 		fmt.Printf("Failed to parse user-data: %v\nContinuing...\n", err)
 		failure = true
 	}
 
+	for _, path := range flags.merge {
+		log.Printf("Merging cloud-config from %q\n", path)
+		merged, err := mergeConfigFile(ccu, path, env)
+		if err != nil {
+			log.Printf("Failed to merge cloud-config from %q: %v\n", path, err)
+			os.Exit(1)
+		}
+		ccu = merged
+	}
+
 	log.Println("Merging cloud-config from meta-data and user-data")
 	cc := mergeConfigs(ccu, metadata)
 
@@ -252,6 +405,8 @@ func main() {
 			ifaces, err = network.ProcessDebianNetconf(metadata.NetworkConfig.([]byte))
 		case "digitalocean":
 			ifaces, err = network.ProcessDigitalOceanNetconf(metadata.NetworkConfig.(digitalocean.Metadata))
+		case "openstack":
+			ifaces, err = network.ProcessOpenStackNetconf(metadata.NetworkConfig.(openstack.NetworkData))
 		case "packet":
 			ifaces, err = network.ProcessPacketNetconf(metadata.NetworkConfig.(packet.NetworkData))
 		case "vmware":
@@ -265,23 +420,49 @@ func main() {
 		}
 	}
 
+	initialize.Notify("Applying cloud-config")
 	if err = initialize.Apply(cc, ifaces, env); err != nil {
 		log.Printf("Failed to apply cloud-config: %v\n", err)
+		writeReport(env.Report(), err)
 		os.Exit(1)
 	}
 
-	if script != nil {
-		if err = runScript(*script, env); err != nil {
+	if len(scripts) > 0 {
+		initialize.Notify("Running scripts")
+	}
+	for _, script := range scripts {
+		if err = env.Report().Add("run-script", initialize.Hash(script), runScript(script, env)); err != nil {
 			log.Printf("Failed to run script: %v\n", err)
+			writeReport(env.Report(), err)
 			os.Exit(1)
 		}
 	}
 
 	if failure && !flags.ignoreFailure {
+		writeReport(env.Report(), errors.New("failed to parse user-data"))
+		os.Exit(1)
+	}
+	writeReport(env.Report(), nil)
+	initialize.NotifyReady()
+
+	if err = initialize.ApplyPowerState(cc.PowerState, env); err != nil {
+		log.Printf("Failed to apply power state: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// writeReport finishes the report of the applied actions, if any, with the
+// given outcome and writes it to the file given by -report-file.
+func writeReport(report *initialize.Report, err error) {
+	if report == nil {
+		return
+	}
+	report.Finish(err)
+	if err := report.Write(flags.reportFile); err != nil {
+		log.Printf("Failed to write report to %q: %v\n", flags.reportFile, err)
+	}
+}
+
 // mergeConfigs merges certain options from md (meta-data from the datasource)
 // onto cc (a CloudConfig derived from user-data), if they are not already set
 // on cc (i.e. user-data always takes precedence)
@@ -303,6 +484,32 @@ func mergeConfigs(cc *config.CloudConfig, md datasource.Metadata) (out config.Cl
 	return
 }
 
+// mergeConfigFile merges the cloud-config stored in the file at path over cc
+// (which may be nil) after applying the environment's substitutions to it.
+func mergeConfigFile(cc *config.CloudConfig, path string, env *initialize.Environment) (*config.CloudConfig, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if contents, err = decompressIfGzip(contents); err != nil {
+		return nil, err
+	}
+	if !config.IsCloudConfig(string(contents)) {
+		return nil, fmt.Errorf("not a cloud-config")
+	}
+	override, err := config.NewCloudConfig(env.Apply(string(contents)))
+	if err != nil {
+		return nil, err
+	}
+
+	var base config.CloudConfig
+	if cc != nil {
+		base = *cc
+	}
+	merged := config.Merge(base, *override)
+	return &merged, nil
+}
+
 // getDatasources creates a slice of possible Datasources for cloudinit based
 // on the different source command-line flags.
 func getDatasources() []datasource.Datasource {
@@ -310,17 +517,32 @@ func getDatasources() []datasource.Datasource {
 	if flags.sources.file != "" {
 		dss = append(dss, file.NewDatasource(flags.sources.file))
 	}
+	if flags.sources.stdin {
+		dss = append(dss, file.NewStdinDatasource())
+	}
+	if flags.sources.directory != "" {
+		dss = append(dss, file.NewDirectoryDatasource(flags.sources.directory))
+	}
 	if flags.sources.url != "" {
-		dss = append(dss, url.NewDatasource(flags.sources.url))
+		if flags.sources.urlCAFile != "" || flags.sources.urlCertFile != "" || flags.sources.urlKeyFile != "" {
+			tlsConfig, err := pkg.NewTLSConfig(flags.sources.urlCAFile, flags.sources.urlCertFile, flags.sources.urlKeyFile)
+			if err != nil {
+				fmt.Printf("Invalid TLS options for --from-url: %v\n", err)
+				os.Exit(2)
+			}
+			dss = append(dss, url.NewTLSDatasource(flags.sources.url, tlsConfig))
+		} else {
+			dss = append(dss, url.NewDatasource(flags.sources.url))
+		}
 	}
 	if flags.sources.configDrive != "" {
 		dss = append(dss, configdrive.NewDatasource(flags.sources.configDrive))
 	}
 	if flags.sources.metadataService {
-		dss = append(dss, ec2.NewDatasource(ec2.DefaultAddress))
+		dss = append(dss, ec2.NewDatasource(ec2.DefaultAddress, flags.sources.ec2MetadataV2Only))
 	}
 	if flags.sources.ec2MetadataService != "" {
-		dss = append(dss, ec2.NewDatasource(flags.sources.ec2MetadataService))
+		dss = append(dss, ec2.NewDatasource(flags.sources.ec2MetadataService, flags.sources.ec2MetadataV2Only))
 	}
 	if flags.sources.cloudSigmaMetadataService {
 		dss = append(dss, cloudsigma.NewServerContextService())
@@ -334,6 +556,27 @@ func getDatasources() []datasource.Datasource {
 	if flags.sources.packetMetadataService != "" {
 		dss = append(dss, packet.NewDatasource(flags.sources.packetMetadataService))
 	}
+	if flags.sources.oracleMetadataService {
+		dss = append(dss, oracle.NewDatasource(oracle.DefaultAddress))
+	}
+	if flags.sources.azureMetadataService {
+		dss = append(dss, azure.NewDatasource(azure.DefaultAddress))
+	}
+	if flags.sources.hetznerMetadataService {
+		dss = append(dss, hetzner.NewDatasource(hetzner.DefaultAddress))
+	}
+	if flags.sources.cloudStackMetadataService {
+		dss = append(dss, cloudstack.NewDatasource(""))
+	}
+	if flags.sources.cloudStackMetadata != "" {
+		dss = append(dss, cloudstack.NewDatasource(flags.sources.cloudStackMetadata))
+	}
+	if flags.sources.scalewayMetadataService {
+		dss = append(dss, scaleway.NewDatasource(scaleway.DefaultAddress))
+	}
+	if flags.sources.openStackMetadataService {
+		dss = append(dss, openstack.NewDatasource(openstack.DefaultAddress))
+	}
 	if flags.sources.procCmdLine {
 		dss = append(dss, proc_cmdline.NewDatasource())
 	}
@@ -343,31 +586,78 @@ func getDatasources() []datasource.Datasource {
 	if flags.sources.ovfEnv != "" {
 		dss = append(dss, vmware.NewDatasource(flags.sources.ovfEnv))
 	}
+	if flags.sources.noCloudLabel != "" {
+		dss = append(dss, nocloud.NewDatasource(flags.sources.noCloudLabel))
+	}
 	return dss
 }
 
+// stringSlice is a flag.Value which collects every occurrence of a flag.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// excludeDatasources removes the datasources whose type is one of the given
+// names from dss. A name also matches any type that it prefixes up to a dash,
+// so "ec2" excludes "ec2-metadata-service".
+func excludeDatasources(dss []datasource.Datasource, names []string) []datasource.Datasource {
+	var filtered []datasource.Datasource
+	for _, ds := range dss {
+		excluded := false
+		for _, name := range names {
+			if ds.Type() == name || strings.HasPrefix(ds.Type(), name+"-") {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			log.Printf("Excluding datasource %q\n", ds.Type())
+		} else {
+			filtered = append(filtered, ds)
+		}
+	}
+	return filtered
+}
+
 // selectDatasource attempts to choose a valid Datasource to use based on its
-// current availability. The first Datasource to report to be available is
-// returned. Datasources will be retried if possible if they are not
-// immediately available. If all Datasources are permanently unavailable or
-// datasourceTimeout is reached before one becomes available, nil is returned.
-func selectDatasource(sources []datasource.Datasource) datasource.Datasource {
-	ds := make(chan datasource.Datasource)
+// current availability. The availability of each Datasource is probed
+// concurrently. Once a Datasource is available, it is selected as soon as
+// every Datasource preceding it in sources has been found to be unavailable,
+// so that the order of sources is the priority of the datasources rather than
+// the speed with which they respond. Once the timeout expires, the first
+// Datasource which has been found to be available is selected regardless of
+// those preceding it (which may be hung), or nil is returned if there is none.
+// The in-flight requests of the Datasources which are not selected are
+// canceled.
+func selectDatasource(sources []datasource.Datasource, timeout time.Duration) datasource.Datasource {
+	type result struct {
+		index     int
+		available bool
+		final     bool
+	}
+	results := make(chan result)
 	stop := make(chan struct{})
-	var wg sync.WaitGroup
-
-	for _, s := range sources {
-		wg.Add(1)
-		go func(s datasource.Datasource) {
-			defer wg.Done()
 
+	for i, s := range sources {
+		go func(i int, s datasource.Datasource) {
 			duration := datasourceInterval
 			for {
 				log.Printf("Checking availability of %q\n", s.Type())
-				if s.IsAvailable() {
-					ds <- s
+				r := result{index: i, available: s.IsAvailable()}
+				r.final = r.available || !s.AvailabilityChanges()
+				select {
+				case results <- r:
+				case <-stop:
 					return
-				} else if !s.AvailabilityChanges() {
+				}
+				if r.final {
 					return
 				}
 				select {
@@ -377,28 +667,66 @@ func selectDatasource(sources []datasource.Datasource) datasource.Datasource {
 					duration = pkg.ExpBackoff(duration, datasourceMaxInterval)
 				}
 			}
-		}(s)
+		}(i, s)
 	}
 
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
+	checked := make([]bool, len(sources))
+	available := make([]bool, len(sources))
+	remaining := len(sources)
+	timer := time.After(timeout)
 
 	var s datasource.Datasource
-	select {
-	case s = <-ds:
-	case <-done:
-	case <-time.After(datasourceTimeout):
+	for s == nil && remaining > 0 {
+		select {
+		case r := <-results:
+			checked[r.index] = true
+			available[r.index] = r.available
+			if r.final && !r.available {
+				remaining--
+			}
+		case <-timer:
+			log.Printf("Timed out after %v waiting for a datasource\n", timeout)
+			for i := range sources {
+				if available[i] {
+					s = sources[i]
+					break
+				}
+			}
+			remaining = 0
+			continue
+		}
+
+		for i := range sources {
+			if !checked[i] {
+				break
+			}
+			if available[i] {
+				s = sources[i]
+				break
+			}
+		}
 	}
 
 	close(stop)
+	for _, ds := range sources {
+		if c, ok := ds.(datasource.Canceler); ok && ds != s {
+			c.Cancel()
+		}
+	}
 	return s
 }
 
 // TODO(jonboulle): this should probably be refactored and moved into a different module
 func runScript(script config.Script, env *initialize.Environment) error {
+	if env.DryRun() {
+		initialize.DryRunScript(script, env)
+		return nil
+	}
+	hash := initialize.Hash(script)
+	if env.Applied("script-"+hash, hash) {
+		log.Printf("Script was already run during this boot, skipping (use -force to run it again)")
+		return nil
+	}
 	err := initialize.PrepWorkspace(env.Workspace())
 	if err != nil {
 		log.Printf("Failed preparing workspace: %v\n", err)
@@ -407,22 +735,68 @@ func runScript(script config.Script, env *initialize.Environment) error {
 	path, err := initialize.PersistScriptInWorkspace(script, env.Workspace())
 	if err == nil {
 		var name string
-		name, err = system.ExecuteScript(path)
+		name, err = system.ExecuteScript(path, script.Interpreter())
 		initialize.PersistUnitNameInWorkspace(name, env.Workspace())
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return env.MarkApplied("script-"+hash, hash)
+}
+
+// validateLocalUserdata validates the user-data stored in the file at path,
+// or given on stdin if path is empty or "-", and returns the exit code.
+func validateLocalUserdata(path string) int {
+	var userdataBytes []byte
+	var err error
+	if path == "" || path == "-" {
+		userdataBytes, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		userdataBytes, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Printf("Failed reading user-data: %v\n", err)
+		return 1
+	}
+	if userdataBytes, err = decompressIfGzip(userdataBytes); err != nil {
+		fmt.Printf("Failed decompressing user-data: %v\n", err)
+		return 1
+	}
+	return validateUserdata(userdataBytes, flags.validateStrict, os.Stdout)
 }
 
-const gzipMagicBytes = "\x1f\x8b"
+// validateUserdata prints every entry of the validation report of the given
+// user-data to w, followed by the offending line of a cloud-config, and
+// returns the exit code: 1 if there are errors (or warnings, if strict is
+// set) and 0 otherwise.
+func validateUserdata(userdataBytes []byte, strict bool, w io.Writer) int {
+	report, err := validate.Validate(userdataBytes)
+	if err != nil {
+		fmt.Fprintf(w, "Failed while validating user_data (%q)\n", err)
+		return 1
+	}
+
+	var lines []string
+	if config.IsCloudConfig(string(userdataBytes)) {
+		lines = strings.Split(string(userdataBytes), "\n")
+	}
+
+	ret := 0
+	for _, e := range report.Entries() {
+		fmt.Fprintln(w, e)
+		if l := e.Line(); l > 0 && l <= len(lines) {
+			fmt.Fprintf(w, "    %d | %s\n", l, strings.TrimRight(lines[l-1], "\r"))
+		}
+		if e.IsError() || (strict && e.IsWarning()) {
+			ret = 1
+		}
+	}
+	return ret
+}
 
 func decompressIfGzip(userdataBytes []byte) ([]byte, error) {
-	if !bytes.HasPrefix(userdataBytes, []byte(gzipMagicBytes)) {
+	if !config.IsGzip(string(userdataBytes)) {
 		return userdataBytes, nil
 	}
-	gzr, err := gzip.NewReader(bytes.NewReader(userdataBytes))
-	if err != nil {
-		return nil, err
-	}
-	defer gzr.Close()
-	return ioutil.ReadAll(gzr)
+	return config.DecodeGzipContent(string(userdataBytes))
 }
@@ -18,11 +18,25 @@ import (
 	"bytes"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/coreos/coreos-cloudinit/config"
 	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/file"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/ec2"
+	"github.com/coreos/coreos-cloudinit/datasource/url"
+	"github.com/coreos/coreos-cloudinit/initialize"
+	"github.com/coreos/coreos-cloudinit/system"
 )
 
 func TestMergeConfigs(t *testing.T) {
@@ -99,6 +113,130 @@ func mustDecode(in string) []byte {
 	return out
 }
 
+func TestSubstituteUserdata(t *testing.T) {
+	metadata := datasource.Metadata{PrivateIPv4: net.ParseIP("10.0.0.5"), PublicIPv4: net.ParseIP("12.34.56.78")}
+	for _, tt := range []struct {
+		userdata string
+
+		etcd2 []string
+		fleet []string
+	}{
+		{
+			userdata: `#cloud-config
+coreos:
+  etcd2:
+    initial-advertise-peer-urls: http://$private_ipv4:2380
+    advertise-client-urls: http://$public_ipv4:2379
+  fleet:
+    public-ip: $private_ipv4
+`,
+			etcd2: []string{
+				`Environment="ETCD_ADVERTISE_CLIENT_URLS=http://12.34.56.78:2379"`,
+				`Environment="ETCD_INITIAL_ADVERTISE_PEER_URLS=http://10.0.0.5:2380"`,
+			},
+			fleet: []string{`Environment="FLEET_PUBLIC_IP=10.0.0.5"`},
+		},
+		{
+			userdata: `#cloud-config
+coreos:
+  etcd2:
+    name: \$private_ipv4
+  fleet:
+    metadata: ip=$private_ipv4
+substitutions:
+  region: us-west
+`,
+			etcd2: []string{`Environment="ETCD_NAME=$private_ipv4"`},
+			fleet: []string{`Environment="FLEET_METADATA=ip=10.0.0.5"`},
+		},
+		{
+			userdata: `#cloud-config
+coreos:
+  fleet:
+    metadata: region=$region,ip=\$public_ipv4
+substitutions:
+  region: us-west
+`,
+			fleet: []string{`Environment="FLEET_METADATA=region=us-west,ip=$public_ipv4"`},
+		},
+	} {
+		env := initialize.NewEnvironment("/", "", "", "", metadata)
+		cfg, err := config.NewCloudConfig(env.SubstituteUserdata(tt.userdata))
+		if err != nil {
+			t.Fatalf("bad error (%q): %v", tt.userdata, err)
+		}
+
+		for _, c := range []struct {
+			units []system.Unit
+			want  []string
+		}{
+			{system.Etcd2{Etcd2: cfg.CoreOS.Etcd2}.Units(), tt.etcd2},
+			{system.Fleet{Fleet: cfg.CoreOS.Fleet}.Units(), tt.fleet},
+		} {
+			var content string
+			for _, u := range c.units {
+				for _, d := range u.DropIns {
+					content += d.Content
+				}
+			}
+			for _, w := range c.want {
+				if !strings.Contains(content, w) {
+					t.Errorf("bad drop-in (%q): want %q in %q", tt.userdata, w, content)
+				}
+			}
+		}
+	}
+}
+
+func TestMergeConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("failed creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := initialize.NewEnvironment("/", "", "", "", datasource.Metadata{PublicIPv4: net.ParseIP("192.0.2.1")})
+	base := &config.CloudConfig{WriteFiles: []config.File{{Path: "/etc/motd", Content: "base"}}}
+	for i, tt := range []struct {
+		contents string
+		cc       *config.CloudConfig
+
+		merged *config.CloudConfig
+		err    bool
+	}{
+		{
+			contents: "#cloud-config\nhostname: prod-$public_ipv4\nwrite_files:\n  - path: /etc/motd\n    content: prod\n",
+			cc:       base,
+			merged:   &config.CloudConfig{Hostname: "prod-192.0.2.1", WriteFiles: []config.File{{Path: "/etc/motd", Content: "prod"}}},
+		},
+		{
+			contents: "#cloud-config\nhostname: prod\n",
+			merged:   &config.CloudConfig{Hostname: "prod"},
+		},
+		{
+			contents: "#!/bin/bash\necho hi\n",
+			cc:       base,
+			err:      true,
+		},
+	} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.yml", i))
+		if err := ioutil.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+			t.Fatalf("failed writing %q: %v", path, err)
+		}
+		merged, err := mergeConfigFile(tt.cc, path, env)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%d): want %t, got %v", i, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.merged, merged) {
+			t.Errorf("bad merged config (%d): want %#v, got %#v", i, tt.merged, merged)
+		}
+	}
+
+	if _, err := mergeConfigFile(nil, filepath.Join(dir, "missing.yml"), env); err == nil {
+		t.Errorf("bad error for missing file: want non-nil, got nil")
+	}
+}
+
 func TestDecompressIfGzip(t *testing.T) {
 	tests := []struct {
 		in []byte
@@ -145,3 +283,209 @@ func TestDecompressIfGzip(t *testing.T) {
 	}
 
 }
+
+func TestExcludeDatasources(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+
+	dss := []datasource.Datasource{
+		file.NewDatasource("/nonexistent"),
+		ec2.NewDatasource(ts.URL, false),
+		url.NewDatasource(ts.URL),
+	}
+
+	for _, tt := range []struct {
+		names []string
+
+		types []string
+	}{
+		{
+			names: nil,
+			types: []string{"local-file", "ec2-metadata-service", "url"},
+		},
+		{
+			names: []string{"ec2"},
+			types: []string{"local-file", "url"},
+		},
+		{
+			names: []string{"ec2-metadata-service", "url"},
+			types: []string{"local-file"},
+		},
+		{
+			names: []string{"ec", "file", "metadata-service"},
+			types: []string{"local-file", "ec2-metadata-service", "url"},
+		},
+		{
+			names: []string{"local-file", "ec2", "url"},
+			types: nil,
+		},
+	} {
+		var types []string
+		for _, ds := range excludeDatasources(dss, tt.names) {
+			types = append(types, ds.Type())
+		}
+		if !reflect.DeepEqual(tt.types, types) {
+			t.Errorf("bad datasources (%q): want %q, got %q", tt.names, tt.types, types)
+		}
+	}
+
+	if requests != 0 {
+		t.Errorf("bad number of requests: want 0, got %d", requests)
+	}
+}
+
+// fakeDatasource reports to be available after the given delay. It blocks
+// forever (until canceled) if the delay is negative.
+type fakeDatasource struct {
+	datasource.Datasource
+	name      string
+	delay     time.Duration
+	available bool
+	canceled  chan struct{}
+}
+
+func newFakeDatasource(name string, delay time.Duration, available bool) *fakeDatasource {
+	return &fakeDatasource{name: name, delay: delay, available: available, canceled: make(chan struct{})}
+}
+
+func (f *fakeDatasource) IsAvailable() bool {
+	if f.delay < 0 {
+		<-f.canceled
+		return false
+	}
+	time.Sleep(f.delay)
+	return f.available
+}
+
+func (f *fakeDatasource) AvailabilityChanges() bool { return false }
+func (f *fakeDatasource) Type() string              { return f.name }
+func (f *fakeDatasource) Cancel()                   { close(f.canceled) }
+
+func TestSelectDatasource(t *testing.T) {
+	for _, tt := range []struct {
+		sources []*fakeDatasource
+		timeout time.Duration
+
+		selected string
+	}{
+		{
+			// the first datasource takes priority even if it is slower
+			sources: []*fakeDatasource{
+				newFakeDatasource("slow", 50*time.Millisecond, true),
+				newFakeDatasource("fast", 0, true),
+			},
+			timeout:  time.Second,
+			selected: "slow",
+		},
+		{
+			sources: []*fakeDatasource{
+				newFakeDatasource("unavailable", 0, false),
+				newFakeDatasource("fast", 0, true),
+			},
+			timeout:  time.Second,
+			selected: "fast",
+		},
+		{
+			sources: []*fakeDatasource{
+				newFakeDatasource("unavailable", 0, false),
+			},
+			timeout: time.Second,
+		},
+		{
+			// a hung datasource must not delay selection past the timeout,
+			// after which the available datasources are used
+			sources: []*fakeDatasource{
+				newFakeDatasource("hung", -1, true),
+				newFakeDatasource("fast", 0, true),
+			},
+			timeout:  100 * time.Millisecond,
+			selected: "fast",
+		},
+		{
+			sources: []*fakeDatasource{
+				newFakeDatasource("hung", -1, true),
+				newFakeDatasource("unavailable", 0, false),
+			},
+			timeout: 100 * time.Millisecond,
+		},
+	} {
+		var dss []datasource.Datasource
+		for _, s := range tt.sources {
+			dss = append(dss, s)
+		}
+
+		start := time.Now()
+		ds := selectDatasource(dss, tt.timeout)
+		if elapsed := time.Since(start); elapsed > tt.timeout+500*time.Millisecond {
+			t.Errorf("bad selection time (%q): want at most %v, took %v", tt.selected, tt.timeout, elapsed)
+		}
+
+		var selected string
+		if ds != nil {
+			selected = ds.Type()
+		}
+		if selected != tt.selected {
+			t.Errorf("bad datasource: want %q, got %q", tt.selected, selected)
+		}
+
+		for _, s := range tt.sources {
+			if s.name == selected {
+				continue
+			}
+			select {
+			case <-s.canceled:
+			default:
+				t.Errorf("datasource %q was not canceled", s.name)
+			}
+		}
+	}
+}
+
+func TestValidateUserdata(t *testing.T) {
+	for _, tt := range []struct {
+		userdata string
+		strict   bool
+
+		ret    int
+		output string
+	}{
+		{
+			userdata: "#cloud-config\nhostname: foo\n",
+		},
+		{
+			userdata: "#cloud-config\nhostname: foo\nbad: key\n",
+			output:   "line 3: warning: unrecognized key \"bad\"\n    3 | bad: key\n",
+		},
+		{
+			userdata: "#cloud-config\nhostname: foo\r\nbad: key\r\n",
+			strict:   true,
+			ret:      1,
+			output:   "line 3: warning: unrecognized key \"bad\"\n    3 | bad: key\n",
+		},
+		{
+			userdata: "#cloud-config\nhostname: [foo\n",
+			ret:      1,
+			output:   "line 2: error: did not find expected ',' or ']'\n    2 | hostname: [foo\n",
+		},
+		{
+			userdata: "hostname: foo\n",
+			ret:      1,
+			output:   "line 1: error: must be \"#cloud-config\" or begin with \"#!\"\n",
+		},
+		{
+			userdata: "{\"hostname\": \"foo\", \"bad\": \"key\"}",
+			output:   "warning: unrecognized key \"bad\"\n",
+		},
+	} {
+		var buf bytes.Buffer
+		if ret := validateUserdata([]byte(tt.userdata), tt.strict, &buf); ret != tt.ret {
+			t.Errorf("bad exit code (%q, %t): want %d, got %d", tt.userdata, tt.strict, tt.ret, ret)
+		}
+		if output := buf.String(); output != tt.output {
+			t.Errorf("bad output (%q, %t): want %q, got %q", tt.userdata, tt.strict, tt.output, output)
+		}
+	}
+}
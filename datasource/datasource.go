@@ -27,12 +27,21 @@ type Datasource interface {
 	Type() string
 }
 
+// Canceler is implemented by datasources whose in-flight requests can be
+// aborted, such as those which are still being probed when another
+// datasource has been selected.
+type Canceler interface {
+	Cancel()
+}
+
 type Metadata struct {
 	PublicIPv4    net.IP
 	PublicIPv6    net.IP
 	PrivateIPv4   net.IP
 	PrivateIPv6   net.IP
 	Hostname      string
+	Region        string
+	Nameservers   []net.IP
 	SSHPublicKeys map[string]string
 	NetworkConfig interface{}
 }
@@ -0,0 +1,85 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+// localDirectory is a datasource which merges the cloud-config fragments
+// (*.yaml files) found in a directory, in lexical order of their names, into a
+// single cloud-config.
+type localDirectory struct {
+	path string
+}
+
+func NewDirectoryDatasource(path string) *localDirectory {
+	return &localDirectory{path}
+}
+
+func (d *localDirectory) IsAvailable() bool {
+	fragments, err := d.fragments()
+	return err == nil && len(fragments) > 0
+}
+
+func (d *localDirectory) AvailabilityChanges() bool {
+	return true
+}
+
+func (d *localDirectory) ConfigRoot() string {
+	return ""
+}
+
+func (d *localDirectory) FetchMetadata() (datasource.Metadata, error) {
+	return datasource.Metadata{}, nil
+}
+
+// FetchUserdata merges the fragments using config.Merge, later fragments
+// taking precedence, and returns the result as a cloud-config. The fragments
+// may omit the #cloud-config header.
+func (d *localDirectory) FetchUserdata() ([]byte, error) {
+	fragments, err := d.fragments()
+	if err != nil {
+		return nil, err
+	}
+
+	var merged config.CloudConfig
+	for _, fragment := range fragments {
+		contents, err := ioutil.ReadFile(fragment)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := config.NewCloudConfig(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", fragment, err)
+		}
+		merged = config.Merge(merged, *cfg)
+	}
+	return []byte(merged.String()), nil
+}
+
+func (d *localDirectory) Type() string {
+	return "local-directory"
+}
+
+// fragments returns the paths of the fragments in lexical order.
+func (d *localDirectory) fragments() ([]string, error) {
+	return filepath.Glob(filepath.Join(d.path, "*.yaml"))
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestDirectoryIsAvailable(t *testing.T) {
+	for _, tt := range []struct {
+		files []string
+
+		available bool
+	}{
+		{files: nil, available: false},
+		{files: []string{"README", "10-base.yml"}, available: false},
+		{files: []string{"10-base.yaml"}, available: true},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, name := range tt.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("hostname: foo\n"), 0644); err != nil {
+				t.Fatalf("Unable to write file: %v", err)
+			}
+		}
+		if available := NewDirectoryDatasource(dir).IsAvailable(); available != tt.available {
+			t.Errorf("bad availability (%q): want %t, got %t", tt.files, tt.available, available)
+		}
+	}
+
+	if NewDirectoryDatasource("/nonexistent").IsAvailable() {
+		t.Errorf("nonexistent directory is available")
+	}
+}
+
+func TestDirectoryFetchUserdata(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"20-site.yaml": "hostname: site\nssh_authorized_keys:\n  - key2\nwrite_files:\n  - path: /etc/a\n    content: site\n",
+		"10-base.yaml": "#cloud-config\nhostname: base\nssh_authorized_keys:\n  - key1\nwrite_files:\n  - path: /etc/a\n    content: base\n  - path: /etc/b\n    content: base\n",
+		"README":       "not a fragment",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Unable to write file: %v", err)
+		}
+	}
+
+	userdata, err := NewDirectoryDatasource(dir).FetchUserdata()
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	if !config.IsCloudConfig(string(userdata)) {
+		t.Fatalf("bad userdata: not a cloud-config: %q", userdata)
+	}
+	cfg, err := config.NewCloudConfig(string(userdata))
+	if err != nil {
+		t.Fatalf("bad userdata: %v", err)
+	}
+
+	if cfg.Hostname != "site" {
+		t.Errorf("bad hostname: want %q, got %q", "site", cfg.Hostname)
+	}
+	if keys := []string{"key1", "key2"}; !reflect.DeepEqual(keys, cfg.SSHAuthorizedKeys) {
+		t.Errorf("bad ssh_authorized_keys: want %q, got %q", keys, cfg.SSHAuthorizedKeys)
+	}
+	files := []config.File{{Path: "/etc/a", Content: "site"}, {Path: "/etc/b", Content: "base"}}
+	if !reflect.DeepEqual(files, cfg.WriteFiles) {
+		t.Errorf("bad write_files: want %#v, got %#v", files, cfg.WriteFiles)
+	}
+}
+
+func TestDirectoryFetchUserdataInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "10-bad.yaml"), []byte("hostname: [\n"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+	if _, err := NewDirectoryDatasource(dir).FetchUserdata(); err == nil {
+		t.Errorf("bad error: want non-nil, got nil")
+	}
+}
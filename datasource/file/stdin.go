@@ -0,0 +1,72 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+// stdin is a datasource which reads the user-data from a file which is not a
+// terminal, usually the standard input of coreos-cloudinit, so that it can be
+// piped in.
+type stdin struct {
+	file     *os.File
+	userdata []byte
+	read     bool
+}
+
+func NewStdinDatasource() *stdin {
+	return &stdin{file: os.Stdin}
+}
+
+// IsAvailable reports whether the user-data is piped in (or redirected from
+// a file) rather than typed on a terminal.
+func (s *stdin) IsAvailable() bool {
+	fi, err := s.file.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice == 0
+}
+
+func (s *stdin) AvailabilityChanges() bool {
+	return false
+}
+
+func (s *stdin) ConfigRoot() string {
+	return ""
+}
+
+func (s *stdin) FetchMetadata() (datasource.Metadata, error) {
+	return datasource.Metadata{}, nil
+}
+
+// FetchUserdata reads the user-data once; later calls return the same
+// user-data, since it can't be read again.
+func (s *stdin) FetchUserdata() ([]byte, error) {
+	if s.read {
+		return s.userdata, nil
+	}
+	userdata, err := ioutil.ReadAll(s.file)
+	if err != nil {
+		return nil, err
+	}
+	s.userdata, s.read = userdata, true
+	return userdata, nil
+}
+
+func (s *stdin) Type() string {
+	return "stdin"
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestStdinIsAvailable(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Unable to create pipe: %v", err)
+	}
+	defer r.Close()
+	w.Close()
+	if !(&stdin{file: r}).IsAvailable() {
+		t.Errorf("pipe is not available")
+	}
+
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("Unable to open %s: %v", os.DevNull, err)
+	}
+	defer null.Close()
+	if (&stdin{file: null}).IsAvailable() {
+		t.Errorf("character device is available")
+	}
+}
+
+func TestStdinFetchUserdata(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Unable to create pipe: %v", err)
+	}
+	defer r.Close()
+
+	userdata := "#cloud-config\nhostname: node1\n"
+	go func() {
+		w.Write([]byte(userdata))
+		w.Close()
+	}()
+
+	s := &stdin{file: r}
+	for i := 0; i < 2; i++ {
+		data, err := s.FetchUserdata()
+		if err != nil {
+			t.Fatalf("bad error: want nil, got %v", err)
+		}
+		if string(data) != userdata {
+			t.Errorf("bad user-data (%d): want %q, got %q", i, userdata, data)
+		}
+	}
+	if metadata, err := s.FetchMetadata(); err != nil || !reflect.DeepEqual(datasource.Metadata{}, metadata) {
+		t.Errorf("bad metadata: want empty, got %#v (%v)", metadata, err)
+	}
+}
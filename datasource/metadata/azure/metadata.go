@@ -0,0 +1,187 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+const (
+	DefaultAddress = "http://169.254.169.254/"
+	apiVersion     = "metadata/instance"
+	userdataPath   = "metadata/instance/compute/userData"
+	metadataPath   = "metadata/instance"
+
+	// userdataVersion is the oldest API version which exposes the user-data.
+	userdataVersion = "2021-01-01"
+)
+
+// apiVersions lists the IMDS API versions which are known to work, newest
+// first. IMDS rejects unsupported versions with a 400, so the first one which
+// is accepted is used for all subsequent requests.
+var apiVersions = []string{"2021-02-01", "2020-09-01", "2019-06-01"}
+
+type PublicKey struct {
+	KeyData string `json:"keyData"`
+	Path    string `json:"path"`
+}
+
+type OSProfile struct {
+	AdminUsername string `json:"adminUsername"`
+	ComputerName  string `json:"computerName"`
+}
+
+type Compute struct {
+	Name       string      `json:"name"`
+	Location   string      `json:"location"`
+	OSProfile  OSProfile   `json:"osProfile"`
+	PublicKeys []PublicKey `json:"publicKeys"`
+}
+
+type IPAddress struct {
+	PrivateIPAddress string `json:"privateIpAddress"`
+	PublicIPAddress  string `json:"publicIpAddress"`
+}
+
+type Interface struct {
+	IPv4 struct {
+		IPAddress []IPAddress `json:"ipAddress"`
+	} `json:"ipv4"`
+	IPv6 struct {
+		IPAddress []IPAddress `json:"ipAddress"`
+	} `json:"ipv6"`
+	MacAddress string `json:"macAddress"`
+}
+
+type Network struct {
+	Interfaces []Interface `json:"interface"`
+}
+
+type Instance struct {
+	Compute Compute `json:"compute"`
+	Network Network `json:"network"`
+}
+
+type metadataService struct {
+	metadata.MetadataService
+	version string
+}
+
+func NewDatasource(root string) *metadataService {
+	ms := metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)
+	// IMDS refuses requests without this header.
+	client := pkg.NewHttpClient()
+	client.Header.Set("Metadata", "true")
+	ms.Client = client
+	return &metadataService{MetadataService: ms}
+}
+
+func (ms *metadataService) IsAvailable() bool {
+	return ms.negotiateVersion() == nil
+}
+
+// negotiateVersion finds the newest API version supported by the service.
+func (ms *metadataService) negotiateVersion() error {
+	if ms.version != "" {
+		return nil
+	}
+
+	for _, version := range apiVersions {
+		_, err := ms.Client.Get(ms.url(ms.MetadataPath, version))
+		if err == nil {
+			ms.version = version
+			return nil
+		}
+		if _, ok := err.(pkg.ErrNotFound); !ok {
+			return err
+		}
+	}
+	return fmt.Errorf("none of the API versions %q are supported", apiVersions)
+}
+
+func (ms *metadataService) url(path, version string) string {
+	return ms.Root + path + "?api-version=" + version
+}
+
+func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data []byte
+	var instance Instance
+
+	if err = ms.negotiateVersion(); err != nil {
+		return
+	}
+	if data, err = ms.FetchData(ms.url(ms.MetadataPath, ms.version)); err != nil || len(data) == 0 {
+		return
+	}
+	if err = json.Unmarshal(data, &instance); err != nil {
+		return
+	}
+
+	if len(instance.Network.Interfaces) > 0 {
+		iface := instance.Network.Interfaces[0]
+		if len(iface.IPv4.IPAddress) > 0 {
+			metadata.PrivateIPv4 = net.ParseIP(iface.IPv4.IPAddress[0].PrivateIPAddress)
+			metadata.PublicIPv4 = net.ParseIP(iface.IPv4.IPAddress[0].PublicIPAddress)
+		}
+		if len(iface.IPv6.IPAddress) > 0 {
+			metadata.PrivateIPv6 = net.ParseIP(iface.IPv6.IPAddress[0].PrivateIPAddress)
+			metadata.PublicIPv6 = net.ParseIP(iface.IPv6.IPAddress[0].PublicIPAddress)
+		}
+	}
+
+	metadata.Hostname = instance.Compute.OSProfile.ComputerName
+	if metadata.Hostname == "" {
+		metadata.Hostname = instance.Compute.Name
+	}
+	metadata.SSHPublicKeys = map[string]string{}
+	for i, pk := range instance.Compute.PublicKeys {
+		if key := strings.TrimSpace(pk.KeyData); key != "" {
+			metadata.SSHPublicKeys[strconv.Itoa(i)] = key
+		}
+	}
+
+	return
+}
+
+// FetchUserdata retrieves the user-data, which IMDS serves base64 encoded.
+func (ms *metadataService) FetchUserdata() ([]byte, error) {
+	if err := ms.negotiateVersion(); err != nil {
+		return nil, err
+	}
+	if ms.version < userdataVersion {
+		log.Printf("Azure API version %s does not provide user-data", ms.version)
+		return []byte{}, nil
+	}
+
+	data, err := ms.FetchData(ms.url(ms.UserdataPath, ms.version) + "&format=text")
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+}
+
+func (ms metadataService) Type() string {
+	return "azure-metadata-service"
+}
@@ -0,0 +1,212 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/test"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func newService(resources map[string]string, err error) *metadataService {
+	return &metadataService{
+		MetadataService: metadata.MetadataService{
+			Root:         "/",
+			Client:       &test.HttpClient{Resources: resources, Err: err},
+			MetadataPath: metadataPath,
+			UserdataPath: userdataPath,
+		},
+	}
+}
+
+func TestType(t *testing.T) {
+	want := "azure-metadata-service"
+	if kind := (metadataService{}).Type(); kind != want {
+		t.Fatalf("bad type: want %q, got %q", want, kind)
+	}
+}
+
+func TestMetadataHeader(t *testing.T) {
+	client := NewDatasource(DefaultAddress).Client.(*pkg.HttpClient)
+	if header := client.Header.Get("Metadata"); header != "true" {
+		t.Fatalf("bad Metadata header: want %q, got %q", "true", header)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	for _, tt := range []struct {
+		resources map[string]string
+		clientErr error
+
+		version   string
+		available bool
+	}{
+		{
+			resources: map[string]string{"/metadata/instance?api-version=2021-02-01": "{}"},
+			version:   "2021-02-01",
+			available: true,
+		},
+		{
+			resources: map[string]string{"/metadata/instance?api-version=2019-06-01": "{}"},
+			version:   "2019-06-01",
+			available: true,
+		},
+		{
+			resources: map[string]string{},
+		},
+		{
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		service := newService(tt.resources, tt.clientErr)
+		if available := service.IsAvailable(); available != tt.available {
+			t.Errorf("bad availability (%q): want %t, got %t", tt.resources, tt.available, available)
+		}
+		if service.version != tt.version {
+			t.Errorf("bad version (%q): want %q, got %q", tt.resources, tt.version, service.version)
+		}
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		resources map[string]string
+		expect    datasource.Metadata
+		clientErr error
+		expectErr error
+	}{
+		{
+			resources: map[string]string{
+				"/metadata/instance?api-version=2021-02-01": "bad",
+			},
+			expectErr: fmt.Errorf("invalid character 'b' looking for beginning of value"),
+		},
+		{
+			resources: map[string]string{
+				"/metadata/instance?api-version=2020-09-01": `{
+  "compute": {
+    "location": "westeurope",
+    "name": "vm-1",
+    "osProfile": {
+      "adminUsername": "core",
+      "computerName": "coreos-1"
+    },
+    "publicKeys": [
+      {"keyData": "publickey1\n", "path": "/home/core/.ssh/authorized_keys"},
+      {"keyData": "publickey2", "path": "/home/core/.ssh/authorized_keys"}
+    ]
+  },
+  "network": {
+    "interface": [
+      {
+        "ipv4": {
+          "ipAddress": [{"privateIpAddress": "10.0.0.4", "publicIpAddress": "40.1.2.3"}],
+          "subnet": [{"address": "10.0.0.0", "prefix": "24"}]
+        },
+        "ipv6": {
+          "ipAddress": [{"privateIpAddress": "fd00::4"}]
+        },
+        "macAddress": "000D3A123456"
+      }
+    ]
+  }
+}`,
+			},
+			expect: datasource.Metadata{
+				Hostname:    "coreos-1",
+				PrivateIPv4: net.ParseIP("10.0.0.4"),
+				PublicIPv4:  net.ParseIP("40.1.2.3"),
+				PrivateIPv6: net.ParseIP("fd00::4"),
+				SSHPublicKeys: map[string]string{
+					"0": "publickey1",
+					"1": "publickey2",
+				},
+			},
+		},
+		{
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		metadata, err := newService(tt.resources, tt.clientErr).FetchMetadata()
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.resources, tt.expectErr, err)
+		}
+		if !reflect.DeepEqual(tt.expect, metadata) {
+			t.Fatalf("bad fetch (%q): want %#v, got %#v", tt.resources, tt.expect, metadata)
+		}
+	}
+}
+
+func TestFetchUserdata(t *testing.T) {
+	for _, tt := range []struct {
+		resources map[string]string
+		userdata  string
+		expectErr bool
+	}{
+		{
+			resources: map[string]string{
+				"/metadata/instance?api-version=2021-02-01":                              "{}",
+				"/metadata/instance/compute/userData?api-version=2021-02-01&format=text": "I2Nsb3VkLWNvbmZpZwo=",
+			},
+			userdata: "#cloud-config\n",
+		},
+		{
+			resources: map[string]string{
+				"/metadata/instance?api-version=2021-02-01": "{}",
+			},
+			userdata: "",
+		},
+		{
+			resources: map[string]string{
+				"/metadata/instance?api-version=2019-06-01":                              "{}",
+				"/metadata/instance/compute/userData?api-version=2019-06-01&format=text": "I2Nsb3VkLWNvbmZpZwo=",
+			},
+			userdata: "",
+		},
+		{
+			resources: map[string]string{
+				"/metadata/instance?api-version=2021-02-01":                              "{}",
+				"/metadata/instance/compute/userData?api-version=2021-02-01&format=text": "!!!",
+			},
+			expectErr: true,
+		},
+		{
+			resources: map[string]string{},
+			expectErr: true,
+		},
+	} {
+		data, err := newService(tt.resources, nil).FetchUserdata()
+		if tt.expectErr != (err != nil) {
+			t.Fatalf("bad error (%q): want %t, got %v", tt.resources, tt.expectErr, err)
+		}
+		if string(data) != tt.userdata {
+			t.Fatalf("bad userdata (%q): want %q, got %q", tt.resources, tt.userdata, data)
+		}
+	}
+}
+
+func Error(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudstack
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+)
+
+const (
+	apiVersion   = "latest/"
+	userdataPath = apiVersion + "user-data"
+	metadataPath = apiVersion + "meta-data"
+)
+
+// LeaseFiles are the globs matching the DHCP lease files of systemd-networkd
+// and dhclient, which are searched in order for the address of the DHCP
+// server, which is also the CloudStack metadata server.
+var LeaseFiles = []string{
+	"/run/systemd/netif/leases/*",
+	"/var/lib/dhclient/*.lease*",
+	"/var/lib/dhcp/dhclient*.lease*",
+}
+
+type metadataService struct {
+	metadata.MetadataService
+	leaseFiles []string
+}
+
+// NewDatasource creates a CloudStack metadata datasource rooted at root. If
+// root is empty, the metadata server is looked up in the DHCP leases every
+// time the availability of the datasource is checked, until one is found.
+func NewDatasource(root string) *metadataService {
+	ms := &metadataService{MetadataService: metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)}
+	if root == "" {
+		ms.Root = ""
+		ms.leaseFiles = LeaseFiles
+	}
+	return ms
+}
+
+func (ms *metadataService) IsAvailable() bool {
+	if ms.Root == "" {
+		server := dhcpServer(ms.leaseFiles)
+		if server == "" {
+			return false
+		}
+		log.Printf("Found DHCP server %s in the leases, using it as the metadata server\n", server)
+		ms.Root = "http://" + server + "/"
+	}
+	return ms.MetadataService.IsAvailable()
+}
+
+func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data []byte
+
+	if data, err = ms.fetchAttribute("instance-id"); err != nil {
+		return
+	} else if len(data) > 0 {
+		log.Printf("Fetching metadata of instance %s\n", data)
+	}
+
+	if data, err = ms.fetchAttribute("local-hostname"); err != nil {
+		return
+	}
+	metadata.Hostname = string(data)
+
+	if data, err = ms.fetchAttribute("local-ipv4"); err != nil {
+		return
+	}
+	metadata.PrivateIPv4 = net.ParseIP(string(data))
+
+	if data, err = ms.fetchAttribute("public-ipv4"); err != nil {
+		return
+	}
+	metadata.PublicIPv4 = net.ParseIP(string(data))
+
+	if data, err = ms.fetchAttribute("public-keys"); err != nil {
+		return
+	}
+	for i, key := range strings.Split(string(data), "\n") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		if metadata.SSHPublicKeys == nil {
+			metadata.SSHPublicKeys = map[string]string{}
+		}
+		metadata.SSHPublicKeys[strconv.Itoa(i)] = key
+	}
+
+	return
+}
+
+func (ms metadataService) Type() string {
+	return "cloudstack-metadata-service"
+}
+
+// fetchAttribute returns the given meta-data attribute without surrounding
+// whitespace, or nothing if it doesn't exist.
+func (ms metadataService) fetchAttribute(name string) ([]byte, error) {
+	data, err := ms.FetchData(ms.MetadataUrl() + "/" + name)
+	return bytes.TrimSpace(data), err
+}
+
+// dhcpServer returns the address of the DHCP server found in the first of the
+// lease files matching the given globs which has one.
+func dhcpServer(globs []string) string {
+	for _, glob := range globs {
+		paths, err := filepath.Glob(glob)
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			f, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			server := dhcpServerAddress(f)
+			f.Close()
+			if server != "" {
+				return server
+			}
+		}
+	}
+	return ""
+}
+
+// dhcpServerAddress reads a systemd-networkd (SERVER_ADDRESS=<ip>) or dhclient
+// (option dhcp-server-identifier <ip>;) lease file and returns the address of
+// the DHCP server. dhclient appends renewed leases to the file, so the last
+// address wins.
+func dhcpServerAddress(r io.Reader) (server string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var value string
+		if strings.HasPrefix(line, "SERVER_ADDRESS=") {
+			value = strings.TrimPrefix(line, "SERVER_ADDRESS=")
+		} else if strings.HasPrefix(line, "option dhcp-server-identifier ") {
+			value = strings.TrimSuffix(strings.TrimPrefix(line, "option dhcp-server-identifier "), ";")
+		}
+		if ip := net.ParseIP(strings.TrimSpace(value)); ip.To4() != nil {
+			server = ip.String()
+		}
+	}
+	return
+}
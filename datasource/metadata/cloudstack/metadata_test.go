@@ -0,0 +1,217 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudstack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/test"
+)
+
+const (
+	networkdLease = `# This is private data. Do not parse.
+ADDRESS=10.1.1.23
+NETMASK=255.255.255.0
+ROUTER=10.1.1.1
+SERVER_ADDRESS=10.1.1.1
+NEXT_SERVER=10.1.1.1
+T1=43200
+T2=75600
+LIFETIME=86400
+DNS=10.1.1.1
+DOMAINNAME=cs1cloud.internal
+HOSTNAME=host
+CLIENTID=ff1f6b0e6300020000ab11e1c8ea7c6a9bd371
+`
+	dhclientLease = `lease {
+  interface "eth0";
+  fixed-address 10.1.1.23;
+  option subnet-mask 255.255.255.0;
+  option routers 10.1.1.1;
+  option dhcp-lease-time 86400;
+  option dhcp-message-type 5;
+  option domain-name-servers 10.1.1.1;
+  option dhcp-server-identifier 10.1.1.1;
+  renew 4 2016/05/26 20:14:28;
+}
+lease {
+  interface "eth0";
+  fixed-address 10.1.1.23;
+  option dhcp-server-identifier 10.1.1.2;
+  renew 5 2016/05/27 08:14:28;
+}
+`
+)
+
+func TestType(t *testing.T) {
+	want := "cloudstack-metadata-service"
+	if kind := (metadataService{}).Type(); kind != want {
+		t.Fatalf("bad type: want %q, got %q", want, kind)
+	}
+}
+
+func TestDHCPServer(t *testing.T) {
+	for _, tt := range []struct {
+		files map[string]string
+		globs []string
+
+		server string
+	}{
+		{
+			files:  map[string]string{},
+			globs:  []string{"leases/*", "*.lease"},
+			server: "",
+		},
+		{
+			files:  map[string]string{"leases/2": networkdLease},
+			globs:  []string{"leases/*", "*.lease"},
+			server: "10.1.1.1",
+		},
+		{
+			files:  map[string]string{"dhclient-eth0.lease": dhclientLease},
+			globs:  []string{"leases/*", "*.lease"},
+			server: "10.1.1.2",
+		},
+		{
+			files:  map[string]string{"leases/1": "ADDRESS=10.1.1.23\n", "leases/2": networkdLease, "dhclient-eth0.lease": dhclientLease},
+			globs:  []string{"leases/*", "*.lease"},
+			server: "10.1.1.1",
+		},
+		{
+			files:  map[string]string{"leases/2": "SERVER_ADDRESS=fe80::1\n"},
+			globs:  []string{"leases/*"},
+			server: "",
+		},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := os.Mkdir(filepath.Join(dir, "leases"), 0755); err != nil {
+			t.Fatalf("Unable to create directory: %v", err)
+		}
+		for name, contents := range tt.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+				t.Fatalf("Unable to write file: %v", err)
+			}
+		}
+		var globs []string
+		for _, glob := range tt.globs {
+			globs = append(globs, filepath.Join(dir, glob))
+		}
+
+		if server := dhcpServer(globs); server != tt.server {
+			t.Errorf("bad DHCP server (%q): want %q, got %q", tt.files, tt.server, server)
+		}
+	}
+}
+
+func TestIsAvailable(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ms := NewDatasource("")
+	ms.leaseFiles = []string{filepath.Join(dir, "*")}
+	ms.Client = &test.HttpClient{Resources: map[string]string{"http://10.1.1.1/latest/": ""}}
+	if ms.IsAvailable() {
+		t.Fatalf("bad availability without lease: want false, got true")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "2"), []byte(networkdLease), 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+	if !ms.IsAvailable() {
+		t.Fatalf("bad availability with lease: want true, got false")
+	}
+	if root := "http://10.1.1.1/"; ms.ConfigRoot() != root {
+		t.Fatalf("bad config root: want %q, got %q", root, ms.ConfigRoot())
+	}
+	if url := "http://10.1.1.1/latest/user-data"; ms.UserdataUrl() != url {
+		t.Fatalf("bad user-data url: want %q, got %q", url, ms.UserdataUrl())
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		root      string
+		resources map[string]string
+		clientErr error
+
+		metadata datasource.Metadata
+		err      error
+	}{
+		{
+			root:      "http://10.1.1.1/",
+			resources: map[string]string{},
+		},
+		{
+			root: "http://10.1.1.1/",
+			resources: map[string]string{
+				"http://10.1.1.1/latest/meta-data/instance-id":    "8b4ac4a4-8f0e-4b2b-9e4b-4ac9f2645e49\n",
+				"http://10.1.1.1/latest/meta-data/local-hostname": "host\n",
+				"http://10.1.1.1/latest/meta-data/local-ipv4":     "10.1.1.23",
+				"http://10.1.1.1/latest/meta-data/public-ipv4":    "203.0.113.23",
+				"http://10.1.1.1/latest/meta-data/public-keys":    "ssh-rsa AAAA alice\n\nssh-rsa BBBB bob\n",
+			},
+			metadata: datasource.Metadata{
+				Hostname:      "host",
+				PrivateIPv4:   net.ParseIP("10.1.1.23"),
+				PublicIPv4:    net.ParseIP("203.0.113.23"),
+				SSHPublicKeys: map[string]string{"0": "ssh-rsa AAAA alice", "2": "ssh-rsa BBBB bob"},
+			},
+		},
+		{
+			root:      "http://10.1.1.1/",
+			clientErr: fmt.Errorf("test error"),
+			err:       fmt.Errorf("test error"),
+		},
+	} {
+		service := &metadataService{MetadataService: metadata.MetadataService{
+			Root:         tt.root,
+			Client:       &test.HttpClient{Resources: tt.resources, Err: tt.clientErr},
+			MetadataPath: metadataPath,
+		}}
+		metadata, err := service.FetchMetadata()
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%q): want %v, got %v", tt.resources, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.metadata, metadata) {
+			t.Errorf("bad fetch (%q): want %#v, got %#v", tt.resources, tt.metadata, metadata)
+		}
+	}
+}
+
+func TestFetchUserdata(t *testing.T) {
+	ms := NewDatasource("http://10.1.1.1")
+	ms.Client = &test.HttpClient{Resources: map[string]string{"http://10.1.1.1/latest/user-data": "#cloud-config\n"}}
+	userdata, err := ms.FetchUserdata()
+	if err != nil || !strings.HasPrefix(string(userdata), "#cloud-config") {
+		t.Fatalf("bad user-data: want %q, got %q (%v)", "#cloud-config\n", userdata, err)
+	}
+}
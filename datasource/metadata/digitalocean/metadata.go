@@ -97,6 +97,11 @@ func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err er
 		}
 	}
 	metadata.Hostname = m.Hostname
+	for _, ns := range m.DNS.Nameservers {
+		if ip := net.ParseIP(ns); ip != nil {
+			metadata.Nameservers = append(metadata.Nameservers, ip)
+		}
+	}
 	metadata.SSHPublicKeys = map[string]string{}
 	for i, key := range m.PublicKeys {
 		metadata.SSHPublicKeys[strconv.Itoa(i)] = key
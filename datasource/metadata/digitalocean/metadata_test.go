@@ -63,6 +63,12 @@ func TestFetchMetadata(t *testing.T) {
     "publickey2"
   ],
   "region": "nyc2",
+  "dns": {
+    "nameservers": [
+      "8.8.8.8",
+      "8.8.4.4"
+    ]
+  },
   "interfaces": {
     "public": [
       {
@@ -86,6 +92,10 @@ func TestFetchMetadata(t *testing.T) {
 			expect: datasource.Metadata{
 				PublicIPv4: net.ParseIP("192.168.1.2"),
 				PublicIPv6: net.ParseIP("fe00::"),
+				Nameservers: []net.IP{
+					net.ParseIP("8.8.8.8"),
+					net.ParseIP("8.8.4.4"),
+				},
 				SSHPublicKeys: map[string]string{
 					"0": "publickey1",
 					"1": "publickey2",
@@ -110,6 +120,97 @@ func TestFetchMetadata(t *testing.T) {
 						},
 					},
 					PublicKeys: []string{"publickey1", "publickey2"},
+					DNS: DNS{
+						Nameservers: []string{"8.8.8.8", "8.8.4.4"},
+					},
+				},
+			},
+		},
+		{
+			root:         "/",
+			metadataPath: "v1.json",
+			resources: map[string]string{
+				"/v1.json": `{
+  "droplet_id": 2756294,
+  "hostname": "sample-droplet",
+  "interfaces": {
+    "public": [
+      {
+        "ipv4": {
+          "ip_address": "104.131.20.105",
+          "netmask": "255.255.192.0",
+          "gateway": "104.131.0.1"
+        },
+        "anchor_ipv4": {
+          "ip_address": "10.17.0.5",
+          "netmask": "255.255.0.0",
+          "gateway": "10.17.0.1"
+        },
+        "mac": "04:01:2a:0f:2a:01",
+        "type": "public"
+      }
+    ],
+    "private": [
+      {
+        "ipv4": {
+          "ip_address": "10.132.255.113",
+          "netmask": "255.255.0.0",
+          "gateway": "10.132.0.1"
+        },
+        "ipv6": {
+          "ip_address": "fd00::2",
+          "cidr": 64,
+          "gateway": "fd00::1"
+        },
+        "mac": "04:01:2a:0f:2a:02",
+        "type": "private"
+      }
+    ]
+  }
+}`,
+			},
+			expect: datasource.Metadata{
+				Hostname:      "sample-droplet",
+				PublicIPv4:    net.ParseIP("104.131.20.105"),
+				PrivateIPv4:   net.ParseIP("10.132.255.113"),
+				PrivateIPv6:   net.ParseIP("fd00::2"),
+				SSHPublicKeys: map[string]string{},
+				NetworkConfig: Metadata{
+					Hostname: "sample-droplet",
+					Interfaces: Interfaces{
+						Public: []Interface{
+							{
+								IPv4: &Address{
+									IPAddress: "104.131.20.105",
+									Netmask:   "255.255.192.0",
+									Gateway:   "104.131.0.1",
+								},
+								AnchorIPv4: &Address{
+									IPAddress: "10.17.0.5",
+									Netmask:   "255.255.0.0",
+									Gateway:   "10.17.0.1",
+								},
+								MAC:  "04:01:2a:0f:2a:01",
+								Type: "public",
+							},
+						},
+						Private: []Interface{
+							{
+								IPv4: &Address{
+									IPAddress: "10.132.255.113",
+									Netmask:   "255.255.0.0",
+									Gateway:   "10.132.0.1",
+								},
+								IPv6: &Address{
+									IPAddress: "fd00::2",
+									Cidr:      64,
+									Gateway:   "fd00::1",
+								},
+								MAC:  "04:01:2a:0f:2a:02",
+								Type: "private",
+							},
+						},
+					},
 				},
 			},
 		},
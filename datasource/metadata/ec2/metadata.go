@@ -38,8 +38,13 @@ type metadataService struct {
 	metadata.MetadataService
 }
 
-func NewDatasource(root string) *metadataService {
-	return &metadataService{metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)}
+// NewDatasource creates an EC2 metadata datasource rooted at root. Requests
+// are made using IMDSv2 session tokens when the service supports them; if
+// v2Only is set, requests fail rather than falling back to IMDSv1.
+func NewDatasource(root string, v2Only bool) *metadataService {
+	ms := metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)
+	ms.Client = newTokenClient(ms.Root, v2Only)
+	return &metadataService{ms}
 }
 
 func (ms metadataService) FetchMetadata() (datasource.Metadata, error) {
@@ -0,0 +1,103 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ec2
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+const (
+	tokenPath      = "latest/api/token"
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	tokenTTL       = 6 * time.Hour
+	// tokenSlack is subtracted from the TTL so that a token is never sent
+	// right as it expires.
+	tokenSlack = time.Minute
+)
+
+// tokenClient is a pkg.Getter which obtains an IMDSv2 session token before
+// making requests and attaches it to every request. If the metadata service
+// does not support session tokens (i.e. the token request is refused with a
+// 403 or 404), it falls back to plain IMDSv1 requests unless v2Only is set.
+// Any other refusal of the token request is an error.
+type tokenClient struct {
+	*pkg.HttpClient
+	root   string
+	v2Only bool
+
+	token   string
+	expires time.Time
+	v1      bool
+}
+
+func newTokenClient(root string, v2Only bool) *tokenClient {
+	if !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	return &tokenClient{HttpClient: pkg.NewHttpClient(), root: root, v2Only: v2Only}
+}
+
+func (c *tokenClient) Get(url string) ([]byte, error) {
+	if err := c.refreshToken(); err != nil {
+		return nil, err
+	}
+	return c.HttpClient.Get(url)
+}
+
+func (c *tokenClient) GetRetry(url string) ([]byte, error) {
+	if err := c.refreshToken(); err != nil {
+		return nil, err
+	}
+	return c.HttpClient.GetRetry(url)
+}
+
+// refreshToken requests a new session token if there is no cached token or
+// the cached one is about to expire.
+func (c *tokenClient) refreshToken() error {
+	if c.v1 || (c.token != "" && time.Now().Before(c.expires)) {
+		return nil
+	}
+
+	header := http.Header{}
+	header.Set(tokenTTLHeader, strconv.Itoa(int(tokenTTL/time.Second)))
+	token, err := c.Request("PUT", c.root+tokenPath, header)
+	if err != nil {
+		c.token = ""
+		c.Header.Del(tokenHeader)
+		if c.v2Only {
+			return err
+		}
+		if e, ok := err.(pkg.ErrNotFound); ok {
+			if e.StatusCode != http.StatusForbidden && e.StatusCode != http.StatusNotFound {
+				return err
+			}
+			log.Printf("Metadata service does not support session tokens (%v), falling back to IMDSv1\n", err)
+			c.v1 = true
+		}
+		return nil
+	}
+
+	c.token = strings.TrimSpace(string(token))
+	c.expires = time.Now().Add(tokenTTL - tokenSlack)
+	c.Header.Set(tokenHeader, c.token)
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ec2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func TestTokenClient(t *testing.T) {
+	for _, tt := range []struct {
+		tokenStatus int
+		v2Only      bool
+
+		puts  int
+		token string
+		err   bool
+	}{
+		{tokenStatus: http.StatusOK, puts: 1, token: "secret"},
+		{tokenStatus: http.StatusOK, v2Only: true, puts: 1, token: "secret"},
+		{tokenStatus: http.StatusForbidden, puts: 1},
+		{tokenStatus: http.StatusNotFound, puts: 1},
+		{tokenStatus: http.StatusForbidden, v2Only: true, puts: 3, err: true},
+		{tokenStatus: http.StatusBadRequest, puts: 3, err: true},
+		{tokenStatus: http.StatusMethodNotAllowed, puts: 3, err: true},
+	} {
+		puts := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "PUT" && r.URL.Path == "/"+tokenPath {
+				puts++
+				if ttl := r.Header.Get(tokenTTLHeader); ttl != "21600" {
+					t.Errorf("bad token ttl: want %q, got %q", "21600", ttl)
+				}
+				if tt.tokenStatus != http.StatusOK {
+					http.Error(w, "", tt.tokenStatus)
+					return
+				}
+				fmt.Fprint(w, "secret")
+				return
+			}
+			fmt.Fprint(w, r.Header.Get(tokenHeader))
+		}))
+
+		client := newTokenClient(ts.URL, tt.v2Only)
+		client.MaxRetries = 1
+		for i := 0; i < 3; i++ {
+			token, err := client.GetRetry(ts.URL + "/" + metadataPath)
+			if tt.err != (err != nil) {
+				t.Errorf("bad error (%d, %t): want %t, got %v", tt.tokenStatus, tt.v2Only, tt.err, err)
+			}
+			if string(token) != tt.token {
+				t.Errorf("bad token (%d, %t): want %q, got %q", tt.tokenStatus, tt.v2Only, tt.token, token)
+			}
+		}
+		if puts != tt.puts {
+			t.Errorf("bad number of token requests (%d, %t): want %d, got %d", tt.tokenStatus, tt.v2Only, tt.puts, puts)
+		}
+		ts.Close()
+	}
+}
+
+func TestTokenClientUserAgent(t *testing.T) {
+	defer func(ua string) { pkg.DefaultUserAgent = ua }(pkg.DefaultUserAgent)
+	pkg.DefaultUserAgent = "coreos-cloudinit/1.2.3"
+
+	var userAgents []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Method+" "+r.Header.Get("User-Agent"))
+		fmt.Fprint(w, "secret")
+	}))
+	defer ts.Close()
+
+	if _, err := NewDatasource(ts.URL, false).FetchUserdata(); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	want := []string{"PUT coreos-cloudinit/1.2.3", "GET coreos-cloudinit/1.2.3"}
+	if !reflect.DeepEqual(want, userAgents) {
+		t.Fatalf("bad user agents: want %q, got %q", want, userAgents)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/yaml"
+)
+
+const (
+	DefaultAddress      = "http://169.254.169.254/"
+	apiVersion          = "hetzner/v1/"
+	userdataPath        = apiVersion + "userdata"
+	metadataPath        = apiVersion + "metadata"
+	privateNetworksPath = metadataPath + "/private-networks"
+)
+
+type Subnet struct {
+	Type           string   `yaml:"type"`
+	Address        string   `yaml:"address"`
+	Gateway        string   `yaml:"gateway"`
+	IPv4           bool     `yaml:"ipv4"`
+	IPv6           bool     `yaml:"ipv6"`
+	DNSNameservers []string `yaml:"dns_nameservers"`
+}
+
+type Interface struct {
+	Name       string   `yaml:"name"`
+	Type       string   `yaml:"type"`
+	MACAddress string   `yaml:"mac_address"`
+	Subnets    []Subnet `yaml:"subnets"`
+}
+
+type NetworkConfig struct {
+	Version int         `yaml:"version"`
+	Config  []Interface `yaml:"config"`
+}
+
+type PrivateNetwork struct {
+	IP           string   `yaml:"ip"`
+	AliasIPs     []string `yaml:"alias_ips"`
+	InterfaceNum int      `yaml:"interface_num"`
+	MACAddress   string   `yaml:"mac_address"`
+	NetworkID    int      `yaml:"network_id"`
+	NetworkName  string   `yaml:"network_name"`
+	Network      string   `yaml:"network"`
+	Subnet       string   `yaml:"subnet"`
+	Gateway      string   `yaml:"gateway"`
+}
+
+type Metadata struct {
+	Hostname         string        `yaml:"hostname"`
+	InstanceID       int           `yaml:"instance_id"`
+	Region           string        `yaml:"region"`
+	AvailabilityZone string        `yaml:"availability_zone"`
+	PublicIPv4       string        `yaml:"public_ipv4"`
+	PublicKeys       []string      `yaml:"public_keys"`
+	NetworkConfig    NetworkConfig `yaml:"network_config"`
+
+	PrivateNetworks []PrivateNetwork `yaml:"-"`
+}
+
+type metadataService struct {
+	metadata.MetadataService
+}
+
+func NewDatasource(root string) *metadataService {
+	return &metadataService{MetadataService: metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)}
+}
+
+func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data []byte
+	var m Metadata
+
+	if data, err = ms.FetchData(ms.MetadataUrl()); err != nil || len(data) == 0 {
+		return
+	}
+	if err = unmarshal(data, &m); err != nil {
+		return
+	}
+
+	if data, err = ms.FetchData(ms.Root + privateNetworksPath); err != nil {
+		return
+	}
+	if len(data) > 0 {
+		if err = unmarshal(data, &m.PrivateNetworks); err != nil {
+			return
+		}
+	}
+
+	metadata.Hostname = m.Hostname
+	metadata.PublicIPv4 = net.ParseIP(m.PublicIPv4)
+	for _, iface := range m.NetworkConfig.Config {
+		for _, subnet := range iface.Subnets {
+			if subnet.IPv6 && subnet.Type == "static" && metadata.PublicIPv6 == nil {
+				if ip, _, err := net.ParseCIDR(subnet.Address); err == nil {
+					metadata.PublicIPv6 = ip
+				} else {
+					metadata.PublicIPv6 = net.ParseIP(subnet.Address)
+				}
+			}
+			for _, ns := range subnet.DNSNameservers {
+				if ip := net.ParseIP(ns); ip != nil {
+					metadata.Nameservers = append(metadata.Nameservers, ip)
+				}
+			}
+		}
+	}
+	if len(m.PrivateNetworks) > 0 {
+		metadata.PrivateIPv4 = net.ParseIP(m.PrivateNetworks[0].IP)
+	}
+	metadata.SSHPublicKeys = map[string]string{}
+	for i, key := range m.PublicKeys {
+		metadata.SSHPublicKeys[strconv.Itoa(i)] = key
+	}
+	metadata.NetworkConfig = m
+
+	return
+}
+
+func (ms metadataService) Type() string {
+	return "hetzner-metadata-service"
+}
+
+// unmarshal parses the YAML metadata documents, whose dashed keys are matched
+// with the underscored tags after the same key transform as used for
+// cloud-configs.
+func unmarshal(data []byte, v interface{}) error {
+	yaml.UnmarshalMappingKeyTransform = func(nameIn string) (nameOut string) {
+		return strings.Replace(nameIn, "-", "_", -1)
+	}
+	return yaml.Unmarshal(data, v)
+}
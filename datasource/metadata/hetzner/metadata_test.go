@@ -0,0 +1,190 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/test"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func TestType(t *testing.T) {
+	want := "hetzner-metadata-service"
+	if kind := (metadataService{}).Type(); kind != want {
+		t.Fatalf("bad type: want %q, got %q", want, kind)
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		root         string
+		metadataPath string
+		resources    map[string]string
+		expect       datasource.Metadata
+		clientErr    error
+		expectErr    error
+	}{
+		{
+			root:         "/",
+			metadataPath: "hetzner/v1/metadata",
+			resources: map[string]string{
+				"/hetzner/v1/metadata": "hostname: [",
+			},
+			expectErr: fmt.Errorf("YAML error: line 1: did not find expected node content"),
+		},
+		{
+			root:         "/",
+			metadataPath: "hetzner/v1/metadata",
+			resources: map[string]string{
+				"/hetzner/v1/metadata": `availability-zone: fsn1-dc14
+hostname: coreos-1
+instance-id: 4711
+local-ipv4: ''
+network-config:
+  config:
+  - mac_address: 96:00:00:1a:2b:3c
+    name: eth0
+    subnets:
+    - dns_nameservers:
+      - 185.12.64.1
+      - 185.12.64.2
+      ipv4: true
+      type: dhcp
+    - address: 2a01:4f8:c2c:1234::1/64
+      dns_nameservers:
+      - 2a01:4ff:ff00::add:1
+      gateway: fe80::1
+      ipv6: true
+      type: static
+    type: physical
+  version: 1
+public-ipv4: 203.0.113.10
+public-keys:
+- ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@example
+region: eu-central
+`,
+				"/hetzner/v1/metadata/private-networks": `- ip: 10.0.0.2
+  alias_ips: []
+  interface_num: 1
+  mac_address: 86:00:00:2a:7d:e0
+  network_id: 1234
+  network_name: internal
+  network: 10.0.0.0/16
+  subnet: 10.0.0.0/24
+  gateway: 10.0.0.1
+`,
+			},
+			expect: datasource.Metadata{
+				Hostname:    "coreos-1",
+				PublicIPv4:  net.ParseIP("203.0.113.10"),
+				PublicIPv6:  net.ParseIP("2a01:4f8:c2c:1234::1"),
+				PrivateIPv4: net.ParseIP("10.0.0.2"),
+				Nameservers: []net.IP{
+					net.ParseIP("185.12.64.1"),
+					net.ParseIP("185.12.64.2"),
+					net.ParseIP("2a01:4ff:ff00::add:1"),
+				},
+				SSHPublicKeys: map[string]string{
+					"0": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@example",
+				},
+				NetworkConfig: Metadata{
+					Hostname:         "coreos-1",
+					InstanceID:       4711,
+					Region:           "eu-central",
+					AvailabilityZone: "fsn1-dc14",
+					PublicIPv4:       "203.0.113.10",
+					PublicKeys:       []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@example"},
+					NetworkConfig: NetworkConfig{
+						Version: 1,
+						Config: []Interface{{
+							Name:       "eth0",
+							Type:       "physical",
+							MACAddress: "96:00:00:1a:2b:3c",
+							Subnets: []Subnet{
+								{
+									Type:           "dhcp",
+									IPv4:           true,
+									DNSNameservers: []string{"185.12.64.1", "185.12.64.2"},
+								},
+								{
+									Type:           "static",
+									Address:        "2a01:4f8:c2c:1234::1/64",
+									Gateway:        "fe80::1",
+									IPv6:           true,
+									DNSNameservers: []string{"2a01:4ff:ff00::add:1"},
+								},
+							},
+						}},
+					},
+					PrivateNetworks: []PrivateNetwork{{
+						IP:           "10.0.0.2",
+						InterfaceNum: 1,
+						MACAddress:   "86:00:00:2a:7d:e0",
+						NetworkID:    1234,
+						NetworkName:  "internal",
+						Network:      "10.0.0.0/16",
+						Subnet:       "10.0.0.0/24",
+						Gateway:      "10.0.0.1",
+					}},
+				},
+			},
+		},
+		{
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		service := &metadataService{
+			MetadataService: metadata.MetadataService{
+				Root:         tt.root,
+				Client:       &test.HttpClient{Resources: tt.resources, Err: tt.clientErr},
+				MetadataPath: tt.metadataPath,
+			},
+		}
+		metadata, err := service.FetchMetadata()
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.resources, tt.expectErr, err)
+		}
+		if !reflect.DeepEqual(tt.expect, metadata) {
+			t.Fatalf("bad fetch (%q): want %#v, got %#v", tt.resources, tt.expect, metadata)
+		}
+	}
+}
+
+func TestFetchUserdata(t *testing.T) {
+	userdata := "#cloud-config\nhostname: coreos-1\n"
+	service := NewDatasource("/")
+	service.Client = &test.HttpClient{Resources: map[string]string{"/hetzner/v1/userdata": userdata}}
+	data, err := service.FetchUserdata()
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+	if string(data) != userdata {
+		t.Fatalf("bad userdata: want %q, got %q", userdata, data)
+	}
+}
+
+func Error(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -17,6 +17,7 @@ package metadata
 import (
 	"strings"
 
+	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/pkg"
 )
 
@@ -40,6 +41,14 @@ func (ms MetadataService) IsAvailable() bool {
 	return (err == nil)
 }
 
+// Cancel aborts the in-flight requests of the underlying client, if it
+// supports it.
+func (ms MetadataService) Cancel() {
+	if c, ok := ms.Client.(datasource.Canceler); ok {
+		c.Cancel()
+	}
+}
+
 func (ms MetadataService) AvailabilityChanges() bool {
 	return true
 }
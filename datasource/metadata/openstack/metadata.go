@@ -0,0 +1,143 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openstack
+
+import (
+	"encoding/json"
+	"net"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+)
+
+const (
+	DefaultAddress  = "http://169.254.169.254/"
+	apiVersion      = "openstack/latest/"
+	userdataPath    = apiVersion + "user_data"
+	metadataPath    = apiVersion + "meta_data.json"
+	networkDataPath = apiVersion + "network_data.json"
+)
+
+type MetaData struct {
+	UUID             string            `json:"uuid"`
+	Name             string            `json:"name"`
+	Hostname         string            `json:"hostname"`
+	AvailabilityZone string            `json:"availability_zone"`
+	PublicKeys       map[string]string `json:"public_keys"`
+}
+
+// Link is a layer 2 interface of the instance: a physical interface, a bond
+// of other links or a VLAN on top of another link.
+type Link struct {
+	ID                 string   `json:"id"`
+	Type               string   `json:"type"`
+	EthernetMACAddress string   `json:"ethernet_mac_address"`
+	MTU                int      `json:"mtu"`
+	BondLinks          []string `json:"bond_links"`
+	BondMode           string   `json:"bond_mode"`
+	BondMIIMon         int      `json:"bond_miimon"`
+	VLANID             int      `json:"vlan_id"`
+	VLANLink           string   `json:"vlan_link"`
+	VLANMACAddress     string   `json:"vlan_mac_address"`
+}
+
+type Route struct {
+	Network string `json:"network"`
+	Netmask string `json:"netmask"`
+	Gateway string `json:"gateway"`
+}
+
+type Service struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// Network is the layer 3 configuration of a link, either static ("ipv4",
+// "ipv6") or dynamic ("ipv4_dhcp", "ipv6_dhcp", "ipv6_slaac").
+type Network struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Link      string    `json:"link"`
+	IPAddress string    `json:"ip_address"`
+	Netmask   string    `json:"netmask"`
+	Routes    []Route   `json:"routes"`
+	Services  []Service `json:"services"`
+}
+
+type NetworkData struct {
+	Links    []Link    `json:"links"`
+	Networks []Network `json:"networks"`
+	Services []Service `json:"services"`
+}
+
+type metadataService struct {
+	metadata.MetadataService
+}
+
+func NewDatasource(root string) *metadataService {
+	return &metadataService{MetadataService: metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)}
+}
+
+func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data []byte
+	var m MetaData
+	var n NetworkData
+
+	if data, err = ms.FetchData(ms.MetadataUrl()); err != nil || len(data) == 0 {
+		return
+	}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return
+	}
+
+	if data, err = ms.FetchData(ms.Root + networkDataPath); err != nil {
+		return
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &n); err != nil {
+			return
+		}
+	}
+
+	metadata.Hostname = m.Hostname
+	metadata.SSHPublicKeys = m.PublicKeys
+	for _, service := range n.Services {
+		if service.Type != "dns" {
+			continue
+		}
+		if ip := net.ParseIP(service.Address); ip != nil {
+			metadata.Nameservers = append(metadata.Nameservers, ip)
+		}
+	}
+	// The networks carry the fixed addresses of the instance; floating IPs
+	// are NATed and are not visible to the instance.
+	for _, network := range n.Networks {
+		ip := net.ParseIP(network.IPAddress)
+		switch {
+		case ip == nil:
+		case network.Type == "ipv4" && metadata.PrivateIPv4 == nil:
+			metadata.PrivateIPv4 = ip
+		case network.Type == "ipv6" && metadata.PrivateIPv6 == nil:
+			metadata.PrivateIPv6 = ip
+		}
+	}
+	metadata.NetworkConfig = n
+
+	return
+}
+
+func (ms metadataService) Type() string {
+	return "openstack-metadata-service"
+}
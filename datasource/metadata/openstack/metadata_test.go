@@ -0,0 +1,137 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openstack
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/test"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func TestType(t *testing.T) {
+	want := "openstack-metadata-service"
+	if kind := (metadataService{}).Type(); kind != want {
+		t.Fatalf("bad type: want %q, got %q", want, kind)
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		root         string
+		metadataPath string
+		resources    map[string]string
+		expect       datasource.Metadata
+		clientErr    error
+		expectErr    error
+	}{
+		{
+			root:         "/",
+			metadataPath: "openstack/latest/meta_data.json",
+			resources: map[string]string{
+				"/openstack/latest/meta_data.json": "bad",
+			},
+			expectErr: fmt.Errorf("invalid character 'b' looking for beginning of value"),
+		},
+		{
+			root:         "/",
+			metadataPath: "openstack/latest/meta_data.json",
+			resources: map[string]string{
+				"/openstack/latest/meta_data.json": `{
+  "uuid": "83679162-1378-4288-a2d4-70e13ec132aa",
+  "name": "coreos-1",
+  "hostname": "coreos-1.novalocal",
+  "availability_zone": "nova",
+  "public_keys": {"mykey": "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQExample user@example"},
+  "launch_index": 0
+}`,
+				"/openstack/latest/network_data.json": `{
+  "links": [
+    {"id": "tap0", "type": "ovs", "ethernet_mac_address": "fa:16:3e:9c:bf:3d", "mtu": 1450}
+  ],
+  "networks": [
+    {"id": "network0", "type": "ipv4", "link": "tap0", "ip_address": "10.0.0.5", "netmask": "255.255.255.0",
+     "routes": [{"network": "0.0.0.0", "netmask": "0.0.0.0", "gateway": "10.0.0.1"}]},
+    {"id": "network1", "type": "ipv6_slaac", "link": "tap0"}
+  ],
+  "services": [{"type": "dns", "address": "10.0.0.2"}]
+}`,
+			},
+			expect: datasource.Metadata{
+				Hostname:      "coreos-1.novalocal",
+				PrivateIPv4:   net.ParseIP("10.0.0.5"),
+				Nameservers:   []net.IP{net.ParseIP("10.0.0.2")},
+				SSHPublicKeys: map[string]string{"mykey": "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQExample user@example"},
+				NetworkConfig: NetworkData{
+					Links: []Link{{ID: "tap0", Type: "ovs", EthernetMACAddress: "fa:16:3e:9c:bf:3d", MTU: 1450}},
+					Networks: []Network{
+						{
+							ID:        "network0",
+							Type:      "ipv4",
+							Link:      "tap0",
+							IPAddress: "10.0.0.5",
+							Netmask:   "255.255.255.0",
+							Routes:    []Route{{Network: "0.0.0.0", Netmask: "0.0.0.0", Gateway: "10.0.0.1"}},
+						},
+						{ID: "network1", Type: "ipv6_slaac", Link: "tap0"},
+					},
+					Services: []Service{{Type: "dns", Address: "10.0.0.2"}},
+				},
+			},
+		},
+		{
+			root:         "/",
+			metadataPath: "openstack/latest/meta_data.json",
+			resources: map[string]string{
+				"/openstack/latest/meta_data.json": `{"hostname": "coreos-1"}`,
+			},
+			expect: datasource.Metadata{
+				Hostname:      "coreos-1",
+				NetworkConfig: NetworkData{},
+			},
+		},
+		{
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		service := &metadataService{
+			MetadataService: metadata.MetadataService{
+				Root:         tt.root,
+				Client:       &test.HttpClient{Resources: tt.resources, Err: tt.clientErr},
+				MetadataPath: tt.metadataPath,
+			},
+		}
+		metadata, err := service.FetchMetadata()
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.resources, tt.expectErr, err)
+		}
+		if !reflect.DeepEqual(tt.expect, metadata) {
+			t.Fatalf("bad fetch (%q): want %#v, got %#v", tt.resources, tt.expect, metadata)
+		}
+	}
+}
+
+func Error(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracle
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+const (
+	DefaultAddress = "http://169.254.169.254/"
+	apiVersion     = "opc/v2/instance/"
+	userdataPath   = apiVersion + "metadata/user_data"
+	metadataPath   = apiVersion
+	vnicsPath      = "opc/v2/vnics/"
+)
+
+type InstanceMetadata struct {
+	SSHAuthorizedKeys string `json:"ssh_authorized_keys"`
+	UserData          string `json:"user_data"`
+}
+
+type Instance struct {
+	ID          string           `json:"id"`
+	DisplayName string           `json:"displayName"`
+	Hostname    string           `json:"hostname"`
+	Region      string           `json:"region"`
+	Metadata    InstanceMetadata `json:"metadata"`
+}
+
+type VNIC struct {
+	ID              string `json:"vnicId"`
+	PrivateIP       string `json:"privateIp"`
+	MAC             string `json:"macAddr"`
+	VirtualRouterIP string `json:"virtualRouterIp"`
+	SubnetCidrBlock string `json:"subnetCidrBlock"`
+}
+
+type metadataService struct {
+	metadata.MetadataService
+}
+
+func NewDatasource(root string) *metadataService {
+	ms := metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath)
+	// The v2 endpoints refuse requests without this header.
+	client := pkg.NewHttpClient()
+	client.Header.Set("Authorization", "Bearer Oracle")
+	ms.Client = client
+	return &metadataService{MetadataService: ms}
+}
+
+func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data []byte
+	var instance Instance
+	var vnics []VNIC
+
+	if data, err = ms.FetchData(ms.MetadataUrl()); err != nil || len(data) == 0 {
+		return
+	}
+	if err = json.Unmarshal(data, &instance); err != nil {
+		return
+	}
+
+	if data, err = ms.FetchData(ms.Root + vnicsPath); err != nil {
+		return
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &vnics); err != nil {
+			return
+		}
+	}
+
+	// OCI only exposes the private addresses of the VNICs; public addresses
+	// are NATed and are not visible to the instance.
+	if len(vnics) > 0 {
+		metadata.PrivateIPv4 = net.ParseIP(vnics[0].PrivateIP)
+	}
+	metadata.Hostname = instance.Hostname
+	metadata.Region = instance.Region
+	metadata.SSHPublicKeys = map[string]string{}
+	for i, key := range strings.Split(instance.Metadata.SSHAuthorizedKeys, "\n") {
+		if key = strings.TrimSpace(key); key != "" {
+			metadata.SSHPublicKeys[strconv.Itoa(i)] = key
+		}
+	}
+
+	return
+}
+
+// FetchUserdata retrieves the user-data, which OCI stores base64 encoded.
+func (ms *metadataService) FetchUserdata() ([]byte, error) {
+	data, err := ms.FetchData(ms.UserdataUrl())
+	if err != nil || len(data) == 0 {
+		return data, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+}
+
+func (ms metadataService) Type() string {
+	return "oracle-metadata-service"
+}
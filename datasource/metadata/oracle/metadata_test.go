@@ -0,0 +1,159 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracle
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/test"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func TestType(t *testing.T) {
+	want := "oracle-metadata-service"
+	if kind := (metadataService{}).Type(); kind != want {
+		t.Fatalf("bad type: want %q, got %q", want, kind)
+	}
+}
+
+func TestAuthorizationHeader(t *testing.T) {
+	client := NewDatasource(DefaultAddress).Client.(*pkg.HttpClient)
+	if auth := client.Header.Get("Authorization"); auth != "Bearer Oracle" {
+		t.Fatalf("bad Authorization header: want %q, got %q", "Bearer Oracle", auth)
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		root         string
+		metadataPath string
+		resources    map[string]string
+		expect       datasource.Metadata
+		clientErr    error
+		expectErr    error
+	}{
+		{
+			root:         "/",
+			metadataPath: "opc/v2/instance/",
+			resources: map[string]string{
+				"/opc/v2/instance/": "bad",
+			},
+			expectErr: fmt.Errorf("invalid character 'b' looking for beginning of value"),
+		},
+		{
+			root:         "/",
+			metadataPath: "opc/v2/instance/",
+			resources: map[string]string{
+				"/opc/v2/instance/": `{
+  "availabilityDomain": "EMIr:PHX-AD-1",
+  "displayName": "coreos-1",
+  "hostname": "coreos-1",
+  "id": "ocid1.instance.oc1.phx.abc",
+  "region": "phx",
+  "metadata": {
+    "ssh_authorized_keys": "publickey1\npublickey2\n",
+    "user_data": "I2Nsb3VkLWNvbmZpZwo="
+  }
+}`,
+				"/opc/v2/vnics/": `[
+  {
+    "vnicId": "ocid1.vnic.oc1.phx.abc",
+    "privateIp": "10.0.0.2",
+    "vlanTag": 0,
+    "macAddr": "00:00:17:02:5e:0a",
+    "virtualRouterIp": "10.0.0.1",
+    "subnetCidrBlock": "10.0.0.0/24"
+  }
+]`,
+			},
+			expect: datasource.Metadata{
+				Hostname:    "coreos-1",
+				Region:      "phx",
+				PrivateIPv4: net.ParseIP("10.0.0.2"),
+				SSHPublicKeys: map[string]string{
+					"0": "publickey1",
+					"1": "publickey2",
+				},
+			},
+		},
+		{
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		service := &metadataService{
+			MetadataService: metadata.MetadataService{
+				Root:         tt.root,
+				Client:       &test.HttpClient{Resources: tt.resources, Err: tt.clientErr},
+				MetadataPath: tt.metadataPath,
+			},
+		}
+		metadata, err := service.FetchMetadata()
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.resources, tt.expectErr, err)
+		}
+		if !reflect.DeepEqual(tt.expect, metadata) {
+			t.Fatalf("bad fetch (%q): want %#v, got %#v", tt.resources, tt.expect, metadata)
+		}
+	}
+}
+
+func TestFetchUserdata(t *testing.T) {
+	for _, tt := range []struct {
+		resources map[string]string
+		userdata  string
+		expectErr bool
+	}{
+		{
+			resources: map[string]string{"/opc/v2/instance/metadata/user_data": "I2Nsb3VkLWNvbmZpZwo="},
+			userdata:  "#cloud-config\n",
+		},
+		{
+			resources: map[string]string{},
+			userdata:  "",
+		},
+		{
+			resources: map[string]string{"/opc/v2/instance/metadata/user_data": "!!!"},
+			expectErr: true,
+		},
+	} {
+		service := &metadataService{
+			MetadataService: metadata.MetadataService{
+				Root:         "/",
+				Client:       &test.HttpClient{Resources: tt.resources},
+				UserdataPath: userdataPath,
+			},
+		}
+		data, err := service.FetchUserdata()
+		if tt.expectErr != (err != nil) {
+			t.Fatalf("bad error (%q): want %t, got %v", tt.resources, tt.expectErr, err)
+		}
+		if string(data) != tt.userdata {
+			t.Fatalf("bad userdata (%q): want %q, got %q", tt.resources, tt.userdata, data)
+		}
+	}
+}
+
+func Error(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
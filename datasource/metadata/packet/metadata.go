@@ -91,6 +91,7 @@ func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err er
 		}
 	}
 	metadata.Hostname = m.Hostname
+	metadata.Nameservers = m.NetworkData.DNS
 	metadata.SSHPublicKeys = map[string]string{}
 	for i, key := range m.SSHKeys {
 		metadata.SSHPublicKeys[strconv.Itoa(i)] = key
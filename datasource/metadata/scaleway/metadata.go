@@ -0,0 +1,156 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+const (
+	DefaultAddress = "http://169.254.42.42/"
+	apiVersion     = "conf"
+	userdataPath   = "user_data/cloud-init"
+	metadataPath   = "conf?format=json"
+)
+
+type SSHPublicKey struct {
+	Key         string `json:"key"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type PublicIP struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Dynamic bool   `json:"dynamic"`
+}
+
+type IPv6 struct {
+	Address string `json:"address"`
+	Gateway string `json:"gateway"`
+	Netmask string `json:"netmask"`
+}
+
+type Metadata struct {
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	Hostname       string         `json:"hostname"`
+	CommercialType string         `json:"commercial_type"`
+	Tags           []string       `json:"tags"`
+	SSHPublicKeys  []SSHPublicKey `json:"ssh_public_keys"`
+	PublicIP       *PublicIP      `json:"public_ip"`
+	PrivateIP      string         `json:"private_ip"`
+	IPv6           *IPv6          `json:"ipv6"`
+}
+
+type metadataService struct {
+	metadata.MetadataService
+	// userdataClient fetches the user-data, which is only served to
+	// requests coming from a privileged source port.
+	userdataClient pkg.Getter
+}
+
+func NewDatasource(root string) *metadataService {
+	client := pkg.NewHttpClient()
+	client.SetDial(dialPrivileged)
+	return &metadataService{
+		MetadataService: metadata.NewDatasource(root, apiVersion, userdataPath, metadataPath),
+		userdataClient:  client,
+	}
+}
+
+func (ms *metadataService) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data []byte
+	var m Metadata
+
+	if data, err = ms.FetchData(ms.MetadataUrl()); err != nil || len(data) == 0 {
+		return
+	}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return
+	}
+
+	metadata.Hostname = m.Hostname
+	if m.PublicIP != nil {
+		metadata.PublicIPv4 = net.ParseIP(m.PublicIP.Address)
+	}
+	if m.IPv6 != nil {
+		metadata.PublicIPv6 = net.ParseIP(m.IPv6.Address)
+	}
+	metadata.PrivateIPv4 = net.ParseIP(m.PrivateIP)
+	metadata.SSHPublicKeys = map[string]string{}
+	for i, key := range m.SSHPublicKeys {
+		metadata.SSHPublicKeys[strconv.Itoa(i)] = key.Key
+	}
+	metadata.NetworkConfig = m
+
+	return
+}
+
+func (ms *metadataService) FetchUserdata() ([]byte, error) {
+	data, err := ms.userdataClient.GetRetry(ms.UserdataUrl())
+	if _, ok := err.(pkg.ErrNotFound); ok {
+		return []byte{}, nil
+	}
+	return data, err
+}
+
+// Cancel aborts the in-flight requests of both clients.
+func (ms *metadataService) Cancel() {
+	ms.MetadataService.Cancel()
+	if c, ok := ms.userdataClient.(datasource.Canceler); ok {
+		c.Cancel()
+	}
+}
+
+func (ms metadataService) Type() string {
+	return "scaleway-metadata-service"
+}
+
+// dialPrivileged connects from the first free privileged port.
+func dialPrivileged(network, addr string) (net.Conn, error) {
+	for port := 1; port < 1024; port++ {
+		dialer := net.Dialer{
+			Timeout:   10 * time.Second,
+			LocalAddr: &net.TCPAddr{Port: port},
+		}
+		conn, err := dialer.Dial(network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		if !isAddrInUse(err) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("no privileged port available")
+}
+
+func isAddrInUse(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.EADDRINUSE || sysErr.Err == syscall.EADDRNOTAVAIL
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaleway
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata"
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/test"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func TestType(t *testing.T) {
+	want := "scaleway-metadata-service"
+	if kind := (metadataService{}).Type(); kind != want {
+		t.Fatalf("bad type: want %q, got %q", want, kind)
+	}
+}
+
+func TestNewDatasource(t *testing.T) {
+	for _, tt := range []struct {
+		root     string
+		metadata string
+		userdata string
+	}{
+		{
+			root:     DefaultAddress,
+			metadata: "http://169.254.42.42/conf?format=json",
+			userdata: "http://169.254.42.42/user_data/cloud-init",
+		},
+		{
+			root:     "http://127.0.0.1:8080",
+			metadata: "http://127.0.0.1:8080/conf?format=json",
+			userdata: "http://127.0.0.1:8080/user_data/cloud-init",
+		},
+	} {
+		service := NewDatasource(tt.root)
+		if url := service.MetadataUrl(); url != tt.metadata {
+			t.Errorf("bad metadata url (%q): want %q, got %q", tt.root, tt.metadata, url)
+		}
+		if url := service.UserdataUrl(); url != tt.userdata {
+			t.Errorf("bad userdata url (%q): want %q, got %q", tt.root, tt.userdata, url)
+		}
+	}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		root         string
+		metadataPath string
+		resources    map[string]string
+		expect       datasource.Metadata
+		clientErr    error
+		expectErr    error
+	}{
+		{
+			root:         "/",
+			metadataPath: "conf?format=json",
+			resources: map[string]string{
+				"/conf?format=json": "bad",
+			},
+			expectErr: fmt.Errorf("invalid character 'b' looking for beginning of value"),
+		},
+		{
+			root:         "/",
+			metadataPath: "conf?format=json",
+			resources: map[string]string{
+				"/conf?format=json": `{
+  "id": "2f0d7a8e-5e4e-4b4e-9f4c-6f2c1d0e8a11",
+  "name": "coreos-1",
+  "hostname": "coreos-1",
+  "commercial_type": "DEV1-S",
+  "organization": "0a1b2c3d-0000-0000-0000-000000000000",
+  "tags": ["web"],
+  "ssh_public_keys": [
+    {
+      "key": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@example",
+      "fingerprint": "256 MD5:3a:5e:... user@example (ssh-ed25519)"
+    }
+  ],
+  "public_ip": {
+    "dynamic": false,
+    "id": "8f3b1c2d-0000-0000-0000-000000000000",
+    "address": "51.15.0.10"
+  },
+  "private_ip": "10.1.2.3",
+  "ipv6": {
+    "netmask": "64",
+    "gateway": "2001:bc8:4400:2000::1",
+    "address": "2001:bc8:4400:2000::2"
+  },
+  "location": {
+    "zone_id": "fr-par-1"
+  }
+}`,
+			},
+			expect: datasource.Metadata{
+				Hostname:    "coreos-1",
+				PublicIPv4:  net.ParseIP("51.15.0.10"),
+				PublicIPv6:  net.ParseIP("2001:bc8:4400:2000::2"),
+				PrivateIPv4: net.ParseIP("10.1.2.3"),
+				SSHPublicKeys: map[string]string{
+					"0": "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@example",
+				},
+				NetworkConfig: Metadata{
+					ID:             "2f0d7a8e-5e4e-4b4e-9f4c-6f2c1d0e8a11",
+					Name:           "coreos-1",
+					Hostname:       "coreos-1",
+					CommercialType: "DEV1-S",
+					Tags:           []string{"web"},
+					SSHPublicKeys: []SSHPublicKey{{
+						Key:         "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIExample user@example",
+						Fingerprint: "256 MD5:3a:5e:... user@example (ssh-ed25519)",
+					}},
+					PublicIP: &PublicIP{
+						ID:      "8f3b1c2d-0000-0000-0000-000000000000",
+						Address: "51.15.0.10",
+					},
+					PrivateIP: "10.1.2.3",
+					IPv6: &IPv6{
+						Address: "2001:bc8:4400:2000::2",
+						Gateway: "2001:bc8:4400:2000::1",
+						Netmask: "64",
+					},
+				},
+			},
+		},
+		{
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		service := &metadataService{
+			MetadataService: metadata.MetadataService{
+				Root:         tt.root,
+				Client:       &test.HttpClient{Resources: tt.resources, Err: tt.clientErr},
+				MetadataPath: tt.metadataPath,
+			},
+		}
+		metadata, err := service.FetchMetadata()
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.resources, tt.expectErr, err)
+		}
+		if !reflect.DeepEqual(tt.expect, metadata) {
+			t.Fatalf("bad fetch (%q): want %#v, got %#v", tt.resources, tt.expect, metadata)
+		}
+	}
+}
+
+func TestFetchUserdata(t *testing.T) {
+	for _, tt := range []struct {
+		resources map[string]string
+		clientErr error
+		userdata  string
+		expectErr error
+	}{
+		{
+			resources: map[string]string{"/user_data/cloud-init": "#cloud-config\n"},
+			userdata:  "#cloud-config\n",
+		},
+		{
+			resources: map[string]string{},
+			userdata:  "",
+		},
+		{
+			clientErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+			expectErr: pkg.ErrTimeout{Err: fmt.Errorf("test error")},
+		},
+	} {
+		service := &metadataService{
+			MetadataService: metadata.MetadataService{
+				Root:         "/",
+				Client:       &test.HttpClient{},
+				UserdataPath: userdataPath,
+			},
+			userdataClient: &test.HttpClient{Resources: tt.resources, Err: tt.clientErr},
+		}
+		data, err := service.FetchUserdata()
+		if Error(err) != Error(tt.expectErr) {
+			t.Fatalf("bad error (%q): want %q, got %q", tt.resources, tt.expectErr, err)
+		}
+		if string(data) != tt.userdata {
+			t.Fatalf("bad userdata (%q): want %q, got %q", tt.resources, tt.userdata, data)
+		}
+	}
+}
+
+func Error(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
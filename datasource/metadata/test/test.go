@@ -16,6 +16,7 @@ package test
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/coreos/coreos-cloudinit/pkg"
 )
@@ -32,7 +33,7 @@ func (t *HttpClient) GetRetry(url string) ([]byte, error) {
 	if val, ok := t.Resources[url]; ok {
 		return []byte(val), nil
 	} else {
-		return nil, pkg.ErrNotFound{fmt.Errorf("not found: %q", url)}
+		return nil, pkg.ErrNotFound{Err: fmt.Errorf("not found: %q", url), StatusCode: http.StatusNotFound}
 	}
 }
 
@@ -0,0 +1,170 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nocloud
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+
+	"github.com/coreos/yaml"
+)
+
+const (
+	DefaultLabel = "cidata"
+
+	byLabelDir = "/dev/disk/by-label"
+)
+
+// noCloud is a datasource which reads the user-data and meta-data files from
+// the root of an unmounted filesystem, located by its label, in the manner of
+// cloud-init's NoCloud datasource. The filesystem is mounted read-only to a
+// temporary directory for every read and unmounted afterwards.
+type noCloud struct {
+	device  string
+	mount   func(device, dir string) error
+	unmount func(dir string) error
+}
+
+func NewDatasource(label string) *noCloud {
+	return &noCloud{
+		device:  path.Join(byLabelDir, label),
+		mount:   mount,
+		unmount: unmount,
+	}
+}
+
+func (nc *noCloud) IsAvailable() bool {
+	_, err := os.Stat(nc.device)
+	return err == nil
+}
+
+func (nc *noCloud) AvailabilityChanges() bool {
+	return true
+}
+
+func (nc *noCloud) ConfigRoot() string {
+	return ""
+}
+
+func (nc *noCloud) FetchMetadata() (metadata datasource.Metadata, err error) {
+	var data []byte
+	if err = nc.withMount(func(dir string) (err error) {
+		data, err = tryReadFile(path.Join(dir, "meta-data"))
+		return
+	}); err != nil || len(data) == 0 {
+		return
+	}
+
+	var m struct {
+		Hostname   string      `yaml:"local-hostname"`
+		PublicKeys interface{} `yaml:"public-keys"`
+	}
+	if err = yaml.Unmarshal(data, &m); err != nil {
+		return
+	}
+
+	metadata.Hostname = m.Hostname
+	metadata.SSHPublicKeys = publicKeys(m.PublicKeys)
+	return
+}
+
+func (nc *noCloud) FetchUserdata() (data []byte, err error) {
+	err = nc.withMount(func(dir string) (err error) {
+		data, err = tryReadFile(path.Join(dir, "user-data"))
+		return
+	})
+	return
+}
+
+func (nc *noCloud) Type() string {
+	return "nocloud"
+}
+
+// withMount mounts the filesystem to a temporary directory, calls fn with it
+// and unmounts the filesystem again, whether or not fn succeeded.
+func (nc *noCloud) withMount(fn func(dir string) error) (err error) {
+	dir, err := ioutil.TempDir("", "coreos-cloudinit-nocloud-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := os.Remove(dir); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+
+	if err = nc.mount(nc.device, dir); err != nil {
+		return fmt.Errorf("failed to mount %s: %v", nc.device, err)
+	}
+	defer func() {
+		if uerr := nc.unmount(dir); uerr != nil && err == nil {
+			err = fmt.Errorf("failed to unmount %s: %v", nc.device, uerr)
+		}
+	}()
+
+	return fn(dir)
+}
+
+// publicKeys converts the public-keys of the meta-data, which may be given as
+// a single key, a list of keys or a map of names to keys, to a map. Listed
+// keys are named by their index.
+func publicKeys(keys interface{}) map[string]string {
+	switch keys := keys.(type) {
+	case string:
+		return map[string]string{"0": keys}
+	case []interface{}:
+		m := map[string]string{}
+		for i, key := range keys {
+			m[fmt.Sprint(i)] = fmt.Sprint(key)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := map[string]string{}
+		for name, key := range keys {
+			m[fmt.Sprint(name)] = fmt.Sprint(key)
+		}
+		return m
+	}
+	return nil
+}
+
+func mount(device, dir string) error {
+	if output, err := exec.Command("mount", "-o", "ro", device, dir).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, output)
+	}
+	return nil
+}
+
+func unmount(dir string) error {
+	if output, err := exec.Command("umount", dir).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, output)
+	}
+	return nil
+}
+
+func tryReadFile(filename string) ([]byte, error) {
+	log.Printf("Attempting to read from %q\n", filename)
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return data, err
+}
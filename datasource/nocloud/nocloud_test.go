@@ -0,0 +1,182 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nocloud
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+// fakeMount returns a mount function which populates the mount point with the
+// given files (a nil content creating a directory) and an unmount function
+// which removes them again, along with the number of filesystems mounted and
+// not (attempted to be) unmounted.
+func fakeMount(files map[string][]byte, mountErr, unmountErr error) (func(string, string) error, func(string) error, *int) {
+	mounted := 0
+	mount := func(device, dir string) error {
+		if device != "/dev/disk/by-label/cidata" {
+			return errors.New("bad device " + device)
+		}
+		if mountErr != nil {
+			return mountErr
+		}
+		mounted++
+		for name, contents := range files {
+			var err error
+			if contents == nil {
+				err = os.Mkdir(path.Join(dir, name), 0755)
+			} else {
+				err = ioutil.WriteFile(path.Join(dir, name), contents, 0644)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	unmount := func(dir string) error {
+		mounted--
+		for name := range files {
+			os.Remove(path.Join(dir, name))
+		}
+		return unmountErr
+	}
+	return mount, unmount, &mounted
+}
+
+func TestFetchMetadata(t *testing.T) {
+	for _, tt := range []struct {
+		files map[string][]byte
+
+		metadata datasource.Metadata
+	}{
+		{
+			files: map[string][]byte{},
+		},
+		{
+			files:    map[string][]byte{"meta-data": []byte("instance-id: iid-local01\nlocal-hostname: host\n")},
+			metadata: datasource.Metadata{Hostname: "host"},
+		},
+		{
+			files: map[string][]byte{"meta-data": []byte("local-hostname: host\npublic-keys: ssh-rsa AAAA\n")},
+			metadata: datasource.Metadata{
+				Hostname:      "host",
+				SSHPublicKeys: map[string]string{"0": "ssh-rsa AAAA"},
+			},
+		},
+		{
+			files: map[string][]byte{"meta-data": []byte("public-keys:\n  - ssh-rsa AAAA\n  - ssh-rsa BBBB\n")},
+			metadata: datasource.Metadata{
+				SSHPublicKeys: map[string]string{"0": "ssh-rsa AAAA", "1": "ssh-rsa BBBB"},
+			},
+		},
+		{
+			files: map[string][]byte{"meta-data": []byte("public-keys:\n  alice: ssh-rsa AAAA\n")},
+			metadata: datasource.Metadata{
+				SSHPublicKeys: map[string]string{"alice": "ssh-rsa AAAA"},
+			},
+		},
+	} {
+		mount, unmount, mounted := fakeMount(tt.files, nil, nil)
+		nc := NewDatasource(DefaultLabel)
+		nc.mount, nc.unmount = mount, unmount
+
+		metadata, err := nc.FetchMetadata()
+		if err != nil {
+			t.Errorf("bad error (%q): want nil, got %v", tt.files, err)
+		}
+		if !reflect.DeepEqual(tt.metadata, metadata) {
+			t.Errorf("bad metadata (%q): want %#v, got %#v", tt.files, tt.metadata, metadata)
+		}
+		if *mounted != 0 {
+			t.Errorf("filesystem left mounted (%q)", tt.files)
+		}
+	}
+}
+
+func TestFetchUserdata(t *testing.T) {
+	for _, tt := range []struct {
+		files      map[string][]byte
+		mountErr   error
+		unmountErr error
+
+		userdata string
+		err      bool
+	}{
+		{
+			files: map[string][]byte{},
+		},
+		{
+			files:    map[string][]byte{"user-data": []byte("#cloud-config\nhostname: host\n")},
+			userdata: "#cloud-config\nhostname: host\n",
+		},
+		{
+			files:    map[string][]byte{"user-data": []byte("#cloud-config\n")},
+			mountErr: errors.New("no such device"),
+			err:      true,
+		},
+		{
+			files:      map[string][]byte{"user-data": []byte("#cloud-config\n")},
+			unmountErr: errors.New("device is busy"),
+			userdata:   "#cloud-config\n",
+			err:        true,
+		},
+		{
+			files: map[string][]byte{"user-data": nil},
+			err:   true,
+		},
+	} {
+		mount, unmount, mounted := fakeMount(tt.files, tt.mountErr, tt.unmountErr)
+		nc := NewDatasource(DefaultLabel)
+		nc.mount, nc.unmount = mount, unmount
+
+		userdata, err := nc.FetchUserdata()
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.files, tt.err, err)
+		}
+		if string(userdata) != tt.userdata {
+			t.Errorf("bad userdata (%q): want %q, got %q", tt.files, tt.userdata, userdata)
+		}
+		if *mounted != 0 {
+			t.Errorf("filesystem left mounted (%q)", tt.files)
+		}
+	}
+}
+
+func TestIsAvailable(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	nc := NewDatasource(DefaultLabel)
+	nc.device = path.Join(dir, DefaultLabel)
+	if nc.IsAvailable() {
+		t.Errorf("bad availability: want false, got true")
+	}
+	if err := ioutil.WriteFile(nc.device, nil, 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+	if !nc.IsAvailable() {
+		t.Errorf("bad availability: want true, got false")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"log"
 	"strings"
+	"unicode"
 
 	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/pkg"
@@ -85,9 +86,11 @@ func (c *procCmdline) Type() string {
 	return "proc-cmdline"
 }
 
+// findCloudConfigURL returns the value of the last cloud-config-url parameter
+// in the given kernel command line.
 func findCloudConfigURL(input string) (url string, err error) {
 	err = errors.New("cloud-config-url not found")
-	for _, token := range strings.Split(input, " ") {
+	for _, token := range splitCmdline(input) {
 		parts := strings.SplitN(token, "=", 2)
 
 		key := parts[0]
@@ -97,7 +100,7 @@ func findCloudConfigURL(input string) (url string, err error) {
 			continue
 		}
 
-		if len(parts) != 2 {
+		if len(parts) != 2 || parts[1] == "" {
 			log.Printf("Found cloud-config-url in /proc/cmdline with no value, ignoring.")
 			continue
 		}
@@ -108,3 +111,36 @@ func findCloudConfigURL(input string) (url string, err error) {
 
 	return
 }
+
+// splitCmdline splits a kernel command line into its parameters the way the
+// kernel does: parameters are separated by whitespace, which may be included
+// in a parameter by enclosing it in double quotes (e.g. foo="bar baz"). The
+// quotes themselves are removed.
+func splitCmdline(input string) []string {
+	var (
+		tokens []string
+		token  []rune
+		quoted bool
+		found  bool
+	)
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			found = true
+		case !quoted && unicode.IsSpace(r):
+			if found {
+				tokens = append(tokens, string(token))
+			}
+			token = token[:0]
+			found = false
+		default:
+			token = append(token, r)
+			found = true
+		}
+	}
+	if found {
+		tokens = append(tokens, string(token))
+	}
+	return tokens
+}
@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -52,6 +53,22 @@ func TestParseCmdlineCloudConfigFound(t *testing.T) {
 			"foo=bar cloud-config-url=example.com ping=pong",
 			"example.com",
 		},
+		{
+			"cloud-config-url=example.com cloud-config-url=",
+			"example.com",
+		},
+		{
+			"cloud-config-url=\"http://example.com/my config.yml\"",
+			"http://example.com/my config.yml",
+		},
+		{
+			"\"cloud-config-url=http://example.com/a b\" foo=\"bar baz\"",
+			"http://example.com/a b",
+		},
+		{
+			"BOOT_IMAGE=/coreos/vmlinuz-a mount.usr=PARTUUID=7130c94a-213a-4e5a-8e26-6cce9662f132 rootflags=rw mount.usrflags=ro consoleblank=0 root=LABEL=ROOT console=ttyS0,115200n8 console=tty0 cloud-config-url=http://one.example.com/cfg coreos.oem.id=qemu\tcloud-config-url=\"http://two.example.com/cloud config\" quiet\n",
+			"http://two.example.com/cloud config",
+		},
 	}
 
 	for i, tt := range tests {
@@ -65,6 +82,27 @@ func TestParseCmdlineCloudConfigFound(t *testing.T) {
 	}
 }
 
+func TestSplitCmdline(t *testing.T) {
+	for _, tt := range []struct {
+		input  string
+		tokens []string
+	}{
+		{"", nil},
+		{"  \n", nil},
+		{"ro quiet", []string{"ro", "quiet"}},
+		{" ro\t quiet\n", []string{"ro", "quiet"}},
+		{"foo=\"bar baz\" ro", []string{"foo=bar baz", "ro"}},
+		{"\"foo=bar baz\" ro", []string{"foo=bar baz", "ro"}},
+		{"foo=\"\" ro", []string{"foo=", "ro"}},
+		{"\"\" ro", []string{"", "ro"}},
+		{"foo=\"bar baz", []string{"foo=bar baz"}},
+	} {
+		if tokens := splitCmdline(tt.input); !reflect.DeepEqual(tt.tokens, tokens) {
+			t.Errorf("bad tokens (%q): want %q, got %q", tt.input, tt.tokens, tokens)
+		}
+	}
+}
+
 func TestProcCmdlineAndFetchConfig(t *testing.T) {
 
 	var (
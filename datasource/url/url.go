@@ -15,24 +15,50 @@
 package url
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
 	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/pkg"
 )
 
+// remoteFile keeps a single client for all of its requests, so that they can
+// be canceled. If the client can't be used (see newClient), err is set instead.
 type remoteFile struct {
-	url string
+	url    string
+	client *pkg.HttpClient
+	err    error
 }
 
 func NewDatasource(url string) *remoteFile {
-	return &remoteFile{url}
+	return &remoteFile{url: url, client: pkg.NewHttpClient()}
+}
+
+// NewTLSDatasource returns a datasource which only fetches the user-data over
+// HTTPS, using the given TLS configuration (e.g. to pin a private CA).
+func NewTLSDatasource(url string, tlsConfig *tls.Config) *remoteFile {
+	client, err := newTLSClient(url, tlsConfig)
+	return &remoteFile{url: url, client: client, err: err}
 }
 
 func (f *remoteFile) IsAvailable() bool {
-	client := pkg.NewHttpClient()
-	_, err := client.Get(f.url)
+	if f.err != nil {
+		return false
+	}
+	_, err := f.client.Get(f.url)
 	return (err == nil)
 }
 
+// Cancel aborts the in-flight requests of the datasource.
+func (f *remoteFile) Cancel() {
+	if f.client != nil {
+		f.client.Cancel()
+	}
+}
+
 func (f *remoteFile) AvailabilityChanges() bool {
 	return true
 }
@@ -46,10 +72,33 @@ func (f *remoteFile) FetchMetadata() (datasource.Metadata, error) {
 }
 
 func (f *remoteFile) FetchUserdata() ([]byte, error) {
-	client := pkg.NewHttpClient()
-	return client.GetRetry(f.url)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.client.GetRetry(f.url)
 }
 
 func (f *remoteFile) Type() string {
 	return "url"
 }
+
+// newTLSClient returns the client used to fetch the user-data from url with
+// the given TLS configuration. Plaintext URLs and redirects are refused.
+func newTLSClient(url string, tlsConfig *tls.Config) (*pkg.HttpClient, error) {
+	if !isHTTPS(url) {
+		return nil, pkg.ErrInvalid{Err: fmt.Errorf("refusing to fetch %s without HTTPS", url)}
+	}
+	client := pkg.NewHttpClient()
+	client.SetTLSConfig(tlsConfig)
+	client.SetCheckRedirect(func(req *http.Request, via []*http.Request) error {
+		if !isHTTPS(req.URL.String()) {
+			return errors.New("refusing to follow redirect without HTTPS")
+		}
+		return nil
+	})
+	return client, nil
+}
+
+func isHTTPS(url string) bool {
+	return strings.HasPrefix(strings.ToLower(url), "https://")
+}
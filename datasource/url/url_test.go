@@ -0,0 +1,184 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package url
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/pkg"
+)
+
+func TestTLSDatasource(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://example.com/user_data", http.StatusFound)
+			return
+		}
+		w.Write([]byte("#cloud-config\n"))
+	}))
+	defer ts.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#cloud-config\n"))
+	}))
+	defer plain.Close()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := path.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatalf("Unable to write CA file: %v", err)
+	}
+	tlsConfig, err := pkg.NewTLSConfig(caFile, "", "")
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	// the system roots must not validate the server's certificate
+	otherConfig, err := pkg.NewTLSConfig("", "", "")
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		ds *remoteFile
+
+		available bool
+	}{
+		{ds: NewTLSDatasource(ts.URL, tlsConfig), available: true},
+		{ds: NewTLSDatasource(ts.URL, otherConfig), available: false},
+		{ds: NewTLSDatasource(plain.URL, tlsConfig), available: false},
+		{ds: NewTLSDatasource(ts.URL+"/redirect", tlsConfig), available: false},
+		{ds: NewDatasource(plain.URL), available: true},
+	} {
+		if available := tt.ds.IsAvailable(); available != tt.available {
+			t.Errorf("bad availability (%s): want %t, got %t", tt.ds.url, tt.available, available)
+		}
+	}
+
+	data, err := NewTLSDatasource(ts.URL, tlsConfig).FetchUserdata()
+	if err != nil || string(data) != "#cloud-config\n" {
+		t.Errorf("bad user-data: want %q, got %q (%v)", "#cloud-config\n", data, err)
+	}
+	if _, err := NewTLSDatasource(plain.URL, tlsConfig).FetchUserdata(); err == nil {
+		t.Errorf("bad error: want error for plaintext URL, got nil")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#cloud-config\n"))
+	}))
+	defer ts.Close()
+
+	var ds datasource.Datasource = NewDatasource(ts.URL)
+	c, ok := ds.(datasource.Canceler)
+	if !ok {
+		t.Fatalf("url datasource cannot be canceled")
+	}
+	if !ds.IsAvailable() {
+		t.Fatalf("datasource unavailable before it was canceled")
+	}
+	c.Cancel()
+	if ds.IsAvailable() {
+		t.Errorf("datasource available after it was canceled")
+	}
+	if _, err := ds.FetchUserdata(); err == nil {
+		t.Errorf("bad error: want error after cancel, got nil")
+	}
+}
+
+func TestProxiedDatasource(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte("#cloud-config\nhostname: proxied\n"))
+	}))
+	defer proxy.Close()
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#cloud-config\nhostname: direct\n"))
+	}))
+	defer direct.Close()
+
+	proxyURL, err := pkg.ParseProxy(proxy.URL)
+	if err != nil {
+		t.Fatalf("bad proxy: %v", err)
+	}
+	defer func(p func(*http.Request) (*neturl.URL, error)) { pkg.DefaultProxy = p }(pkg.DefaultProxy)
+	pkg.DefaultProxy = pkg.NewProxy(proxyURL, nil)
+
+	for _, tt := range []struct {
+		url string
+
+		userdata string
+		proxied  []string
+	}{
+		{
+			url:      "http://config.example.com/user_data",
+			userdata: "#cloud-config\nhostname: proxied\n",
+			proxied:  []string{"http://config.example.com/user_data"},
+		},
+		{
+			// The test server listens on a loopback address, which is
+			// never proxied just like link-local ones.
+			url:      direct.URL + "/user_data",
+			userdata: "#cloud-config\nhostname: direct\n",
+		},
+	} {
+		proxied = nil
+		userdata, err := NewDatasource(tt.url).FetchUserdata()
+		if err != nil {
+			t.Errorf("bad error (%q): want nil, got %v", tt.url, err)
+		}
+		if string(userdata) != tt.userdata {
+			t.Errorf("bad userdata (%q): want %q, got %q", tt.url, tt.userdata, userdata)
+		}
+		if !reflect.DeepEqual(tt.proxied, proxied) {
+			t.Errorf("bad proxied requests (%q): want %q, got %q", tt.url, tt.proxied, proxied)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var userAgent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write([]byte("#cloud-config\n"))
+	}))
+	defer ts.Close()
+
+	defer func(ua string) { pkg.DefaultUserAgent = ua }(pkg.DefaultUserAgent)
+	pkg.DefaultUserAgent = "coreos-cloudinit/1.2.3"
+
+	if _, err := NewDatasource(ts.URL).FetchUserdata(); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	if userAgent != "coreos-cloudinit/1.2.3" {
+		t.Fatalf("bad user agent: want %q, got %q", "coreos-cloudinit/1.2.3", userAgent)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vmware
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// ovfEnvironment is the part of an OVF environment document which is used to
+// configure the machine: its properties and, as provided by vCloud Director,
+// its network adapters.
+type ovfEnvironment struct {
+	Properties []struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"PropertySection>Property"`
+	Adapters []struct {
+		MAC string `xml:"mac,attr"`
+	} `xml:"EthernetAdapterSection>Adapter"`
+}
+
+// parseOvfEnvironment parses an OVF environment document into the variables
+// which are otherwise read from guestinfo (without the "guestinfo." prefix).
+// The guestinfo.* properties are used as is. In addition, the vCloud
+// Director guest customization properties (vCloud_computerName and
+// vCloud_{ip,netmask,gateway,macaddr,bootproto,primaryDns,secondaryDns}_<n>)
+// and the network adapters are translated to the hostname, interface.<n>.*
+// and dns.server.<n> variables, and a base64-encoded user-data property is
+// used as the cloud-config. Explicit guestinfo.* properties take precedence.
+func parseOvfEnvironment(doc []byte) (map[string]string, error) {
+	var env ovfEnvironment
+	if err := xml.Unmarshal(doc, &env); err != nil {
+		return nil, err
+	}
+
+	props := map[string]string{}
+	for _, p := range env.Properties {
+		props[p.Key] = p.Value
+	}
+
+	vars := map[string]string{}
+	set := func(value string, key string, args ...interface{}) {
+		if value != "" {
+			vars[fmt.Sprintf(key, args...)] = value
+		}
+	}
+
+	set(props["hostname"], "hostname")
+	set(props["vCloud_computerName"], "hostname")
+	if data := props["user-data"]; data != "" {
+		set(data, "coreos.config.data")
+		set("base64", "coreos.config.data.encoding")
+	}
+
+	dns := 0
+	for i := 0; ; i++ {
+		prop := func(name string) string {
+			return props[fmt.Sprintf("vCloud_%s_%d", name, i)]
+		}
+
+		mac := prop("macaddr")
+		if mac == "" && i < len(env.Adapters) {
+			mac = env.Adapters[i].MAC
+		}
+		ip := prop("ip")
+		if mac == "" && ip == "" && prop("bootproto") == "" {
+			break
+		}
+
+		set(mac, "interface.%d.mac", i)
+		switch strings.ToLower(prop("bootproto")) {
+		case "dhcp":
+			set("yes", "interface.%d.dhcp", i)
+		case "static":
+			set("no", "interface.%d.dhcp", i)
+		}
+		if ip != "" {
+			address, err := cidr(ip, prop("netmask"))
+			if err != nil {
+				return nil, err
+			}
+			set(address, "interface.%d.ip.0.address", i)
+		}
+		if gateway := prop("gateway"); gateway != "" {
+			set(gateway, "interface.%d.route.0.gateway", i)
+			set("0.0.0.0/0", "interface.%d.route.0.destination", i)
+		}
+		for _, name := range []string{"primaryDns", "secondaryDns"} {
+			if server := prop(name); server != "" {
+				set(server, "dns.server.%d", dns)
+				dns++
+			}
+		}
+	}
+
+	for key, value := range props {
+		if strings.HasPrefix(key, "guestinfo.") {
+			vars[strings.TrimPrefix(key, "guestinfo.")] = value
+		}
+	}
+	return vars, nil
+}
+
+// cidr combines an address and its netmask (which is optional for IPv6
+// addresses given in CIDR notation) into CIDR notation.
+func cidr(ip, netmask string) (string, error) {
+	if strings.Contains(ip, "/") {
+		return ip, nil
+	}
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("invalid address: %q", ip)
+	}
+	mask := net.ParseIP(netmask).To4()
+	if mask == nil {
+		return "", fmt.Errorf("invalid netmask for %s: %q", ip, netmask)
+	}
+	ones, bits := net.IPMask(mask).Size()
+	if bits == 0 {
+		return "", fmt.Errorf("invalid netmask for %s: %q", ip, netmask)
+	}
+	return fmt.Sprintf("%s/%d", ip, ones), nil
+}
+
+// getOvfReadConfig returns a readConfigFunction which reads the variables of
+// the given OVF environment document. An invalid document provides none.
+func getOvfReadConfig(ovfEnv []byte) readConfigFunction {
+	vars := map[string]string{}
+	if len(ovfEnv) != 0 {
+		var err error
+		if vars, err = parseOvfEnvironment(ovfEnv); err != nil {
+			log.Printf("Failed to parse OVF environment: %v\n", err)
+			vars = map[string]string{}
+		}
+	}
+
+	return func(key string) (string, error) {
+		return vars[key], nil
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vmware
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+const vCloudOvfEnv = `<?xml version="1.0" encoding="UTF-8"?>
+<Environment xmlns="http://schemas.dmtf.org/ovf/environment/1"
+     xmlns:oe="http://schemas.dmtf.org/ovf/environment/1"
+     xmlns:ve="http://www.vmware.com/schema/ovfenv"
+     oe:id="">
+   <PlatformSection>
+      <Kind>VMware ESXi</Kind>
+      <Version>6.5.0</Version>
+      <Vendor>VMware, Inc.</Vendor>
+      <Locale>en_US</Locale>
+   </PlatformSection>
+   <PropertySection>
+      <Property oe:key="vCloud_bitMask" oe:value="1"/>
+      <Property oe:key="vCloud_bootproto_0" oe:value="static"/>
+      <Property oe:key="vCloud_bootproto_1" oe:value="dhcp"/>
+      <Property oe:key="vCloud_computerName" oe:value="core-01"/>
+      <Property oe:key="vCloud_gateway_0" oe:value="192.168.10.1"/>
+      <Property oe:key="vCloud_ip_0" oe:value="192.168.10.20"/>
+      <Property oe:key="vCloud_macaddr_0" oe:value="00:50:56:01:00:01"/>
+      <Property oe:key="vCloud_netmask_0" oe:value="255.255.255.0"/>
+      <Property oe:key="vCloud_primaryDns_0" oe:value="192.168.10.2"/>
+      <Property oe:key="vCloud_secondaryDns_0" oe:value="192.168.10.3"/>
+      <Property oe:key="user-data" oe:value="I2Nsb3VkLWNvbmZpZwpob3N0bmFtZTogdXNlcmRhdGEK"/>
+      <Property oe:key="guestinfo.interface.0.role" oe:value="private"/>
+   </PropertySection>
+   <ve:EthernetAdapterSection>
+      <ve:Adapter ve:mac="00:50:56:01:00:01" ve:network="routed" ve:unitNumber="7"/>
+      <ve:Adapter ve:mac="00:50:56:01:00:02" ve:network="isolated" ve:unitNumber="8"/>
+   </ve:EthernetAdapterSection>
+</Environment>`
+
+func TestParseOvfEnvironment(t *testing.T) {
+	for _, tt := range []struct {
+		document string
+
+		vars map[string]string
+		err  bool
+	}{
+		{
+			document: `<Environment><PropertySection></PropertySection></Environment>`,
+			vars:     map[string]string{},
+		},
+		{
+			document: vCloudOvfEnv,
+			vars: map[string]string{
+				"hostname":                        "core-01",
+				"coreos.config.data":              "I2Nsb3VkLWNvbmZpZwpob3N0bmFtZTogdXNlcmRhdGEK",
+				"coreos.config.data.encoding":     "base64",
+				"interface.0.mac":                 "00:50:56:01:00:01",
+				"interface.0.dhcp":                "no",
+				"interface.0.role":                "private",
+				"interface.0.ip.0.address":        "192.168.10.20/24",
+				"interface.0.route.0.gateway":     "192.168.10.1",
+				"interface.0.route.0.destination": "0.0.0.0/0",
+				"interface.1.mac":                 "00:50:56:01:00:02",
+				"interface.1.dhcp":                "yes",
+				"dns.server.0":                    "192.168.10.2",
+				"dns.server.1":                    "192.168.10.3",
+			},
+		},
+		{
+			document: `<Environment><PropertySection>
+				<Property key="vCloud_computerName" value="vcloud"/>
+				<Property key="guestinfo.hostname" value="guestinfo"/>
+				<Property key="guestinfo.coreos.config.url" value="http://good.example.com"/>
+			</PropertySection></Environment>`,
+			vars: map[string]string{
+				"hostname":          "guestinfo",
+				"coreos.config.url": "http://good.example.com",
+			},
+		},
+		{
+			document: `<Environment><PropertySection>
+				<Property key="vCloud_ip_0" value="192.168.10.20"/>
+				<Property key="vCloud_netmask_0" value="bad"/>
+			</PropertySection></Environment>`,
+			err: true,
+		},
+		{
+			document: `<Environment>`,
+			err:      true,
+		},
+	} {
+		vars, err := parseOvfEnvironment([]byte(tt.document))
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.document, tt.err, err)
+		}
+		if !tt.err && !reflect.DeepEqual(tt.vars, vars) {
+			t.Errorf("bad variables (%q): want %#v, got %#v", tt.document, tt.vars, vars)
+		}
+	}
+}
+
+func TestOvfGuestinfo(t *testing.T) {
+	for _, tt := range []struct {
+		guestinfo MockHypervisor
+
+		metadata datasource.Metadata
+		userdata []byte
+	}{
+		{
+			guestinfo: MockHypervisor{"ovfenv": vCloudOvfEnv, "hostname": "ignored"},
+			metadata: datasource.Metadata{
+				Hostname:    "core-01",
+				PrivateIPv4: net.ParseIP("192.168.10.20"),
+				Nameservers: []net.IP{net.ParseIP("192.168.10.2"), net.ParseIP("192.168.10.3")},
+				NetworkConfig: map[string]string{
+					"dns.server.0":                    "192.168.10.2",
+					"dns.server.1":                    "192.168.10.3",
+					"interface.0.mac":                 "00:50:56:01:00:01",
+					"interface.0.dhcp":                "no",
+					"interface.0.ip.0.address":        "192.168.10.20/24",
+					"interface.0.route.0.gateway":     "192.168.10.1",
+					"interface.0.route.0.destination": "0.0.0.0/0",
+					"interface.1.mac":                 "00:50:56:01:00:02",
+					"interface.1.dhcp":                "yes",
+				},
+			},
+			userdata: []byte("#cloud-config\nhostname: userdata\n"),
+		},
+		{
+			guestinfo: MockHypervisor{"ovfenv": "<Environment>", "hostname": "ignored"},
+			metadata:  datasource.Metadata{NetworkConfig: map[string]string{}},
+			userdata:  []byte{},
+		},
+		{
+			guestinfo: MockHypervisor{"hostname": "guestinfo"},
+			metadata:  datasource.Metadata{Hostname: "guestinfo", NetworkConfig: map[string]string{}},
+			userdata:  []byte{},
+		},
+	} {
+		v := newDatasource("", nil, tt.guestinfo.ReadConfig)
+
+		metadata, err := v.FetchMetadata()
+		if err != nil {
+			t.Errorf("bad error (%q): want nil, got %v", tt.guestinfo, err)
+		}
+		if !reflect.DeepEqual(tt.metadata, metadata) {
+			t.Errorf("bad metadata (%q): want %#v, got %#v", tt.guestinfo, tt.metadata, metadata)
+		}
+		userdata, err := v.FetchUserdata()
+		if err != nil {
+			t.Errorf("bad error (%q): want nil, got %v", tt.guestinfo, err)
+		}
+		if !reflect.DeepEqual(tt.userdata, userdata) {
+			t.Errorf("bad userdata (%q): want %q, got %q", tt.guestinfo, tt.userdata, userdata)
+		}
+	}
+}
+
+func TestOvfFile(t *testing.T) {
+	readFile := func(name string) ([]byte, error) {
+		if name != "/media/ovfenv/ovf-env.xml" {
+			return nil, errors.New("not found")
+		}
+		return []byte(vCloudOvfEnv), nil
+	}
+	guestinfo := func(key string) (string, error) {
+		t.Errorf("guestinfo read for %q", key)
+		return "", nil
+	}
+
+	v := newDatasource("/media/ovfenv/ovf-env.xml", readFile, guestinfo)
+	if hostname, _ := v.readConfig("hostname"); hostname != "core-01" {
+		t.Errorf("bad hostname: want %q, got %q", "core-01", hostname)
+	}
+}
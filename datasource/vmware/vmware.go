@@ -16,10 +16,12 @@ package vmware
 
 import (
 	"fmt"
+	"log"
 	"net"
 
 	"github.com/coreos/coreos-cloudinit/config"
 	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/pkg"
 )
 
 type readConfigFunction func(key string) (string, error)
@@ -31,6 +33,41 @@ type vmware struct {
 	urlDownload urlDownloadFunction
 }
 
+// newDatasource creates a datasource reading the provided OVF environment
+// document (typically /media/ovfenv/ovf-env.xml) with readFile or, without
+// one, the OVF environment or the variables read through guestinfo.
+func newDatasource(fileName string, readFile func(string) ([]byte, error), guestinfo readConfigFunction) *vmware {
+	if fileName != "" {
+		log.Printf("Using OVF environment from %s\n", fileName)
+		ovfEnv, err := readFile(fileName)
+		if err != nil {
+			ovfEnv = make([]byte, 0)
+		}
+		return &vmware{
+			ovfFileName: fileName,
+			readConfig:  getOvfReadConfig(ovfEnv),
+			urlDownload: urlDownload,
+		}
+	}
+
+	// try to read ovf environment from VMware tools
+	data, err := guestinfo("ovfenv")
+	if err == nil && data != "" {
+		log.Printf("Using OVF environment from guestinfo\n")
+		return &vmware{
+			readConfig:  getOvfReadConfig([]byte(data)),
+			urlDownload: urlDownload,
+		}
+	}
+
+	// if everything fails, fallback to directly reading variables from the backdoor
+	log.Printf("Using guestinfo variables\n")
+	return &vmware{
+		readConfig:  guestinfo,
+		urlDownload: urlDownload,
+	}
+}
+
 func (v vmware) AvailabilityChanges() bool {
 	return false
 }
@@ -55,6 +92,8 @@ func (v vmware) FetchMetadata() (metadata datasource.Metadata, err error) {
 	for i := 0; ; i++ {
 		if nameserver := saveConfig("dns.server.%d", i); nameserver == "" {
 			break
+		} else if ip := net.ParseIP(nameserver); ip != nil {
+			metadata.Nameservers = append(metadata.Nameservers, ip)
 		}
 	}
 
@@ -151,3 +190,8 @@ func (v vmware) FetchUserdata() ([]byte, error) {
 func (v vmware) Type() string {
 	return "vmware"
 }
+
+func urlDownload(url string) ([]byte, error) {
+	client := pkg.NewHttpClient()
+	return client.GetRetry(url)
+}
@@ -19,52 +19,12 @@ import (
 	"log"
 	"os"
 
-	"github.com/coreos/coreos-cloudinit/pkg"
-
 	"github.com/sigma/vmw-guestinfo/rpcvmx"
 	"github.com/sigma/vmw-guestinfo/vmcheck"
-	"github.com/sigma/vmw-ovflib"
 )
 
-type ovfWrapper struct {
-	env *ovf.OvfEnvironment
-}
-
-func (ovf ovfWrapper) readConfig(key string) (string, error) {
-	return ovf.env.Properties["guestinfo."+key], nil
-}
-
 func NewDatasource(fileName string) *vmware {
-	// read from provided ovf environment document (typically /media/ovfenv/ovf-env.xml)
-	if fileName != "" {
-		log.Printf("Using OVF environment from %s\n", fileName)
-		ovfEnv, err := ioutil.ReadFile(fileName)
-		if err != nil {
-			ovfEnv = make([]byte, 0)
-		}
-		return &vmware{
-			ovfFileName: fileName,
-			readConfig:  getOvfReadConfig(ovfEnv),
-			urlDownload: urlDownload,
-		}
-	}
-
-	// try to read ovf environment from VMware tools
-	data, err := readConfig("ovfenv")
-	if err == nil && data != "" {
-		log.Printf("Using OVF environment from guestinfo\n")
-		return &vmware{
-			readConfig:  getOvfReadConfig([]byte(data)),
-			urlDownload: urlDownload,
-		}
-	}
-
-	// if everything fails, fallback to directly reading variables from the backdoor
-	log.Printf("Using guestinfo variables\n")
-	return &vmware{
-		readConfig:  readConfig,
-		urlDownload: urlDownload,
-	}
+	return newDatasource(fileName, ioutil.ReadFile, readConfig)
 }
 
 func (v vmware) IsAvailable() bool {
@@ -84,18 +44,3 @@ func readConfig(key string) (string, error) {
 	}
 	return data, err
 }
-
-func getOvfReadConfig(ovfEnv []byte) readConfigFunction {
-	env := &ovf.OvfEnvironment{}
-	if len(ovfEnv) != 0 {
-		env = ovf.ReadEnvironment(ovfEnv)
-	}
-
-	wrapper := ovfWrapper{env}
-	return wrapper.readConfig
-}
-
-func urlDownload(url string) ([]byte, error) {
-	client := pkg.NewHttpClient()
-	return client.GetRetry(url)
-}
@@ -18,7 +18,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"path"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
 	"github.com/coreos/coreos-cloudinit/network"
@@ -42,12 +46,169 @@ type CloudConfigUnit interface {
 // Apply renders a CloudConfig to an Environment. This can involve things like
 // configuring the hostname, adding new users, writing various configuration
 // files to disk, and manipulating systemd services.
+//
+// Once the config has been applied successfully, a sentinel recording its
+// inputs is written to the workspace, and applying the same inputs again
+// during the same boot is a no-op unless forced (see Environment.SetForce).
+// Likewise, only the units whose inputs changed are placed and commanded.
 func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Environment) error {
+	hash := configHash(cfg, ifaces, env)
+	if env.Applied("config", hash) {
+		log.Printf("Config was already applied during this boot, skipping (use -force to apply it again)")
+		return nil
+	}
+	if err := apply(cfg, ifaces, env); err != nil {
+		return err
+	}
+	return env.MarkApplied("config", hash)
+}
+
+func apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Environment) error {
+	if err := cfg.BootCmd.Check(); err != nil {
+		return fmt.Errorf("invalid bootcmd %v", err)
+	}
+	if err := cfg.RunCmd.Check(); err != nil {
+		return fmt.Errorf("invalid runcmd %v", err)
+	}
+	for device, disk := range cfg.DiskSetup {
+		if err := disk.Check(device); err != nil {
+			return err
+		}
+	}
+	for _, fs := range cfg.FsSetup {
+		if err := fs.Check(); err != nil {
+			return err
+		}
+	}
+	if err := cfg.Growpart.Check(); err != nil {
+		return err
+	}
+	if err := cfg.Packages.CheckNames(); err != nil {
+		return err
+	}
+	if err := cfg.CoreOS.Locksmith.CheckWindow(); err != nil {
+		return err
+	}
+	for _, u := range cfg.CoreOS.Units {
+		if len(u.Instances) > 0 && !u.IsTemplate() {
+			return fmt.Errorf("unit %q is not a template unit and cannot have instances", u.Name)
+		}
+		for _, d := range u.DropIns {
+			if err := d.Check(); err != nil {
+				return fmt.Errorf("invalid drop-in of unit %q: %v", u.Name, err)
+			}
+		}
+	}
+	if err := config.CheckMounts(cfg.Mounts); err != nil {
+		return err
+	}
+	if cfg.Hostname != "" && !system.IsValidHostname(cfg.Hostname) {
+		return fmt.Errorf("invalid hostname %q", cfg.Hostname)
+	}
+	for i, dir := range cfg.Directories {
+		if err := dir.CheckPath(); err != nil {
+			return fmt.Errorf("invalid directories entry %d: %v", i, err)
+		}
+	}
+	for i, file := range cfg.WriteFiles {
+		if err := file.CheckPath(); err != nil {
+			return fmt.Errorf("invalid write_files entry %d: %v", i, err)
+		}
+	}
+
+	// The boot commands are run before anything else is applied, so that
+	// e.g. the disks they partition or the modules they load can be used.
+	if len(cfg.BootCmd) > 0 {
+		Notify("Running boot commands")
+	}
+	if err := runCommands(cfg.BootCmd, env); err != nil {
+		return err
+	}
+
+	// The disks are partitioned and formatted next, so that the files and
+	// mounts can make use of them.
+	if err := setupDisks(cfg.DiskSetup, cfg.FsSetup, env); err != nil {
+		return err
+	}
+
+	// The partitions are grown before the files are written, so that the
+	// files don't fill up a root filesystem which is still small.
+	if len(cfg.Growpart.Devices) > 0 {
+		Notify("Growing partitions")
+	}
+	if env.DryRun() {
+		for _, device := range cfg.Growpart.Devices {
+			fmt.Fprintf(env.dryRun, "grow-partition %s\n", device)
+		}
+	} else {
+		for _, device := range cfg.Growpart.Devices {
+			growpart := system.Growpart{
+				Resolve:  system.ResolveGrowTarget,
+				Probe:    system.ProbeBlockDevice,
+				Run:      system.ExecCommand,
+				Growpart: config.Growpart{Devices: []string{device}},
+			}
+			if err := env.report.Add("grow-partition", device, growpart.Grow()); err != nil {
+				return err
+			}
+		}
+	}
+
 	if cfg.Hostname != "" {
-		if err := system.SetHostname(cfg.Hostname); err != nil {
+		hostname := cfg.Hostname
+		if env.DryRun() {
+			fmt.Fprintf(env.dryRun, "set-hostname %s\n", hostname)
+		} else {
+			if err := env.report.Add("set-hostname", hostname, system.SetHostname(hostname)); err != nil {
+				return err
+			}
+			log.Printf("Set hostname to %s", hostname)
+		}
+	}
+
+	if cfg.Timezone != "" {
+		if env.DryRun() {
+			fmt.Fprintf(env.dryRun, "set-timezone %s\n", cfg.Timezone)
+		} else {
+			if err := env.report.Add("set-timezone", cfg.Timezone, system.SetTimezone(cfg.Timezone, env.Root())); err != nil {
+				return err
+			}
+			log.Printf("Set timezone to %s", cfg.Timezone)
+		}
+	}
+
+	if cfg.Locale != "" {
+		if generated, err := system.LocaleGenerated(cfg.Locale, env.Root()); err == nil && !generated {
+			log.Printf("Warning: locale %q has not been generated on this image", cfg.Locale)
+		}
+		if env.DryRun() {
+			fmt.Fprintf(env.dryRun, "set-locale %s\n", cfg.Locale)
+		} else {
+			if err := env.report.Add("set-locale", cfg.Locale, system.SetLocale(cfg.Locale, env.Root())); err != nil {
+				return err
+			}
+			log.Printf("Set locale to %s", cfg.Locale)
+		}
+	}
+
+	Notify("Creating users")
+
+	// Groups are created before the users, so that they can be used as the
+	// users' groups, but only get their members once the users exist.
+	for _, group := range cfg.Groups {
+		if env.DryRun() {
+			dryRunGroup(env.dryRun, group)
+			continue
+		}
+		if system.GroupExists(group.Name) {
+			log.Printf("Group '%s' exists, skipping creation", group.Name)
+			continue
+		}
+		log.Printf("Creating group '%s'", group.Name)
+		if err := env.report.Add("create-group", group.Name, system.CreateGroup(group)); err != nil {
+			log.Printf("Failed creating group '%s': %v", group.Name, err)
 			return err
 		}
-		log.Printf("Set hostname to %s", cfg.Hostname)
 	}
 
 	for _, user := range cfg.Users {
@@ -56,6 +217,20 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 			continue
 		}
 
+		if env.DryRun() {
+			dryRunUser(env.dryRun, user)
+			if len(user.Sudo) > 0 {
+				f, err := system.SudoersFile(user.Name, user.Sudo)
+				if err != nil {
+					return err
+				}
+				if _, err := dryRunFile(env.dryRun, f, env.Root()); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
 		if system.UserExists(&user) {
 			log.Printf("User '%s' exists, ignoring creation-time fields", user.Name)
 			if user.PasswordHash != "" {
@@ -64,16 +239,42 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 					log.Printf("Failed setting '%s' user's password: %v", user.Name, err)
 					return err
 				}
+			} else if user.PlainTextPasswd != "" {
+				if err := setPlainTextPassword(user); err != nil {
+					return err
+				}
+			}
+			if user.LockPasswd {
+				if err := lockPassword(user); err != nil {
+					return err
+				}
 			}
 		} else {
 			log.Printf("Creating user '%s'", user.Name)
-			if err := system.CreateUser(&user); err != nil {
+			if err := env.report.Add("create-user", user.Name, system.CreateUser(&user)); err != nil {
 				log.Printf("Failed creating user '%s': %v", user.Name, err)
 				return err
 			}
+			// The password hash (if any) is set and locked by useradd,
+			// but a plaintext password can only be set afterwards.
+			if user.PasswordHash == "" && user.PlainTextPasswd != "" {
+				if err := setPlainTextPassword(user); err != nil {
+					return err
+				}
+				if user.LockPasswd {
+					if err := lockPassword(user); err != nil {
+						return err
+					}
+				}
+			}
 		}
 
-		if len(user.SSHAuthorizedKeys) > 0 {
+		if user.SSHKeysExclusive {
+			log.Printf("Replacing SSH keys of user '%s' with %d keys", user.Name, len(user.SSHAuthorizedKeys))
+			if err := system.ReplaceSSHKeys(user.Name, env.SSHKeyName(), user.SSHAuthorizedKeys); err != nil {
+				return err
+			}
+		} else if len(user.SSHAuthorizedKeys) > 0 {
 			log.Printf("Authorizing %d SSH keys for user '%s'", len(user.SSHAuthorizedKeys), user.Name)
 			if err := system.AuthorizeSSHKeys(user.Name, env.SSHKeyName(), user.SSHAuthorizedKeys); err != nil {
 				return err
@@ -97,9 +298,47 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 				return err
 			}
 		}
+		if err := SSHImportKeys(user.Name, user.SSHImportGithub, user.SSHImportGitlab); err != nil {
+			return err
+		}
+		if len(user.Sudo) > 0 {
+			log.Printf("Writing %d sudo rules for user '%s'", len(user.Sudo), user.Name)
+			if _, err := system.WriteSudoers(user.Name, user.Sudo, env.Root()); err != nil {
+				log.Printf("Failed writing sudo rules for user '%s': %v", user.Name, err)
+				return err
+			}
+		}
 	}
 
-	if len(cfg.SSHAuthorizedKeys) > 0 {
+	for _, group := range cfg.Groups {
+		if env.DryRun() {
+			dryRunGroupMembers(env.dryRun, group)
+			continue
+		}
+		members, err := system.MissingGroupMembers(group, system.GroupFile)
+		if err != nil {
+			log.Printf("Failed reading members of group '%s': %v", group.Name, err)
+			return err
+		}
+		for _, member := range members {
+			log.Printf("Adding user '%s' to group '%s'", member, group.Name)
+			if err := system.AddGroupMember(group.Name, member); err != nil {
+				log.Printf("Failed adding user '%s' to group '%s': %v", member, group.Name, err)
+				return err
+			}
+		}
+	}
+
+	if cfg.SSHKeysExclusive && env.DryRun() {
+		fmt.Fprintf(env.dryRun, "replace-ssh-keys core %d\n", len(cfg.SSHAuthorizedKeys))
+	} else if len(cfg.SSHAuthorizedKeys) > 0 && env.DryRun() {
+		fmt.Fprintf(env.dryRun, "authorize-ssh-keys core %d\n", len(cfg.SSHAuthorizedKeys))
+	} else if cfg.SSHKeysExclusive {
+		if err := system.ReplaceSSHKeys("core", env.SSHKeyName(), cfg.SSHAuthorizedKeys); err != nil {
+			return err
+		}
+		log.Printf("Replaced SSH keys for core user")
+	} else if len(cfg.SSHAuthorizedKeys) > 0 {
 		err := system.AuthorizeSSHKeys("core", env.SSHKeyName(), cfg.SSHAuthorizedKeys)
 		if err == nil {
 			log.Printf("Authorized SSH keys for core user")
@@ -108,16 +347,57 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 		}
 	}
 
+	if env.DryRun() {
+		dryRunSSHImport(env.dryRun, "core", cfg.SSHImportGithub, cfg.SSHImportGitlab)
+	} else if err := SSHImportKeys("core", cfg.SSHImportGithub, cfg.SSHImportGitlab); err != nil {
+		return err
+	}
+
+	Notify("Writing files")
+
+	// The directories and files are created once the users and groups have
+	// been created, so that they can be owned by them.
+	for _, dir := range cfg.Directories {
+		d := system.Directory{Directory: dir}
+		if env.DryRun() {
+			if err := dryRunDirectory(env.dryRun, &d, env.Root()); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := system.EnsureDirectory(&d, env.Root()); env.report.Add("ensure-directory", d.Path, err) != nil {
+			return err
+		}
+	}
+
 	var writeFiles []system.File
-	for _, file := range cfg.WriteFiles {
+	for i, file := range cfg.WriteFiles {
+		if !file.AppliesTo(env.Datasource()) {
+			log.Printf("Skipping file %q on datasource %q", file.Path, env.Datasource())
+			continue
+		}
+		if file.ExpandEnv {
+			var err error
+			if file, err = expandEnv(file); err != nil {
+				return fmt.Errorf("invalid write_files entry %d: %v", i, err)
+			}
+		}
+		if file.Template {
+			var err error
+			if file, err = renderTemplate(file, cfg.Hostname, env); err != nil {
+				return fmt.Errorf("invalid write_files entry %d: %v", i, err)
+			}
+		}
 		writeFiles = append(writeFiles, system.File{File: file})
 	}
 
 	for _, ccf := range []CloudConfigFile{
 		system.OEM{OEM: cfg.CoreOS.OEM},
 		system.Update{Update: cfg.CoreOS.Update, ReadConfig: system.DefaultReadConfig},
-		system.EtcHosts{EtcHosts: cfg.ManageEtcHosts},
+		system.EtcHosts{EtcHosts: cfg.ManageEtcHosts, Entries: cfg.EtcHostsEntries, Root: env.Root(), Hostname: cfg.Hostname},
 		system.Flannel{Flannel: cfg.CoreOS.Flannel},
+		system.NTP{NTP: cfg.NTP},
+		system.Sysctl{Sysctl: cfg.Sysctl},
 	} {
 		f, err := ccf.File()
 		if err != nil {
@@ -128,25 +408,61 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 		}
 	}
 
+	caCerts := system.CACerts{CACerts: cfg.CACerts}
+	writeFiles = append(writeFiles, caCerts.Files(env.Root())...)
+
+	uniqueModules, err := cfg.Modules.Deduped()
+	if err != nil {
+		return err
+	}
+	modules := system.Modules{Modules: uniqueModules, Modprobe: system.Modprobe}
+	moduleFiles, err := modules.Files()
+	if err != nil {
+		return err
+	}
+	writeFiles = append(writeFiles, moduleFiles...)
+
 	var units []system.Unit
 	for _, u := range cfg.CoreOS.Units {
+		if !u.AppliesTo(env.Datasource()) {
+			log.Printf("Skipping unit %q on datasource %q", u.Name, env.Datasource())
+			continue
+		}
 		units = append(units, system.Unit{Unit: u})
 	}
 
 	for _, ccu := range []CloudConfigUnit{
 		system.Etcd{Etcd: cfg.CoreOS.Etcd},
 		system.Etcd2{Etcd2: cfg.CoreOS.Etcd2},
+		system.Etcd3{Etcd3: cfg.CoreOS.Etcd3},
+		system.Flannel{Flannel: cfg.CoreOS.Flannel},
 		system.Fleet{Fleet: cfg.CoreOS.Fleet},
 		system.Locksmith{Locksmith: cfg.CoreOS.Locksmith},
 		system.Update{Update: cfg.CoreOS.Update, ReadConfig: system.DefaultReadConfig},
+		system.NTP{NTP: cfg.NTP},
+		system.Packages{Packages: cfg.Packages, Layered: system.LayeredPackages, Workspace: env.Workspace()},
+		system.Sysctl{Sysctl: cfg.Sysctl},
 	} {
 		units = append(units, ccu.Units()...)
 	}
 
+	for _, m := range cfg.Mounts {
+		units = append(units, system.Mount{Mount: m}.Units()...)
+	}
+
 	wroteEnvironment := false
 	for _, file := range writeFiles {
+		if env.DryRun() {
+			if _, err := dryRunFile(env.dryRun, &file, env.Root()); err != nil {
+				return err
+			}
+			if path.Clean(file.Path) == "/etc/environment" {
+				wroteEnvironment = true
+			}
+			continue
+		}
 		fullPath, err := system.WriteFile(&file, env.Root())
-		if err != nil {
+		if env.report.Add("write-file", file.Path, err) != nil {
 			return err
 		}
 		if path.Clean(file.Path) == "/etc/environment" {
@@ -157,24 +473,270 @@ func Apply(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Env
 
 	if !wroteEnvironment {
 		ef := env.DefaultEnvironmentFile()
-		if ef != nil {
+		if ef != nil && env.DryRun() {
+			dryRunEnvFile(env.dryRun, ef, env.Root())
+		} else if ef != nil {
 			err := system.WriteEnvFile(ef, env.Root())
-			if err != nil {
+			if env.report.Add("update-environment", ef.Path, err) != nil {
 				return err
 			}
 			log.Printf("Updated /etc/environment")
 		}
 	}
 
-	if len(ifaces) > 0 {
+	if len(cfg.CACerts.Trusted) > 0 || cfg.CACerts.RemoveDefaults {
+		if env.DryRun() {
+			fmt.Fprintln(env.dryRun, "update-ca-certificates")
+		} else if err := env.report.Add("update-ca-certificates", "", caCerts.Update(env.Root())); err != nil {
+			return err
+		} else {
+			log.Printf("Updated CA certificates")
+		}
+	}
+
+	if env.DryRun() {
+		for _, m := range modules.Modules {
+			fmt.Fprintf(env.dryRun, "load-module %s\n", m.Name)
+		}
+	} else {
+		for _, err := range modules.Load() {
+			log.Printf("Failed loading kernel module: %v", err)
+		}
+	}
+
+	if cfg.Swap.Path != "" && env.DryRun() {
+		fmt.Fprintf(env.dryRun, "create-swap %s size=%s\n", path.Join(env.Root(), cfg.Swap.Path), cfg.Swap.Size)
+		units = append(units, system.Swap{Swap: cfg.Swap}.Units()...)
+	} else if cfg.Swap.Path != "" {
+		swap := system.Swap{Swap: cfg.Swap}
+		if err := swap.Create(env.Root()); err == system.ErrFallocateUnsupported {
+			log.Printf("Warning: unable to create swap file %q: %v, not enabling swap", cfg.Swap.Path, err)
+		} else if env.report.Add("create-swap", cfg.Swap.Path, err) != nil {
+			return err
+		} else {
+			units = append(units, swap.Units()...)
+		}
+	}
+
+	if len(ifaces) > 0 && env.Netplan() {
+		file := system.File{File: config.File{
+			Path:               path.Join("etc", "netplan", "50-cloudinit.yaml"),
+			RawFilePermissions: "0644",
+			Content:            network.Netplan(ifaces),
+		}}
+		if env.DryRun() {
+			if _, err := dryRunFile(env.dryRun, &file, env.Root()); err != nil {
+				return err
+			}
+			fmt.Fprintln(env.dryRun, "netplan-apply")
+		} else {
+			if _, err := system.WriteFile(&file, env.Root()); env.report.Add("write-file", "/"+file.Path, err) != nil {
+				return err
+			}
+			if err := env.report.Add("apply-netplan", "", system.ApplyNetplan()); err != nil {
+				return err
+			}
+		}
+	} else if len(ifaces) > 0 {
 		units = append(units, createNetworkingUnits(ifaces)...)
-		if err := system.RestartNetwork(ifaces); err != nil {
+		if env.DryRun() {
+			fmt.Fprintln(env.dryRun, "restart-network")
+		} else if err := env.report.Add("restart-network", "", system.RestartNetwork(ifaces)); err != nil {
 			return err
 		}
 	}
 
+	Notify("Enabling units")
 	um := system.NewUnitManager(env.Root())
-	return processUnits(units, env.Root(), um)
+	if env.DryRun() {
+		um = dryRunUnitManager{w: env.dryRun, root: env.Root()}
+	} else if env.report != nil {
+		um = reportingUnitManager{UnitManager: um, report: env.report}
+	}
+	units, hashes := changedUnits(units, env)
+	masked := env.maskedUnits()
+	if err := processUnits(units, env.Root(), um, masked); err != nil {
+		return err
+	}
+	if err := env.setMaskedUnits(masked); err != nil {
+		return err
+	}
+	for name, hash := range hashes {
+		if err := env.MarkApplied("unit-"+name, hash); err != nil {
+			return err
+		}
+	}
+
+	// The commands are run last, once the files, users and units they may
+	// rely on are in place.
+	if len(cfg.RunCmd) > 0 {
+		Notify("Running commands")
+	}
+	return runCommands(cfg.RunCmd, env)
+}
+
+// setupDisks creates the partition tables of the disks, in the order of their
+// devices, and then the filesystems.
+func setupDisks(disks config.DiskSetup, filesystems config.FsSetup, env *Environment) error {
+	if len(disks) == 0 && len(filesystems) == 0 {
+		return nil
+	}
+	Notify("Setting up disks")
+
+	devices := make([]string, 0, len(disks))
+	for device := range disks {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		disk := system.Disk{Device: device, Probe: system.ProbeBlockDevice, Disk: disks[device]}
+		if env.DryRun() {
+			dryRunDisk(env.dryRun, disk)
+			continue
+		}
+		if err := env.report.Add("partition-disk", device, disk.Partition()); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range filesystems {
+		fs := system.Filesystem{Probe: system.ProbeBlockDevice, Filesystem: f}
+		if env.DryRun() {
+			dryRunFilesystem(env.dryRun, fs)
+			continue
+		}
+		if err := env.report.Add("create-filesystem", f.Device, fs.Create()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCommands runs the given commands (of bootcmd or runcmd) in order,
+// stopping at the first one which fails unless its errors are ignored.
+func runCommands(cmds config.RunCmd, env *Environment) error {
+	for _, c := range cmds {
+		if env.DryRun() {
+			dryRunCommand(env.dryRun, c)
+			continue
+		}
+		if err := runCommand(c, env); err != nil {
+			if !c.IgnoreErrors {
+				return err
+			}
+			log.Printf("Ignoring failure of command %s: %v", c, err)
+		}
+	}
+	return nil
+}
+
+// runCommand runs a single command, logging its output.
+func runCommand(c config.Command, env *Environment) error {
+	log.Printf("Running command %s", c)
+	output, err := system.RunCommand(c)
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if line != "" {
+			log.Printf("%s: %s", c, line)
+		}
+	}
+	return env.report.Add("run-command", c.String(), err)
+}
+
+// configHash returns the hash of all of the inputs of Apply.
+func configHash(cfg config.CloudConfig, ifaces []network.InterfaceGenerator, env *Environment) string {
+	return Hash(cfg, networkInputs(ifaces), env.Netplan(), env.substitutions)
+}
+
+// networkInputs returns the rendered configuration of the given interfaces.
+func networkInputs(ifaces []network.InterfaceGenerator) []string {
+	var inputs []string
+	for _, i := range ifaces {
+		inputs = append(inputs, i.Filename(), i.Netdev(), i.Link(), i.Network())
+	}
+	return inputs
+}
+
+// changedUnits returns the units which weren't already applied with the same
+// inputs during this boot, along with the hash of the inputs of each of them
+// (keyed by name, since several units may share a name).
+func changedUnits(units []system.Unit, env *Environment) ([]system.Unit, map[string]string) {
+	byName := map[string][]system.Unit{}
+	for _, u := range units {
+		byName[u.Name] = append(byName[u.Name], u)
+	}
+
+	hashes := map[string]string{}
+	for name, us := range byName {
+		hashes[name] = Hash(us)
+	}
+
+	var changed []system.Unit
+	for _, u := range units {
+		if u.Name != "" && env.Applied("unit-"+u.Name, hashes[u.Name]) {
+			log.Printf("Unit %q was already applied during this boot, skipping", u.Name)
+			continue
+		}
+		changed = append(changed, u)
+	}
+	for name := range hashes {
+		if name == "" {
+			delete(hashes, name)
+		}
+	}
+	return changed, hashes
+}
+
+// envVariable matches the ${VAR} references expanded by expandEnv.
+var envVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv returns the file with the ${VAR} references in its (decoded)
+// content replaced by the values of the variables in the environment of
+// coreos-cloudinit, undefined variables expanding to nothing. Other uses of
+// "$" (e.g. $VAR) are left alone.
+func expandEnv(file config.File) (config.File, error) {
+	content, err := config.DecodeContent(file.Content, file.Encoding)
+	if err != nil {
+		return file, fmt.Errorf("unable to decode %s (%v)", file.Path, err)
+	}
+	file.Content = envVariable.ReplaceAllStringFunc(string(content), func(ref string) string {
+		return os.Getenv(envVariable.FindStringSubmatch(ref)[1])
+	})
+	file.Encoding = ""
+	return file, nil
+}
+
+// renderTemplate returns the file with its (decoded) content rendered as a
+// template.
+func renderTemplate(file config.File, hostname string, env *Environment) (config.File, error) {
+	content, err := config.DecodeContent(file.Content, file.Encoding)
+	if err != nil {
+		return file, fmt.Errorf("unable to decode %s (%v)", file.Path, err)
+	}
+	rendered, err := env.RenderTemplate(file.Path, string(content), hostname)
+	if err != nil {
+		return file, err
+	}
+	file.Content = rendered
+	file.Encoding = ""
+	return file, nil
+}
+
+func setPlainTextPassword(user config.User) error {
+	log.Printf("Setting '%s' user's plaintext password", user.Name)
+	if err := system.SetUserPlainTextPassword(user.Name, user.PlainTextPasswd); err != nil {
+		log.Printf("Failed setting '%s' user's plaintext password: %v", user.Name, err)
+		return err
+	}
+	return nil
+}
+
+func lockPassword(user config.User) error {
+	log.Printf("Locking '%s' user's password", user.Name)
+	if err := system.LockUserPassword(user.Name); err != nil {
+		log.Printf("Failed locking '%s' user's password: %v", user.Name, err)
+		return err
+	}
+	return nil
 }
 
 func createNetworkingUnits(interfaces []network.InterfaceGenerator) (units []system.Unit) {
@@ -200,12 +762,25 @@ func createNetworkingUnits(interfaces []network.InterfaceGenerator) (units []sys
 // the given UnitManager. This can involve things like writing unit files to
 // disk, masking/unmasking units, or invoking systemd
 // commands against units. It returns any error encountered.
-func processUnits(units []system.Unit, root string, um system.UnitManager) error {
+//
+// The units are applied in phases, so that units may refer to each other
+// regardless of the order in which they are listed: first all of the unit
+// files and drop-ins are written (and masked or unmasked), then the units are
+// enabled, systemd is reloaded and finally the commands are executed in the
+// order of the units.
+//
+// masked holds the units which coreos-cloudinit masked itself (see
+// Environment.maskedUnits) and is updated as units are masked and unmasked.
+// Apart from runtime units, only those are unmasked once they are no longer
+// to be masked, so that masks created by an administrator are left alone.
+// Units which only consist of drop-ins are never masked or unmasked.
+func processUnits(units []system.Unit, root string, um system.UnitManager, masked map[string]bool) error {
 	type action struct {
 		unit    system.Unit
 		command string
 	}
 	actions := make([]action, 0, len(units))
+	var targets []system.Unit
 	reload := false
 	restartNetworkd := false
 	for _, unit := range units {
@@ -234,34 +809,60 @@ func processUnits(units []system.Unit, root string, um system.UnitManager) error
 			}
 		}
 
-		if unit.Mask {
+		// Units which were masked by an earlier run are unmasked unless
+		// they are still to be masked, so that they can run again.
+		switch {
+		case unit.Mask:
 			log.Printf("Masking unit file %q", unit.Name)
-			if err := um.MaskUnit(unit); err != nil {
+			changed, err := um.MaskUnit(unit)
+			if err != nil {
 				return err
 			}
-		} else if unit.Runtime {
-			log.Printf("Ensuring runtime unit file %q is unmasked", unit.Name)
-			if err := um.UnmaskUnit(unit); err != nil {
+			if changed {
+				masked[unit.Name] = true
+			}
+			reload = reload || changed
+		case unit.Content == "" && len(unit.DropIns) > 0:
+			// Drop-ins never touch the mask of the base unit.
+		case unit.Runtime || masked[unit.Name]:
+			changed, err := um.UnmaskUnit(unit)
+			if err != nil {
 				return err
 			}
+			delete(masked, unit.Name)
+			if changed {
+				log.Printf("Unmasked unit file %q", unit.Name)
+			}
+			reload = reload || changed
 		}
 
-		if unit.Enable {
-			if unit.Group() != "network" {
-				log.Printf("Enabling unit file %q", unit.Name)
-				if err := um.EnableUnitFile(unit); err != nil {
+		// The instances of a template unit are enabled and commanded in
+		// place of the template itself.
+		if len(unit.Instances) == 0 {
+			targets = append(targets, unit)
+		}
+		for _, name := range unit.Instances {
+			targets = append(targets, unit.Instance(name))
+		}
+	}
+
+	for _, u := range targets {
+		if u.Enable {
+			if u.Group() != "network" {
+				log.Printf("Enabling unit file %q", u.Name)
+				if err := um.EnableUnitFile(u); err != nil {
 					return err
 				}
-				log.Printf("Enabled unit %q", unit.Name)
+				log.Printf("Enabled unit %q", u.Name)
 			} else {
-				log.Printf("Skipping enable for network-like unit %q", unit.Name)
+				log.Printf("Skipping enable for network-like unit %q", u.Name)
 			}
 		}
 
-		if unit.Group() == "network" {
+		if u.Group() == "network" {
 			restartNetworkd = true
-		} else if unit.Command != "" {
-			actions = append(actions, action{unit, unit.Command})
+		} else if u.Command != "" {
+			actions = append(actions, action{u, u.Command})
 		}
 	}
 
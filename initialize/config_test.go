@@ -15,6 +15,8 @@
 package initialize
 
 import (
+	"fmt"
+	"os"
 	"reflect"
 	"testing"
 
@@ -57,13 +59,13 @@ func (tum *TestUnitManager) DaemonReload() error {
 	tum.reload = true
 	return nil
 }
-func (tum *TestUnitManager) MaskUnit(u system.Unit) error {
+func (tum *TestUnitManager) MaskUnit(u system.Unit) (bool, error) {
 	tum.masked = append(tum.masked, u.Name)
-	return nil
+	return true, nil
 }
-func (tum *TestUnitManager) UnmaskUnit(u system.Unit) error {
+func (tum *TestUnitManager) UnmaskUnit(u system.Unit) (bool, error) {
 	tum.unmasked = append(tum.unmasked, u.Name)
-	return nil
+	return true, nil
 }
 
 type mockInterface struct {
@@ -161,6 +163,7 @@ func TestProcessUnits(t *testing.T) {
 			},
 			result: TestUnitManager{
 				masked: []string{"foo"},
+				reload: true,
 			},
 		},
 		{
@@ -209,6 +212,19 @@ func TestProcessUnits(t *testing.T) {
 			},
 			result: TestUnitManager{
 				unmasked: []string{"locksmithd.service"},
+				reload:   true,
+			},
+		},
+		{
+			units: []system.Unit{
+				{Unit: config.Unit{
+					Name:    "docker.service",
+					DropIns: []config.UnitDropIn{{Name: "50-opts.conf", Content: "[Service]\nEnvironment=DOCKER_OPTS=--debug"}},
+				}},
+			},
+			result: TestUnitManager{
+				placed: []string{"docker.service.d/50-opts.conf"},
+				reload: true,
 			},
 		},
 		{
@@ -222,6 +238,25 @@ func TestProcessUnits(t *testing.T) {
 				enabled: []string{"woof"},
 			},
 		},
+		{
+			units: []system.Unit{
+				{Unit: config.Unit{
+					Name:      "echo@.service",
+					Content:   "[Service]\nExecStart=/bin/echo %i",
+					Command:   "start",
+					Instances: []string{"a", "b"},
+				}},
+			},
+			result: TestUnitManager{
+				placed:  []string{"echo@.service"},
+				enabled: []string{"echo@a.service", "echo@b.service"},
+				commands: []UnitAction{
+					{"echo@a.service", "start"},
+					{"echo@b.service", "start"},
+				},
+				reload: true,
+			},
+		},
 		{
 			units: []system.Unit{
 				{Unit: config.Unit{
@@ -289,7 +324,7 @@ func TestProcessUnits(t *testing.T) {
 
 	for _, tt := range tests {
 		tum := &TestUnitManager{}
-		if err := processUnits(tt.units, "", tum); err != nil {
+		if err := processUnits(tt.units, "", tum, map[string]bool{}); err != nil {
 			t.Errorf("bad error (%+v): want nil, got %s", tt.units, err)
 		}
 		if !reflect.DeepEqual(tt.result, *tum) {
@@ -297,3 +332,161 @@ func TestProcessUnits(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessUnitsUnmask(t *testing.T) {
+	tum := &TestUnitManager{}
+	masked := map[string]bool{}
+	units := []system.Unit{{Unit: config.Unit{Name: "foo.service", Mask: true}}}
+	if err := processUnits(units, "", tum, masked); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	if !tum.reload {
+		t.Fatalf("masking did not reload systemd")
+	}
+	if !masked["foo.service"] {
+		t.Fatalf("mask of foo.service was not recorded: %v", masked)
+	}
+
+	// Only foo.service was masked by coreos-cloudinit, so neither the unit
+	// masked by the administrator nor the drop-in-only unit are unmasked.
+	tum.reload = false
+	units = []system.Unit{
+		{Unit: config.Unit{Name: "foo.service", Command: "start"}},
+		{Unit: config.Unit{Name: "admin.service", Command: "start"}},
+		{Unit: config.Unit{Name: "docker.service", DropIns: []config.UnitDropIn{{Name: "50-opts.conf", Content: "[Service]"}}}},
+	}
+	if err := processUnits(units, "", tum, masked); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	want := TestUnitManager{
+		placed:   []string{"docker.service.d/50-opts.conf"},
+		masked:   []string{"foo.service"},
+		unmasked: []string{"foo.service"},
+		commands: []UnitAction{{"foo.service", "start"}, {"admin.service", "start"}},
+		reload:   true,
+	}
+	if !reflect.DeepEqual(want, *tum) {
+		t.Fatalf("bad result: want %+v, got %+v", want, tum)
+	}
+	if masked["foo.service"] {
+		t.Fatalf("unmask of foo.service was not recorded: %v", masked)
+	}
+}
+
+// dependencyUnitManager is a UnitManager which fails to enable or start a
+// unit if the units it depends on haven't been placed (and, for starting,
+// systemd hasn't been reloaded since).
+type dependencyUnitManager struct {
+	TestUnitManager
+	deps     map[string][]string
+	present  map[string]bool
+	reloaded map[string]bool
+}
+
+func (m *dependencyUnitManager) PlaceUnit(u system.Unit) error {
+	m.present[u.Name] = true
+	m.reloaded[u.Name] = false
+	return m.TestUnitManager.PlaceUnit(u)
+}
+
+func (m *dependencyUnitManager) EnableUnitFile(u system.Unit) error {
+	for _, d := range m.deps[u.Name] {
+		if !m.present[d] {
+			return fmt.Errorf("enabling %s: unit %s not found", u.Name, d)
+		}
+	}
+	return m.TestUnitManager.EnableUnitFile(u)
+}
+
+func (m *dependencyUnitManager) DaemonReload() error {
+	for name := range m.present {
+		m.reloaded[name] = true
+	}
+	return m.TestUnitManager.DaemonReload()
+}
+
+func (m *dependencyUnitManager) RunUnitCommand(u system.Unit, c string) (string, error) {
+	for _, d := range m.deps[u.Name] {
+		if !m.reloaded[d] {
+			return "", fmt.Errorf("starting %s: unit %s not loaded", u.Name, d)
+		}
+	}
+	return m.TestUnitManager.RunUnitCommand(u, c)
+}
+
+func TestProcessUnitsDependencies(t *testing.T) {
+	// The first unit depends on the second one, which is only listed after
+	// it.
+	units := []system.Unit{
+		{Unit: config.Unit{
+			Name:    "app.service",
+			Content: "[Unit]\nRequires=db.service\nAfter=db.service\n[Service]\nExecStart=/usr/bin/app\n[Install]\nWantedBy=multi-user.target\nAlso=db.service\n",
+			Enable:  true,
+			Command: "start",
+		}},
+		{Unit: config.Unit{
+			Name:    "db.service",
+			Content: "[Service]\nExecStart=/usr/bin/db\n[Install]\nWantedBy=multi-user.target\n",
+			Command: "start",
+		}},
+	}
+	um := &dependencyUnitManager{
+		deps:     map[string][]string{"app.service": {"db.service"}},
+		present:  map[string]bool{},
+		reloaded: map[string]bool{},
+	}
+	if err := processUnits(units, "", um, map[string]bool{}); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	want := TestUnitManager{
+		placed:   []string{"app.service", "db.service"},
+		enabled:  []string{"app.service"},
+		commands: []UnitAction{{"app.service", "start"}, {"db.service", "start"}},
+		reload:   true,
+	}
+	if !reflect.DeepEqual(want, um.TestUnitManager) {
+		t.Errorf("bad result: want %+v, got %+v", want, um.TestUnitManager)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	defer os.Unsetenv("CLOUDINIT_TEST_REGISTRY")
+	os.Setenv("CLOUDINIT_TEST_REGISTRY", "registry.example.com:5000")
+	os.Unsetenv("CLOUDINIT_TEST_UNDEFINED")
+
+	for _, tt := range []struct {
+		file config.File
+
+		content string
+	}{
+		{
+			file:    config.File{Content: "REGISTRY=${CLOUDINIT_TEST_REGISTRY}\n"},
+			content: "REGISTRY=registry.example.com:5000\n",
+		},
+		{
+			file:    config.File{Content: "OPTS=-x ${CLOUDINIT_TEST_UNDEFINED}-y"},
+			content: "OPTS=-x -y",
+		},
+		{
+			file:    config.File{Content: "$CLOUDINIT_TEST_REGISTRY ${} ${1} $ {CLOUDINIT_TEST_REGISTRY}"},
+			content: "$CLOUDINIT_TEST_REGISTRY ${} ${1} $ {CLOUDINIT_TEST_REGISTRY}",
+		},
+		{
+			file:    config.File{Content: "JHtDTE9VRElOSVRfVEVTVF9SRUdJU1RSWX0=", Encoding: "base64"},
+			content: "registry.example.com:5000",
+		},
+	} {
+		file, err := expandEnv(tt.file)
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", tt.file.Content, err)
+		}
+		if file.Content != tt.content || file.Encoding != "" {
+			t.Errorf("bad file (%q): want content %q, got %q (encoding %q)", tt.file.Content, tt.content, file.Content, file.Encoding)
+		}
+	}
+
+	if _, err := expandEnv(config.File{Content: "!", Encoding: "base64"}); err == nil {
+		t.Errorf("bad error: want non-nil, got nil")
+	}
+}
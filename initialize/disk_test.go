@@ -0,0 +1,93 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestApplyDryRunDisks(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	env.SetDryRun(&out)
+	cfg := config.CloudConfig{
+		BootCmd: config.RunCmd{{Args: []string{"modprobe", "dm_crypt"}}},
+		DiskSetup: config.DiskSetup{
+			"/dev/vdc": {Layout: config.Layout{{Size: 100}}, Overwrite: true},
+			"/dev/vdb": {TableType: "gpt", Layout: config.Layout{{Size: 75}, {Size: 25, Type: "8200"}}},
+		},
+		FsSetup: config.FsSetup{
+			{Device: "/dev/vdb1", Type: "ext4", Label: "data"},
+			{Device: "/dev/vdb2", Type: "swap", Overwrite: true},
+		},
+		Growpart:   config.Growpart{Devices: []string{"/"}},
+		WriteFiles: []config.File{{Path: "/etc/foo.conf", Content: "foo"}},
+	}
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	// The disks are set up and the partitions grown after the boot commands
+	// and before the files are written.
+	want := []string{
+		`run-command ["modprobe" "dm_crypt"] ignore-errors=false`,
+		"partition-disk /dev/vdb table=gpt layout=75%,25%:8200 overwrite=false",
+		"partition-disk /dev/vdc table=mbr layout=100% overwrite=true",
+		"create-filesystem /dev/vdb1 type=ext4 label=data overwrite=false: mkfs.ext4 -L data /dev/vdb1",
+		"create-filesystem /dev/vdb2 type=swap label= overwrite=true: mkswap -f /dev/vdb2",
+		"grow-partition /",
+		"write-file " + dir + "/etc/foo.conf",
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < len(want) {
+		t.Fatalf("bad dry-run output: want %d lines, got:\n%s", len(want), out.String())
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Errorf("bad dry-run output line %d: want %q, got %q", i, w, lines[i])
+		}
+	}
+}
+
+func TestApplyInvalidDisks(t *testing.T) {
+	for _, cfg := range []config.CloudConfig{
+		{DiskSetup: config.DiskSetup{"sdb": {Layout: config.Layout{{Size: 100}}}}},
+		{FsSetup: config.FsSetup{{Device: "/dev/sdb1", Type: "ntfs"}}},
+		{Growpart: config.Growpart{Devices: []string{"vda9"}}},
+	} {
+		var out bytes.Buffer
+		env := NewEnvironment("/nonexistent", "", "/nonexistent", "", datasource.Metadata{})
+		env.SetDryRun(&out)
+		if err := Apply(cfg, nil, env); err == nil {
+			t.Errorf("bad error (%+v): want non-nil, got nil", cfg)
+		}
+		if out.Len() != 0 {
+			t.Errorf("bad dry-run output (%+v): want nothing, got:\n%s", cfg, out.String())
+		}
+	}
+}
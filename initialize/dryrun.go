@@ -0,0 +1,233 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// The dry-run output consists of one action per line, each starting with the
+// name of the action followed by its target. The contents of files and units
+// are printed after their action; each line is prefixed with "content" and the
+// name of the target so that it can be grepped for.
+
+func dryRunContent(w io.Writer, name, content string) {
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		fmt.Fprintf(w, "content %s: %s\n", name, line)
+	}
+}
+
+// dryRunFile prints the given file as it would be written to the root.
+func dryRunFile(w io.Writer, f *system.File, root string) (string, error) {
+	fullpath := path.Join(root, f.Path)
+
+	content, err := config.DecodeContent(f.Content, f.Encoding)
+	if err != nil {
+		return "", fmt.Errorf("Unable to decode %s (%v)", f.Path, err)
+	}
+
+	perm, err := f.Permissions()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(w, "write-file %s mode=%#o owner=%s append=%t\n", fullpath, perm, f.Owner, f.Append)
+	if f.SELinuxContext != "" {
+		fmt.Fprintf(w, "selinux-context %s %s\n", fullpath, f.SELinuxContext)
+	}
+	if len(content) > 0 {
+		dryRunContent(w, fullpath, string(content))
+	}
+	return fullpath, nil
+}
+
+// dryRunDirectory prints the given directory as it would be created in the
+// root.
+func dryRunDirectory(w io.Writer, d *system.Directory, root string) error {
+	perm, err := d.Permissions()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "ensure-directory %s mode=%s owner=%s\n", path.Join(root, d.Path), perm|os.ModeDir, d.Owner)
+	return nil
+}
+
+// dryRunEnvFile prints the variables which would be set in the environment
+// file, in sorted order.
+func dryRunEnvFile(w io.Writer, ef *system.EnvFile, root string) {
+	keys := make([]string, 0, len(ef.Vars))
+	for key := range ef.Vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "set-environment %s %s=%s\n", path.Join(root, ef.Path), key, ef.Vars[key])
+	}
+}
+
+// dryRunUnitManager is a system.UnitManager which prints the operations it is
+// asked to perform instead of performing them.
+type dryRunUnitManager struct {
+	w    io.Writer
+	root string
+}
+
+func (m dryRunUnitManager) PlaceUnit(u system.Unit) error {
+	dst := u.Destination(m.root)
+	fmt.Fprintf(m.w, "place-unit %s\n", dst)
+	dryRunContent(m.w, dst, u.Content)
+	return nil
+}
+
+func (m dryRunUnitManager) PlaceUnitDropIn(u system.Unit, d config.UnitDropIn) error {
+	dst := u.DropInDestination(m.root, d)
+	fmt.Fprintf(m.w, "place-drop-in %s\n", dst)
+	dryRunContent(m.w, dst, d.Content)
+	return nil
+}
+
+func (m dryRunUnitManager) EnableUnitFile(u system.Unit) error {
+	fmt.Fprintf(m.w, "enable-unit %s\n", u.Name)
+	return nil
+}
+
+func (m dryRunUnitManager) RunUnitCommand(u system.Unit, c string) (string, error) {
+	fmt.Fprintf(m.w, "unit-command %s %s\n", c, u.Name)
+	return "dry-run", nil
+}
+
+func (m dryRunUnitManager) DaemonReload() error {
+	fmt.Fprintln(m.w, "daemon-reload")
+	return nil
+}
+
+func (m dryRunUnitManager) MaskUnit(u system.Unit) (bool, error) {
+	fmt.Fprintf(m.w, "mask-unit %s\n", u.Name)
+	return true, nil
+}
+
+// UnmaskUnit only prints the units which are currently masked, as only those
+// would be unmasked.
+func (m dryRunUnitManager) UnmaskUnit(u system.Unit) (bool, error) {
+	masked, err := system.UnitMasked(u, m.root)
+	if err != nil || !masked {
+		return false, err
+	}
+	fmt.Fprintf(m.w, "unmask-unit %s\n", u.Name)
+	return true, nil
+}
+
+// dryRunGroup prints the creation of the given group, unless it exists.
+func dryRunGroup(w io.Writer, group config.Group) {
+	if !system.GroupExists(group.Name) {
+		fmt.Fprintf(w, "create-group %s\n", group.Name)
+	}
+}
+
+// dryRunGroupMembers prints the members which would be added to the group.
+func dryRunGroupMembers(w io.Writer, group config.Group) {
+	members, err := system.MissingGroupMembers(group, system.GroupFile)
+	if err != nil {
+		members = group.Members
+	}
+	for _, member := range members {
+		fmt.Fprintf(w, "add-group-member %s %s\n", group.Name, member)
+	}
+}
+
+// dryRunUser prints the actions which would be taken to create or update the
+// given user. Unlike the real path, no keys are fetched from remote sources.
+func dryRunUser(w io.Writer, user config.User) {
+	if system.UserExists(&user) {
+		if user.PasswordHash != "" || user.PlainTextPasswd != "" {
+			fmt.Fprintf(w, "set-password %s\n", user.Name)
+		}
+	} else {
+		fmt.Fprintf(w, "create-user %s\n", user.Name)
+		if user.PasswordHash == "" && user.PlainTextPasswd != "" {
+			fmt.Fprintf(w, "set-password %s\n", user.Name)
+		}
+	}
+	if user.LockPasswd {
+		fmt.Fprintf(w, "lock-password %s\n", user.Name)
+	}
+
+	if user.SSHKeysExclusive {
+		fmt.Fprintf(w, "replace-ssh-keys %s %d\n", user.Name, len(user.SSHAuthorizedKeys))
+	} else if len(user.SSHAuthorizedKeys) > 0 {
+		fmt.Fprintf(w, "authorize-ssh-keys %s %d\n", user.Name, len(user.SSHAuthorizedKeys))
+	}
+	if user.SSHImportGithubUser != "" {
+		fmt.Fprintf(w, "import-ssh-keys %s github:%s\n", user.Name, user.SSHImportGithubUser)
+	}
+	for _, u := range user.SSHImportGithubUsers {
+		fmt.Fprintf(w, "import-ssh-keys %s github:%s\n", user.Name, u)
+	}
+	if user.SSHImportURL != "" {
+		fmt.Fprintf(w, "import-ssh-keys %s url:%s\n", user.Name, user.SSHImportURL)
+	}
+	dryRunSSHImport(w, user.Name, user.SSHImportGithub, user.SSHImportGitlab)
+}
+
+func dryRunSSHImport(w io.Writer, systemUser string, githubUsers, gitlabUsers []string) {
+	for _, u := range githubUsers {
+		fmt.Fprintf(w, "import-ssh-keys %s github:%s\n", systemUser, u)
+	}
+	for _, u := range gitlabUsers {
+		fmt.Fprintf(w, "import-ssh-keys %s gitlab:%s\n", systemUser, u)
+	}
+}
+
+// DryRunScript prints the script which would be run in the environment.
+func DryRunScript(script config.Script, env *Environment) {
+	fmt.Fprintln(env.dryRun, "run-script")
+	dryRunContent(env.dryRun, "script", string(script))
+}
+
+func dryRunCommand(w io.Writer, c config.Command) {
+	fmt.Fprintf(w, "run-command %s ignore-errors=%t\n", c, c.IgnoreErrors)
+}
+
+func dryRunDisk(w io.Writer, d system.Disk) {
+	if len(d.Layout) == 0 {
+		return
+	}
+	table := d.TableType
+	if table == "" {
+		table = "mbr"
+	}
+	var layout []string
+	for _, p := range d.Layout {
+		if p.Type == "" {
+			layout = append(layout, fmt.Sprintf("%d%%", p.Size))
+		} else {
+			layout = append(layout, fmt.Sprintf("%d%%:%s", p.Size, p.Type))
+		}
+	}
+	fmt.Fprintf(w, "partition-disk %s table=%s layout=%s overwrite=%t\n", d.Device, table, strings.Join(layout, ","), d.Overwrite)
+}
+
+func dryRunFilesystem(w io.Writer, f system.Filesystem) {
+	fmt.Fprintf(w, "create-filesystem %s type=%s label=%s overwrite=%t: %s\n", f.Device, f.Type, f.Label, f.Overwrite, strings.Join(f.Command(), " "))
+}
@@ -0,0 +1,310 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestApplyDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CloudConfig{
+		Hostname: "host1",
+		Groups: []config.Group{
+			{Name: "dry-run-group", Members: []string{"dry-run-user"}},
+			{Name: "root"},
+		},
+		Users: []config.User{{
+			Name:                "dry-run-user",
+			SSHAuthorizedKeys:   []string{"ssh-rsa AAAA"},
+			SSHImportGithubUser: "octocat",
+		}},
+		WriteFiles: []config.File{{
+			Path:               "/etc/motd",
+			Content:            "hello\nworld\n",
+			RawFilePermissions: "0600",
+		}},
+		CoreOS: config.CoreOS{Units: []config.Unit{{
+			Name:    "hello.service",
+			Content: "[Service]\nExecStart=/bin/true\n",
+			Enable:  true,
+			Command: "start",
+		}}},
+	}
+
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	env.substitutions["$private_ipv4"] = "host1"
+	env.SetDryRun(&out)
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := `set-hostname host1
+create-group dry-run-group
+create-user dry-run-user
+authorize-ssh-keys dry-run-user 1
+import-ssh-keys dry-run-user github:octocat
+add-group-member dry-run-group dry-run-user
+write-file ` + path.Join(dir, "etc/motd") + ` mode=0600 owner= append=false
+content ` + path.Join(dir, "etc/motd") + `: hello
+content ` + path.Join(dir, "etc/motd") + `: world
+set-environment ` + path.Join(dir, "etc/environment") + ` COREOS_PRIVATE_IPV4=host1
+place-unit ` + path.Join(dir, "etc/systemd/system/hello.service") + `
+content ` + path.Join(dir, "etc/systemd/system/hello.service") + `: [Service]
+content ` + path.Join(dir, "etc/systemd/system/hello.service") + `: ExecStart=/bin/true
+enable-unit hello.service
+daemon-reload
+unit-command start hello.service
+`
+	if out.String() != expect {
+		t.Errorf("bad dry-run output:\ngot:\n%s\nwant:\n%s", out.String(), expect)
+	}
+
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Errorf("dry-run modified the root: %v, %v", files, err)
+	}
+}
+
+func TestApplyDryRunManageEtcHosts(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("Unable to get hostname: %v", err)
+	}
+
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	env.substitutions["$private_ipv4"] = "10.0.0.5"
+	env.SetDryRun(&out)
+	ud, err := env.ParseUserData("#cloud-config\nmanage_etc_hosts: $private_ipv4\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Apply(*ud.(*config.CloudConfig), nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hosts := path.Join(dir, "etc/hosts")
+	if want := "content " + hosts + ": 10.0.0.5 " + hostname; !strings.Contains(out.String(), want) {
+		t.Errorf("bad dry-run output: want %q in:\n%s", want, out.String())
+	}
+}
+
+func TestApplyDryRunFileOwner(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CloudConfig{
+		Groups: []config.Group{{Name: "builders"}},
+		Users:  []config.User{{Name: "builder"}},
+		Directories: []config.Directory{
+			{Path: "/var/lib/builder", Owner: "builder:builders", RawFilePermissions: "0700"},
+		},
+		WriteFiles: []config.File{
+			{Path: "/home/builder/.netrc", Owner: "builder:builders"},
+			{Path: "/srv/data/README", Owner: "1000:1000"},
+		},
+	}
+
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	env.SetDryRun(&out)
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	index := func(prefix string) int {
+		for i, l := range lines {
+			if strings.HasPrefix(l, prefix) {
+				return i
+			}
+		}
+		t.Fatalf("bad dry-run output: want %q in:\n%s", prefix, out.String())
+		return -1
+	}
+	user := index("create-user builder")
+	group := index("create-group builders")
+	directory := index("ensure-directory " + path.Join(dir, "var/lib/builder") + " mode=drwx------ owner=builder:builders")
+	file := index("write-file " + path.Join(dir, "home/builder/.netrc") + " mode=0644 owner=builder:builders")
+	if directory < user || directory < group || file < user || file < group {
+		t.Errorf("bad dry-run output: want the directory and file created after the user and group:\n%s", out.String())
+	}
+	index("write-file " + path.Join(dir, "srv/data/README") + " mode=0644 owner=1000:1000")
+}
+
+func TestApplyDryRunDatasource(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CloudConfig{
+		WriteFiles: []config.File{
+			{Path: "/etc/ec2.conf", Content: "ec2", OnlyOn: []string{"ec2-metadata-service"}},
+			{Path: "/etc/other.conf", Content: "other", SkipOn: []string{"ec2-metadata-service"}},
+		},
+		CoreOS: config.CoreOS{Units: []config.Unit{
+			{Name: "ec2.service", Command: "start", OnlyOn: []string{"ec2-metadata-service"}},
+			{Name: "other.service", Command: "start", SkipOn: []string{"ec2-metadata-service"}},
+		}},
+	}
+
+	for _, tt := range []struct {
+		datasource string
+
+		applied []string
+		skipped []string
+	}{
+		{
+			datasource: "ec2-metadata-service",
+			applied:    []string{"ec2.conf", "ec2.service"},
+			skipped:    []string{"other.conf", "other.service"},
+		},
+		{
+			datasource: "nocloud",
+			applied:    []string{"other.conf", "other.service"},
+			skipped:    []string{"ec2.conf", "ec2.service"},
+		},
+	} {
+		var out bytes.Buffer
+		env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+		env.SetDatasource(tt.datasource)
+		env.SetDryRun(&out)
+		if err := Apply(cfg, nil, env); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, name := range tt.applied {
+			if !strings.Contains(out.String(), name) {
+				t.Errorf("%s was not applied on %q:\n%s", name, tt.datasource, out.String())
+			}
+		}
+		for _, name := range tt.skipped {
+			if strings.Contains(out.String(), name) {
+				t.Errorf("%s was applied on %q:\n%s", name, tt.datasource, out.String())
+			}
+		}
+	}
+}
+
+func TestApplyDryRunDropInName(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CloudConfig{CoreOS: config.CoreOS{Units: []config.Unit{{
+		Name:    "docker.service",
+		DropIns: []config.UnitDropIn{{Name: "../escape.conf", Content: "[Service]"}},
+	}}}}
+
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	env.SetDryRun(&out)
+	err = Apply(cfg, nil, env)
+	if want := `invalid drop-in of unit "docker.service": drop-in name "../escape.conf" must not contain a path separator`; err == nil || err.Error() != want {
+		t.Errorf("bad error: want %q, got %v", want, err)
+	}
+	if strings.Contains(out.String(), "escape.conf") {
+		t.Errorf("drop-in was written:\n%s", out.String())
+	}
+}
+
+// TestApplyDryRunEarlyChecks verifies that an invalid config is rejected
+// before anything (e.g. the boot commands or the hostname) is applied.
+func TestApplyDryRunEarlyChecks(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		cfg config.CloudConfig
+		err string
+	}{
+		{
+			cfg: config.CloudConfig{Packages: config.Packages{"vim; rm -rf /"}},
+			err: `invalid package name "vim; rm -rf /"`,
+		},
+		{
+			cfg: config.CloudConfig{CoreOS: config.CoreOS{Locksmith: config.Locksmith{RebootWindowStart: "Thu 04:00"}}},
+			err: "window_start requires window_length",
+		},
+		{
+			cfg: config.CloudConfig{CoreOS: config.CoreOS{Units: []config.Unit{{Name: "docker.service", Instances: []string{"a"}}}}},
+			err: `unit "docker.service" is not a template unit and cannot have instances`,
+		},
+		{
+			cfg: config.CloudConfig{CoreOS: config.CoreOS{Units: []config.Unit{{Name: "docker.service", DropIns: []config.UnitDropIn{{Name: "override"}}}}}},
+			err: `invalid drop-in of unit "docker.service": drop-in name "override" must end in .conf`,
+		},
+		{
+			cfg: config.CloudConfig{Mounts: []config.Mount{{What: "/dev/sdb1", Where: "/var/lib/docker"}, {What: "/dev/sdc1", Where: "/var/lib/docker/"}}},
+			err: `invalid mounts entry 1: mount point "/var/lib/docker" is declared more than once`,
+		},
+		{
+			cfg: config.CloudConfig{WriteFiles: []config.File{{Path: "/etc/motd"}, {Path: "/../etc/shadow"}}},
+			err: `invalid write_files entry 1: path "/../etc/shadow" escapes the root directory`,
+		},
+		{
+			cfg: config.CloudConfig{Hostname: "bad_host!"},
+			err: `invalid hostname "bad_host!"`,
+		},
+		{
+			cfg: config.CloudConfig{Directories: []config.Directory{{Path: "var/lib/app"}}},
+			err: `invalid directories entry 0: path "var/lib/app" is not absolute`,
+		},
+	} {
+		tt.cfg.BootCmd = config.RunCmd{{Args: []string{"modprobe", "dm_crypt"}}}
+		if tt.cfg.Hostname == "" {
+			tt.cfg.Hostname = "early"
+		}
+
+		var out bytes.Buffer
+		env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+		env.SetDryRun(&out)
+		if err := Apply(tt.cfg, nil, env); err == nil || err.Error() != tt.err {
+			t.Errorf("bad error: want %q, got %v", tt.err, err)
+		}
+		if out.Len() > 0 {
+			t.Errorf("config was partially applied (%q):\n%s", tt.err, out.String())
+		}
+	}
+}
@@ -15,15 +15,23 @@
 package initialize
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
 	"net"
 	"os"
 	"path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
 	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/system"
+
+	"github.com/dotcloud/docker/pkg/netlink"
 )
 
 const DefaultSSHKeyName = "coreos-cloudinit"
@@ -34,6 +42,16 @@ type Environment struct {
 	workspace     string
 	sshKeyName    string
 	substitutions map[string]string
+	dryRun        io.Writer
+	netplan       bool
+	force         bool
+	mergeEnv      bool
+	report        *Report
+	interfaces    []netInterface
+	defaultIface  string
+	defaultIface6 string
+	hostname      string
+	datasource    string
 }
 
 // TODO(jonboulle): this is getting unwieldy, should be able to simplify the interface somehow
@@ -49,8 +67,313 @@ func NewEnvironment(root, configRoot, workspace, sshKeyName string, metadata dat
 		"$private_ipv4": firstNonNull(metadata.PrivateIPv4, os.Getenv("COREOS_PRIVATE_IPV4")),
 		"$public_ipv6":  firstNonNull(metadata.PublicIPv6, os.Getenv("COREOS_PUBLIC_IPV6")),
 		"$private_ipv6": firstNonNull(metadata.PrivateIPv6, os.Getenv("COREOS_PRIVATE_IPV6")),
+		"$dns_servers":  joinIPs(metadata.Nameservers),
+	}
+	if metadata.Region != "" {
+		substitutions["$region"] = metadata.Region
+	}
+	ifaces, defaultIface, defaultIface6, err := getInterfaces(interfaces, routes)
+	if err != nil {
+		log.Printf("Unable to enumerate network interfaces: %v", err)
+	}
+	for key, val := range interfaceSubstitutions(ifaces, defaultIface, defaultIface6, false) {
+		substitutions[key] = val
+	}
+	return &Environment{root, configRoot, workspace, sshKeyName, substitutions, nil, false, false, false, nil, ifaces, defaultIface, defaultIface6, metadata.Hostname, ""}
+}
+
+func joinIPs(ips []net.IP) string {
+	var strs []string
+	for _, ip := range ips {
+		strs = append(strs, ip.String())
+	}
+	return strings.Join(strs, " ")
+}
+
+// netInterface is the subset of a network interface's configuration which is
+// exposed through substitutions and Interfaces.
+type netInterface struct {
+	name string
+	mac  string
+	ipv4 []net.IP
+	ipv6 []net.IP
+}
+
+// Interface is a network interface of the system, as it is exposed to file
+// templates.
+type Interface struct {
+	Name    string
+	MAC     string
+	IPv4s   []string
+	IPv6s   []string
+	Default bool
+}
+
+// interfaceProvider enumerates the network interfaces of the system and
+// their addresses.
+type interfaceProvider interface {
+	Interfaces() ([]net.Interface, error)
+	Addrs(iface net.Interface) ([]net.Addr, error)
+}
+
+// routeProvider looks up the names of the interfaces holding the IPv4 and
+// IPv6 default routes, which needn't be the same. It returns "" if there is
+// no such default route.
+type routeProvider interface {
+	DefaultRouteInterface() (string, error)
+	DefaultIPv6RouteInterface() (string, error)
+}
+
+type systemInterfaceProvider struct{}
+
+func (systemInterfaceProvider) Interfaces() ([]net.Interface, error) {
+	return net.Interfaces()
+}
+
+func (systemInterfaceProvider) Addrs(iface net.Interface) ([]net.Addr, error) {
+	return iface.Addrs()
+}
+
+type systemRouteProvider struct{}
+
+func (systemRouteProvider) DefaultRouteInterface() (string, error) {
+	routes, err := netlink.NetworkGetRoutes()
+	if err != nil {
+		return "", err
+	}
+	for _, route := range routes {
+		if route.Default && route.Iface != nil {
+			return route.Iface.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// ipv6RoutePath is the IPv6 routing table, which the netlink package can't
+// read.
+var ipv6RoutePath = "/proc/net/ipv6_route"
+
+func (systemRouteProvider) DefaultIPv6RouteInterface() (string, error) {
+	f, err := os.Open(ipv6RoutePath)
+	if os.IsNotExist(err) {
+		// IPv6 is disabled
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return defaultIPv6RouteInterface(f)
+}
+
+// defaultIPv6RouteInterface parses an IPv6 routing table in the format of
+// /proc/net/ipv6_route and returns the interface of the default route with
+// the lowest metric which is up and isn't a reject route.
+func defaultIPv6RouteInterface(r io.Reader) (string, error) {
+	const (
+		rtfUp     = 0x0001
+		rtfReject = 0x0200
+	)
+
+	var iface string
+	var ifaceMetric uint64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// destination, prefix length, source, prefix length, next hop,
+		// metric, reference count, use count, flags, device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 10 || strings.Trim(fields[0], "0") != "" || fields[1] != "00" {
+			continue
+		}
+		metric, err := strconv.ParseUint(fields[5], 16, 32)
+		if err != nil {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		if iface == "" || metric < ifaceMetric {
+			iface, ifaceMetric = fields[9], metric
+		}
+	}
+	return iface, scanner.Err()
+}
+
+// The providers used by NewEnvironment. They are variables so that they can
+// be replaced in tests.
+var (
+	interfaces interfaceProvider = systemInterfaceProvider{}
+	routes     routeProvider     = systemRouteProvider{}
+)
+
+// getInterfaces returns the interfaces given by ip, along with the names of
+// the interfaces holding the IPv4 and IPv6 default routes according to rp.
+func getInterfaces(ip interfaceProvider, rp routeProvider) ([]netInterface, string, string, error) {
+	sysIfaces, err := ip.Interfaces()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	var ifaces []netInterface
+	for _, sysIface := range sysIfaces {
+		iface := netInterface{
+			name: sysIface.Name,
+			mac:  sysIface.HardwareAddr.String(),
+		}
+		addrs, err := ip.Addrs(sysIface)
+		if err != nil {
+			return nil, "", "", err
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip := ipnet.IP.To4(); ip != nil {
+				iface.ipv4 = append(iface.ipv4, ip)
+			} else {
+				iface.ipv6 = append(iface.ipv6, ipnet.IP)
+			}
+		}
+		ifaces = append(ifaces, iface)
+	}
+
+	defaultIface, err := rp.DefaultRouteInterface()
+	if err != nil {
+		return ifaces, "", "", err
+	}
+	defaultIface6, err := rp.DefaultIPv6RouteInterface()
+	return ifaces, defaultIface, defaultIface6, err
+}
+
+var invalidVarChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// interfaceVarNames maps the name of each interface onto the name used for
+// its $iface_<name>_* substitutions: the lowercased name with any character
+// other than letters, digits and underscores (e.g. ".", "@" or ":") replaced
+// by an underscore. Since different names can map onto the same variable name
+// (e.g. eth0.100 and eth0_100), those which collide are suffixed with _2, _3,
+// etc. Interfaces whose names are valid as is take precedence, followed by
+// the others in lexical order, so that the names don't depend on the order
+// in which the interfaces are enumerated. "default" is reserved for the
+// interface holding the default route.
+func interfaceVarNames(ifaces []netInterface) map[string]string {
+	names := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		names = append(names, iface.name)
+	}
+	sort.Strings(names)
+
+	sanitize := func(name string) string {
+		return invalidVarChars.ReplaceAllString(strings.ToLower(name), "_")
+	}
+	var valid, sanitized []string
+	for _, name := range names {
+		if sanitize(name) == name {
+			valid = append(valid, name)
+		} else {
+			sanitized = append(sanitized, name)
+		}
+	}
+
+	used := map[string]bool{"default": true}
+	varNames := map[string]string{}
+	for _, name := range append(valid, sanitized...) {
+		if _, ok := varNames[name]; ok {
+			continue
+		}
+		base := sanitize(name)
+		varName := base
+		for i := 2; used[varName]; i++ {
+			varName = fmt.Sprintf("%s_%d", base, i)
+		}
+		if varName != base {
+			log.Printf("Variable name %q of interface %q is already used, using %q", base, name, varName)
+		}
+		used[varName] = true
+		varNames[name] = varName
+	}
+	return varNames
+}
+
+// isLocalAddress reports whether ip is a loopback or link-local address.
+func isLocalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
+
+// firstAddress returns the first of the addresses which isn't a loopback or
+// link-local address. If local is set, the first address is returned in the
+// absence of such an address.
+func firstAddress(ips []net.IP, local bool) net.IP {
+	for _, ip := range ips {
+		if !isLocalAddress(ip) {
+			return ip
+		}
 	}
-	return &Environment{root, configRoot, workspace, sshKeyName, substitutions}
+	if local && len(ips) > 0 {
+		return ips[0]
+	}
+	return nil
+}
+
+// interfaceSubstitutions generates the $iface_<name>_ipv4 and
+// $iface_<name>_mac substitutions for the given interfaces (see
+// interfaceVarNames). The interface named by defaultIface is additionally
+// exposed as $iface_default_ipv4 and $iface_default_mac, and the IPv6 address
+// of the one named by defaultIface6 as $iface_default_ipv6. Loopback and
+// link-local addresses are skipped unless local is set.
+func interfaceSubstitutions(ifaces []netInterface, defaultIface, defaultIface6 string, local bool) map[string]string {
+	varNames := interfaceVarNames(ifaces)
+	substitutions := map[string]string{}
+	for _, iface := range ifaces {
+		names := []string{varNames[iface.name]}
+		if iface.name == defaultIface {
+			names = append(names, "default")
+		}
+		ipv4 := firstAddress(iface.ipv4, local)
+		for _, name := range names {
+			if ipv4 != nil {
+				substitutions[fmt.Sprintf("$iface_%s_ipv4", name)] = ipv4.String()
+			}
+			if iface.mac != "" {
+				substitutions[fmt.Sprintf("$iface_%s_mac", name)] = iface.mac
+			}
+		}
+		if ipv6 := firstAddress(iface.ipv6, local); iface.name == defaultIface6 && ipv6 != nil {
+			substitutions["$iface_default_ipv6"] = ipv6.String()
+		}
+	}
+	return substitutions
+}
+
+// SetLocalAddresses causes loopback and link-local addresses to be used for
+// the $iface_* substitutions (in the absence of other addresses), which they
+// are excluded from by default.
+func (e *Environment) SetLocalAddresses(local bool) {
+	for key := range interfaceSubstitutions(e.interfaces, e.defaultIface, e.defaultIface6, true) {
+		delete(e.substitutions, key)
+	}
+	for key, val := range interfaceSubstitutions(e.interfaces, e.defaultIface, e.defaultIface6, local) {
+		e.substitutions[key] = val
+	}
+}
+
+// Interfaces returns the network interfaces of the system, in the order in
+// which they were enumerated. Unlike the $iface_* substitutions, they include
+// all of the addresses of each interface.
+func (e *Environment) Interfaces() []Interface {
+	ifaces := []Interface{}
+	for _, iface := range e.interfaces {
+		i := Interface{Name: iface.name, MAC: iface.mac, Default: iface.name == e.defaultIface}
+		for _, ip := range iface.ipv4 {
+			i.IPv4s = append(i.IPv4s, ip.String())
+		}
+		for _, ip := range iface.ipv6 {
+			i.IPv6s = append(i.IPv6s, ip.String())
+		}
+		ifaces = append(ifaces, i)
+	}
+	return ifaces
 }
 
 func (e *Environment) Workspace() string {
@@ -73,22 +396,156 @@ func (e *Environment) SetSSHKeyName(name string) {
 	e.sshKeyName = name
 }
 
-// Apply goes through the map of substitutions and replaces all instances of
-// the keys with their respective values. It supports escaping substitutions
-// with a leading '\'.
+// SetDryRun causes the configuration to be printed to w as a list of actions
+// rather than applied to the system. A nil writer disables dry-run mode.
+func (e *Environment) SetDryRun(w io.Writer) {
+	e.dryRun = w
+}
+
+func (e *Environment) DryRun() bool {
+	return e.dryRun != nil
+}
+
+// SetNetplan causes the network configuration to be rendered for netplan
+// rather than as networkd units.
+func (e *Environment) SetNetplan(netplan bool) {
+	e.netplan = netplan
+}
+
+func (e *Environment) Netplan() bool {
+	return e.netplan
+}
+
+// SetForce causes actions to be applied even if they were already applied
+// with the same inputs by a previous run (see Applied).
+func (e *Environment) SetForce(force bool) {
+	e.force = force
+}
+
+// SetReport causes the actions taken to apply the config to be recorded in r.
+// Actions are not recorded in dry-run mode.
+func (e *Environment) SetReport(r *Report) {
+	e.report = r
+}
+
+// Report returns the report the actions are recorded in, or nil.
+func (e *Environment) Report() *Report {
+	return e.report
+}
+
+// SetMergeEnvironment causes the COREOS_* and IFACE_* variables to be managed
+// in /etc/environment: those which are no longer provided are removed, while
+// other variables are left untouched.
+func (e *Environment) SetMergeEnvironment(merge bool) {
+	e.mergeEnv = merge
+}
+
+func (e *Environment) Force() bool {
+	return e.force
+}
+
+// SetDatasource records the type of the datasource the config comes from (see
+// Datasource.Type), against which the only_on and skip_on lists of the units
+// and files are matched.
+func (e *Environment) SetDatasource(datasource string) {
+	e.datasource = datasource
+}
+
+func (e *Environment) Datasource() string {
+	return e.datasource
+}
+
+var validSubstitutionName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// AddSubstitutions registers user-defined substitutions, each of which is
+// referenced as $<name>. The built-in substitutions take precedence over
+// user-defined ones of the same name.
+func (e *Environment) AddSubstitutions(substitutions map[string]string) {
+	names := make([]string, 0, len(substitutions))
+	for name := range substitutions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := "$" + name
+		if !validSubstitutionName.MatchString(name) {
+			log.Printf("Warning: ignoring substitution with invalid name %q", name)
+		} else if _, ok := e.substitutions[key]; ok {
+			log.Printf("Warning: substitution %q collides with a built-in substitution, ignoring", key)
+		} else {
+			e.substitutions[key] = substitutions[name]
+		}
+	}
+}
+
+// Apply replaces every substitution variable found in data with its value.
+// Variables preceded by a backslash are left in place (minus the backslash).
+// Replacement happens in a single pass, so substituted values are never
+// themselves subject to substitution.
 func (e *Environment) Apply(data string) string {
-	for key, val := range e.substitutions {
-		matchKey := strings.Replace(key, `$`, `\$`, -1)
-		replKey := strings.Replace(key, `$`, `$$`, -1)
+	if len(e.substitutions) == 0 {
+		return data
+	}
 
+	keys := make([]string, 0, len(e.substitutions))
+	for key := range e.substitutions {
+		keys = append(keys, key)
+	}
+	// prefer the longest variable when one is a prefix of another
+	sort.Sort(sort.Reverse(byLength(keys)))
+	for i, key := range keys {
+		keys[i] = regexp.QuoteMeta(key)
+	}
+
+	exp := regexp.MustCompile(`\\?(` + strings.Join(keys, "|") + `)`)
+	return exp.ReplaceAllStringFunc(data, func(match string) string {
+		if strings.HasPrefix(match, `\`) {
+			// "\key" -> "key"
+			return match[1:]
+		}
 		// "key" -> "val"
-		data = regexp.MustCompile(`([^\\]|^)`+matchKey).ReplaceAllString(data, `${1}`+val)
-		// "\key" -> "key"
-		data = regexp.MustCompile(`\\`+matchKey).ReplaceAllString(data, replKey)
+		return e.substitutions[match]
+	})
+}
+
+// SubstituteUserdata registers the substitutions defined by the given document,
+// if it is a cloud-config, with the environment and applies all of the
+// environment's substitutions to it. ParseUserData calls it for every script,
+// cloud-config and include list after it has been decompressed, decoded from
+// a multipart message or fetched from an include list, and before it is
+// parsed, so every value of a cloud-config (e.g. the etcd and fleet options as
+// well as write_files) is covered. Ignition configs are not substituted. Each
+// document is substituted exactly once, so escaped variables (e.g.
+// "\$private_ipv4") end up as literal dollar signs.
+func (e *Environment) SubstituteUserdata(contents string) string {
+	var cc *config.CloudConfig
+	var err error
+	switch {
+	case config.IsCloudConfig(contents):
+		cc, err = config.NewCloudConfig(contents)
+	case config.IsCloudConfigJSON(contents):
+		cc, err = config.NewCloudConfigJSON(contents)
+	}
+	if cc != nil && err == nil {
+		e.AddSubstitutions(cc.Substitutions)
 	}
-	return data
+	return e.Apply(contents)
+}
+
+type byLength []string
+
+func (s byLength) Len() int { return len(s) }
+func (s byLength) Less(i, j int) bool {
+	return len(s[i]) < len(s[j]) || (len(s[i]) == len(s[j]) && s[i] < s[j])
 }
+func (s byLength) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
+// DefaultEnvironmentFile returns the variables to be stored in
+// /etc/environment, or nil if there are none (and no stale variables are to
+// be removed). The substitutions are visited in sorted order so that, should
+// several of them map to the same variable (e.g. user-defined $iface_Foo_mac
+// and $iface_foo_mac), the same one wins each run.
 func (e *Environment) DefaultEnvironmentFile() *system.EnvFile {
 	ef := system.EnvFile{
 		File: &system.File{File: config.File{
@@ -108,7 +565,29 @@ func (e *Environment) DefaultEnvironmentFile() *system.EnvFile {
 	if ip, ok := e.substitutions["$private_ipv6"]; ok && len(ip) > 0 {
 		ef.Vars["COREOS_PRIVATE_IPV6"] = ip
 	}
-	if len(ef.Vars) == 0 {
+	if servers, ok := e.substitutions["$dns_servers"]; ok && len(servers) > 0 {
+		ef.Vars["COREOS_DNS_SERVERS"] = servers
+	}
+	if region, ok := e.substitutions["$region"]; ok && len(region) > 0 {
+		ef.Vars["COREOS_REGION"] = region
+	}
+	keys := make([]string, 0, len(e.substitutions))
+	for key := range e.substitutions {
+		if strings.HasPrefix(key, "$iface_") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := strings.ToUpper(strings.TrimPrefix(key, "$"))
+		if _, ok := ef.Vars[name]; !ok && len(e.substitutions[key]) > 0 {
+			ef.Vars[name] = e.substitutions[key]
+		}
+	}
+	if e.mergeEnv {
+		ef.Owned = []string{"COREOS_", "IFACE_"}
+	}
+	if len(ef.Vars) == 0 && len(ef.Owned) == 0 {
 		return nil
 	} else {
 		return &ef
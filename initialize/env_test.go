@@ -15,16 +15,78 @@
 package initialize
 
 import (
+	"errors"
 	"io/ioutil"
 	"net"
 	"os"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/datasource"
 	"github.com/coreos/coreos-cloudinit/system"
 )
 
+func init() {
+	// keep the host's interfaces out of the substitutions
+	interfaces = fakeInterfaces{}
+	routes = fakeRoutes{}
+}
+
+// fakeInterfaces is an interfaceProvider for a fixed set of interfaces. The
+// addresses of each interface are listed (in CIDR notation) under its name.
+type fakeInterfaces struct {
+	ifaces []net.Interface
+	addrs  map[string][]string
+	err    error
+}
+
+func (f fakeInterfaces) Interfaces() ([]net.Interface, error) {
+	return f.ifaces, f.err
+}
+
+func (f fakeInterfaces) Addrs(iface net.Interface) ([]net.Addr, error) {
+	var addrs []net.Addr
+	for _, a := range f.addrs[iface.Name] {
+		ip, ipnet, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, err
+		}
+		ipnet.IP = ip
+		addrs = append(addrs, ipnet)
+	}
+	return addrs, nil
+}
+
+// fakeRoutes is a routeProvider whose IPv4 and IPv6 default routes are held
+// by the named interfaces.
+type fakeRoutes struct {
+	ipv4 string
+	ipv6 string
+}
+
+func (r fakeRoutes) DefaultRouteInterface() (string, error) {
+	return r.ipv4, nil
+}
+
+func (r fakeRoutes) DefaultIPv6RouteInterface() (string, error) {
+	return r.ipv6, nil
+}
+
+func fakeInterface(name, mac string) net.Interface {
+	hw, _ := net.ParseMAC(mac)
+	return net.Interface{Name: name, HardwareAddr: hw}
+}
+
+// withInterfaces replaces the providers used by NewEnvironment and returns a
+// function restoring them.
+func withInterfaces(ip interfaceProvider, rp routeProvider) func() {
+	oldInterfaces, oldRoutes := interfaces, routes
+	interfaces, routes = ip, rp
+	return func() { interfaces, routes = oldInterfaces, oldRoutes }
+}
+
 func TestEnvironmentApply(t *testing.T) {
 	os.Setenv("COREOS_PUBLIC_IPV4", "1.2.3.4")
 	os.Setenv("COREOS_PRIVATE_IPV4", "5.6.7.8")
@@ -87,6 +149,42 @@ addr: \$private_ipv4
 addr: $private_ipv4
 \$private_ipv4`,
 		},
+		{
+			// Nameservers from the datasource
+			datasource.Metadata{
+				Nameservers: []net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("2001:4860:4860::8888")},
+			},
+			"nameservers: $dns_servers",
+			"nameservers: 8.8.8.8 2001:4860:4860::8888",
+		},
+		{
+			// Datasource without nameservers
+			datasource.Metadata{},
+			"nameservers: $dns_servers",
+			"nameservers: ",
+		},
+		{
+			// Region from the datasource
+			datasource.Metadata{
+				Region: "eu-frankfurt-1",
+			},
+			"region: $region",
+			"region: eu-frankfurt-1",
+		},
+		{
+			// Datasource without a region
+			datasource.Metadata{},
+			"region: $region",
+			"region: $region",
+		},
+		{
+			// Templated hostname
+			datasource.Metadata{
+				PrivateIPv4: net.ParseIP("10.0.0.1"),
+			},
+			"hostname: web-$private_ipv4",
+			"hostname: web-10.0.0.1",
+		},
 		{
 			// No substitutions with escaping
 			datasource.Metadata{},
@@ -109,8 +207,10 @@ func TestEnvironmentFile(t *testing.T) {
 		PrivateIPv4: net.ParseIP("5.6.7.8"),
 		PublicIPv6:  net.ParseIP("1234::"),
 		PrivateIPv6: net.ParseIP("5678::"),
+		Nameservers: []net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("8.8.4.4")},
+		Region:      "eu-frankfurt-1",
 	}
-	expect := "COREOS_PRIVATE_IPV4=5.6.7.8\nCOREOS_PRIVATE_IPV6=5678::\nCOREOS_PUBLIC_IPV4=1.2.3.4\nCOREOS_PUBLIC_IPV6=1234::\n"
+	expect := "COREOS_DNS_SERVERS=8.8.8.8 8.8.4.4\nCOREOS_PRIVATE_IPV4=5.6.7.8\nCOREOS_PRIVATE_IPV6=5678::\nCOREOS_PUBLIC_IPV4=1.2.3.4\nCOREOS_PUBLIC_IPV6=1234::\nCOREOS_REGION=eu-frankfurt-1\n"
 
 	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
 	if err != nil {
@@ -136,6 +236,110 @@ func TestEnvironmentFile(t *testing.T) {
 	}
 }
 
+func TestEnvironmentFileSorted(t *testing.T) {
+	os.Clearenv()
+	defer withInterfaces(fakeInterfaces{
+		ifaces: []net.Interface{fakeInterface("eth1", "52:54:00:12:34:57"), fakeInterface("eth0", "52:54:00:12:34:56")},
+		addrs: map[string][]string{
+			"eth1": {"192.0.2.2/24"},
+			"eth0": {"10.0.0.2/8"},
+		},
+	}, fakeRoutes{ipv4: "eth1"})()
+
+	metadata := datasource.Metadata{
+		PublicIPv4:  net.ParseIP("1.2.3.4"),
+		Nameservers: []net.IP{net.ParseIP("8.8.8.8")},
+	}
+	expect := "COREOS_DNS_SERVERS=8.8.8.8\n" +
+		"COREOS_PUBLIC_IPV4=1.2.3.4\n" +
+		"IFACE_DEFAULT_IPV4=192.0.2.2\n" +
+		"IFACE_DEFAULT_MAC=52:54:00:12:34:57\n" +
+		"IFACE_ETH0_IPV4=10.0.0.2\n" +
+		"IFACE_ETH0_MAC=52:54:00:12:34:56\n" +
+		"IFACE_ETH1_IPV4=192.0.2.2\n" +
+		"IFACE_ETH1_MAC=52:54:00:12:34:57\n" +
+		"IFACE_FOO_MAC=52:54:00:00:00:01\n"
+
+	for i := 0; i < 10; i++ {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		env := NewEnvironment("./", "./", "./", "", metadata)
+		env.AddSubstitutions(map[string]string{
+			"iface_foo_mac": "52:54:00:00:00:02",
+			"iface_Foo_mac": "52:54:00:00:00:01",
+		})
+		if err := system.WriteEnvFile(env.DefaultEnvironmentFile(), dir); err != nil {
+			t.Fatalf("WriteEnvFile failed: %v", err)
+		}
+
+		contents, err := ioutil.ReadFile(path.Join(dir, "etc", "environment"))
+		if err != nil {
+			t.Fatalf("Unable to read expected file: %v", err)
+		}
+		if string(contents) != expect {
+			t.Fatalf("File has incorrect contents (run %d):\ngot:\n%s\nwant:\n%s", i, contents, expect)
+		}
+	}
+}
+
+func TestEnvironmentFileMerge(t *testing.T) {
+	os.Clearenv()
+	defer withInterfaces(fakeInterfaces{
+		ifaces: []net.Interface{fakeInterface("eth0", "52:54:00:12:34:56")},
+	}, fakeRoutes{})()
+
+	base := "# local settings\nEDITOR=vi\nCOREOS_PUBLIC_IPV4=9.9.9.9\nIFACE_ETH1_MAC=52:54:00:12:34:57\nhttp_proxy=http://proxy:3128\n"
+	for _, tt := range []struct {
+		merge bool
+
+		expect string
+	}{
+		{
+			merge:  false,
+			expect: "# local settings\nEDITOR=vi\nCOREOS_PUBLIC_IPV4=9.9.9.9\nIFACE_ETH1_MAC=52:54:00:12:34:57\nhttp_proxy=http://proxy:3128\nCOREOS_PRIVATE_IPV4=5.6.7.8\nIFACE_ETH0_MAC=52:54:00:12:34:56\n",
+		},
+		{
+			merge:  true,
+			expect: "# local settings\nEDITOR=vi\nhttp_proxy=http://proxy:3128\nCOREOS_PRIVATE_IPV4=5.6.7.8\nIFACE_ETH0_MAC=52:54:00:12:34:56\n",
+		},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		fullPath := path.Join(dir, "etc", "environment")
+		if err := os.MkdirAll(path.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Unable to create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(fullPath, []byte(base), 0644); err != nil {
+			t.Fatalf("Unable to write file: %v", err)
+		}
+
+		// A second run must leave the file as the first one did.
+		for i := 0; i < 2; i++ {
+			env := NewEnvironment("./", "./", "./", "", datasource.Metadata{PrivateIPv4: net.ParseIP("5.6.7.8")})
+			env.SetMergeEnvironment(tt.merge)
+			if err := system.WriteEnvFile(env.DefaultEnvironmentFile(), dir); err != nil {
+				t.Fatalf("WriteEnvFile failed: %v", err)
+			}
+
+			contents, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				t.Fatalf("Unable to read expected file: %v", err)
+			}
+			if string(contents) != tt.expect {
+				t.Errorf("bad environment file (merge %t, run %d): want %q, got %q", tt.merge, i, tt.expect, contents)
+			}
+		}
+	}
+}
+
 func TestEnvironmentFileNil(t *testing.T) {
 	os.Clearenv()
 	metadata := datasource.Metadata{}
@@ -145,4 +349,403 @@ func TestEnvironmentFileNil(t *testing.T) {
 	if ef != nil {
 		t.Fatalf("Environment file not nil: %v", ef)
 	}
+
+	env.SetMergeEnvironment(true)
+	if ef := env.DefaultEnvironmentFile(); ef == nil || len(ef.Vars) != 0 {
+		t.Fatalf("bad environment file: want no variables, got %v", ef)
+	}
+}
+
+func TestInterfaceSubstitutions(t *testing.T) {
+	for _, tt := range []struct {
+		ifaces        []netInterface
+		defaultIface  string
+		defaultIface6 string
+		local         bool
+
+		substitutions map[string]string
+	}{
+		{
+			ifaces:        nil,
+			substitutions: map[string]string{},
+		},
+		{
+			ifaces: []netInterface{
+				{name: "lo", ipv4: []net.IP{net.ParseIP("127.0.0.1")}},
+				{name: "eth0", mac: "52:54:00:12:34:56", ipv4: []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")}},
+				{name: "eth1.100", mac: "52:54:00:12:34:57"},
+			},
+			defaultIface: "eth0",
+			substitutions: map[string]string{
+				"$iface_eth0_ipv4":    "10.0.0.2",
+				"$iface_eth0_mac":     "52:54:00:12:34:56",
+				"$iface_default_ipv4": "10.0.0.2",
+				"$iface_default_mac":  "52:54:00:12:34:56",
+				"$iface_eth1_100_mac": "52:54:00:12:34:57",
+			},
+		},
+		{
+			ifaces: []netInterface{
+				{name: "eth0.100", mac: "52:54:00:12:34:56", ipv4: []net.IP{net.ParseIP("10.0.100.2")}},
+				{name: "eth0_100", mac: "52:54:00:12:34:57", ipv4: []net.IP{net.ParseIP("10.1.100.2")}},
+				{name: "veth0@if5", ipv4: []net.IP{net.ParseIP("172.17.0.2")}},
+			},
+			defaultIface: "eth0.100",
+			substitutions: map[string]string{
+				"$iface_eth0_100_ipv4":   "10.1.100.2",
+				"$iface_eth0_100_mac":    "52:54:00:12:34:57",
+				"$iface_eth0_100_2_ipv4": "10.0.100.2",
+				"$iface_eth0_100_2_mac":  "52:54:00:12:34:56",
+				"$iface_veth0_if5_ipv4":  "172.17.0.2",
+				"$iface_default_ipv4":    "10.0.100.2",
+				"$iface_default_mac":     "52:54:00:12:34:56",
+			},
+		},
+		{
+			ifaces: []netInterface{
+				{
+					name: "eth0",
+					ipv4: []net.IP{net.ParseIP("10.0.0.2")},
+					ipv6: []net.IP{net.ParseIP("fe80::5054:ff:fe12:3456")},
+				},
+				{
+					name: "eth1",
+					ipv6: []net.IP{net.ParseIP("fe80::5054:ff:fe12:3457"), net.ParseIP("2001:db8::2"), net.ParseIP("2001:db8::3")},
+				},
+			},
+			defaultIface:  "eth0",
+			defaultIface6: "eth1",
+			substitutions: map[string]string{
+				"$iface_eth0_ipv4":    "10.0.0.2",
+				"$iface_default_ipv4": "10.0.0.2",
+				"$iface_default_ipv6": "2001:db8::2",
+			},
+		},
+		{
+			// only link-local addresses
+			ifaces: []netInterface{
+				{name: "eth0", ipv6: []net.IP{net.ParseIP("fe80::5054:ff:fe12:3456")}},
+			},
+			defaultIface6: "eth0",
+			substitutions: map[string]string{},
+		},
+		{
+			// loopback and link-local addresses are skipped
+			ifaces: []netInterface{
+				{name: "lo", ipv4: []net.IP{net.ParseIP("127.0.0.1")}, ipv6: []net.IP{net.ParseIP("::1")}},
+				{name: "eth0", ipv4: []net.IP{net.ParseIP("169.254.10.1"), net.ParseIP("10.0.0.2")}},
+				{name: "eth1", ipv4: []net.IP{net.ParseIP("169.254.10.2")}, ipv6: []net.IP{net.ParseIP("fe80::2")}},
+			},
+			defaultIface:  "eth1",
+			defaultIface6: "eth1",
+			substitutions: map[string]string{
+				"$iface_eth0_ipv4": "10.0.0.2",
+			},
+		},
+		{
+			// unless they are asked for
+			ifaces: []netInterface{
+				{name: "lo", ipv4: []net.IP{net.ParseIP("127.0.0.1")}, ipv6: []net.IP{net.ParseIP("::1")}},
+				{name: "eth0", ipv4: []net.IP{net.ParseIP("169.254.10.1"), net.ParseIP("10.0.0.2")}},
+				{name: "eth1", ipv4: []net.IP{net.ParseIP("169.254.10.2")}, ipv6: []net.IP{net.ParseIP("fe80::2")}},
+			},
+			defaultIface:  "eth1",
+			defaultIface6: "eth1",
+			local:         true,
+			substitutions: map[string]string{
+				"$iface_lo_ipv4":      "127.0.0.1",
+				"$iface_eth0_ipv4":    "10.0.0.2",
+				"$iface_eth1_ipv4":    "169.254.10.2",
+				"$iface_default_ipv4": "169.254.10.2",
+				"$iface_default_ipv6": "fe80::2",
+			},
+		},
+	} {
+		substitutions := interfaceSubstitutions(tt.ifaces, tt.defaultIface, tt.defaultIface6, tt.local)
+		if !reflect.DeepEqual(tt.substitutions, substitutions) {
+			t.Errorf("bad substitutions (%+v): want %#v, got %#v", tt.ifaces, tt.substitutions, substitutions)
+		}
+	}
+}
+
+func TestDefaultIPv6RouteInterface(t *testing.T) {
+	for _, tt := range []struct {
+		table string
+
+		iface string
+	}{
+		{},
+		{
+			table: `fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth1
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`,
+			iface: "eth1",
+		},
+		{
+			// the lowest metric wins
+			table: `00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth1
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000100 00000001 00000000 00000003     eth2
+`,
+			iface: "eth2",
+		},
+		{
+			// reject and down routes are ignored
+			table: `00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000002     eth1
+`,
+		},
+	} {
+		iface, err := defaultIPv6RouteInterface(strings.NewReader(tt.table))
+		if err != nil || iface != tt.iface {
+			t.Errorf("bad interface (%q): want %q, got %q (%v)", tt.table, tt.iface, iface, err)
+		}
+	}
+}
+
+func TestGetInterfaces(t *testing.T) {
+	ip := fakeInterfaces{
+		ifaces: []net.Interface{
+			fakeInterface("lo", ""),
+			fakeInterface("eth0", "52:54:00:12:34:56"),
+		},
+		addrs: map[string][]string{
+			"lo":   {"127.0.0.1/8", "::1/128"},
+			"eth0": {"10.0.0.2/24", "2001:db8::2/64"},
+		},
+	}
+	ifaces, defaultIface, defaultIface6, err := getInterfaces(ip, fakeRoutes{ipv4: "eth0", ipv6: "eth1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect := []netInterface{
+		{name: "lo", ipv4: []net.IP{net.ParseIP("127.0.0.1").To4()}, ipv6: []net.IP{net.ParseIP("::1")}},
+		{name: "eth0", mac: "52:54:00:12:34:56", ipv4: []net.IP{net.ParseIP("10.0.0.2").To4()}, ipv6: []net.IP{net.ParseIP("2001:db8::2")}},
+	}
+	if !reflect.DeepEqual(expect, ifaces) || defaultIface != "eth0" || defaultIface6 != "eth1" {
+		t.Fatalf("bad interfaces: want %#v, %q, %q, got %#v, %q, %q", expect, "eth0", "eth1", ifaces, defaultIface, defaultIface6)
+	}
+
+	if _, _, _, err := getInterfaces(fakeInterfaces{err: errors.New("no netlink")}, fakeRoutes{}); err == nil {
+		t.Fatalf("bad error: want non-nil, got nil")
+	}
+}
+
+func TestEnvironmentInterfaceSubstitutions(t *testing.T) {
+	for _, tt := range []struct {
+		ip interfaceProvider
+		rp routeProvider
+
+		input string
+		out   string
+		vars  map[string]string
+	}{
+		{
+			ip: fakeInterfaces{
+				ifaces: []net.Interface{fakeInterface("lo", ""), fakeInterface("eth0", ""), fakeInterface("eth1", "")},
+				addrs: map[string][]string{
+					"lo":   {"127.0.0.1/8"},
+					"eth0": {"fe80::1/64", "10.0.0.2/24", "10.0.0.3/24"},
+					"eth1": {"192.0.2.2/24"},
+				},
+			},
+			rp:    fakeRoutes{ipv4: "eth1"},
+			input: "$iface_lo_ipv4 $iface_eth0_ipv4 $iface_eth1_ipv4 $iface_default_ipv4",
+			out:   "$iface_lo_ipv4 10.0.0.2 192.0.2.2 192.0.2.2",
+			vars: map[string]string{
+				"IFACE_ETH0_IPV4":    "10.0.0.2",
+				"IFACE_ETH1_IPV4":    "192.0.2.2",
+				"IFACE_DEFAULT_IPV4": "192.0.2.2",
+			},
+		},
+		{
+			// without a default route, there is no $iface_default_*
+			ip: fakeInterfaces{
+				ifaces: []net.Interface{fakeInterface("eth0", "")},
+				addrs:  map[string][]string{"eth0": {"10.0.0.2/24"}},
+			},
+			rp:    fakeRoutes{},
+			input: "$iface_eth0_ipv4 $iface_default_ipv4",
+			out:   "10.0.0.2 $iface_default_ipv4",
+			vars:  map[string]string{"IFACE_ETH0_IPV4": "10.0.0.2"},
+		},
+		{
+			ip: fakeInterfaces{
+				ifaces: []net.Interface{fakeInterface("eth0", ""), fakeInterface("eth1", "")},
+				addrs: map[string][]string{
+					"eth0": {"10.0.0.2/24", "fe80::1/64"},
+					"eth1": {"fe80::2/64", "2001:db8::2/64"},
+				},
+			},
+			rp:    fakeRoutes{ipv4: "eth0", ipv6: "eth1"},
+			input: "$iface_default_ipv4 $iface_default_ipv6",
+			out:   "10.0.0.2 2001:db8::2",
+			vars: map[string]string{
+				"IFACE_ETH0_IPV4":    "10.0.0.2",
+				"IFACE_DEFAULT_IPV4": "10.0.0.2",
+				"IFACE_DEFAULT_IPV6": "2001:db8::2",
+			},
+		},
+		{
+			// an enumeration failure leaves the interfaces out
+			ip:    fakeInterfaces{err: errors.New("no netlink")},
+			rp:    fakeRoutes{ipv4: "eth0"},
+			input: "$iface_eth0_ipv4 $iface_default_ipv4",
+			out:   "$iface_eth0_ipv4 $iface_default_ipv4",
+		},
+	} {
+		restore := withInterfaces(tt.ip, tt.rp)
+		env := NewEnvironment("./", "./", "./", "", datasource.Metadata{})
+		restore()
+
+		if out := env.Apply(tt.input); out != tt.out {
+			t.Errorf("bad substitution (%q): want %q, got %q", tt.input, tt.out, out)
+		}
+		var vars map[string]string
+		if ef := env.DefaultEnvironmentFile(); ef != nil {
+			vars = ef.Vars
+		}
+		if !reflect.DeepEqual(tt.vars, vars) {
+			t.Errorf("bad environment file (%q): want %#v, got %#v", tt.input, tt.vars, vars)
+		}
+	}
+}
+
+func TestInterfaceVarNames(t *testing.T) {
+	for _, tt := range []struct {
+		names []string
+
+		varNames map[string]string
+	}{
+		{
+			names:    nil,
+			varNames: map[string]string{},
+		},
+		{
+			names:    []string{"eth0", "eth0.100", "veth0@if5", "eth1:1", "wlP1s0"},
+			varNames: map[string]string{"eth0": "eth0", "eth0.100": "eth0_100", "veth0@if5": "veth0_if5", "eth1:1": "eth1_1", "wlP1s0": "wlp1s0"},
+		},
+		{
+			names:    []string{"eth0.100", "eth0_100"},
+			varNames: map[string]string{"eth0_100": "eth0_100", "eth0.100": "eth0_100_2"},
+		},
+		{
+			names:    []string{"eth0_100", "eth0.100"},
+			varNames: map[string]string{"eth0_100": "eth0_100", "eth0.100": "eth0_100_2"},
+		},
+		{
+			names:    []string{"eth0:100", "eth0.100", "eth0_100_2", "eth0_100"},
+			varNames: map[string]string{"eth0_100": "eth0_100", "eth0_100_2": "eth0_100_2", "eth0.100": "eth0_100_3", "eth0:100": "eth0_100_4"},
+		},
+		{
+			names:    []string{"default", "Default"},
+			varNames: map[string]string{"default": "default_2", "Default": "default_3"},
+		},
+	} {
+		var ifaces []netInterface
+		for _, name := range tt.names {
+			ifaces = append(ifaces, netInterface{name: name})
+		}
+		if varNames := interfaceVarNames(ifaces); !reflect.DeepEqual(tt.varNames, varNames) {
+			t.Errorf("bad variable names (%q): want %#v, got %#v", tt.names, tt.varNames, varNames)
+		}
+	}
+}
+
+func TestEnvironmentApplyInterfaces(t *testing.T) {
+	defer withInterfaces(fakeInterfaces{ifaces: []net.Interface{fakeInterface("eth0", "52:54:00:12:34:56")}}, fakeRoutes{ipv4: "eth0"})()
+
+	env := NewEnvironment("./", "./", "./", "", datasource.Metadata{})
+	input := "ATTR{address}==\"$iface_eth0_mac\"\nMACAddress=$iface_default_mac\n\\$iface_eth0_mac"
+	expect := "ATTR{address}==\"52:54:00:12:34:56\"\nMACAddress=52:54:00:12:34:56\n$iface_eth0_mac"
+	if got := env.Apply(input); got != expect {
+		t.Fatalf("Environment incorrectly applied.\ngot:\n%s\nwant:\n%s", got, expect)
+	}
+
+	ef := env.DefaultEnvironmentFile()
+	expectVars := map[string]string{
+		"IFACE_ETH0_MAC":    "52:54:00:12:34:56",
+		"IFACE_DEFAULT_MAC": "52:54:00:12:34:56",
+	}
+	if ef == nil || !reflect.DeepEqual(expectVars, ef.Vars) {
+		t.Fatalf("bad environment file: want %#v, got %#v", expectVars, ef)
+	}
+}
+
+func TestEnvironmentSetLocalAddresses(t *testing.T) {
+	defer withInterfaces(fakeInterfaces{
+		ifaces: []net.Interface{fakeInterface("lo", ""), fakeInterface("eth0", "52:54:00:12:34:56")},
+		addrs: map[string][]string{
+			"lo":   {"127.0.0.1/8", "::1/128"},
+			"eth0": {"169.254.10.1/16", "fe80::1/64"},
+		},
+	}, fakeRoutes{ipv4: "eth0", ipv6: "eth0"})()
+
+	env := NewEnvironment("./", "./", "./", "", datasource.Metadata{})
+	input := "$iface_lo_ipv4 $iface_eth0_ipv4 $iface_default_ipv6 $iface_eth0_mac"
+	for _, tt := range []struct {
+		local bool
+		out   string
+	}{
+		{false, "$iface_lo_ipv4 $iface_eth0_ipv4 $iface_default_ipv6 52:54:00:12:34:56"},
+		{true, "127.0.0.1 169.254.10.1 fe80::1 52:54:00:12:34:56"},
+		{false, "$iface_lo_ipv4 $iface_eth0_ipv4 $iface_default_ipv6 52:54:00:12:34:56"},
+	} {
+		env.SetLocalAddresses(tt.local)
+		if out := env.Apply(input); out != tt.out {
+			t.Errorf("bad substitution (%t): want %q, got %q", tt.local, tt.out, out)
+		}
+	}
+}
+
+func TestEnvironmentInterfaces(t *testing.T) {
+	defer withInterfaces(fakeInterfaces{
+		ifaces: []net.Interface{
+			fakeInterface("lo", ""),
+			fakeInterface("eth0", "52:54:00:12:34:56"),
+			fakeInterface("eth1", "52:54:00:12:34:57"),
+		},
+		addrs: map[string][]string{
+			"lo":   {"127.0.0.1/8", "::1/128"},
+			"eth0": {"10.0.0.5/24", "fe80::5054:ff:fe12:3456/64", "10.0.0.6/24", "2001:db8::5/64"},
+		},
+	}, fakeRoutes{ipv4: "eth0"})()
+
+	env := NewEnvironment("./", "./", "./", "", datasource.Metadata{})
+	expect := []Interface{
+		{Name: "lo", IPv4s: []string{"127.0.0.1"}, IPv6s: []string{"::1"}},
+		{
+			Name:    "eth0",
+			MAC:     "52:54:00:12:34:56",
+			IPv4s:   []string{"10.0.0.5", "10.0.0.6"},
+			IPv6s:   []string{"fe80::5054:ff:fe12:3456", "2001:db8::5"},
+			Default: true,
+		},
+		{Name: "eth1", MAC: "52:54:00:12:34:57"},
+	}
+	if ifaces := env.Interfaces(); !reflect.DeepEqual(expect, ifaces) {
+		t.Fatalf("bad interfaces: want %#v, got %#v", expect, ifaces)
+	}
+
+	// The flat substitutions only expose the first IPv4 address.
+	if got := env.Apply("$iface_eth0_ipv4"); got != "10.0.0.5" {
+		t.Fatalf("bad substitution: want %q, got %q", "10.0.0.5", got)
+	}
+}
+
+func TestEnvironmentAddSubstitutions(t *testing.T) {
+	metadata := datasource.Metadata{PrivateIPv4: net.ParseIP("10.0.0.1")}
+	env := NewEnvironment("./", "./", "./", "", metadata)
+	env.AddSubstitutions(map[string]string{
+		"registry":     "registry.example.com",
+		"registry_url": "https://$registry",
+		"private_ipv4": "192.0.2.1",
+		"not-valid":    "ignored",
+	})
+
+	input := "$registry_url $registry \\$registry $private_ipv4 $not-valid"
+	expect := "https://$registry registry.example.com $registry 10.0.0.1 $not-valid"
+	if got := env.Apply(input); got != expect {
+		t.Fatalf("Environment incorrectly applied.\ngot:\n%s\nwant:\n%s", got, expect)
+	}
 }
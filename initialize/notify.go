@@ -0,0 +1,38 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"log"
+
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// Notify reports the given stage as the status of the coreos-cloudinit unit
+// to systemd. Failures are only logged, as they don't affect the config.
+func Notify(status string) {
+	notify("STATUS=" + status)
+}
+
+// NotifyReady reports to systemd that coreos-cloudinit is done.
+func NotifyReady() {
+	notify("READY=1\nSTATUS=Done")
+}
+
+func notify(state string) {
+	if err := system.SdNotify(state); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestApplyNotify(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := path.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Unable to listen on %q: %v", socket, err)
+	}
+	defer conn.Close()
+	if old, ok := os.LookupEnv("NOTIFY_SOCKET"); ok {
+		defer os.Setenv("NOTIFY_SOCKET", old)
+	} else {
+		defer os.Unsetenv("NOTIFY_SOCKET")
+	}
+	os.Setenv("NOTIFY_SOCKET", socket)
+
+	root := path.Join(dir, "root")
+	env := NewEnvironment(root, root, root, "", datasource.Metadata{})
+	cfg := config.CloudConfig{WriteFiles: []config.File{{Path: "/etc/foo.conf", Content: "foo"}}}
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	NotifyReady()
+
+	var got []string
+	buf := make([]byte, 1024)
+	for {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		got = append(got, string(buf[:n]))
+	}
+	want := []string{
+		"STATUS=Creating users",
+		"STATUS=Writing files",
+		"STATUS=Enabling units",
+		"READY=1\nSTATUS=Done",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("bad notifications: want %q, got %q", want, got)
+	}
+}
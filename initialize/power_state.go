@@ -0,0 +1,60 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// ApplyPowerState schedules the power transition of the given config, unless
+// its condition isn't met. It is meant to be called once everything else has
+// been applied. Since the cloud-config is processed during each boot, a power
+// transition is only performed once for the same config (unless forced), so
+// that e.g. a reboot doesn't cause a reboot loop.
+func ApplyPowerState(cfg config.PowerState, env *Environment) error {
+	ps := system.PowerState{PowerState: cfg}
+	command, err := ps.Command()
+	if err != nil || command == nil {
+		return err
+	}
+
+	hash := Hash(cfg)
+	if env.AppliedOnce("power-state", hash) {
+		log.Printf("Power state %q was already applied, skipping", cfg.Mode)
+		return nil
+	}
+
+	if env.DryRun() {
+		fmt.Fprintf(env.dryRun, "power-state %s condition=%s\n", strings.Join(command, " "), cfg.Condition)
+		return nil
+	}
+
+	if !ps.ConditionMet() {
+		log.Printf("Skipping power state %q", cfg.Mode)
+		return nil
+	}
+	// The sentinel is written first, since there may be no chance to write
+	// it afterwards.
+	if err := env.MarkAppliedOnce("power-state", hash); err != nil {
+		return err
+	}
+	log.Printf("Scheduling power state %q (%s)", cfg.Mode, strings.Join(command, " "))
+	return ps.Apply()
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestApplyPowerStateDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.PowerState{Mode: "reboot", Delay: "5", Message: "bye", Condition: "test -f /run/reboot-needed"}
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, "workspace", "", datasource.Metadata{})
+	env.SetDryRun(&out)
+
+	if err := ApplyPowerState(config.PowerState{}, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "" {
+		t.Errorf("bad output without power state: %q", out.String())
+	}
+
+	if err := ApplyPowerState(cfg, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "power-state shutdown --reboot +5 bye condition=test -f /run/reboot-needed\n"; out.String() != want {
+		t.Errorf("bad output: want %q, got %q", want, out.String())
+	}
+
+	// A power state applied during a previous boot is not applied again.
+	env.SetDryRun(nil)
+	if err := env.MarkAppliedOnce("power-state", Hash(cfg)); err != nil {
+		t.Fatalf("Unable to mark power state: %v", err)
+	}
+	out.Reset()
+	env.SetDryRun(&out)
+	if err := ApplyPowerState(cfg, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "" {
+		t.Errorf("power state applied again: %q", out.String())
+	}
+
+	if err := ApplyPowerState(config.PowerState{Mode: "sleep"}, env); err == nil {
+		t.Errorf("invalid mode not rejected")
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// Report is a machine-readable summary of the actions taken to apply a
+// config, which is recorded if set with Environment.SetReport. A nil Report
+// records nothing.
+type Report struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Actions  []Action  `json:"actions"`
+}
+
+// Action is an action recorded in a Report. Name identifies the kind of the
+// action (e.g. write-file or start-unit) and Target what it was applied to
+// (e.g. the path of the file or the name of the unit).
+type Action struct {
+	Time    time.Time `json:"time"`
+	Name    string    `json:"action"`
+	Target  string    `json:"target"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// NewReport returns an empty report started now.
+func NewReport() *Report {
+	return &Report{Started: now(), Actions: []Action{}}
+}
+
+// now returns the current time, without the monotonic clock reading so that
+// times survive a JSON round trip unchanged.
+var now = func() time.Time {
+	return time.Now().Round(0)
+}
+
+// Add records the outcome of an action and returns its error, if any.
+func (r *Report) Add(name, target string, err error) error {
+	if r == nil {
+		return err
+	}
+	a := Action{Time: now(), Name: name, Target: target, Success: err == nil}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	r.Actions = append(r.Actions, a)
+	return err
+}
+
+// Finish records the overall outcome once all actions have been taken.
+func (r *Report) Finish(err error) {
+	if r == nil {
+		return
+	}
+	r.Finished = now()
+	r.Success = err == nil
+	r.Error = ""
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Write stores the report as JSON in the file at the given path, which is
+// replaced atomically.
+func (r *Report) Write(filename string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(path.Dir(filename), ".report-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// reportingUnitManager is a system.UnitManager which records the operations
+// it performs through the wrapped UnitManager in a Report.
+type reportingUnitManager struct {
+	system.UnitManager
+	report *Report
+}
+
+func (m reportingUnitManager) PlaceUnit(u system.Unit) error {
+	return m.report.Add("place-unit", u.Name, m.UnitManager.PlaceUnit(u))
+}
+
+func (m reportingUnitManager) PlaceUnitDropIn(u system.Unit, d config.UnitDropIn) error {
+	return m.report.Add("place-drop-in", u.Name+"/"+d.Name, m.UnitManager.PlaceUnitDropIn(u, d))
+}
+
+func (m reportingUnitManager) EnableUnitFile(u system.Unit) error {
+	return m.report.Add("enable-unit", u.Name, m.UnitManager.EnableUnitFile(u))
+}
+
+func (m reportingUnitManager) RunUnitCommand(u system.Unit, c string) (string, error) {
+	res, err := m.UnitManager.RunUnitCommand(u, c)
+	return res, m.report.Add(c+"-unit", u.Name, err)
+}
+
+// MaskUnit and UnmaskUnit only record the units which were actually masked
+// or unmasked (or failed to be).
+func (m reportingUnitManager) MaskUnit(u system.Unit) (bool, error) {
+	return m.recordChange("mask-unit", u, m.UnitManager.MaskUnit)
+}
+
+func (m reportingUnitManager) UnmaskUnit(u system.Unit) (bool, error) {
+	return m.recordChange("unmask-unit", u, m.UnitManager.UnmaskUnit)
+}
+
+func (m reportingUnitManager) recordChange(name string, u system.Unit, f func(system.Unit) (bool, error)) (bool, error) {
+	changed, err := f(u)
+	if changed || err != nil {
+		m.report.Add(name, u.Name, err)
+	}
+	return changed, err
+}
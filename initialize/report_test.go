@@ -0,0 +1,177 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+func stubNow(t time.Time) func() {
+	old := now
+	now = func() time.Time { return t }
+	return func() { now = old }
+}
+
+func TestReportWrite(t *testing.T) {
+	ts := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	defer stubNow(ts)()
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewReport()
+	if err := r.Add("write-file", "/etc/foo", nil); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	fail := errors.New("failed")
+	if err := r.Add("start-unit", "foo.service", fail); err != fail {
+		t.Fatalf("bad error: want %v, got %v", fail, err)
+	}
+	r.Finish(fail)
+
+	filename := path.Join(dir, "report.json")
+	if err := r.Write(filename); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("Unable to stat report: %v", err)
+	}
+	if fi.Mode() != 0644 {
+		t.Errorf("bad mode: want %v, got %v", os.FileMode(0644), fi.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("bad number of files: want 1, got %d", len(files))
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Unable to read report: %v", err)
+	}
+	var got Report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("bad report %q: %v", data, err)
+	}
+	want := Report{
+		Started:  ts,
+		Finished: ts,
+		Success:  false,
+		Error:    "failed",
+		Actions: []Action{
+			{Time: ts, Name: "write-file", Target: "/etc/foo", Success: true},
+			{Time: ts, Name: "start-unit", Target: "foo.service", Success: false, Error: "failed"},
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("bad report: want %+v, got %+v", want, got)
+	}
+}
+
+func TestReportNil(t *testing.T) {
+	var r *Report
+	fail := errors.New("failed")
+	if err := r.Add("write-file", "/etc/foo", fail); err != fail {
+		t.Errorf("bad error: want %v, got %v", fail, err)
+	}
+	r.Finish(nil)
+}
+
+func TestReportingUnitManager(t *testing.T) {
+	r := NewReport()
+	tum := &TestUnitManager{}
+	units := []system.Unit{
+		{Unit: config.Unit{
+			Name:    "foo.service",
+			Content: "[Service]\nExecStart=/bin/true",
+			Command: "start",
+			DropIns: []config.UnitDropIn{{Name: "bar.conf", Content: "[Service]\nUser=core"}},
+		}},
+		{Unit: config.Unit{Name: "baz.service", Content: "[Install]\nWantedBy=multi-user.target", Enable: true}},
+		{Unit: config.Unit{Name: "mask.service", Mask: true}},
+	}
+	if err := processUnits(units, "", reportingUnitManager{tum, r}, map[string]bool{}); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	var got []string
+	for _, a := range r.Actions {
+		if !a.Success {
+			t.Errorf("bad action %+v: want success", a)
+		}
+		got = append(got, a.Name+" "+a.Target)
+	}
+	want := []string{
+		"place-unit foo.service",
+		"place-drop-in foo.service/bar.conf",
+		"place-unit baz.service",
+		"mask-unit mask.service",
+		"enable-unit baz.service",
+		"start-unit foo.service",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("bad actions: want %q, got %q", want, got)
+	}
+}
+
+func TestApplyReport(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	r := NewReport()
+	env.SetReport(r)
+	cfg := config.CloudConfig{
+		Directories: []config.Directory{{Path: "/var/lib/foo"}},
+		WriteFiles:  []config.File{{Path: "/etc/foo.conf", Content: "foo"}},
+	}
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	var got []string
+	for _, a := range r.Actions {
+		if !a.Success {
+			t.Errorf("bad action %+v: want success", a)
+		}
+		got = append(got, a.Name+" "+a.Target)
+	}
+	// Only the leading actions are checked; the units which Apply always
+	// processes (e.g. unmasking etcd) follow them.
+	want := []string{
+		"ensure-directory /var/lib/foo",
+		"write-file /etc/foo.conf",
+	}
+	if len(got) < len(want) || !reflect.DeepEqual(want, got[:len(want)]) {
+		t.Errorf("bad actions: want %q, got %q", want, got)
+	}
+}
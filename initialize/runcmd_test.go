@@ -0,0 +1,190 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestApplyRunCmd(t *testing.T) {
+	for _, tt := range []struct {
+		runcmd func(dir string) config.RunCmd
+
+		log string
+		err bool
+	}{
+		{
+			runcmd: func(dir string) config.RunCmd {
+				return config.RunCmd{
+					{Shell: "echo one >> " + path.Join(dir, "log")},
+					{Args: []string{"/bin/sh", "-c", `echo "$0" >> "$1"`, "two", path.Join(dir, "log")}},
+					{Shell: "exit 1", IgnoreErrors: true},
+					{Args: []string{"/nonexistent/command"}, IgnoreErrors: true},
+					{Shell: "echo three >> " + path.Join(dir, "log")},
+				}
+			},
+			log: "one\ntwo\nthree\n",
+		},
+		{
+			runcmd: func(dir string) config.RunCmd {
+				return config.RunCmd{
+					{Shell: "echo one >> " + path.Join(dir, "log")},
+					{Shell: "exit 1"},
+					{Shell: "echo two >> " + path.Join(dir, "log")},
+				}
+			},
+			log: "one\n",
+			err: true,
+		},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		root := path.Join(dir, "root")
+		env := NewEnvironment(root, root, root, "", datasource.Metadata{})
+		cfg := config.CloudConfig{RunCmd: tt.runcmd(dir)}
+		if err := Apply(cfg, nil, env); tt.err != (err != nil) {
+			t.Errorf("bad error (%v): want %t, got %v", cfg.RunCmd, tt.err, err)
+		}
+		log, err := ioutil.ReadFile(path.Join(dir, "log"))
+		if err != nil {
+			t.Fatalf("Unable to read log: %v", err)
+		}
+		if string(log) != tt.log {
+			t.Errorf("bad log (%v): want %q, got %q", cfg.RunCmd, tt.log, log)
+		}
+	}
+}
+
+func TestApplyRunCmdInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	cfg := config.CloudConfig{
+		WriteFiles: []config.File{{Path: "/etc/foo.conf", Content: "foo"}},
+		BootCmd:    config.RunCmd{{Shell: "touch " + path.Join(dir, "ran")}},
+		RunCmd:     config.RunCmd{{Shell: "true"}, {}},
+	}
+	if err := Apply(cfg, nil, env); err == nil {
+		t.Fatalf("bad error: want non-nil, got nil")
+	}
+	for _, p := range []string{"etc/foo.conf", "ran"} {
+		if _, err := os.Stat(path.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("bad %s: want nothing applied, got %v", p, err)
+		}
+	}
+}
+
+func TestApplyDryRunRunCmd(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	env.SetDryRun(&out)
+	cfg := config.CloudConfig{RunCmd: config.RunCmd{
+		{Shell: "touch " + path.Join(dir, "ran")},
+		{Args: []string{"touch", path.Join(dir, "ran")}, IgnoreErrors: true},
+	}}
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+
+	for _, want := range []string{
+		"run-command touch " + path.Join(dir, "ran") + " ignore-errors=false\n",
+		`run-command ["touch" "` + path.Join(dir, "ran") + `"] ignore-errors=true` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("bad dry-run output: want %q in:\n%s", want, out.String())
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Errorf("dry-run ran a command: %v", err)
+	}
+}
+
+func TestApplyBootCmd(t *testing.T) {
+	for _, tt := range []struct {
+		bootcmd func(dir, file string) config.RunCmd
+
+		log     string
+		written bool
+		err     bool
+	}{
+		{
+			// The boot commands run before write_files and the commands of
+			// runcmd after it.
+			bootcmd: func(dir, file string) config.RunCmd {
+				return config.RunCmd{{Args: []string{"/bin/sh", "-c", `test -e "$1" || echo boot >> "$2"`, "-", file, path.Join(dir, "log")}}}
+			},
+			log:     "boot\nrun\n",
+			written: true,
+		},
+		{
+			// A failing boot command stops the config from being applied.
+			bootcmd: func(dir, file string) config.RunCmd {
+				return config.RunCmd{{Shell: "echo boot >> " + path.Join(dir, "log") + "; exit 1"}}
+			},
+			log: "boot\n",
+			err: true,
+		},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		root := path.Join(dir, "root")
+		file := path.Join(root, "etc/foo.conf")
+		env := NewEnvironment(root, root, root, "", datasource.Metadata{})
+		cfg := config.CloudConfig{
+			BootCmd:    tt.bootcmd(dir, file),
+			WriteFiles: []config.File{{Path: "/etc/foo.conf", Content: "foo"}},
+			RunCmd:     config.RunCmd{{Args: []string{"/bin/sh", "-c", `test -e "$1" && echo run >> "$2"`, "-", file, path.Join(dir, "log")}}},
+		}
+		if err := Apply(cfg, nil, env); tt.err != (err != nil) {
+			t.Errorf("bad error (%v): want %t, got %v", cfg.BootCmd, tt.err, err)
+		}
+		log, err := ioutil.ReadFile(path.Join(dir, "log"))
+		if err != nil {
+			t.Fatalf("Unable to read log: %v", err)
+		}
+		if string(log) != tt.log {
+			t.Errorf("bad log (%v): want %q, got %q", cfg.BootCmd, tt.log, log)
+		}
+		if _, err := os.Stat(file); tt.written != (err == nil) {
+			t.Errorf("bad write_files (%v): want written %t, got %v", cfg.BootCmd, tt.written, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// bootIDPath holds the ID of the current boot. Sentinels are only honored
+// within the boot which wrote them, since runtime units, network
+// configuration, etc. don't survive a reboot.
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// Hash returns a digest of the given inputs of an action, for use with
+// Applied and MarkApplied.
+func Hash(inputs ...interface{}) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%#v", inputs))))
+}
+
+// Applied reports whether the named action was already applied with inputs
+// of the given hash during the current boot, according to its sentinel in
+// the workspace. Actions are never considered applied if forced.
+func (e *Environment) Applied(action, hash string) bool {
+	return e.applied(action, sentinel(hash))
+}
+
+// AppliedOnce is like Applied, but also honors sentinels written during
+// previous boots (see MarkAppliedOnce).
+func (e *Environment) AppliedOnce(action, hash string) bool {
+	return e.applied(action, hash)
+}
+
+func (e *Environment) applied(action, value string) bool {
+	if e.Force() {
+		return false
+	}
+	contents, err := ioutil.ReadFile(e.sentinelPath(action))
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(contents)) == value
+}
+
+// MarkApplied records in the sentinel of the named action that it was
+// applied with inputs of the given hash. Nothing is recorded in dry-run mode.
+func (e *Environment) MarkApplied(action, hash string) error {
+	return e.markApplied(action, sentinel(hash))
+}
+
+// MarkAppliedOnce is like MarkApplied, but the sentinel is honored by
+// AppliedOnce across reboots, for actions which must not be repeated during
+// every boot with the same inputs.
+func (e *Environment) MarkAppliedOnce(action, hash string) error {
+	return e.markApplied(action, hash)
+}
+
+func (e *Environment) markApplied(action, value string) error {
+	if e.DryRun() {
+		return nil
+	}
+	file := system.File{File: config.File{
+		Path:               path.Join("sentinels", action),
+		RawFilePermissions: "0644",
+		Content:            value + "\n",
+	}}
+	_, err := system.WriteFile(&file, e.Workspace())
+	return err
+}
+
+// maskedUnitsPath is the file in the workspace which lists the units masked by
+// coreos-cloudinit itself, one per line.
+const maskedUnitsPath = "masked-units"
+
+// maskedUnits returns the units which coreos-cloudinit masked itself during
+// earlier runs (see setMaskedUnits).
+func (e *Environment) maskedUnits() map[string]bool {
+	masked := map[string]bool{}
+	contents, err := ioutil.ReadFile(path.Join(e.Workspace(), maskedUnitsPath))
+	if err != nil {
+		return masked
+	}
+	for _, name := range strings.Fields(string(contents)) {
+		masked[name] = true
+	}
+	return masked
+}
+
+// setMaskedUnits records the units which coreos-cloudinit masked itself.
+// Nothing is recorded in dry-run mode.
+func (e *Environment) setMaskedUnits(masked map[string]bool) error {
+	if e.DryRun() {
+		return nil
+	}
+	names := make([]string, 0, len(masked))
+	for name := range masked {
+		names = append(names, name+"\n")
+	}
+	sort.Strings(names)
+	file := system.File{File: config.File{
+		Path:               maskedUnitsPath,
+		RawFilePermissions: "0644",
+		Content:            strings.Join(names, ""),
+	}}
+	_, err := system.WriteFile(&file, e.Workspace())
+	return err
+}
+
+func (e *Environment) sentinelPath(action string) string {
+	return path.Join(e.Workspace(), "sentinels", action)
+}
+
+func sentinel(hash string) string {
+	bootID, err := ioutil.ReadFile(bootIDPath)
+	if err != nil {
+		log.Printf("Unable to read boot ID: %v", err)
+	}
+	return fmt.Sprintf("%s %s", strings.TrimSpace(string(bootID)), hash)
+}
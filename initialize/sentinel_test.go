@@ -0,0 +1,232 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+func withBootID(t *testing.T, dir, id string) func() {
+	p := path.Join(dir, "boot_id")
+	if err := ioutil.WriteFile(p, []byte(id+"\n"), 0644); err != nil {
+		t.Fatalf("Unable to write boot ID: %v", err)
+	}
+	old := bootIDPath
+	bootIDPath = p
+	return func() { bootIDPath = old }
+}
+
+func TestSentinels(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer withBootID(t, dir, "boot-1")()
+
+	env := NewEnvironment(dir, dir, "workspace", "", datasource.Metadata{})
+	hash := Hash("input")
+	if env.Applied("config", hash) {
+		t.Errorf("action applied before it was marked")
+	}
+
+	if err := env.MarkApplied("config", hash); err != nil {
+		t.Fatalf("Unable to mark action: %v", err)
+	}
+	if !env.Applied("config", hash) {
+		t.Errorf("marked action not applied")
+	}
+	if env.Applied("config", Hash("other input")) {
+		t.Errorf("action applied with different inputs")
+	}
+	if env.Applied("unit-foo.service", hash) {
+		t.Errorf("different action applied")
+	}
+
+	env.SetForce(true)
+	if env.Applied("config", hash) {
+		t.Errorf("marked action applied despite force")
+	}
+	env.SetForce(false)
+
+	withBootID(t, dir, "boot-2")
+	if env.Applied("config", hash) {
+		t.Errorf("action applied during a different boot")
+	}
+
+	env.SetDryRun(&bytes.Buffer{})
+	if err := env.MarkApplied("unit-foo.service", hash); err != nil {
+		t.Fatalf("Unable to mark action: %v", err)
+	}
+	if _, err := os.Stat(env.sentinelPath("unit-foo.service")); !os.IsNotExist(err) {
+		t.Errorf("action marked in dry-run mode: %v", err)
+	}
+}
+
+func TestMaskedUnits(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	env := NewEnvironment(dir, dir, "workspace", "", datasource.Metadata{})
+	if masked := env.maskedUnits(); len(masked) != 0 {
+		t.Errorf("bad masked units before any were recorded: %v", masked)
+	}
+
+	want := map[string]bool{"foo.service": true, "bar.service": true}
+	if err := env.setMaskedUnits(want); err != nil {
+		t.Fatalf("Unable to record masked units: %v", err)
+	}
+	if masked := env.maskedUnits(); !reflect.DeepEqual(want, masked) {
+		t.Errorf("bad masked units: want %v, got %v", want, masked)
+	}
+
+	env.SetDryRun(&bytes.Buffer{})
+	if err := env.setMaskedUnits(map[string]bool{}); err != nil {
+		t.Fatalf("Unable to record masked units: %v", err)
+	}
+	if masked := env.maskedUnits(); !reflect.DeepEqual(want, masked) {
+		t.Errorf("dry-run changed the masked units: want %v, got %v", want, masked)
+	}
+}
+
+func TestApplyUnchanged(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer withBootID(t, dir, "boot-1")()
+
+	cfg := config.CloudConfig{WriteFiles: []config.File{{Path: "/etc/motd", Content: "hello\n"}}}
+	env := NewEnvironment(dir, dir, "workspace", "", datasource.Metadata{})
+	if err := env.MarkApplied("config", configHash(cfg, nil, env)); err != nil {
+		t.Fatalf("Unable to mark config: %v", err)
+	}
+
+	var out bytes.Buffer
+	env.SetDryRun(&out)
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "" {
+		t.Errorf("second run with identical input was not a no-op:\n%s", out.String())
+	}
+
+	cfg.WriteFiles[0].Content = "world\n"
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "content "+path.Join(dir, "etc/motd")+": world") {
+		t.Errorf("changed input was not applied:\n%s", out.String())
+	}
+
+	out.Reset()
+	cfg.WriteFiles[0].Content = "hello\n"
+	env.SetForce(true)
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "content "+path.Join(dir, "etc/motd")+": hello") {
+		t.Errorf("forced run was a no-op:\n%s", out.String())
+	}
+}
+
+func TestChangedUnits(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer withBootID(t, dir, "boot-1")()
+
+	env := NewEnvironment(dir, dir, "workspace", "", datasource.Metadata{})
+	units := []system.Unit{
+		{Unit: config.Unit{Name: "foo.service", Content: "[Service]\nExecStart=/bin/true\n", Command: "start"}},
+		{Unit: config.Unit{Name: "bar.service", Command: "start"}},
+		{Unit: config.Unit{Name: "bar.service", DropIns: []config.UnitDropIn{{Name: "10-bar.conf", Content: "[Service]\n"}}}},
+	}
+
+	changed, hashes := changedUnits(units, env)
+	if !reflect.DeepEqual(units, changed) {
+		t.Errorf("bad changed units: want %#v, got %#v", units, changed)
+	}
+	for name, hash := range hashes {
+		if err := env.MarkApplied("unit-"+name, hash); err != nil {
+			t.Fatalf("Unable to mark unit: %v", err)
+		}
+	}
+
+	if changed, _ := changedUnits(units, env); len(changed) != 0 {
+		t.Errorf("unchanged units were not skipped: %#v", changed)
+	}
+
+	units[2].DropIns[0].Content = "[Service]\nRestart=always\n"
+	if changed, _ := changedUnits(units, env); !reflect.DeepEqual(units[1:], changed) {
+		t.Errorf("bad changed units: want %#v, got %#v", units[1:], changed)
+	}
+}
+
+func TestApplyChangedUnits(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer withBootID(t, dir, "boot-1")()
+
+	cfg := config.CloudConfig{CoreOS: config.CoreOS{Units: []config.Unit{
+		{Name: "foo.service", Content: "[Service]\nExecStart=/bin/true\n", Command: "restart"},
+		{Name: "bar.service", Content: "[Service]\nExecStart=/bin/false\n", Command: "restart"},
+	}}}
+	env := NewEnvironment(dir, dir, "workspace", "", datasource.Metadata{})
+	for _, u := range cfg.CoreOS.Units {
+		if err := env.MarkApplied("unit-"+u.Name, Hash([]system.Unit{{Unit: u}})); err != nil {
+			t.Fatalf("Unable to mark unit: %v", err)
+		}
+	}
+
+	cfg.CoreOS.Units[1].DropIns = []config.UnitDropIn{{Name: "10-bar.conf", Content: "[Service]\nRestart=always\n"}}
+	var out bytes.Buffer
+	env.SetDryRun(&out)
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "foo.service") {
+		t.Errorf("unchanged unit was applied again:\n%s", out.String())
+	}
+	for _, line := range []string{
+		"place-unit " + path.Join(dir, "etc/systemd/system/bar.service"),
+		"place-drop-in " + path.Join(dir, "etc/systemd/system/bar.service.d/10-bar.conf"),
+		"daemon-reload",
+		"unit-command restart bar.service",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("changed unit was not applied, missing %q:\n%s", line, out.String())
+		}
+	}
+}
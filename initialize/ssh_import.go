@@ -0,0 +1,149 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/pkg"
+	"github.com/coreos/coreos-cloudinit/system"
+)
+
+// sshImportURLs maps the providers supported by ssh_import_* to the URL
+// serving the public keys of one of their users.
+var sshImportURLs = map[string]string{
+	"github": "https://github.com/%s.keys",
+	"gitlab": "https://gitlab.com/%s.keys",
+}
+
+// SSHImportKeys authorizes the public keys of the given GitHub and GitLab
+// users for the system user. The keys of each user are stored under the name
+// "<provider>-<user>". Keys which are already authorized under another name
+// are skipped, and failing to fetch the keys of a user is logged rather than
+// treated as an error.
+func SSHImportKeys(systemUser string, githubUsers, gitlabUsers []string) error {
+	if len(githubUsers) == 0 && len(gitlabUsers) == 0 {
+		return nil
+	}
+
+	sshDir := ""
+	if u, err := user.Lookup(systemUser); err == nil {
+		sshDir = path.Join(u.HomeDir, ".ssh")
+	}
+
+	for _, i := range []struct {
+		provider string
+		users    []string
+	}{
+		{"github", githubUsers},
+		{"gitlab", gitlabUsers},
+	} {
+		for _, name := range i.users {
+			keysName := fmt.Sprintf("%s-%s", i.provider, name)
+			keys, err := fetchPlainKeys(fmt.Sprintf(sshImportURLs[i.provider], name))
+			if err != nil {
+				log.Printf("Failed fetching SSH keys of %s user %q: %v", i.provider, name, err)
+				continue
+			}
+
+			seen := map[string]bool{}
+			if sshDir != "" {
+				seen = readAuthorizedKeys(sshDir, keysName)
+			}
+			if keys = dedupeKeys(keys, seen); len(keys) == 0 {
+				log.Printf("All SSH keys of %s user %q are already authorized", i.provider, name)
+				continue
+			}
+
+			log.Printf("Authorizing %d SSH keys of %s user %q for user '%s'", len(keys), i.provider, name, systemUser)
+			if err := system.AuthorizeSSHKeys(systemUser, keysName, keys); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fetchPlainKeys fetches a list of public keys, one per line.
+func fetchPlainKeys(url string) ([]string, error) {
+	client := pkg.NewHttpClient()
+	data, err := client.GetRetry(url)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeys(data), nil
+}
+
+func parseKeys(data []byte) []string {
+	var keys []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	return keys
+}
+
+// dedupeKeys returns the keys which are not in seen, each only once.
+func dedupeKeys(keys []string, seen map[string]bool) []string {
+	var unique []string
+	for _, key := range keys {
+		id := system.SSHKeyBlob(key)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, key)
+	}
+	return unique
+}
+
+// readAuthorizedKeys returns the IDs of the public keys authorized in the
+// given .ssh directory, except those stored under the name exclude (which are
+// about to be replaced). If the keys aren't managed by update-ssh-keys, the
+// authorized_keys file is read instead.
+func readAuthorizedKeys(sshDir, exclude string) map[string]bool {
+	var files []string
+	if infos, err := ioutil.ReadDir(path.Join(sshDir, "authorized_keys.d")); err == nil {
+		for _, info := range infos {
+			if info.Name() != exclude {
+				files = append(files, path.Join(sshDir, "authorized_keys.d", info.Name()))
+			}
+		}
+	} else if os.IsNotExist(err) {
+		files = append(files, path.Join(sshDir, "authorized_keys"))
+	}
+
+	seen := map[string]bool{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, key := range parseKeys(data) {
+			seen[system.SSHKeyBlob(key)] = true
+		}
+	}
+	return seen
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFetchPlainKeys(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ssh-rsa AAAA1\n\n# comment\nssh-ed25519 AAAA2 user@host\n")
+	}))
+	defer ts.Close()
+
+	keys, err := fetchPlainKeys(ts.URL)
+	if err != nil {
+		t.Fatalf("Encountered unexpected error: %v", err)
+	}
+	expect := []string{"ssh-rsa AAAA1", "ssh-ed25519 AAAA2 user@host"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("bad keys: want %q, got %q", expect, keys)
+	}
+}
+
+func TestDedupeKeys(t *testing.T) {
+	seen := map[string]bool{"AAAA1": true}
+	keys := dedupeKeys([]string{
+		"ssh-rsa AAAA1 other-comment",
+		"ssh-rsa AAAA2 one",
+		"ssh-rsa AAAA2 two",
+		"ssh-ed25519 AAAA3",
+	}, seen)
+	expect := []string{"ssh-rsa AAAA2 one", "ssh-ed25519 AAAA3"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("bad keys: want %q, got %q", expect, keys)
+	}
+}
+
+func TestReadAuthorizedKeys(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(path.Join(dir, "authorized_keys"), []byte("ssh-rsa AAAA1 a\nssh-rsa AAAA2 b\n"), 0600); err != nil {
+		t.Fatalf("Unable to write authorized_keys: %v", err)
+	}
+	expect := map[string]bool{"AAAA1": true, "AAAA2": true}
+	if seen := readAuthorizedKeys(dir, "github-octocat"); !reflect.DeepEqual(expect, seen) {
+		t.Fatalf("bad keys: want %v, got %v", expect, seen)
+	}
+
+	// once update-ssh-keys manages the keys, the keys stored under the
+	// excluded name are ignored
+	if err := os.Mkdir(path.Join(dir, "authorized_keys.d"), 0700); err != nil {
+		t.Fatalf("Unable to create authorized_keys.d: %v", err)
+	}
+	for name, content := range map[string]string{
+		"coreos-cloudinit": "ssh-rsa AAAA1 a\n",
+		"github-octocat":   "ssh-rsa AAAA3 c\n",
+	} {
+		if err := ioutil.WriteFile(path.Join(dir, "authorized_keys.d", name), []byte(content), 0600); err != nil {
+			t.Fatalf("Unable to write keys: %v", err)
+		}
+	}
+	expect = map[string]bool{"AAAA1": true}
+	if seen := readAuthorizedKeys(dir, "github-octocat"); !reflect.DeepEqual(expect, seen) {
+		t.Fatalf("bad keys: want %v, got %v", expect, seen)
+	}
+}
+
+func TestSSHImportKeysFailure(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	defer func(urls map[string]string) { sshImportURLs = urls }(sshImportURLs)
+	sshImportURLs = map[string]string{
+		"github": ts.URL + "/github/%s.keys",
+		"gitlab": ts.URL + "/gitlab/%s.keys",
+	}
+
+	// failing to fetch the keys of a user must not abort the import
+	if err := SSHImportKeys("nobody", []string{"a", "b"}, []string{"c"}); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("bad number of requests: want 3, got %d", requests)
+	}
+}
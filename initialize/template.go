@@ -0,0 +1,55 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+)
+
+// templateContext returns the data file templates are executed with: each
+// substitution variable by its name (without the "$"), the network
+// interfaces (see Interfaces) as "interfaces" and the hostname as "hostname". The given
+// hostname (i.e. the one of the cloud-config) takes precedence over the one
+// of the metadata.
+func (e *Environment) templateContext(hostname string) map[string]interface{} {
+	ctx := map[string]interface{}{}
+	for key, val := range e.substitutions {
+		ctx[strings.TrimPrefix(key, "$")] = val
+	}
+	ctx["interfaces"] = e.Interfaces()
+
+	if hostname == "" {
+		hostname = e.hostname
+	}
+	ctx["hostname"] = hostname
+	return ctx
+}
+
+// RenderTemplate executes content as a text/template with the template
+// context (see templateContext). Referencing a variable which doesn't exist is
+// an error.
+func (e *Environment) RenderTemplate(name, content, hostname string) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, e.templateContext(hostname)); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package initialize
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	defer withInterfaces(fakeInterfaces{
+		ifaces: []net.Interface{
+			fakeInterface("eth0", "52:54:00:12:34:56"),
+			fakeInterface("eth1", "52:54:00:12:34:57"),
+			fakeInterface("lo", ""),
+		},
+		addrs: map[string][]string{
+			"eth0": {"10.0.0.5/24"},
+			"eth1": {"192.0.2.5/24", "192.0.2.6/24"},
+		},
+	}, fakeRoutes{ipv4: "eth0"})()
+
+	metadata := datasource.Metadata{PrivateIPv4: net.ParseIP("10.0.0.5"), Hostname: "metadata-host"}
+	env := NewEnvironment("./", "./", "./", "", metadata)
+	env.AddSubstitutions(map[string]string{"registry": "registry.example.com"})
+
+	for _, tt := range []struct {
+		content  string
+		hostname string
+
+		out string
+		err bool
+	}{
+		{
+			content: `{{range .interfaces}}{{if .IPv4s}}{{.Name}} {{.MAC}}{{range .IPv4s}} {{.}}{{end}}{{if .Default}} default{{end}}
+{{end}}{{end}}`,
+			out: "eth0 52:54:00:12:34:56 10.0.0.5 default\neth1 52:54:00:12:34:57 192.0.2.5 192.0.2.6\n",
+		},
+		{
+			content: "{{.hostname}} {{.private_ipv4}} {{.iface_default_ipv4}} {{.registry}}",
+			out:     "metadata-host 10.0.0.5 10.0.0.5 registry.example.com",
+		},
+		{
+			content:  "{{.hostname}}",
+			hostname: "config-host",
+			out:      "config-host",
+		},
+		{
+			content: "{{.unknown}}",
+			err:     true,
+		},
+		{
+			content: "{{range .interfaces}}",
+			err:     true,
+		},
+	} {
+		out, err := env.RenderTemplate("test", tt.content, tt.hostname)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.content, tt.err, err)
+		}
+		if out != tt.out {
+			t.Errorf("bad output (%q): want %q, got %q", tt.content, tt.out, out)
+		}
+	}
+}
+
+func TestApplyDryRunTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := config.CloudConfig{
+		Hostname: "node1",
+		WriteFiles: []config.File{
+			{Path: "/etc/hostname.template", Content: "{{.hostname}}", Template: true},
+			{Path: "/etc/hostname.plain", Content: "{{.hostname}}"},
+			{Path: "/etc/hostname.encoded", Content: "e3suaG9zdG5hbWV9fQ==", Encoding: "base64", Template: true},
+		},
+	}
+
+	var out bytes.Buffer
+	env := NewEnvironment(dir, dir, dir, "", datasource.Metadata{})
+	env.SetDryRun(&out)
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"content " + path.Join(dir, "etc/hostname.template") + ": node1\n",
+		"content " + path.Join(dir, "etc/hostname.plain") + ": {{.hostname}}\n",
+		"content " + path.Join(dir, "etc/hostname.encoded") + ": node1\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("bad dry-run output: want %q in:\n%s", want, out.String())
+		}
+	}
+
+	os.Setenv("CLOUDINIT_TEST_HOSTNAME", "{{.hostname}}")
+	defer os.Unsetenv("CLOUDINIT_TEST_HOSTNAME")
+	out.Reset()
+	cfg.WriteFiles = []config.File{
+		{Path: "/etc/hostname.env", Content: "${CLOUDINIT_TEST_HOSTNAME}", ExpandEnv: true},
+		{Path: "/etc/hostname.env-template", Content: "${CLOUDINIT_TEST_HOSTNAME}", ExpandEnv: true, Template: true},
+		{Path: "/etc/hostname.literal", Content: "${CLOUDINIT_TEST_HOSTNAME}"},
+	}
+	if err := Apply(cfg, nil, env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"content " + path.Join(dir, "etc/hostname.env") + ": {{.hostname}}\n",
+		"content " + path.Join(dir, "etc/hostname.env-template") + ": node1\n",
+		"content " + path.Join(dir, "etc/hostname.literal") + ": ${CLOUDINIT_TEST_HOSTNAME}\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("bad dry-run output: want %q in:\n%s", want, out.String())
+		}
+	}
+
+	cfg.WriteFiles = []config.File{{Path: "/etc/broken", Content: "{{.nope}}", Template: true}}
+	if err := Apply(cfg, nil, env); err == nil {
+		t.Errorf("bad error: want non-nil, got nil")
+	}
+}
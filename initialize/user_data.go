@@ -16,30 +16,171 @@ package initialize
 
 import (
 	"errors"
+	"fmt"
 	"log"
 
 	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/pkg"
 )
 
-var (
-	ErrIgnitionConfig = errors.New("not a config (found Ignition)")
-)
+// maxIncludeDepth is the number of nested "#include" documents which are
+// followed before giving up.
+const maxIncludeDepth = 5
 
+// ParseUserData parses the given user-data as a script, a cloud-config (in
+// YAML or JSON) or a multipart MIME message containing both. Gzipped user-data
+// is decompressed first. "#include" documents are resolved by fetching and
+// parsing each of the listed URLs. Ignition configs are recognized and
+// returned as a *config.Ignition so that the caller can leave them to Ignition
+// instead of applying them.
 func ParseUserData(contents string) (interface{}, error) {
+	p := userDataParser{client: pkg.NewHttpClient(), visited: map[string]bool{}}
+	return p.parse(contents, 0)
+}
+
+// ParseUserData parses the given user-data like the package-level
+// ParseUserData, substituting the environment's variables in each document
+// once it has been decompressed, decoded or fetched.
+func (e *Environment) ParseUserData(contents string) (interface{}, error) {
+	p := userDataParser{client: pkg.NewHttpClient(), visited: map[string]bool{}, substitute: e.SubstituteUserdata}
+	return p.parse(contents, 0)
+}
+
+// userDataParser keeps track of the URLs which have already been included so
+// that include loops are broken. If substitute is set, it is applied to each
+// script, cloud-config and include list before it is parsed.
+type userDataParser struct {
+	client     pkg.Getter
+	visited    map[string]bool
+	substitute func(string) string
+}
+
+func (p *userDataParser) parse(contents string, depth int) (interface{}, error) {
 	if len(contents) == 0 {
 		return nil, nil
 	}
 
+	if config.IsGzip(contents) {
+		log.Printf("Decompressing gzipped user-data")
+		decompressed, err := config.DecodeGzipContent(contents)
+		if err != nil {
+			return nil, err
+		}
+		contents = string(decompressed)
+	}
+
 	switch {
 	case config.IsScript(contents):
 		log.Printf("Parsing user-data as script")
-		return config.NewScript(contents)
+		return config.NewScript(p.apply(contents))
 	case config.IsCloudConfig(contents):
 		log.Printf("Parsing user-data as cloud-config")
-		return config.NewCloudConfig(contents)
+		return config.NewCloudConfig(p.apply(contents))
+	case config.IsCloudConfigJSON(contents):
+		log.Printf("Parsing user-data as JSON cloud-config")
+		return config.NewCloudConfigJSON(p.apply(contents))
+	case config.IsMultipart(contents):
+		log.Printf("Parsing user-data as multipart MIME message")
+		return p.multipart(contents)
+	case config.IsInclude(contents):
+		log.Printf("Parsing user-data as include list")
+		return p.include(p.apply(contents), depth)
 	case config.IsIgnitionConfig(contents):
-		return nil, ErrIgnitionConfig
+		log.Printf("Parsing user-data as Ignition config")
+		return config.NewIgnition(contents)
 	default:
 		return nil, errors.New("Unrecognized user-data format")
 	}
 }
+
+// apply substitutes the variables in the given document, if the parser does
+// substitution at all.
+func (p *userDataParser) apply(contents string) string {
+	if p.substitute == nil {
+		return contents
+	}
+	return p.substitute(contents)
+}
+
+// multipart parses the given multipart MIME message, substituting the
+// variables in each part once it has been decoded. The cloud-config parts are
+// substituted first so that the scripts can use the substitutions they define.
+func (p *userDataParser) multipart(contents string) (*config.Multipart, error) {
+	parts, err := config.MultipartParts(contents)
+	if err != nil {
+		return nil, err
+	}
+	for _, contentType := range []string{config.ContentTypeCloudConfig, config.ContentTypeShellScript} {
+		for i := range parts {
+			if parts[i].ContentType == contentType {
+				parts[i].Content = p.apply(parts[i].Content)
+			}
+		}
+	}
+	return config.NewMultipartFromParts(parts)
+}
+
+// include fetches and parses each of the URLs listed in the given "#include"
+// document, combining the results into a single *config.Multipart. URLs which
+// have already been included are skipped.
+func (p *userDataParser) include(contents string, depth int) (*config.Multipart, error) {
+	if depth >= maxIncludeDepth {
+		return nil, fmt.Errorf("#include nested more than %d levels deep", maxIncludeDepth)
+	}
+
+	urls, err := config.NewInclude(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &config.Multipart{}
+	for _, url := range urls {
+		if p.visited[url] {
+			log.Printf("Skipping already included %q", url)
+			continue
+		}
+		p.visited[url] = true
+
+		log.Printf("Fetching included user-data from %q", url)
+		data, err := p.client.GetRetry(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch included user-data from %q: %v", url, err)
+		}
+		ud, err := p.parse(string(data), depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse included user-data from %q: %v", url, err)
+		}
+		if err := addUserData(m, ud); err != nil {
+			return nil, fmt.Errorf("failed to include user-data from %q: %v", url, err)
+		}
+	}
+	return m, nil
+}
+
+// addUserData adds the cloud-config and scripts of the parsed user-data ud to
+// m. At most one cloud-config may be added.
+func addUserData(m *config.Multipart, ud interface{}) error {
+	var cc *config.CloudConfig
+	switch t := ud.(type) {
+	case nil:
+	case *config.CloudConfig:
+		cc = t
+	case *config.Script:
+		m.Scripts = append(m.Scripts, *t)
+	case *config.Multipart:
+		cc = t.CloudConfig
+		m.Scripts = append(m.Scripts, t.Scripts...)
+	case *config.Ignition:
+		return errors.New("Ignition configs cannot be included")
+	default:
+		return fmt.Errorf("unexpected user-data type %T", ud)
+	}
+
+	if cc != nil {
+		if m.CloudConfig != nil {
+			return errors.New("multiple cloud-configs are not supported")
+		}
+		m.CloudConfig = cc
+	}
+	return nil
+}
@@ -15,9 +15,19 @@
 package initialize
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/coreos-cloudinit/datasource"
 )
 
 func TestParseHeaderCRLF(t *testing.T) {
@@ -72,3 +82,264 @@ func TestParseConfigEmpty(t *testing.T) {
 		t.Error("ParseUserData of empty string returned error unexpectedly")
 	}
 }
+
+func TestParseIgnition(t *testing.T) {
+	for _, tt := range []struct {
+		contents string
+
+		version string
+		err     bool
+	}{
+		{contents: `{"ignitionVersion":1}`, version: "1"},
+		{contents: `{"ignition":{"version":"2.3.0"},"storage":{"files":[]}}`, version: "2.3.0"},
+		{contents: `{"ignition":{"version":"3.0.0"},"passwd":{"users":[{"name":"core"}]}}`, version: "3.0.0"},
+		{contents: `{"ignition":{"version":"latest"}}`, err: true},
+	} {
+		ud, err := ParseUserData(tt.contents)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.contents, tt.err, err)
+		}
+		if tt.err {
+			continue
+		}
+		ign, ok := ud.(*config.Ignition)
+		if !ok {
+			t.Errorf("bad type (%q): want *config.Ignition, got %T", tt.contents, ud)
+			continue
+		}
+		if ign.Version != tt.version {
+			t.Errorf("bad version (%q): want %q, got %q", tt.contents, tt.version, ign.Version)
+		}
+		if ign.Contents != tt.contents {
+			t.Errorf("bad contents: want %q, got %q", tt.contents, ign.Contents)
+		}
+	}
+}
+
+func TestParseCloudConfigJSON(t *testing.T) {
+	for _, contents := range []string{
+		"#cloud-config-json\n{\"hostname\": \"node1\", \"coreos\": {\"units\": [{\"name\": \"hello.service\", \"command\": \"start\"}]}}",
+		`{"hostname":"node1","coreos":{"units":[{"name":"hello.service","command":"start"}]}}`,
+	} {
+		ud, err := ParseUserData(contents)
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", contents, err)
+		}
+		cfg, ok := ud.(*config.CloudConfig)
+		if !ok {
+			t.Fatalf("bad type (%q): want *config.CloudConfig, got %T", contents, ud)
+		}
+		want := config.CloudConfig{
+			Hostname: "node1",
+			CoreOS:   config.CoreOS{Units: []config.Unit{{Name: "hello.service", Command: "start"}}},
+		}
+		if !reflect.DeepEqual(want, *cfg) {
+			t.Errorf("bad cloud-config (%q): want %#v, got %#v", contents, want, *cfg)
+		}
+	}
+}
+
+func TestParseMultipart(t *testing.T) {
+	contents := "Content-Type: multipart/mixed; boundary=\"===\"\r\nMIME-Version: 1.0\r\n\r\n" +
+		"--===\r\nContent-Type: text/cloud-config\r\n\r\n#cloud-config\r\nhostname: foo\r\n" +
+		"--===\r\nContent-Type: text/x-shellscript\r\n\r\n#!/bin/bash\r\necho foo\r\n" +
+		"--===--\r\n"
+	ud, err := ParseUserData(contents)
+	if err != nil {
+		t.Fatalf("Failed parsing multipart user-data: %v", err)
+	}
+
+	m, ok := ud.(*config.Multipart)
+	if !ok {
+		t.Fatalf("bad type: want *config.Multipart, got %T", ud)
+	}
+	if m.CloudConfig == nil || m.CloudConfig.Hostname != "foo" {
+		t.Errorf("Failed parsing hostname from cloud-config part")
+	}
+	if len(m.Scripts) != 1 {
+		t.Errorf("Parsed incorrect number of scripts: want 1, got %d", len(m.Scripts))
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config":
+			fmt.Fprint(w, "#cloud-config\nhostname: included\n")
+		case "/other-config":
+			fmt.Fprint(w, "#cloud-config\nhostname: other\n")
+		case "/script":
+			fmt.Fprint(w, "#!/bin/bash\necho included\n")
+		case "/nested":
+			fmt.Fprintf(w, "#include-once\n%s/config\n%s/script\n", ts.URL, ts.URL)
+		case "/loop":
+			fmt.Fprintf(w, "#include\n%s/loop\n%s/script\n", ts.URL, ts.URL)
+		case "/deep":
+			n, _ := strconv.Atoi(r.URL.RawQuery)
+			fmt.Fprintf(w, "#include\n%s/deep?%d\n", ts.URL, n+1)
+		case "/ignition":
+			fmt.Fprint(w, `{"ignition":{"version":"3.0.0"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		contents string
+
+		hostname string
+		scripts  int
+		err      bool
+	}{
+		{
+			contents: "#include\n" + ts.URL + "/config\n",
+			hostname: "included",
+		},
+		{
+			contents: "#include\n" + ts.URL + "/nested\n" + ts.URL + "/script\n",
+			hostname: "included",
+			scripts:  1,
+		},
+		{
+			contents: "#include\n" + ts.URL + "/loop\n",
+			scripts:  1,
+		},
+		{
+			contents: "#include\n" + ts.URL + "/deep\n",
+			err:      true,
+		},
+		{
+			contents: "#include\n" + ts.URL + "/config\n" + ts.URL + "/nested\n",
+			hostname: "included",
+			scripts:  1,
+		},
+		{
+			contents: "#include\n" + ts.URL + "/config\n" + ts.URL + "/other-config\n",
+			err:      true,
+		},
+		{
+			contents: "#include\n" + ts.URL + "/ignition\n",
+			err:      true,
+		},
+	} {
+		ud, err := ParseUserData(tt.contents)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.contents, tt.err, err)
+		}
+		if tt.err {
+			continue
+		}
+
+		m, ok := ud.(*config.Multipart)
+		if !ok {
+			t.Errorf("bad type (%q): want *config.Multipart, got %T", tt.contents, ud)
+			continue
+		}
+		var hostname string
+		if m.CloudConfig != nil {
+			hostname = m.CloudConfig.Hostname
+		}
+		if hostname != tt.hostname {
+			t.Errorf("bad hostname (%q): want %q, got %q", tt.contents, tt.hostname, hostname)
+		}
+		if len(m.Scripts) != tt.scripts {
+			t.Errorf("bad number of scripts (%q): want %d, got %d", tt.contents, tt.scripts, len(m.Scripts))
+		}
+	}
+}
+
+func TestEnvironmentParseMultipart(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("#cloud-config\nhostname: web-$public_ipv4\nsubstitutions:\n  region: west\n"))
+	contents := "Content-Type: multipart/mixed; boundary=\"===\"\r\nMIME-Version: 1.0\r\n\r\n" +
+		"--===\r\nContent-Type: text/x-shellscript\r\n\r\n#!/bin/bash\r\necho $region\r\n" +
+		"--===\r\nContent-Type: text/cloud-config\r\nContent-Transfer-Encoding: base64\r\n\r\n" + encoded + "\r\n" +
+		"--===--\r\n"
+
+	env := NewEnvironment("/", "", "", "", datasource.Metadata{PublicIPv4: net.ParseIP("192.0.2.1")})
+	ud, err := env.ParseUserData(contents)
+	if err != nil {
+		t.Fatalf("Failed parsing multipart user-data: %v", err)
+	}
+
+	m, ok := ud.(*config.Multipart)
+	if !ok {
+		t.Fatalf("bad type: want *config.Multipart, got %T", ud)
+	}
+	if m.CloudConfig == nil {
+		t.Fatalf("missing cloud-config part")
+	}
+	if want := "web-192.0.2.1"; m.CloudConfig.Hostname != want {
+		t.Errorf("bad hostname: want %q, got %q", want, m.CloudConfig.Hostname)
+	}
+	if want := []config.Script{config.Script("#!/bin/bash\r\necho west")}; !reflect.DeepEqual(m.Scripts, want) {
+		t.Errorf("bad scripts: want %q, got %q", want, m.Scripts)
+	}
+}
+
+func TestEnvironmentParseInclude(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config":
+			fmt.Fprint(w, "#cloud-config\nhostname: web-$public_ipv4-$region\nwrite_files:\n  - path: /etc/motd\n    content: \\$public_ipv4\nsubstitutions:\n  region: west\n")
+		case "/script":
+			fmt.Fprint(w, "#!/bin/bash\necho $public_ipv4\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	env := NewEnvironment("/", "", "", "", datasource.Metadata{PublicIPv4: net.ParseIP("192.0.2.1")})
+	ud, err := env.ParseUserData("#include\n" + ts.URL + "/config\n" + ts.URL + "/script\n")
+	if err != nil {
+		t.Fatalf("Failed parsing include list: %v", err)
+	}
+
+	m, ok := ud.(*config.Multipart)
+	if !ok {
+		t.Fatalf("bad type: want *config.Multipart, got %T", ud)
+	}
+	if m.CloudConfig == nil {
+		t.Fatalf("missing included cloud-config")
+	}
+	if want := "web-192.0.2.1-west"; m.CloudConfig.Hostname != want {
+		t.Errorf("bad hostname: want %q, got %q", want, m.CloudConfig.Hostname)
+	}
+	if want := []config.File{{Path: "/etc/motd", Content: "$public_ipv4"}}; !reflect.DeepEqual(m.CloudConfig.WriteFiles, want) {
+		t.Errorf("bad write_files: want %#v, got %#v", want, m.CloudConfig.WriteFiles)
+	}
+	if want := []config.Script{config.Script("#!/bin/bash\necho 192.0.2.1\n")}; !reflect.DeepEqual(m.Scripts, want) {
+		t.Errorf("bad scripts: want %q, got %q", want, m.Scripts)
+	}
+}
+
+func TestParseGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	if _, err := gzw.Write([]byte("#cloud-config\nhostname: gzipped\n")); err != nil {
+		t.Fatalf("Failed compressing config: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("Failed compressing config: %v", err)
+	}
+	gz := buf.Bytes()
+
+	ud, err := ParseUserData(string(gz))
+	if err != nil {
+		t.Fatalf("Failed parsing gzipped config: %v", err)
+	}
+	cfg, ok := ud.(*config.CloudConfig)
+	if !ok {
+		t.Fatalf("bad type: want *config.CloudConfig, got %T", ud)
+	}
+	if cfg.Hostname != "gzipped" {
+		t.Errorf("bad hostname: want %q, got %q", "gzipped", cfg.Hostname)
+	}
+
+	_, err = ParseUserData(string(gz[:len(gz)/2]))
+	if want := "Unable to decode gzip: stream is truncated"; err == nil || err.Error() != want {
+		t.Errorf("bad error for truncated stream: want %q, got %v", want, err)
+	}
+}
@@ -15,6 +15,7 @@
 package network
 
 import (
+	"fmt"
 	"log"
 	"strings"
 )
@@ -28,18 +29,151 @@ func ProcessDebianNetconf(config []byte) ([]InterfaceGenerator, error) {
 	}
 
 	interfaces := make([]*stanzaInterface, 0, len(stanzas))
+	interfaceMap := make(map[string]*stanzaInterface)
 	for _, stanza := range stanzas {
 		switch s := stanza.(type) {
 		case *stanzaInterface:
+			if s.kind == interfaceVLAN && len(s.options["raw_device"]) != 1 {
+				return nil, fmt.Errorf("vlan %q has no parent interface (vlan_raw_device)", s.name)
+			}
+			if iface, ok := interfaceMap[s.name]; ok {
+				if err := mergeInterfaceStanzas(iface, s); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			interfaceMap[s.name] = s
 			interfaces = append(interfaces, s)
 		}
 	}
+	if err := resolveMembers(interfaces); err != nil {
+		return nil, err
+	}
 	log.Printf("Parsed %d network interfaces\n", len(interfaces))
 
 	log.Println("Processed Debian network config")
 	return buildInterfaces(interfaces), nil
 }
 
+// mergeInterfaceStanzas merges a second stanza for the same interface, such
+// as the inet6 stanza of a dual-stack interface, into the first one. Static
+// configs are combined, manual ones give way to the other stanza's config and
+// DHCP covers both address families already.
+func mergeInterfaceStanzas(iface, other *stanzaInterface) error {
+	switch c := iface.configMethod.(type) {
+	case configMethodManual:
+		iface.configMethod = other.configMethod
+	case configMethodStatic:
+		switch o := other.configMethod.(type) {
+		case configMethodManual:
+		case configMethodStatic:
+			c.addresses = append(c.addresses, o.addresses...)
+			c.routes = append(c.routes, o.routes...)
+			c.nameservers = append(c.nameservers, o.nameservers...)
+			if c.hwaddress == nil {
+				c.hwaddress = o.hwaddress
+			}
+			if c.acceptRA == "" {
+				c.acceptRA = o.acceptRA
+			}
+			iface.configMethod = c
+		default:
+			return fmt.Errorf("conflicting config methods for %q", iface.name)
+		}
+	case configMethodDHCP:
+		switch o := other.configMethod.(type) {
+		case configMethodManual:
+		case configMethodDHCP:
+			if c.hwaddress == nil {
+				iface.configMethod = o
+			}
+		default:
+			return fmt.Errorf("conflicting config methods for %q", iface.name)
+		}
+	case configMethodLoopback:
+		switch other.configMethod.(type) {
+		case configMethodManual, configMethodLoopback:
+		default:
+			return fmt.Errorf("conflicting config methods for %q", iface.name)
+		}
+	}
+
+	if iface.kind == interfacePhysical {
+		iface.kind = other.kind
+	}
+	for k, v := range other.options {
+		if _, ok := iface.options[k]; !ok {
+			iface.options[k] = v
+		}
+	}
+	iface.auto = iface.auto || other.auto
+	return nil
+}
+
+// resolveMembers adds the interfaces which name their bond using bond-master
+// to that bond's members and makes sure that every bond has members and that
+// no interface is a member of more than one bond or bridge.
+func resolveMembers(interfaces []*stanzaInterface) error {
+	bonds := map[string]*stanzaInterface{}
+	for _, iface := range interfaces {
+		if iface.kind == interfaceBond {
+			bonds[iface.name] = iface
+		}
+	}
+
+	for _, iface := range interfaces {
+		master, ok := iface.options["bond-master"]
+		if !ok || iface.kind == interfaceBond {
+			continue
+		}
+		if len(master) != 1 {
+			return fmt.Errorf("malformed bond-master option for %q", iface.name)
+		}
+		bond, ok := bonds[master[0]]
+		if !ok {
+			return fmt.Errorf("bond-master %q of %q is not a bond", master[0], iface.name)
+		}
+		if !containsString(bond.options["bond-slaves"], iface.name) {
+			bond.options["bond-slaves"] = append(bond.options["bond-slaves"], iface.name)
+		}
+	}
+
+	owners := map[string]string{}
+	for _, iface := range interfaces {
+		var members []string
+		switch iface.kind {
+		case interfaceBond:
+			members = iface.options["bond-slaves"]
+			if len(members) == 0 {
+				return fmt.Errorf("bond %q has no members", iface.name)
+			}
+		case interfaceBridge:
+			members = iface.options["bridge_ports"]
+		default:
+			continue
+		}
+		for _, member := range members {
+			if member == iface.name {
+				return fmt.Errorf("%q cannot be a member of itself", iface.name)
+			}
+			if owner, ok := owners[member]; ok && owner != iface.name {
+				return fmt.Errorf("%q is a member of both %q and %q", member, owner, iface.name)
+			}
+			owners[member] = iface.name
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
 func formatConfig(config string) []string {
 	lines := []string{}
 	config = strings.Replace(config, "\\\n", "", -1)
@@ -15,6 +15,7 @@
 package network
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -43,6 +44,34 @@ func TestProcessDebianNetconf(t *testing.T) {
 		{"iface", true, -1},
 		{"auto eth1\nauto eth2", false, 0},
 		{"iface eth1 inet manual", false, 1},
+		{"iface eth1.10 inet manual", false, 2},
+		{"iface vlan10 inet manual\nvlan_raw_device eth1", false, 2},
+		{"iface vlan10 inet manual\nvlan_raw_device", true, -1},
+		{"iface eth1.0 inet manual", true, -1},
+		{"iface eth1.4095 inet manual", true, -1},
+		{"iface bond0 inet manual\nbond-slaves eth1 eth2", false, 3},
+		{"iface bond0 inet manual\nbond-slaves none\niface eth1 inet manual\nbond-master bond0", false, 2},
+		{"iface bond0 inet manual\nbond-slaves none", true, -1},
+		{"iface bond0 inet manual\nbond-slaves bond0", true, -1},
+		{"iface eth1 inet manual\nbond-master bond0", true, -1},
+		{"iface bond0 inet manual\nbond-slaves eth1\niface bond1 inet manual\nbond-slaves eth1", true, -1},
+		{"iface br0 inet manual\nbridge_ports none", false, 1},
+		{"iface lo inet loopback\niface lo inet6 loopback", false, 0},
+		{"iface eth1 inet manual\nmtu 9000", false, 1},
+		{"iface eth1 inet static\naddress 10.0.0.2/24\npost-up route add -net invalid gw 10.0.0.1", true, -1},
+		{"iface eth1 inet static\naddress 10.0.0.2/24\npost-up route add -net 10.1.0.0/16 gw invalid", true, -1},
+		{"iface eth1 inet static\naddress 10.0.0.2/24\npost-up route add -net 10.1.0.0/16 gw 10.0.0.1 metric -1", true, -1},
+		{"iface eth1 inet manual\nmtu 67", true, -1},
+		{"iface eth1 inet manual\nmtu 65537", true, -1},
+		{"iface eth1 inet manual\nmtu jumbo", true, -1},
+		{"iface eth1 inet dhcp\niface eth1 inet6 dhcp", false, 1},
+		{"iface eth1 inet manual\niface eth1 inet6 static\naddress 2001:db8::2/64", false, 1},
+		{"iface eth1 inet dhcp\niface eth1 inet6 static\naddress 2001:db8::2/64", true, -1},
+		{"iface eth1 inet6 static\naddress 2001:db8::2\nnetmask 129", true, -1},
+		{"iface eth1 inet6 static\naddress 2001:db8::2\nnetmask ffff::", true, -1},
+		{"iface eth1 inet6 static\naddress 2001:db8::2/64\naccept_ra maybe", true, -1},
+		{"iface br0 inet manual\nbridge_ports eth1\nbridge_stp maybe", true, -1},
+		{"iface br0 inet manual\nbridge_ports eth1\niface bond0 inet manual\nbond-slaves eth1", true, -1},
 	} {
 		interfaces, err := ProcessDebianNetconf([]byte(tt.in))
 		failed := err != nil
@@ -54,3 +83,183 @@ func TestProcessDebianNetconf(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessDebianNetconfVLAN(t *testing.T) {
+	interfaces, err := ProcessDebianNetconf([]byte(`auto eth0
+iface eth0 inet manual
+
+auto eth0.10
+iface eth0.10 inet static
+address 10.0.10.2
+netmask 255.255.255.0
+gateway 10.0.10.1
+`))
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, i := range interfaces {
+		for ext, content := range map[string]string{"netdev": i.Netdev(), "network": i.Network()} {
+			if content != "" {
+				files[i.Filename()+"."+ext] = content
+			}
+		}
+	}
+
+	expect := map[string]string{
+		"01-eth0.network":    "[Match]\nName=eth0\n\n[Network]\nVLAN=eth0.10\n",
+		"00-eth0.10.netdev":  "[NetDev]\nKind=vlan\nName=eth0.10\n\n[VLAN]\nId=10\n",
+		"00-eth0.10.network": "[Match]\nName=eth0.10\n\n[Network]\n\n[Address]\nAddress=10.0.10.2/24\n\n[Route]\nDestination=0.0.0.0/0\nGateway=10.0.10.1\n",
+	}
+	if !reflect.DeepEqual(expect, files) {
+		t.Fatalf("bad files:\nwant %q\ngot  %q", expect, files)
+	}
+}
+
+func TestProcessDebianNetconfBond(t *testing.T) {
+	interfaces, err := ProcessDebianNetconf([]byte(`auto eth0
+iface eth0 inet manual
+bond-master bond0
+
+auto eth1
+iface eth1 inet manual
+bond-master bond0
+
+auto bond0
+iface bond0 inet static
+bond-slaves none
+bond-mode 802.3ad
+bond-miimon 100
+bond-lacp-rate 1
+address 10.0.0.2
+netmask 255.255.255.0
+gateway 10.0.0.1
+`))
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, i := range interfaces {
+		for ext, content := range map[string]string{"netdev": i.Netdev(), "network": i.Network()} {
+			if content != "" {
+				files[i.Filename()+"."+ext] = content
+			}
+		}
+	}
+
+	expect := map[string]string{
+		"01-eth0.network":  "[Match]\nName=eth0\n\n[Network]\nBond=bond0\n",
+		"01-eth1.network":  "[Match]\nName=eth1\n\n[Network]\nBond=bond0\n",
+		"00-bond0.netdev":  "[NetDev]\nKind=bond\nName=bond0\n\n[Bond]\nLACPTransmitRate=fast\nMIIMonitorSec=100ms\nMode=802.3ad\n",
+		"00-bond0.network": "[Match]\nName=bond0\n\n[Network]\n\n[Address]\nAddress=10.0.0.2/24\n\n[Route]\nDestination=0.0.0.0/0\nGateway=10.0.0.1\n",
+	}
+	if !reflect.DeepEqual(expect, files) {
+		t.Fatalf("bad files:\nwant %q\ngot  %q", expect, files)
+	}
+}
+
+func TestProcessDebianNetconfBridge(t *testing.T) {
+	interfaces, err := ProcessDebianNetconf([]byte(`auto eth0
+iface eth0 inet manual
+
+auto eth1
+iface eth1 inet manual
+
+auto br0
+iface br0 inet static
+bridge_ports eth0 eth1
+bridge_stp on
+address 10.0.0.2
+netmask 255.255.255.0
+gateway 10.0.0.1
+`))
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, i := range interfaces {
+		for ext, content := range map[string]string{"netdev": i.Netdev(), "network": i.Network()} {
+			if content != "" {
+				files[i.Filename()+"."+ext] = content
+			}
+		}
+	}
+
+	expect := map[string]string{
+		"01-eth0.network": "[Match]\nName=eth0\n\n[Network]\nBridge=br0\n",
+		"01-eth1.network": "[Match]\nName=eth1\n\n[Network]\nBridge=br0\n",
+		"00-br0.netdev":   "[NetDev]\nKind=bridge\nName=br0\n\n[Bridge]\nSTP=yes\n",
+		"00-br0.network":  "[Match]\nName=br0\n\n[Network]\n\n[Address]\nAddress=10.0.0.2/24\n\n[Route]\nDestination=0.0.0.0/0\nGateway=10.0.0.1\n",
+	}
+	if !reflect.DeepEqual(expect, files) {
+		t.Fatalf("bad files:\nwant %q\ngot  %q", expect, files)
+	}
+}
+
+func TestProcessDebianNetconfDualStack(t *testing.T) {
+	interfaces, err := ProcessDebianNetconf([]byte(`auto eth0
+iface eth0 inet static
+address 10.0.0.2
+netmask 255.255.255.0
+gateway 10.0.0.1
+
+iface eth0 inet6 static
+address 2001:db8::2
+netmask 64
+gateway 2001:db8::1
+accept_ra 0
+
+iface eth1 inet6 static
+address 2001:db8:1::2/64
+address 2001:db8:1::3/64
+`))
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, i := range interfaces {
+		files[i.Filename()+".network"] = i.Network()
+	}
+
+	expect := map[string]string{
+		"00-eth0.network": "[Match]\nName=eth0\n\n[Network]\nIPv6AcceptRA=no\n" +
+			"\n[Address]\nAddress=10.0.0.2/24\n" +
+			"\n[Address]\nAddress=2001:db8::2/64\n" +
+			"\n[Route]\nDestination=0.0.0.0/0\nGateway=10.0.0.1\n" +
+			"\n[Route]\nDestination=::/0\nGateway=2001:db8::1\n",
+		"00-eth1.network": "[Match]\nName=eth1\n\n[Network]\n\n[Address]\nAddress=2001:db8:1::2/64\n\n[Address]\nAddress=2001:db8:1::3/64\n",
+	}
+	if !reflect.DeepEqual(expect, files) {
+		t.Fatalf("bad files:\nwant %q\ngot  %q", expect, files)
+	}
+}
+
+func TestProcessDebianNetconfRoutes(t *testing.T) {
+	interfaces, err := ProcessDebianNetconf([]byte(`auto eth0
+iface eth0 inet static
+address 10.0.0.2
+netmask 255.255.255.0
+gateway 10.0.0.1
+post-up route add -net 10.1.0.0 netmask 255.255.0.0 gw 10.0.0.254
+post-up route add -net 192.168.0.0/24 gw 10.0.0.253 metric 100
+`))
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+	if len(interfaces) != 1 {
+		t.Fatalf("bad number of interfaces: want 1, got %d", len(interfaces))
+	}
+
+	expect := "[Match]\nName=eth0\n\n[Network]\n" +
+		"\n[Address]\nAddress=10.0.0.2/24\n" +
+		"\n[Route]\nDestination=0.0.0.0/0\nGateway=10.0.0.1\n" +
+		"\n[Route]\nDestination=10.1.0.0/16\nGateway=10.0.0.254\n" +
+		"\n[Route]\nDestination=192.168.0.0/24\nGateway=10.0.0.253\nMetric=100\n"
+	if network := interfaces[0].Network(); network != expect {
+		t.Fatalf("bad network:\nwant %q\ngot  %q", expect, network)
+	}
+}
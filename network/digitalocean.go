@@ -134,19 +134,13 @@ func parseInterface(iface digitalocean.Interface, nameservers []net.IP, useRoute
 		if mask = net.ParseIP(iface.AnchorIPv4.Netmask); mask == nil {
 			return nil, fmt.Errorf("could not parse %q as anchor IPv4 mask", iface.AnchorIPv4.Netmask)
 		}
+		// The anchor address only receives the traffic of a floating IP,
+		// which is answered through the interface's regular gateway, so it
+		// doesn't get a route of its own.
 		addresses = append(addresses, net.IPNet{
 			IP:   ip,
 			Mask: net.IPMask(mask),
 		})
-
-		if useRoute {
-			routes = append(routes, route{
-				destination: net.IPNet{
-					IP:   net.IPv4zero,
-					Mask: net.IPMask(net.IPv4zero),
-				},
-			})
-		}
 	}
 
 	hwaddr, err := net.ParseMAC(iface.MAC)
@@ -15,6 +15,7 @@
 package network
 
 import (
+	"encoding/json"
 	"errors"
 	"net"
 	"reflect"
@@ -180,8 +181,8 @@ func TestParseInterface(t *testing.T) {
 					}},
 					nameservers: []net.IP{},
 					routes: []route{{
-						net.IPNet{IP: net.IPv4zero, Mask: net.IPMask(net.IPv4zero)},
-						net.ParseIP("5.6.7.8"),
+						destination: net.IPNet{IP: net.IPv4zero, Mask: net.IPMask(net.IPv4zero)},
+						gateway:     net.ParseIP("5.6.7.8"),
 					}},
 				},
 			},
@@ -252,8 +253,8 @@ func TestParseInterface(t *testing.T) {
 					}},
 					nameservers: []net.IP{},
 					routes: []route{{
-						net.IPNet{IP: net.IPv6zero, Mask: net.IPMask(net.IPv6zero)},
-						net.ParseIP("fe00:1234::"),
+						destination: net.IPNet{IP: net.IPv6zero, Mask: net.IPMask(net.IPv6zero)},
+						gateway:     net.ParseIP("fe00:1234::"),
 					}},
 				},
 			},
@@ -315,9 +316,6 @@ func TestParseInterface(t *testing.T) {
 							destination: net.IPNet{IP: net.IPv4zero, Mask: net.IPMask(net.IPv4zero)},
 							gateway:     net.ParseIP("5.6.7.8"),
 						},
-						{
-							destination: net.IPNet{IP: net.IPv4zero, Mask: net.IPMask(net.IPv4zero)},
-						},
 					},
 				},
 			},
@@ -470,6 +468,82 @@ func TestProcessDigitalOceanNetconf(t *testing.T) {
 	}
 }
 
+// digitalOceanMetadata is the network part of the metadata of a droplet with
+// IPv6, private networking and a floating IP assigned.
+const digitalOceanMetadata = `{
+  "droplet_id": 2756294,
+  "hostname": "sample-droplet",
+  "interfaces": {
+    "public": [
+      {
+        "ipv4": {
+          "ip_address": "104.131.20.105",
+          "netmask": "255.255.192.0",
+          "gateway": "104.131.0.1"
+        },
+        "ipv6": {
+          "ip_address": "2604:A880:0800:0010:0000:0000:017D:2001",
+          "cidr": 64,
+          "gateway": "2604:A880:0800:0010:0000:0000:0000:0001"
+        },
+        "anchor_ipv4": {
+          "ip_address": "10.17.0.5",
+          "netmask": "255.255.0.0",
+          "gateway": "10.17.0.1"
+        },
+        "mac": "04:01:2a:0f:2a:01",
+        "type": "public"
+      }
+    ],
+    "private": [
+      {
+        "ipv4": {
+          "ip_address": "10.132.255.113",
+          "netmask": "255.255.0.0",
+          "gateway": "10.132.0.1"
+        },
+        "mac": "04:01:2a:0f:2a:02",
+        "type": "private"
+      }
+    ]
+  },
+  "dns": {
+    "nameservers": [
+      "2001:4860:4860::8844",
+      "8.8.8.8"
+    ]
+  }
+}`
+
+func TestProcessDigitalOceanNetconfMetadata(t *testing.T) {
+	var cfg digitalocean.Metadata
+	if err := json.Unmarshal([]byte(digitalOceanMetadata), &cfg); err != nil {
+		t.Fatalf("bad metadata: %v", err)
+	}
+	ifaces, err := ProcessDigitalOceanNetconf(cfg)
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	networks := []string{}
+	for _, iface := range ifaces {
+		networks = append(networks, iface.Network())
+	}
+	expect := []string{
+		"[Match]\nMACAddress=04:01:2a:0f:2a:01\n\n[Network]\nDNS=2001:4860:4860::8844\nDNS=8.8.8.8\n" +
+			"\n[Address]\nAddress=104.131.20.105/18\n" +
+			"\n[Address]\nAddress=2604:a880:800:10::17d:2001/64\n" +
+			"\n[Address]\nAddress=10.17.0.5/16\n" +
+			"\n[Route]\nDestination=0.0.0.0/0\nGateway=104.131.0.1\n" +
+			"\n[Route]\nDestination=::/0\nGateway=2604:a880:800:10::1\n",
+		"[Match]\nMACAddress=04:01:2a:0f:2a:02\n\n[Network]\n" +
+			"\n[Address]\nAddress=10.132.255.113/16\n",
+	}
+	if !reflect.DeepEqual(expect, networks) {
+		t.Fatalf("bad networks:\nwant %q\ngot  %q", expect, networks)
+	}
+}
+
 func errorsEqual(a, b error) bool {
 	if a == nil && b == nil {
 		return true
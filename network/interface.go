@@ -41,6 +41,7 @@ type networkInterface interface {
 type logicalInterface struct {
 	name        string
 	hwaddr      net.HardwareAddr
+	mtu         int
 	config      configMethod
 	children    []networkInterface
 	configDepth int
@@ -58,6 +59,9 @@ func (i *logicalInterface) Network() string {
 	if i.hwaddr != nil {
 		config += fmt.Sprintf("MACAddress=%s\n", i.hwaddr)
 	}
+	if i.mtu != 0 {
+		config += fmt.Sprintf("\n[Link]\nMTUBytes=%d\n", i.mtu)
+	}
 	config += "\n[Network]\n"
 
 	for _, child := range i.children {
@@ -66,6 +70,8 @@ func (i *logicalInterface) Network() string {
 			config += fmt.Sprintf("VLAN=%s\n", iface.name)
 		case *bondInterface:
 			config += fmt.Sprintf("Bond=%s\n", iface.name)
+		case *bridgeInterface:
+			config += fmt.Sprintf("Bridge=%s\n", iface.name)
 		}
 	}
 
@@ -74,11 +80,17 @@ func (i *logicalInterface) Network() string {
 		for _, nameserver := range conf.nameservers {
 			config += fmt.Sprintf("DNS=%s\n", nameserver)
 		}
+		if conf.acceptRA != "" {
+			config += fmt.Sprintf("IPv6AcceptRA=%s\n", conf.acceptRA)
+		}
 		for _, addr := range conf.addresses {
 			config += fmt.Sprintf("\n[Address]\nAddress=%s\n", addr.String())
 		}
 		for _, route := range conf.routes {
 			config += fmt.Sprintf("\n[Route]\nDestination=%s\nGateway=%s\n", route.destination.String(), route.gateway)
+			if route.metric != 0 {
+				config += fmt.Sprintf("Metric=%d\n", route.metric)
+			}
 		}
 	case configMethodDHCP:
 		config += "DHCP=true\n"
@@ -134,10 +146,17 @@ func (b *bondInterface) Netdev() string {
 	if b.hwaddr != nil {
 		config += fmt.Sprintf("MACAddress=%s\n", b.hwaddr.String())
 	}
+	if b.mtu != 0 {
+		config += fmt.Sprintf("MTUBytes=%d\n", b.mtu)
+	}
 
 	config += fmt.Sprintf("\n[Bond]\n")
 	for _, name := range sortedKeys(b.options) {
-		config += fmt.Sprintf("%s=%s\n", name, b.options[name])
+		key, value := name, b.options[name]
+		if o, ok := networkdBondOptions[name]; ok {
+			key, value = o.key, o.value(value)
+		}
+		config += fmt.Sprintf("%s=%s\n", key, value)
 	}
 
 	return config
@@ -156,6 +175,76 @@ func (b *bondInterface) ModprobeParams() string {
 	return params
 }
 
+// bondModes maps the numeric bonding modes, which ifupdown accepts as well,
+// to their names.
+var bondModes = map[string]string{
+	"0": "balance-rr",
+	"1": "active-backup",
+	"2": "balance-xor",
+	"3": "broadcast",
+	"4": "802.3ad",
+	"5": "balance-tlb",
+	"6": "balance-alb",
+}
+
+func bondModeName(mode string) string {
+	if name, ok := bondModes[mode]; ok {
+		return name
+	}
+	return mode
+}
+
+// networkdBondOptions maps the ifupdown style bond options (as used for the
+// bonding module's parameters) to their networkd equivalents. Other options
+// are expected to be networkd options already.
+var networkdBondOptions = map[string]struct {
+	key   string
+	value func(string) string
+}{
+	"mode":      {"Mode", bondModeName},
+	"miimon":    {"MIIMonitorSec", func(v string) string { return v + "ms" }},
+	"lacp-rate": {"LACPTransmitRate", bondLACPRateName},
+}
+
+func bondLACPRateName(rate string) string {
+	switch rate {
+	case "0":
+		return "slow"
+	case "1":
+		return "fast"
+	}
+	return rate
+}
+
+type bridgeInterface struct {
+	logicalInterface
+	ports   []string
+	options map[string]string
+}
+
+func (b *bridgeInterface) Netdev() string {
+	config := fmt.Sprintf("[NetDev]\nKind=bridge\nName=%s\n", b.name)
+	if b.hwaddr != nil {
+		config += fmt.Sprintf("MACAddress=%s\n", b.hwaddr.String())
+	}
+	if b.mtu != 0 {
+		config += fmt.Sprintf("MTUBytes=%d\n", b.mtu)
+	}
+
+	if len(b.options) > 0 {
+		config += "\n[Bridge]\n"
+		for _, name := range sortedKeys(b.options) {
+			config += fmt.Sprintf("%s=%s\n", name, b.options[name])
+		}
+	}
+
+	return config
+}
+
+func (b *bridgeInterface) Type() string {
+	return "bridge"
+}
+
 type vlanInterface struct {
 	logicalInterface
 	id        int
@@ -174,6 +263,9 @@ func (v *vlanInterface) Netdev() string {
 			config += fmt.Sprintf("MACAddress=%s\n", c.hwaddress)
 		}
 	}
+	if v.mtu != 0 {
+		config += fmt.Sprintf("MTUBytes=%d\n", v.mtu)
+	}
 	config += fmt.Sprintf("\n[VLAN]\nId=%d\n", v.id)
 	return config
 }
@@ -209,6 +301,7 @@ func createInterfaces(stanzas []*stanzaInterface) map[string]networkInterface {
 			interfaceMap[iface.name] = &bondInterface{
 				logicalInterface{
 					name:     iface.name,
+					mtu:      stanzaMTU(iface),
 					config:   iface.configMethod,
 					children: []networkInterface{},
 				},
@@ -227,6 +320,33 @@ func createInterfaces(stanzas []*stanzaInterface) map[string]networkInterface {
 				}
 			}
 
+		case interfaceBridge:
+			bridgeOptions := make(map[string]string)
+			if v, ok := iface.options["bridge_stp"]; ok && len(v) > 0 {
+				bridgeOptions["STP"] = v[0]
+			}
+			interfaceMap[iface.name] = &bridgeInterface{
+				logicalInterface{
+					name:     iface.name,
+					mtu:      stanzaMTU(iface),
+					config:   iface.configMethod,
+					children: []networkInterface{},
+				},
+				iface.options["bridge_ports"],
+				bridgeOptions,
+			}
+			for _, port := range iface.options["bridge_ports"] {
+				if _, ok := interfaceMap[port]; !ok {
+					interfaceMap[port] = &physicalInterface{
+						logicalInterface{
+							name:     port,
+							config:   configMethodManual{},
+							children: []networkInterface{},
+						},
+					}
+				}
+			}
+
 		case interfacePhysical:
 			if _, ok := iface.configMethod.(configMethodLoopback); ok {
 				continue
@@ -234,6 +354,7 @@ func createInterfaces(stanzas []*stanzaInterface) map[string]networkInterface {
 			interfaceMap[iface.name] = &physicalInterface{
 				logicalInterface{
 					name:     iface.name,
+					mtu:      stanzaMTU(iface),
 					config:   iface.configMethod,
 					children: []networkInterface{},
 				},
@@ -257,6 +378,7 @@ func createInterfaces(stanzas []*stanzaInterface) map[string]networkInterface {
 			interfaceMap[iface.name] = &vlanInterface{
 				logicalInterface{
 					name:     iface.name,
+					mtu:      stanzaMTU(iface),
 					config:   iface.configMethod,
 					children: []networkInterface{},
 				},
@@ -268,6 +390,16 @@ func createInterfaces(stanzas []*stanzaInterface) map[string]networkInterface {
 	return interfaceMap
 }
 
+// stanzaMTU returns the MTU given by the stanza's mtu option, which has been
+// validated while parsing the stanza, or 0 if there is none.
+func stanzaMTU(iface *stanzaInterface) int {
+	if v := iface.options["mtu"]; len(v) == 1 {
+		mtu, _ := strconv.Atoi(v[0])
+		return mtu
+	}
+	return 0
+}
+
 func linkAncestors(interfaceMap map[string]networkInterface) {
 	for _, name := range sortedInterfaces(interfaceMap) {
 		iface := interfaceMap[name]
@@ -279,6 +411,8 @@ func linkAncestors(interfaceMap map[string]networkInterface) {
 					p.children = append(p.children, iface)
 				case *bondInterface:
 					p.children = append(p.children, iface)
+				case *bridgeInterface:
+					p.children = append(p.children, iface)
 				}
 			}
 		case *bondInterface:
@@ -292,6 +426,19 @@ func linkAncestors(interfaceMap map[string]networkInterface) {
 					}
 				}
 			}
+		case *bridgeInterface:
+			for _, port := range i.ports {
+				if parent, ok := interfaceMap[port]; ok {
+					switch p := parent.(type) {
+					case *physicalInterface:
+						p.children = append(p.children, iface)
+					case *bondInterface:
+						p.children = append(p.children, iface)
+					case *vlanInterface:
+						p.children = append(p.children, iface)
+					}
+				}
+			}
 		}
 	}
 }
@@ -72,6 +72,19 @@ func TestInterfaceGenerators(t *testing.T) {
 			kind:    "vlan",
 			iface:   &vlanInterface{logicalInterface{name: "testname"}, 1, ""},
 		},
+		{
+			name:    "testname",
+			network: "[Match]\nName=testname\n\n[Link]\nMTUBytes=9000\n\n[Network]\n",
+			kind:    "physical",
+			iface:   &physicalInterface{logicalInterface{name: "testname", mtu: 9000}},
+		},
+		{
+			name:    "testname",
+			netdev:  "[NetDev]\nKind=vlan\nName=testname\nMTUBytes=9000\n\n[VLAN]\nId=1\n",
+			network: "[Match]\nName=testname\n\n[Link]\nMTUBytes=9000\n\n[Network]\n",
+			kind:    "vlan",
+			iface:   &vlanInterface{logicalInterface{name: "testname", mtu: 9000}, 1, ""},
+		},
 		{
 			name:    "testname",
 			netdev:  "[NetDev]\nKind=vlan\nName=testname\nMACAddress=00:01:02:03:04:05\n\n[VLAN]\nId=1\n",
@@ -0,0 +1,211 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// netplanBondParameters maps the bond options used by the networkd
+// generator (both the ifupdown style of the Debian stanzas and the networkd
+// style of the other providers) to their netplan parameter names. The options
+// given in seconds are converted to milliseconds.
+var netplanBondParameters = map[string]struct {
+	name    string
+	seconds bool
+}{
+	"mode":             {name: "mode"},
+	"Mode":             {name: "mode"},
+	"miimon":           {name: "mii-monitor-interval"},
+	"MIIMonitorSec":    {name: "mii-monitor-interval", seconds: true},
+	"lacp-rate":        {name: "lacp-rate"},
+	"LACPTransmitRate": {name: "lacp-rate"},
+	"UpDelaySec":       {name: "up-delay", seconds: true},
+	"DownDelaySec":     {name: "down-delay", seconds: true},
+}
+
+// Netplan renders the given interfaces as a netplan configuration, the
+// alternative to the networkd units generated from their Netdev(), Link()
+// and Network(). Interfaces are matched in the same way by name and MAC
+// address.
+func Netplan(interfaces []InterfaceGenerator) string {
+	var ethernets, bonds, bridges, vlans string
+	for _, iface := range interfaces {
+		switch i := iface.(type) {
+		case *physicalInterface:
+			ethernets += i.netplan(i.netplanMatch())
+		case *bondInterface:
+			bonds += i.netplan(i.netplanBond())
+		case *bridgeInterface:
+			bridges += i.netplan(i.netplanBridge())
+		case *vlanInterface:
+			vlans += i.netplan(i.netplanVLAN())
+		}
+	}
+
+	config := "network:\n  version: 2\n  renderer: networkd\n"
+	for _, section := range []struct {
+		name   string
+		config string
+	}{
+		{"ethernets", ethernets},
+		{"bonds", bonds},
+		{"bridges", bridges},
+		{"vlans", vlans},
+	} {
+		if section.config != "" {
+			config += fmt.Sprintf("  %s:\n%s", section.name, section.config)
+		}
+	}
+	return config
+}
+
+// netplan renders the interface's definition, consisting of the given
+// kind-specific properties followed by its addressing.
+func (i *logicalInterface) netplan(properties string) string {
+	id := i.name
+	if id == "" {
+		id = i.Filename()
+	}
+	config := fmt.Sprintf("    %s:\n%s", netplanQuote(id), properties)
+	if i.mtu != 0 {
+		config += fmt.Sprintf("      mtu: %d\n", i.mtu)
+	}
+
+	switch conf := i.config.(type) {
+	case configMethodStatic:
+		if len(conf.addresses) > 0 {
+			config += "      addresses:\n"
+			for _, addr := range conf.addresses {
+				config += fmt.Sprintf("        - %s\n", netplanQuote(addr.String()))
+			}
+		}
+		if len(conf.nameservers) > 0 {
+			config += "      nameservers:\n        addresses:\n"
+			for _, nameserver := range conf.nameservers {
+				config += fmt.Sprintf("          - %s\n", netplanQuote(nameserver.String()))
+			}
+		}
+		if len(conf.routes) > 0 {
+			config += "      routes:\n"
+			for _, route := range conf.routes {
+				config += fmt.Sprintf("        - to: %s\n          via: %s\n", netplanQuote(route.destination.String()), netplanQuote(route.gateway.String()))
+				if route.metric != 0 {
+					config += fmt.Sprintf("          metric: %d\n", route.metric)
+				}
+			}
+		}
+		if conf.acceptRA != "" {
+			config += fmt.Sprintf("      accept-ra: %t\n", conf.acceptRA == "yes")
+		}
+	case configMethodDHCP:
+		config += "      dhcp4: true\n      dhcp6: true\n"
+	}
+
+	return config
+}
+
+// netplanMatch renders the same match as the [Match] section of Network().
+// Bonds and VLANs are matched by their name, which is their netplan ID.
+func (p *physicalInterface) netplanMatch() string {
+	match := "      match:\n"
+	if p.name != "" {
+		match += fmt.Sprintf("        name: %s\n", netplanQuote(p.name))
+	}
+	if p.hwaddr != nil {
+		match += fmt.Sprintf("        macaddress: %s\n", netplanQuote(p.hwaddr.String()))
+	}
+	return match
+}
+
+func (b *bondInterface) netplanBond() string {
+	config := ""
+	if len(b.slaves) > 0 {
+		config += "      interfaces:\n"
+		for _, slave := range b.slaves {
+			config += fmt.Sprintf("        - %s\n", netplanQuote(slave))
+		}
+	}
+	if b.hwaddr != nil {
+		config += fmt.Sprintf("      macaddress: %s\n", netplanQuote(b.hwaddr.String()))
+	}
+
+	params := ""
+	for _, name := range sortedKeys(b.options) {
+		p, ok := netplanBondParameters[name]
+		if !ok {
+			continue
+		}
+		value := b.options[name]
+		switch p.name {
+		case "mode":
+			value = bondModeName(value)
+		case "lacp-rate":
+			value = bondLACPRateName(value)
+		}
+		if p.seconds {
+			s, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			value = strconv.Itoa(int(s*1000 + 0.5))
+		}
+		params += fmt.Sprintf("        %s: %s\n", p.name, netplanQuote(value))
+	}
+	if params != "" {
+		config += "      parameters:\n" + params
+	}
+	return config
+}
+
+func (b *bridgeInterface) netplanBridge() string {
+	config := ""
+	if len(b.ports) > 0 {
+		config += "      interfaces:\n"
+		for _, port := range b.ports {
+			config += fmt.Sprintf("        - %s\n", netplanQuote(port))
+		}
+	}
+	if b.hwaddr != nil {
+		config += fmt.Sprintf("      macaddress: %s\n", netplanQuote(b.hwaddr.String()))
+	}
+	if stp, ok := b.options["STP"]; ok {
+		config += fmt.Sprintf("      parameters:\n        stp: %t\n", stp == "yes")
+	}
+	return config
+}
+
+func (v *vlanInterface) netplanVLAN() string {
+	config := fmt.Sprintf("      id: %d\n      link: %s\n", v.id, netplanQuote(v.rawDevice))
+	var hwaddress net.HardwareAddr
+	switch c := v.config.(type) {
+	case configMethodStatic:
+		hwaddress = c.hwaddress
+	case configMethodDHCP:
+		hwaddress = c.hwaddress
+	}
+	if hwaddress != nil {
+		config += fmt.Sprintf("      macaddress: %s\n", netplanQuote(hwaddress.String()))
+	}
+	return config
+}
+
+// netplanQuote quotes the string for YAML. Go's quoting is a subset of
+// YAML's double-quoted style for the values used here.
+func netplanQuote(s string) string {
+	return strconv.Quote(s)
+}
@@ -0,0 +1,184 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/yaml"
+)
+
+type netplanTestMatch struct {
+	Name       string `yaml:"name"`
+	MACAddress string `yaml:"macaddress"`
+}
+
+type netplanTestRoute struct {
+	To  string `yaml:"to"`
+	Via string `yaml:"via"`
+}
+
+type netplanTestDevice struct {
+	Match       *netplanTestMatch `yaml:"match"`
+	Interfaces  []string          `yaml:"interfaces"`
+	Parameters  map[string]string `yaml:"parameters"`
+	ID          int               `yaml:"id"`
+	Link        string            `yaml:"link"`
+	MACAddress  string            `yaml:"macaddress"`
+	Addresses   []string          `yaml:"addresses"`
+	Nameservers struct {
+		Addresses []string `yaml:"addresses"`
+	} `yaml:"nameservers"`
+	Routes []netplanTestRoute `yaml:"routes"`
+	DHCP4  bool               `yaml:"dhcp4"`
+	DHCP6  bool               `yaml:"dhcp6"`
+}
+
+type netplanTestConfig struct {
+	Network struct {
+		Version   int                          `yaml:"version"`
+		Renderer  string                       `yaml:"renderer"`
+		Ethernets map[string]netplanTestDevice `yaml:"ethernets"`
+		Bonds     map[string]netplanTestDevice `yaml:"bonds"`
+		Bridges   map[string]netplanTestDevice `yaml:"bridges"`
+		VLANs     map[string]netplanTestDevice `yaml:"vlans"`
+	} `yaml:"network"`
+}
+
+func TestNetplanRoundTrip(t *testing.T) {
+	interfaces, err := ProcessDebianNetconf([]byte(`auto eth0
+iface eth0 inet static
+address 10.0.0.2
+netmask 255.255.255.0
+gateway 10.0.0.1
+dns-nameservers 8.8.8.8 8.8.4.4
+
+iface eth1 inet dhcp
+`))
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	var cfg netplanTestConfig
+	if err := yaml.Unmarshal([]byte(Netplan(interfaces)), &cfg); err != nil {
+		t.Fatalf("bad netplan: %v\n%s", err, Netplan(interfaces))
+	}
+
+	if cfg.Network.Version != 2 || cfg.Network.Renderer != "networkd" {
+		t.Errorf("bad version/renderer: %d, %q", cfg.Network.Version, cfg.Network.Renderer)
+	}
+
+	eth0 := netplanTestDevice{
+		Match:     &netplanTestMatch{Name: "eth0"},
+		Addresses: []string{"10.0.0.2/24"},
+		Routes:    []netplanTestRoute{{To: "0.0.0.0/0", Via: "10.0.0.1"}},
+	}
+	eth0.Nameservers.Addresses = []string{"8.8.8.8", "8.8.4.4"}
+	eth1 := netplanTestDevice{
+		Match: &netplanTestMatch{Name: "eth1"},
+		DHCP4: true,
+		DHCP6: true,
+	}
+	if want := map[string]netplanTestDevice{"eth0": eth0, "eth1": eth1}; !reflect.DeepEqual(want, cfg.Network.Ethernets) {
+		t.Errorf("bad ethernets:\nwant %+v\ngot  %+v", want, cfg.Network.Ethernets)
+	}
+	if cfg.Network.Bonds != nil || cfg.Network.VLANs != nil {
+		t.Errorf("bad bonds/vlans: want none, got %+v, %+v", cfg.Network.Bonds, cfg.Network.VLANs)
+	}
+}
+
+func TestNetplanBondsBridgesAndVLANs(t *testing.T) {
+	mac, _ := net.ParseMAC("01:23:45:67:89:ab")
+	vlanMAC, _ := net.ParseMAC("02:23:45:67:89:ab")
+
+	eth0 := &physicalInterface{logicalInterface{name: "eth0", hwaddr: mac, config: configMethodManual{}}}
+	noName := &physicalInterface{logicalInterface{hwaddr: vlanMAC, config: configMethodManual{}}}
+	bond0 := &bondInterface{
+		logicalInterface: logicalInterface{
+			name:   "bond0",
+			hwaddr: mac,
+			config: configMethodDHCP{},
+		},
+		slaves: []string{"eth0"},
+		options: map[string]string{
+			"Mode":             "802.3ad",
+			"LACPTransmitRate": "fast",
+			"MIIMonitorSec":    ".2",
+			"Unknown":          "ignored",
+		},
+	}
+	vlan10 := &vlanInterface{
+		logicalInterface: logicalInterface{
+			name:   "vlan10",
+			config: configMethodStatic{hwaddress: vlanMAC},
+		},
+		id:        10,
+		rawDevice: "bond0",
+	}
+	br0 := &bridgeInterface{
+		logicalInterface: logicalInterface{
+			name:   "br0",
+			config: configMethodDHCP{},
+		},
+		ports:   []string{"vlan10"},
+		options: map[string]string{"STP": "no"},
+	}
+
+	var cfg netplanTestConfig
+	out := Netplan([]InterfaceGenerator{eth0, noName, bond0, br0, vlan10})
+	if err := yaml.Unmarshal([]byte(out), &cfg); err != nil {
+		t.Fatalf("bad netplan: %v\n%s", err, out)
+	}
+
+	ethernets := map[string]netplanTestDevice{
+		"eth0":            {Match: &netplanTestMatch{Name: "eth0", MACAddress: "01:23:45:67:89:ab"}},
+		noName.Filename(): {Match: &netplanTestMatch{MACAddress: "02:23:45:67:89:ab"}},
+	}
+	if !reflect.DeepEqual(ethernets, cfg.Network.Ethernets) {
+		t.Errorf("bad ethernets:\nwant %+v\ngot  %+v", ethernets, cfg.Network.Ethernets)
+	}
+
+	bonds := map[string]netplanTestDevice{"bond0": {
+		Interfaces: []string{"eth0"},
+		MACAddress: "01:23:45:67:89:ab",
+		Parameters: map[string]string{"mode": "802.3ad", "lacp-rate": "fast", "mii-monitor-interval": "200"},
+		DHCP4:      true,
+		DHCP6:      true,
+	}}
+	if !reflect.DeepEqual(bonds, cfg.Network.Bonds) {
+		t.Errorf("bad bonds:\nwant %+v\ngot  %+v", bonds, cfg.Network.Bonds)
+	}
+
+	bridges := map[string]netplanTestDevice{"br0": {
+		Interfaces: []string{"vlan10"},
+		Parameters: map[string]string{"stp": "false"},
+		DHCP4:      true,
+		DHCP6:      true,
+	}}
+	if !reflect.DeepEqual(bridges, cfg.Network.Bridges) {
+		t.Errorf("bad bridges:\nwant %+v\ngot  %+v", bridges, cfg.Network.Bridges)
+	}
+
+	vlans := map[string]netplanTestDevice{"vlan10": {
+		ID:         10,
+		Link:       "bond0",
+		MACAddress: "02:23:45:67:89:ab",
+	}}
+	if !reflect.DeepEqual(vlans, cfg.Network.VLANs) {
+		t.Errorf("bad vlans:\nwant %+v\ngot  %+v", vlans, cfg.Network.VLANs)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/openstack"
+)
+
+func ProcessOpenStackNetconf(config openstack.NetworkData) ([]InterfaceGenerator, error) {
+	log.Println("Processing OpenStack network config")
+
+	var nameservers []net.IP
+	for _, service := range config.Services {
+		if service.Type == "dns" {
+			if ip := net.ParseIP(service.Address); ip == nil {
+				return nil, fmt.Errorf("could not parse %q as nameserver IP address", service.Address)
+			} else {
+				nameservers = append(nameservers, ip)
+			}
+		}
+	}
+
+	log.Println("Parsing links")
+	interfaceMap, err := parseOpenStackLinks(config.Links)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Parsed %d links\n", len(interfaceMap))
+
+	log.Println("Parsing networks")
+	if err := parseOpenStackNetworks(config.Networks, interfaceMap, nameservers); err != nil {
+		return nil, err
+	}
+
+	markConfigDepths(interfaceMap)
+	interfaces := make([]InterfaceGenerator, 0, len(interfaceMap))
+	for _, id := range sortedInterfaces(interfaceMap) {
+		interfaces = append(interfaces, interfaceMap[id])
+	}
+
+	log.Println("Processed OpenStack network config")
+	return interfaces, nil
+}
+
+// parseOpenStackLinks creates the interfaces for the given links, keyed by
+// the links' IDs. Physical links are matched by their MAC address while bonds
+// and VLANs are named after their link.
+func parseOpenStackLinks(links []openstack.Link) (map[string]networkInterface, error) {
+	interfaceMap := make(map[string]networkInterface)
+	for _, link := range links {
+		if _, ok := interfaceMap[link.ID]; ok {
+			return nil, fmt.Errorf("duplicate link %q", link.ID)
+		}
+		if link.MTU != 0 && (link.MTU < minMTU || link.MTU > maxMTU) {
+			return nil, fmt.Errorf("invalid mtu %d for link %q (must be between %d and %d)", link.MTU, link.ID, minMTU, maxMTU)
+		}
+
+		var hwaddr net.HardwareAddr
+		if link.EthernetMACAddress != "" {
+			var err error
+			if hwaddr, err = net.ParseMAC(link.EthernetMACAddress); err != nil {
+				return nil, err
+			}
+		}
+
+		switch link.Type {
+		case "bond":
+			options := map[string]string{}
+			if link.BondMode != "" {
+				options["mode"] = link.BondMode
+			}
+			if link.BondMIIMon != 0 {
+				options["miimon"] = strconv.Itoa(link.BondMIIMon)
+			}
+			interfaceMap[link.ID] = &bondInterface{
+				logicalInterface{name: link.ID, hwaddr: hwaddr, mtu: link.MTU, config: configMethodManual{}, children: []networkInterface{}},
+				link.BondLinks,
+				options,
+			}
+		case "vlan":
+			var vlanHwaddr net.HardwareAddr
+			if link.VLANMACAddress != "" {
+				var err error
+				if vlanHwaddr, err = net.ParseMAC(link.VLANMACAddress); err != nil {
+					return nil, err
+				}
+			}
+			if link.VLANID < 1 || link.VLANID > 4094 {
+				return nil, fmt.Errorf("vlan id %d of link %q is out of range (1-4094)", link.VLANID, link.ID)
+			}
+			interfaceMap[link.ID] = &vlanInterface{
+				logicalInterface{name: link.ID, mtu: link.MTU, config: configMethodStatic{hwaddress: vlanHwaddr}, children: []networkInterface{}},
+				link.VLANID,
+				link.VLANLink,
+			}
+		default:
+			if hwaddr == nil {
+				return nil, fmt.Errorf("link %q has no MAC address", link.ID)
+			}
+			interfaceMap[link.ID] = &physicalInterface{
+				logicalInterface{hwaddr: hwaddr, mtu: link.MTU, config: configMethodManual{}, children: []networkInterface{}},
+			}
+		}
+	}
+
+	for _, id := range sortedInterfaces(interfaceMap) {
+		var parents []string
+		switch i := interfaceMap[id].(type) {
+		case *bondInterface:
+			parents = i.slaves
+		case *vlanInterface:
+			parents = []string{i.rawDevice}
+		}
+		for _, parent := range parents {
+			p, ok := interfaceMap[parent]
+			if !ok {
+				return nil, fmt.Errorf("link %q refers to unknown link %q", id, parent)
+			}
+			switch p := p.(type) {
+			case *physicalInterface:
+				p.children = append(p.children, interfaceMap[id])
+			case *bondInterface:
+				p.children = append(p.children, interfaceMap[id])
+			case *vlanInterface:
+				p.children = append(p.children, interfaceMap[id])
+			}
+		}
+	}
+	return interfaceMap, nil
+}
+
+// parseOpenStackNetworks applies the networks to the interfaces of their
+// links. Static networks take precedence over dynamic ones on the same link.
+func parseOpenStackNetworks(networks []openstack.Network, interfaceMap map[string]networkInterface, nameservers []net.IP) error {
+	statics := make(map[string]configMethodStatic)
+	dynamic := make(map[string]bool)
+	for _, network := range networks {
+		if _, ok := interfaceMap[network.Link]; !ok {
+			return fmt.Errorf("network %q refers to unknown link %q", network.ID, network.Link)
+		}
+
+		switch network.Type {
+		case "ipv4", "ipv6":
+			config, ok := statics[network.Link]
+			if !ok {
+				config = configMethodStatic{
+					addresses:   []net.IPNet{},
+					nameservers: append([]net.IP{}, nameservers...),
+					routes:      []route{},
+				}
+			}
+
+			address, err := parseOpenStackAddress(network.IPAddress, network.Netmask)
+			if err != nil {
+				return fmt.Errorf("network %q: %v", network.ID, err)
+			}
+			config.addresses = append(config.addresses, address)
+
+			for _, r := range network.Routes {
+				destination, err := parseOpenStackAddress(r.Network, r.Netmask)
+				if err != nil {
+					return fmt.Errorf("network %q: %v", network.ID, err)
+				}
+				gateway := net.ParseIP(r.Gateway)
+				if gateway == nil {
+					return fmt.Errorf("network %q: could not parse %q as route gateway", network.ID, r.Gateway)
+				}
+				destination.IP = destination.IP.Mask(destination.Mask)
+				config.routes = append(config.routes, route{destination: destination, gateway: gateway})
+			}
+
+			for _, service := range network.Services {
+				if service.Type != "dns" {
+					continue
+				}
+				ip := net.ParseIP(service.Address)
+				if ip == nil {
+					return fmt.Errorf("network %q: could not parse %q as nameserver IP address", network.ID, service.Address)
+				}
+				config.nameservers = append(config.nameservers, ip)
+			}
+			statics[network.Link] = config
+		case "ipv4_dhcp", "ipv6_dhcp", "ipv6_slaac":
+			dynamic[network.Link] = true
+		default:
+			return fmt.Errorf("network %q has unsupported type %q", network.ID, network.Type)
+		}
+	}
+
+	for id, iface := range interfaceMap {
+		var config configMethod
+		if static, ok := statics[id]; ok {
+			if vlan, ok := iface.(*vlanInterface); ok {
+				static.hwaddress = vlan.config.(configMethodStatic).hwaddress
+			}
+			config = static
+		} else if dynamic[id] {
+			dhcp := configMethodDHCP{}
+			if vlan, ok := iface.(*vlanInterface); ok {
+				dhcp.hwaddress = vlan.config.(configMethodStatic).hwaddress
+			}
+			config = dhcp
+		} else {
+			continue
+		}
+
+		switch i := iface.(type) {
+		case *physicalInterface:
+			i.config = config
+		case *bondInterface:
+			i.config = config
+		case *vlanInterface:
+			i.config = config
+		}
+	}
+	return nil
+}
+
+// parseOpenStackAddress parses an address along with its netmask, which is
+// given either in dotted notation or, for IPv6, possibly as a prefix length.
+func parseOpenStackAddress(address, netmask string) (net.IPNet, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return net.IPNet{}, fmt.Errorf("could not parse %q as IP address", address)
+	}
+
+	var mask net.IPMask
+	if m := net.ParseIP(netmask); m != nil {
+		if ip.To4() != nil {
+			mask = net.IPMask(m.To4())
+		} else {
+			mask = net.IPMask(m.To16())
+		}
+	} else {
+		mask = parseNetmask(netmask, ip)
+	}
+	if mask == nil {
+		return net.IPNet{}, fmt.Errorf("could not parse %q as netmask of %q", netmask, address)
+	}
+	return net.IPNet{IP: ip, Mask: mask}, nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/datasource/metadata/openstack"
+)
+
+// openStackNetworkData is the network_data.json of an instance with a DHCP
+// configured interface and a static VLAN on top of a bond.
+const openStackNetworkData = `{
+  "links": [
+    {
+      "id": "interface2",
+      "type": "vif",
+      "ethernet_mac_address": "a0:36:9f:2c:e8:70",
+      "vif_id": "e1c90e4d-a3e3-4a4e-a6f3-1bd1b84c1a36",
+      "mtu": 1500
+    },
+    {
+      "id": "interface0",
+      "type": "phy",
+      "ethernet_mac_address": "a0:36:9f:2c:e8:80",
+      "mtu": 9000
+    },
+    {
+      "id": "interface1",
+      "type": "phy",
+      "ethernet_mac_address": "a0:36:9f:2c:e8:81",
+      "mtu": 9000
+    },
+    {
+      "id": "bond0",
+      "type": "bond",
+      "bond_links": ["interface0", "interface1"],
+      "ethernet_mac_address": "a0:36:9f:2c:e8:82",
+      "bond_mode": "802.3ad",
+      "bond_xmit_hash_policy": "layer3+4",
+      "bond_miimon": 100
+    },
+    {
+      "id": "vlan0",
+      "type": "vlan",
+      "vlan_link": "bond0",
+      "vlan_id": 101,
+      "vlan_mac_address": "a0:36:9f:2c:e8:83",
+      "vif_id": "1bcf8bd8-3e1a-4b3f-9d0e-6b5e41d1f0a1"
+    }
+  ],
+  "networks": [
+    {
+      "id": "private-ipv4",
+      "type": "ipv4_dhcp",
+      "link": "interface2",
+      "network_id": "da5bb487-5193-4a65-a3df-4a0055a8c0d7"
+    },
+    {
+      "id": "publicnet-ipv4",
+      "type": "ipv4",
+      "link": "vlan0",
+      "ip_address": "23.253.157.244",
+      "netmask": "255.255.255.0",
+      "routes": [
+        {
+          "network": "0.0.0.0",
+          "netmask": "0.0.0.0",
+          "gateway": "23.253.157.1"
+        },
+        {
+          "network": "10.0.0.0",
+          "netmask": "255.0.0.0",
+          "gateway": "23.253.157.254"
+        }
+      ],
+      "network_id": "62611d6f-66cb-4270-8b1f-503ef0dd4736"
+    },
+    {
+      "id": "publicnet-ipv6",
+      "type": "ipv6",
+      "link": "vlan0",
+      "ip_address": "2001:cdba::3257:9652",
+      "netmask": "ffff:ffff:ffff:ffff::",
+      "routes": [
+        {
+          "network": "::",
+          "netmask": "::",
+          "gateway": "2001:cdba::1"
+        }
+      ],
+      "services": [
+        {
+          "type": "dns",
+          "address": "2001:4860:4860::8888"
+        }
+      ],
+      "network_id": "62611d6f-66cb-4270-8b1f-503ef0dd4736"
+    }
+  ],
+  "services": [
+    {
+      "type": "dns",
+      "address": "8.8.8.8"
+    }
+  ]
+}`
+
+func TestProcessOpenStackNetconf(t *testing.T) {
+	var cfg openstack.NetworkData
+	if err := json.Unmarshal([]byte(openStackNetworkData), &cfg); err != nil {
+		t.Fatalf("bad network data: %v", err)
+	}
+	ifaces, err := ProcessOpenStackNetconf(cfg)
+	if err != nil {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, i := range ifaces {
+		for ext, content := range map[string]string{"netdev": i.Netdev(), "network": i.Network()} {
+			if content != "" {
+				files[i.Filename()+"."+ext] = content
+			}
+		}
+	}
+
+	expect := map[string]string{
+		"00-a0:36:9f:2c:e8:70.network": "[Match]\nMACAddress=a0:36:9f:2c:e8:70\n\n[Link]\nMTUBytes=1500\n\n[Network]\nDHCP=true\n",
+		"02-a0:36:9f:2c:e8:80.network": "[Match]\nMACAddress=a0:36:9f:2c:e8:80\n\n[Link]\nMTUBytes=9000\n\n[Network]\nBond=bond0\n",
+		"02-a0:36:9f:2c:e8:81.network": "[Match]\nMACAddress=a0:36:9f:2c:e8:81\n\n[Link]\nMTUBytes=9000\n\n[Network]\nBond=bond0\n",
+		"01-bond0.netdev":              "[NetDev]\nKind=bond\nName=bond0\nMACAddress=a0:36:9f:2c:e8:82\n\n[Bond]\nMIIMonitorSec=100ms\nMode=802.3ad\n",
+		"01-bond0.network":             "[Match]\nName=bond0\nMACAddress=a0:36:9f:2c:e8:82\n\n[Network]\nVLAN=vlan0\n",
+		"00-vlan0.netdev":              "[NetDev]\nKind=vlan\nName=vlan0\nMACAddress=a0:36:9f:2c:e8:83\n\n[VLAN]\nId=101\n",
+		"00-vlan0.network": "[Match]\nName=vlan0\n\n[Network]\nDNS=8.8.8.8\nDNS=2001:4860:4860::8888\n" +
+			"\n[Address]\nAddress=23.253.157.244/24\n" +
+			"\n[Address]\nAddress=2001:cdba::3257:9652/64\n" +
+			"\n[Route]\nDestination=0.0.0.0/0\nGateway=23.253.157.1\n" +
+			"\n[Route]\nDestination=10.0.0.0/8\nGateway=23.253.157.254\n" +
+			"\n[Route]\nDestination=::/0\nGateway=2001:cdba::1\n",
+	}
+	if !reflect.DeepEqual(expect, files) {
+		t.Fatalf("bad files:\nwant %q\ngot  %q", expect, files)
+	}
+}
+
+func TestProcessOpenStackNetconfErrors(t *testing.T) {
+	for _, tt := range []struct {
+		cfg openstack.NetworkData
+		err error
+	}{
+		{
+			cfg: openstack.NetworkData{Services: []openstack.Service{{Type: "dns", Address: "bad"}}},
+			err: errors.New(`could not parse "bad" as nameserver IP address`),
+		},
+		{
+			cfg: openstack.NetworkData{Links: []openstack.Link{{ID: "interface0", Type: "phy"}}},
+			err: errors.New(`link "interface0" has no MAC address`),
+		},
+		{
+			cfg: openstack.NetworkData{Links: []openstack.Link{{ID: "vlan0", Type: "vlan", VLANID: 10, VLANLink: "interface0"}}},
+			err: errors.New(`link "vlan0" refers to unknown link "interface0"`),
+		},
+		{
+			cfg: openstack.NetworkData{Links: []openstack.Link{{ID: "vlan0", Type: "vlan", VLANID: 4095}}},
+			err: errors.New(`vlan id 4095 of link "vlan0" is out of range (1-4094)`),
+		},
+		{
+			cfg: openstack.NetworkData{Networks: []openstack.Network{{ID: "net0", Type: "ipv4", Link: "interface0"}}},
+			err: errors.New(`network "net0" refers to unknown link "interface0"`),
+		},
+		{
+			cfg: openstack.NetworkData{
+				Links:    []openstack.Link{{ID: "interface0", Type: "phy", EthernetMACAddress: "a0:36:9f:2c:e8:80"}},
+				Networks: []openstack.Network{{ID: "net0", Type: "ipv4", Link: "interface0", IPAddress: "10.0.0.2", Netmask: "bad"}},
+			},
+			err: errors.New(`network "net0": could not parse "bad" as netmask of "10.0.0.2"`),
+		},
+		{
+			cfg: openstack.NetworkData{
+				Links:    []openstack.Link{{ID: "interface0", Type: "phy", EthernetMACAddress: "a0:36:9f:2c:e8:80"}},
+				Networks: []openstack.Network{{ID: "net0", Type: "ipv5", Link: "interface0"}},
+			},
+			err: errors.New(`network "net0" has unsupported type "ipv5"`),
+		},
+	} {
+		_, err := ProcessOpenStackNetconf(tt.cfg)
+		if !errorsEqual(tt.err, err) {
+			t.Errorf("bad error (%+v): want %v, got %v", tt.cfg, tt.err, err)
+		}
+	}
+}
@@ -41,11 +41,18 @@ const (
 	interfaceBond = interfaceKind(iota)
 	interfacePhysical
 	interfaceVLAN
+	interfaceBridge
+)
+
+const (
+	minMTU = 68
+	maxMTU = 65536
 )
 
 type route struct {
 	destination net.IPNet
 	gateway     net.IP
+	metric      int
 }
 
 type configMethod interface{}
@@ -55,6 +62,8 @@ type configMethodStatic struct {
 	nameservers []net.IP
 	routes      []route
 	hwaddress   net.HardwareAddr
+	// acceptRA is the IPv6AcceptRA= setting ("yes" or "no"), if any.
+	acceptRA string
 }
 
 type configMethodLoopback struct{}
@@ -199,6 +208,15 @@ func parseInterfaceStanza(attributes []string, options []string) (*stanzaInterfa
 			}
 		} else {
 			tokens := strings.Fields(option)
+			// address may be repeated to assign several addresses, each
+			// line carrying exactly one.
+			if tokens[0] == "address" {
+				if len(tokens) != 2 {
+					return nil, fmt.Errorf("malformed static network config for %q", iface)
+				}
+				optionMap["address"] = append(optionMap["address"], tokens[1])
+				continue
+			}
 			optionMap[tokens[0]] = tokens[1:]
 		}
 	}
@@ -207,34 +225,57 @@ func parseInterfaceStanza(attributes []string, options []string) (*stanzaInterfa
 	switch confMethod {
 	case "static":
 		config := configMethodStatic{
-			addresses:   make([]net.IPNet, 1),
+			addresses:   make([]net.IPNet, 0),
 			routes:      make([]route, 0),
 			nameservers: make([]net.IP, 0),
 		}
-		if addresses, ok := optionMap["address"]; ok {
-			if len(addresses) == 1 {
-				config.addresses[0].IP = net.ParseIP(addresses[0])
+		for _, address := range optionMap["address"] {
+			addr := net.IPNet{}
+			if ip, network, err := net.ParseCIDR(address); err == nil {
+				addr = net.IPNet{IP: ip, Mask: network.Mask}
+			} else {
+				addr.IP = net.ParseIP(address)
+				if netmasks, ok := optionMap["netmask"]; ok && len(netmasks) == 1 {
+					addr.Mask = parseNetmask(netmasks[0], addr.IP)
+				}
 			}
-		}
-		if netmasks, ok := optionMap["netmask"]; ok {
-			if len(netmasks) == 1 {
-				config.addresses[0].Mask = net.IPMask(net.ParseIP(netmasks[0]).To4())
+			if addr.IP == nil || addr.Mask == nil {
+				return nil, fmt.Errorf("malformed static network config for %q", iface)
 			}
+			config.addresses = append(config.addresses, addr)
 		}
-		if config.addresses[0].IP == nil || config.addresses[0].Mask == nil {
+		if len(config.addresses) == 0 {
 			return nil, fmt.Errorf("malformed static network config for %q", iface)
 		}
 		if gateways, ok := optionMap["gateway"]; ok {
 			if len(gateways) == 1 {
+				gateway := net.ParseIP(gateways[0])
+				destination := net.IPNet{
+					IP:   net.IPv4(0, 0, 0, 0),
+					Mask: net.IPv4Mask(0, 0, 0, 0),
+				}
+				if gateway != nil && gateway.To4() == nil {
+					destination = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)}
+				}
 				config.routes = append(config.routes, route{
-					destination: net.IPNet{
-						IP:   net.IPv4(0, 0, 0, 0),
-						Mask: net.IPv4Mask(0, 0, 0, 0),
-					},
-					gateway: net.ParseIP(gateways[0]),
+					destination: destination,
+					gateway:     gateway,
 				})
 			}
 		}
+		if acceptRA, ok := optionMap["accept_ra"]; ok {
+			if len(acceptRA) != 1 {
+				return nil, fmt.Errorf("malformed accept_ra option for %q", iface)
+			}
+			switch acceptRA[0] {
+			case "0":
+				config.acceptRA = "no"
+			case "1", "2":
+				config.acceptRA = "yes"
+			default:
+				return nil, fmt.Errorf("invalid accept_ra option %q for %q", acceptRA[0], iface)
+			}
+		}
 		if hwaddress, err := parseHwaddress(optionMap, iface); err == nil {
 			config.hwaddress = hwaddress
 		} else {
@@ -252,13 +293,21 @@ func parseInterfaceStanza(attributes []string, options []string) (*stanzaInterfa
 					case "-net":
 						if _, dst, err := net.ParseCIDR(fields[i+1]); err == nil {
 							route.destination = *dst
-						} else {
-							route.destination.IP = net.ParseIP(fields[i+1])
+						} else if route.destination.IP = net.ParseIP(fields[i+1]); route.destination.IP == nil {
+							return nil, fmt.Errorf("invalid route destination %q for %q", fields[i+1], iface)
 						}
 					case "netmask":
 						route.destination.Mask = net.IPMask(net.ParseIP(fields[i+1]).To4())
 					case "gw":
-						route.gateway = net.ParseIP(fields[i+1])
+						if route.gateway = net.ParseIP(fields[i+1]); route.gateway == nil {
+							return nil, fmt.Errorf("invalid route gateway %q for %q", fields[i+1], iface)
+						}
+					case "metric":
+						metric, err := strconv.Atoi(fields[i+1])
+						if err != nil || metric < 0 {
+							return nil, fmt.Errorf("invalid route metric %q for %q", fields[i+1], iface)
+						}
+						route.metric = metric
 					}
 				}
 				if route.destination.IP != nil && route.destination.Mask != nil && route.gateway != nil {
@@ -283,6 +332,15 @@ func parseInterfaceStanza(attributes []string, options []string) (*stanzaInterfa
 		return nil, fmt.Errorf("invalid config method %q", confMethod)
 	}
 
+	if mtu, ok := optionMap["mtu"]; ok {
+		if len(mtu) != 1 {
+			return nil, fmt.Errorf("malformed mtu option for %q", iface)
+		}
+		if n, err := strconv.Atoi(mtu[0]); err != nil || n < minMTU || n > maxMTU {
+			return nil, fmt.Errorf("invalid mtu %q for %q (must be between %d and %d)", mtu[0], iface, minMTU, maxMTU)
+		}
+	}
+
 	if _, ok := optionMap["vlan_raw_device"]; ok {
 		return parseVLANStanza(iface, conf, attributes, optionMap)
 	}
@@ -295,9 +353,32 @@ func parseInterfaceStanza(attributes []string, options []string) (*stanzaInterfa
 		return parseBondStanza(iface, conf, attributes, optionMap)
 	}
 
+	if _, ok := optionMap["bridge_ports"]; ok {
+		return parseBridgeStanza(iface, conf, attributes, optionMap)
+	}
+
 	return parsePhysicalStanza(iface, conf, attributes, optionMap)
 }
 
+// parseNetmask parses either a dotted IPv4 netmask or a prefix length, which
+// is the only form used for IPv6 addresses.
+func parseNetmask(netmask string, ip net.IP) net.IPMask {
+	bits := 8 * net.IPv4len
+	if ip != nil && ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	}
+	if n, err := strconv.Atoi(netmask); err == nil {
+		if n < 0 || n > bits {
+			return nil
+		}
+		return net.CIDRMask(n, bits)
+	}
+	if bits != 8*net.IPv4len {
+		return nil
+	}
+	return net.IPMask(net.ParseIP(netmask).To4())
+}
+
 func parseHwaddress(options map[string][]string, iface string) (net.HardwareAddr, error) {
 	if hwaddress, ok := options["hwaddress"]; ok && len(hwaddress) == 2 {
 		switch hwaddress[0] {
@@ -312,9 +393,46 @@ func parseHwaddress(options map[string][]string, iface string) (net.HardwareAddr
 }
 
 func parseBondStanza(iface string, conf configMethod, attributes []string, options map[string][]string) (*stanzaInterface, error) {
+	// "bond-slaves none" leaves the members to declare the bond themselves
+	// using bond-master.
+	if members, ok := options["bond-slaves"]; ok {
+		slaves := []string{}
+		for _, slave := range members {
+			if slave != "none" {
+				slaves = append(slaves, slave)
+			}
+		}
+		options["bond-slaves"] = slaves
+	}
 	return &stanzaInterface{name: iface, kind: interfaceBond, configMethod: conf, options: options}, nil
 }
 
+func parseBridgeStanza(iface string, conf configMethod, attributes []string, options map[string][]string) (*stanzaInterface, error) {
+	// "bridge_ports none" declares a bridge without any ports.
+	ports := []string{}
+	for _, port := range options["bridge_ports"] {
+		if port != "none" {
+			ports = append(ports, port)
+		}
+	}
+	options["bridge_ports"] = ports
+
+	if stp, ok := options["bridge_stp"]; ok {
+		if len(stp) != 1 {
+			return nil, fmt.Errorf("malformed bridge_stp option for %q", iface)
+		}
+		switch stp[0] {
+		case "on", "yes":
+			options["bridge_stp"] = []string{"yes"}
+		case "off", "no":
+			options["bridge_stp"] = []string{"no"}
+		default:
+			return nil, fmt.Errorf("invalid bridge_stp option %q for %q", stp[0], iface)
+		}
+	}
+	return &stanzaInterface{name: iface, kind: interfaceBridge, configMethod: conf, options: options}, nil
+}
+
 func parsePhysicalStanza(iface string, conf configMethod, attributes []string, options map[string][]string) (*stanzaInterface, error) {
 	return &stanzaInterface{name: iface, kind: interfacePhysical, configMethod: conf, options: options}, nil
 }
@@ -330,11 +448,19 @@ func parseVLANStanza(iface string, conf configMethod, attributes []string, optio
 		return nil, fmt.Errorf("malformed vlan name %q", iface)
 	}
 
-	if _, err := strconv.Atoi(id); err != nil {
+	n, err := strconv.Atoi(id)
+	if err != nil {
 		return nil, fmt.Errorf("malformed vlan name %q", iface)
 	}
+	if n < 1 || n > 4094 {
+		return nil, fmt.Errorf("vlan id %d of %q is out of range (1-4094)", n, iface)
+	}
 	options["id"] = []string{id}
 	options["raw_device"] = options["vlan_raw_device"]
+	if i := strings.LastIndex(iface, "."); len(options["raw_device"]) == 0 && i > 0 {
+		// The parent of e.g. eth0.10 is eth0.
+		options["raw_device"] = []string{iface[:i]}
+	}
 
 	return &stanzaInterface{name: iface, kind: interfaceVLAN, configMethod: conf, options: options}, nil
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 )
 
 func ProcessVMwareNetconf(config map[string]string) ([]InterfaceGenerator, error) {
@@ -148,9 +149,17 @@ func processRouteConfig(config map[string]string, prefix string) (routes []route
 			return nil, err
 		}
 
+		var metric int
+		if metricStr, ok := config[prefix+"metric"]; ok {
+			if metric, err = strconv.Atoi(metricStr); err != nil || metric < 0 {
+				return nil, fmt.Errorf("invalid metric: %q", metricStr)
+			}
+		}
+
 		routes = append(routes, route{
 			destination: *destination,
 			gateway:     gateway,
+			metric:      metric,
 		})
 	}
 
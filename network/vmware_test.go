@@ -288,6 +288,15 @@ func TestProcessRouteConfig(t *testing.T) {
 
 			routes: []route{{destination: net.IPNet{IP: net.IPv6zero, Mask: net.IPMask(net.IPv6zero)}, gateway: net.ParseIP("fe00::1")}},
 		},
+		{
+			config: map[string]string{
+				"route.0.gateway":     "10.0.0.1",
+				"route.0.destination": "0.0.0.0/0",
+				"route.0.metric":      "100",
+			},
+
+			routes: []route{{destination: net.IPNet{IP: net.IP(net.CIDRMask(0, net.IPv4len*8)), Mask: net.CIDRMask(0, net.IPv4len*8)}, gateway: net.ParseIP("10.0.0.1"), metric: 100}},
+		},
 
 		// invalid
 		{
@@ -298,6 +307,15 @@ func TestProcessRouteConfig(t *testing.T) {
 
 			err: errors.New(`invalid gateway: "test gateway"`),
 		},
+		{
+			config: map[string]string{
+				"route.0.gateway":     "10.0.0.1",
+				"route.0.destination": "0.0.0.0/0",
+				"route.0.metric":      "low",
+			},
+
+			err: errors.New(`invalid metric: "low"`),
+		},
 		{
 			config: map[string]string{
 				"route.0.gateway":     "10.0.0.1",
@@ -19,9 +19,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
 	neturl "net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,14 +33,27 @@ const (
 	HTTP_4xx = 4
 )
 
+var (
+	// DefaultInitialBackoff and DefaultMaxRetries are the retry settings of
+	// the clients returned by NewHttpClient.
+	DefaultInitialBackoff = 50 * time.Millisecond
+	DefaultMaxRetries     = 15
+
+	// DefaultUserAgent is the User-Agent header sent by the clients returned
+	// by NewHttpClient.
+	DefaultUserAgent = "coreos-cloudinit"
+)
+
 type Err error
 
 type ErrTimeout struct {
 	Err
 }
 
+// ErrNotFound is returned for 4xx responses, along with their status code.
 type ErrNotFound struct {
 	Err
+	StatusCode int
 }
 
 type ErrInvalid struct {
@@ -65,7 +81,13 @@ type HttpClient struct {
 	// Whether or not to skip TLS verification. Defaults to false
 	SkipTLS bool
 
-	client *http.Client
+	// Headers sent along with every request. Defaults to the User-Agent
+	// given by DefaultUserAgent
+	Header http.Header
+
+	client     *http.Client
+	cancel     chan struct{}
+	cancelOnce sync.Once
 }
 
 type Getter interface {
@@ -75,13 +97,16 @@ type Getter interface {
 
 func NewHttpClient() *HttpClient {
 	hc := &HttpClient{
-		InitialBackoff: 50 * time.Millisecond,
+		InitialBackoff: DefaultInitialBackoff,
 		MaxBackoff:     time.Second * 5,
-		MaxRetries:     15,
+		MaxRetries:     DefaultMaxRetries,
 		SkipTLS:        false,
+		Header:         http.Header{"User-Agent": {DefaultUserAgent}},
 		client: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{Proxy: DefaultProxy},
 		},
+		cancel: make(chan struct{}),
 	}
 
 	return hc
@@ -95,7 +120,18 @@ func ExpBackoff(interval, max time.Duration) time.Duration {
 	return interval
 }
 
-// GetRetry fetches a given URL with support for exponential backoff and maximum retries
+// Jitter returns a random duration between half of the given duration and
+// the duration itself, so that clients don't retry in lockstep. Durations which
+// aren't positive are returned unchanged.
+func Jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// GetRetry fetches a given URL with support for exponential backoff and
+// maximum retries. Only server errors (5xx) and network errors are retried.
 func (h *HttpClient) GetRetry(rawurl string) ([]byte, error) {
 	if rawurl == "" {
 		return nil, ErrInvalid{errors.New("URL is empty. Skipping.")}
@@ -131,21 +167,54 @@ func (h *HttpClient) GetRetry(rawurl string) ([]byte, error) {
 		}
 
 		duration = ExpBackoff(duration, h.MaxBackoff)
-		log.Printf("Sleeping for %v...", duration)
-		time.Sleep(duration)
+		sleep := Jitter(duration)
+		log.Printf("Sleeping for %v...", sleep)
+		select {
+		case <-h.cancel:
+			return nil, ErrNetwork{errors.New("Request canceled")}
+		case <-time.After(sleep):
+		}
 	}
 
 	return nil, ErrTimeout{fmt.Errorf("Unable to fetch data. Maximum retries reached: %d", h.MaxRetries)}
 }
 
+// Cancel aborts any in-flight requests and causes all further requests made
+// by the client to fail.
+func (h *HttpClient) Cancel() {
+	h.cancelOnce.Do(func() {
+		if h.cancel != nil {
+			close(h.cancel)
+		}
+	})
+}
+
 func (h *HttpClient) Get(dataURL string) ([]byte, error) {
-	if resp, err := h.client.Get(dataURL); err == nil {
+	return h.Request("GET", dataURL, nil)
+}
+
+// Request performs a single request of the given method against dataURL,
+// sending the client's default headers in addition to the ones provided.
+func (h *HttpClient) Request(method, dataURL string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(method, dataURL, nil)
+	if err != nil {
+		return nil, ErrInvalid{err}
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Cancel = h.cancel
+
+	if resp, err := h.client.Do(req); err == nil {
 		defer resp.Body.Close()
 		switch resp.StatusCode / 100 {
 		case HTTP_2xx:
 			return ioutil.ReadAll(resp.Body)
 		case HTTP_4xx:
-			return nil, ErrNotFound{fmt.Errorf("Not found. HTTP status code: %d", resp.StatusCode)}
+			return nil, ErrNotFound{fmt.Errorf("Not found. HTTP status code: %d", resp.StatusCode), resp.StatusCode}
 		default:
 			return nil, ErrServer{fmt.Errorf("Server error. HTTP status code: %d", resp.StatusCode)}
 		}
@@ -153,3 +222,15 @@ func (h *HttpClient) Get(dataURL string) ([]byte, error) {
 		return nil, ErrNetwork{fmt.Errorf("Unable to fetch data: %s", err.Error())}
 	}
 }
+
+// SetCheckRedirect sets the policy used to decide whether redirects are
+// followed (see http.Client).
+func (h *HttpClient) SetCheckRedirect(check func(req *http.Request, via []*http.Request) error) {
+	h.client.CheckRedirect = check
+}
+
+// SetDial makes the client open its connections using the given function
+// instead of the default dialer.
+func (h *HttpClient) SetDial(dial func(network, addr string) (net.Conn, error)) {
+	h.client.Transport.(*http.Transport).Dial = dial
+}
@@ -38,6 +38,21 @@ func TestExpBackoff(t *testing.T) {
 	}
 }
 
+func TestJitter(t *testing.T) {
+	for _, d := range []time.Duration{time.Nanosecond, time.Millisecond, time.Hour} {
+		for i := 0; i < 100; i++ {
+			if j := Jitter(d); j < d/2 || j > d {
+				t.Fatalf("bad jitter (%v): want between %v and %v, got %v", d, d/2, d, j)
+			}
+		}
+	}
+	for _, d := range []time.Duration{0, -time.Nanosecond, -time.Second} {
+		if j := Jitter(d); j != d {
+			t.Errorf("bad jitter (%v): want %v, got %v", d, d, j)
+		}
+	}
+}
+
 // Test exponential backoff and that it continues retrying if a 5xx response is
 // received
 func TestGetURLExpBackOff(t *testing.T) {
@@ -152,3 +167,53 @@ func TestGetMalformedURL(t *testing.T) {
 		}
 	}
 }
+
+// Test that the client gives up after the maximum number of retries when the
+// server keeps failing, and that connection errors are retried.
+func TestGetURLMaxRetries(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "", 503)
+	}))
+	defer ts.Close()
+
+	client := NewHttpClient()
+	client.InitialBackoff = time.Millisecond
+	client.MaxRetries = 3
+
+	if _, err := client.GetRetry(ts.URL); err == nil {
+		t.Errorf("bad error: want ErrTimeout, got nil")
+	} else if _, ok := err.(ErrTimeout); !ok {
+		t.Errorf("bad error: want ErrTimeout, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("bad number of attempts: want %d, got %d", 3, attempts)
+	}
+
+	// nothing is listening on the URL of a closed server
+	url := ts.URL
+	ts.Close()
+	if _, err := client.GetRetry(url); err == nil {
+		t.Errorf("bad error: want ErrTimeout, got nil")
+	} else if _, ok := err.(ErrTimeout); !ok {
+		t.Errorf("bad error: want ErrTimeout, got %v", err)
+	}
+}
+
+func TestNewHttpClientDefaults(t *testing.T) {
+	defer func(b time.Duration, r int, ua string) {
+		DefaultInitialBackoff, DefaultMaxRetries, DefaultUserAgent = b, r, ua
+	}(DefaultInitialBackoff, DefaultMaxRetries, DefaultUserAgent)
+
+	DefaultInitialBackoff = time.Second
+	DefaultMaxRetries = 2
+	DefaultUserAgent = "coreos-cloudinit/test"
+	client := NewHttpClient()
+	if client.InitialBackoff != time.Second || client.MaxRetries != 2 {
+		t.Errorf("bad client settings: want %v and %d, got %v and %d", time.Second, 2, client.InitialBackoff, client.MaxRetries)
+	}
+	if ua := client.Header.Get("User-Agent"); ua != "coreos-cloudinit/test" {
+		t.Errorf("bad user agent: want %q, got %q", "coreos-cloudinit/test", ua)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// DefaultProxy selects the proxy used by the clients returned by
+// NewHttpClient. By default, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables are honored, save for link-local and loopback
+// addresses.
+var DefaultProxy = NewProxy(nil, nil)
+
+// NewProxy returns a function selecting the proxy of a request (see
+// http.Transport) which sends requests through the given proxy or, if it is
+// nil, the proxy given by the environment. Requests to loopback and
+// link-local addresses (such as the 169.254.169.254 metadata service), which
+// no proxy could reach, and to hosts matching one of the noProxy entries are
+// never proxied. An entry is an IP address, a CIDR network or a domain, which
+// also matches its subdomains.
+func NewProxy(proxy *neturl.URL, noProxy []string) func(*http.Request) (*neturl.URL, error) {
+	return func(req *http.Request) (*neturl.URL, error) {
+		if bypassProxy(req.URL.Host, noProxy) {
+			return nil, nil
+		}
+		if proxy != nil {
+			return proxy, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+}
+
+// ParseProxy parses the URL of a proxy, which defaults to the http scheme.
+func ParseProxy(proxy string) (*neturl.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	url, err := neturl.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if url.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q", proxy)
+	}
+	return url, nil
+}
+
+// bypassProxy reports whether requests to host (optionally including a port)
+// must not be proxied.
+func bypassProxy(host string, noProxy []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	if ip != nil && (ip.IsLoopback() || ip.IsLinkLocalUnicast()) {
+		return true
+	}
+
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if entryIP := net.ParseIP(entry); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
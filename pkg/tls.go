@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// NewTLSConfig returns a TLS configuration which only trusts the CA
+// certificate(s) in the PEM encoded caFile and, if certFile and keyFile are
+// given, presents that key pair as client certificate.
+func NewTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in %q", caFile)
+		}
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("a client certificate requires both a certificate and a key file")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// SetTLSConfig makes the client use the given TLS configuration for all
+// of its requests.
+func (h *HttpClient) SetTLSConfig(config *tls.Config) {
+	h.client.Transport.(*http.Transport).TLSClientConfig = config
+}
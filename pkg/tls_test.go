@@ -0,0 +1,54 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	invalid := path.Join(dir, "invalid.pem")
+	if err := ioutil.WriteFile(invalid, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+
+	for _, tt := range []struct {
+		caFile   string
+		certFile string
+		keyFile  string
+
+		err bool
+	}{
+		{},
+		{caFile: path.Join(dir, "missing.pem"), err: true},
+		{caFile: invalid, err: true},
+		{certFile: invalid, err: true},
+		{keyFile: invalid, err: true},
+		{certFile: invalid, keyFile: invalid, err: true},
+	} {
+		if _, err := NewTLSConfig(tt.caFile, tt.certFile, tt.keyFile); tt.err != (err != nil) {
+			t.Errorf("bad error (%q, %q, %q): want %t, got %v", tt.caFile, tt.certFile, tt.keyFile, tt.err, err)
+		}
+	}
+}
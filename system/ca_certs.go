@@ -0,0 +1,110 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// caTrustLayout describes where an image expects additional trust anchors
+// and how its certificate bundle is regenerated from them.
+type caTrustLayout struct {
+	dir     string
+	command []string
+}
+
+// caTrustLayouts are tried in order; the last one is the default. p11-kit
+// based images (e.g. Fedora) also have /etc/ssl/certs, so they come first.
+var caTrustLayouts = []caTrustLayout{
+	{dir: "etc/pki/ca-trust/source/anchors", command: []string{"update-ca-trust", "extract"}},
+	{dir: "etc/ssl/certs", command: []string{"update-ca-certificates"}},
+}
+
+// CACerts is a top-level structure which embeds its underlying
+// configuration, config.CACerts, and provides the system-specific Files()
+// and Update().
+type CACerts struct {
+	config.CACerts
+}
+
+func (c CACerts) configured() bool {
+	return len(c.Trusted) > 0 || c.RemoveDefaults
+}
+
+func detectCATrustLayout(root string) caTrustLayout {
+	for _, l := range caTrustLayouts[:len(caTrustLayouts)-1] {
+		if info, err := os.Stat(path.Join(root, l.dir)); err == nil && info.IsDir() {
+			return l
+		}
+	}
+	return caTrustLayouts[len(caTrustLayouts)-1]
+}
+
+// Files generates a file for each of the trusted certificates in the trust
+// anchor directory of the image beneath root. Certificates which fail to
+// parse are skipped with a warning. If the defaults are to be removed, an
+// empty /etc/ca-certificates.conf is generated as well, which deselects the
+// certificates shipped with the image.
+func (c CACerts) Files(root string) []File {
+	if !c.configured() {
+		return nil
+	}
+
+	layout := detectCATrustLayout(root)
+	var files []File
+	for i, cert := range c.Trusted {
+		if err := c.CheckCertificate(cert); err != nil {
+			log.Printf("Warning: skipping trusted CA certificate %d: %v", i, err)
+			continue
+		}
+		files = append(files, File{config.File{
+			Path:               path.Join(layout.dir, fmt.Sprintf("cloudinit-%d.pem", i)),
+			RawFilePermissions: "0644",
+			Content:            cert,
+		}})
+	}
+
+	if c.RemoveDefaults {
+		if layout.dir == "etc/ssl/certs" {
+			files = append(files, File{config.File{
+				Path:               path.Join("etc", "ca-certificates.conf"),
+				RawFilePermissions: "0644",
+				Content:            "# The default CA certificates have been removed by coreos-cloudinit.\n",
+			}})
+		} else {
+			log.Printf("Warning: removing the default CA certificates is not supported on this image")
+		}
+	}
+	return files
+}
+
+// Update regenerates the certificate bundle of the image beneath root.
+func (c CACerts) Update(root string) error {
+	if !c.configured() {
+		return nil
+	}
+
+	command := detectCATrustLayout(root).command
+	if out, err := exec.Command(command[0], command[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed with %v: %s", command[0], err, out)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func testCertificate(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "coreos-cloudinit test CA"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCACertsFiles(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert := testCertificate(t)
+	p11kit := path.Join(dir, "p11-kit")
+	if err := os.MkdirAll(path.Join(p11kit, "etc", "pki", "ca-trust", "source", "anchors"), 0755); err != nil {
+		t.Fatalf("Unable to create anchors directory: %v", err)
+	}
+
+	for _, tt := range []struct {
+		config config.CACerts
+		root   string
+		files  []File
+	}{
+		{
+			config: config.CACerts{},
+			root:   dir,
+		},
+		{
+			config: config.CACerts{Trusted: []string{"not a certificate", cert}},
+			root:   dir,
+			files: []File{{config.File{
+				Path:               "etc/ssl/certs/cloudinit-1.pem",
+				RawFilePermissions: "0644",
+				Content:            cert,
+			}}},
+		},
+		{
+			config: config.CACerts{Trusted: []string{cert}, RemoveDefaults: true},
+			root:   dir,
+			files: []File{
+				{config.File{
+					Path:               "etc/ssl/certs/cloudinit-0.pem",
+					RawFilePermissions: "0644",
+					Content:            cert,
+				}},
+				{config.File{
+					Path:               "etc/ca-certificates.conf",
+					RawFilePermissions: "0644",
+					Content:            "# The default CA certificates have been removed by coreos-cloudinit.\n",
+				}},
+			},
+		},
+		{
+			config: config.CACerts{Trusted: []string{cert}, RemoveDefaults: true},
+			root:   p11kit,
+			files: []File{{config.File{
+				Path:               "etc/pki/ca-trust/source/anchors/cloudinit-0.pem",
+				RawFilePermissions: "0644",
+				Content:            cert,
+			}}},
+		},
+	} {
+		if files := (CACerts{tt.config}).Files(tt.root); !reflect.DeepEqual(tt.files, files) {
+			t.Errorf("bad files (%+v, %q): want %#v, got %#v", tt.config, tt.root, tt.files, files)
+		}
+	}
+}
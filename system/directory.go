@@ -0,0 +1,83 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// Directory is a top-level structure which embeds its underlying
+// configuration, config.Directory, and provides the system-specific
+// Permissions().
+type Directory struct {
+	config.Directory
+}
+
+func (d *Directory) Permissions() (os.FileMode, error) {
+	if d.RawFilePermissions == "" {
+		return os.FileMode(0755), nil
+	}
+
+	perm, err := strconv.ParseInt(d.RawFilePermissions, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to parse directory permissions %q as integer", d.RawFilePermissions)
+	}
+
+	// The special bits of os.FileMode don't match their octal notation.
+	mode := os.FileMode(perm).Perm()
+	for bit, m := range map[int64]os.FileMode{04000: os.ModeSetuid, 02000: os.ModeSetgid, 01000: os.ModeSticky} {
+		if perm&bit != 0 {
+			mode |= m
+		}
+	}
+	return mode, nil
+}
+
+// EnsureDirectory creates the directory beneath root, along with any missing
+// parents (which get the default permissions), and sets its mode and owner.
+// If the directory already exists, only its mode and owner are reconciled.
+func EnsureDirectory(d *Directory, root string) (string, error) {
+	fullpath := path.Join(root, d.Path)
+
+	perm, err := d.Permissions()
+	if err != nil {
+		return "", err
+	}
+
+	if err := EnsureDirectoryExists(fullpath); err != nil {
+		return "", err
+	}
+
+	// Ensure the permissions are as requested (since MkdirAll is affected by
+	// the umask and doesn't touch existing directories)
+	if err := os.Chmod(fullpath, perm); err != nil {
+		return "", err
+	}
+
+	if d.Owner != "" {
+		if err := chown(d.Owner, fullpath); err != nil {
+			return "", err
+		}
+	}
+
+	log.Printf("Ensured directory %q", fullpath)
+	return fullpath, nil
+}
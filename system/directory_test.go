@@ -0,0 +1,80 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestEnsureDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(path.Join(dir, "var/lib/existing"), 0755); err != nil {
+		t.Fatalf("Unable to create directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "var/lib/file"), nil, 0644); err != nil {
+		t.Fatalf("Unable to create file: %v", err)
+	}
+
+	// Changing the owner to ourselves is permitted without privileges.
+	owner := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	for _, tt := range []struct {
+		dir config.Directory
+
+		mode os.FileMode
+		err  bool
+	}{
+		{dir: config.Directory{Path: "/var/lib/myapp/data", RawFilePermissions: "0700", Owner: owner}, mode: 0700},
+		{dir: config.Directory{Path: "/var/lib/myapp/data", RawFilePermissions: "0750"}, mode: 0750},
+		{dir: config.Directory{Path: "/var/lib/existing", RawFilePermissions: "1777"}, mode: 0777 | os.ModeSticky},
+		{dir: config.Directory{Path: "/var/lib/default"}, mode: 0755},
+		{dir: config.Directory{Path: "/var/lib/file"}, err: true},
+		{dir: config.Directory{Path: "/var/lib/invalid", RawFilePermissions: "0999"}, err: true},
+	} {
+		fullpath, err := EnsureDirectory(&Directory{tt.dir}, dir)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want %t, got %v", tt.dir, tt.err, err)
+		}
+		if tt.err {
+			continue
+		}
+		if want := path.Join(dir, tt.dir.Path); fullpath != want {
+			t.Errorf("bad path (%+v): want %q, got %q", tt.dir, want, fullpath)
+		}
+
+		fi, err := os.Stat(fullpath)
+		if err != nil {
+			t.Fatalf("Unable to stat directory: %v", err)
+		}
+		if !fi.IsDir() || fi.Mode().Perm()|fi.Mode()&os.ModeSticky != tt.mode {
+			t.Errorf("bad mode (%+v): want %v, got %v", tt.dir, tt.mode, fi.Mode())
+		}
+		st := fi.Sys().(*syscall.Stat_t)
+		if int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid() {
+			t.Errorf("bad owner (%+v): want %d:%d, got %d:%d", tt.dir, os.Getuid(), os.Getgid(), st.Uid, st.Gid)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+const (
+	// partitionAlignment is the alignment (and the offset of the first
+	// partition) in 512-byte sectors, i.e. 1MiB.
+	partitionAlignment = 2048
+
+	linuxTypeGPT = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
+	linuxTypeMBR = "83"
+)
+
+// BlockDevice describes what a block device currently holds.
+type BlockDevice struct {
+	// PartitionTable is the type of its partition table as reported by
+	// blkid (e.g. "gpt" or "dos"), if any.
+	PartitionTable string
+	// Filesystem and Label are the type and label of its filesystem, if
+	// any.
+	Filesystem string
+	Label      string
+	// Partitions is the number of partitions known to the kernel.
+	Partitions int
+	// Sectors is its size in 512-byte sectors.
+	Sectors uint64
+}
+
+// ProbeBlockDevice inspects the given block device with blkid and sysfs.
+func ProbeBlockDevice(device string) (BlockDevice, error) {
+	var bd BlockDevice
+	resolved, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return bd, err
+	}
+	sys := path.Join("/sys/class/block", path.Base(resolved))
+
+	size, err := ioutil.ReadFile(path.Join(sys, "size"))
+	if err != nil {
+		return bd, err
+	}
+	if bd.Sectors, err = strconv.ParseUint(strings.TrimSpace(string(size)), 10, 64); err != nil {
+		return bd, fmt.Errorf("invalid size of %s: %v", device, err)
+	}
+
+	entries, err := ioutil.ReadDir(sys)
+	if err != nil {
+		return bd, err
+	}
+	for _, e := range entries {
+		if _, err := os.Stat(path.Join(sys, e.Name(), "partition")); err == nil {
+			bd.Partitions++
+		}
+	}
+
+	// blkid exits with status 2 if it didn't find anything.
+	out, err := exec.Command("blkid", "-p", "-o", "export", resolved).Output()
+	if _, ok := err.(*exec.ExitError); ok && len(out) == 0 {
+		return bd, nil
+	} else if err != nil {
+		return bd, fmt.Errorf("blkid %s failed with %v", device, err)
+	}
+	parseBlkid(out, &bd)
+	return bd, nil
+}
+
+// parseBlkid sets the partition table and filesystem of bd from the output
+// of "blkid -o export".
+func parseBlkid(out []byte, bd *BlockDevice) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "PTTYPE":
+			bd.PartitionTable = kv[1]
+		case "TYPE":
+			bd.Filesystem = kv[1]
+		case "LABEL":
+			bd.Label = kv[1]
+		}
+	}
+}
+
+// Disk is a top-level structure which embeds its underlying configuration,
+// config.Disk, as well as the device it applies to and a function probing
+// block devices (the default being ProbeBlockDevice).
+type Disk struct {
+	Device string
+	Probe  func(device string) (BlockDevice, error)
+	config.Disk
+}
+
+// tableType returns the blkid name of the partition table type of the disk.
+func (d Disk) tableType() string {
+	if d.TableType == "gpt" {
+		return "gpt"
+	}
+	return "dos"
+}
+
+// Partition creates the partition table of the disk with sfdisk, unless it
+// already holds a matching one. A disk holding any other partition table or
+// a filesystem is only repartitioned if Overwrite is set.
+func (d Disk) Partition() error {
+	if len(d.Layout) == 0 {
+		return nil
+	}
+	bd, err := d.Probe(d.Device)
+	if err != nil {
+		return err
+	}
+	if bd.PartitionTable == d.tableType() && bd.Partitions == len(d.Layout) {
+		log.Printf("%s already has a %s partition table with %d partitions, skipping partitioning", d.Device, bd.PartitionTable, bd.Partitions)
+		return nil
+	}
+	if (bd.PartitionTable != "" || bd.Filesystem != "") && !d.Overwrite {
+		log.Printf("%s already holds data (partition table %q, filesystem %q), not partitioning it without overwrite", d.Device, bd.PartitionTable, bd.Filesystem)
+		return nil
+	}
+
+	command := d.Command()
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(d.Script(bd.Sectors))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sfdisk %s failed with %v: %s", d.Device, err, out)
+	}
+	// Wait for the devices of the new partitions to show up.
+	if out, err := exec.Command("udevadm", "settle").CombinedOutput(); err != nil {
+		return fmt.Errorf("udevadm settle failed with %v: %s", err, out)
+	}
+	return nil
+}
+
+// Command returns the sfdisk command partitioning the disk, which reads the
+// script returned by Script.
+func (d Disk) Command() []string {
+	return []string{"sfdisk", "--wipe", "always", "--wipe-partitions", "always", d.Device}
+}
+
+// Script returns the sfdisk script creating the partition table of the disk,
+// given its size in 512-byte sectors. The sizes of the partitions are aligned
+// to 1MiB and a partition which ends at the end of the disk takes up all of
+// the remaining space.
+func (d Disk) Script(sectors uint64) string {
+	label, defaultType := d.tableType(), linuxTypeMBR
+	if label == "gpt" {
+		defaultType = linuxTypeGPT
+	}
+
+	script := fmt.Sprintf("label: %s\n", label)
+	total := 0
+	for _, p := range d.Layout {
+		typ := p.Type
+		if typ == "" {
+			typ = defaultType
+		}
+		total += p.Size
+		if total == 100 {
+			script += fmt.Sprintf("type=%s\n", typ)
+			continue
+		}
+		size := sectors * uint64(p.Size) / 100 / partitionAlignment * partitionAlignment
+		script += fmt.Sprintf("size=%d, type=%s\n", size, typ)
+	}
+	return script
+}
+
+// Filesystem is a top-level structure which embeds its underlying
+// configuration, config.Filesystem, as well as a function probing block
+// devices (the default being ProbeBlockDevice).
+type Filesystem struct {
+	Probe func(device string) (BlockDevice, error)
+	config.Filesystem
+}
+
+// Create formats the device with the filesystem, unless it already holds
+// the same filesystem with the same label. A device holding any other
+// filesystem or a partition table is only formatted if Overwrite is set.
+func (f Filesystem) Create() error {
+	bd, err := f.Probe(f.Device)
+	if err != nil {
+		return err
+	}
+	if bd.Filesystem == f.Type && bd.Label == f.Label {
+		log.Printf("%s already holds a %s filesystem labeled %q, skipping creation", f.Device, bd.Filesystem, bd.Label)
+		return nil
+	}
+	if (bd.PartitionTable != "" || bd.Filesystem != "") && !f.Overwrite {
+		log.Printf("%s already holds data (partition table %q, filesystem %q), not formatting it without overwrite", f.Device, bd.PartitionTable, bd.Filesystem)
+		return nil
+	}
+
+	command := f.Command()
+	if out, err := exec.Command(command[0], command[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s failed with %v: %s", command[0], f.Device, err, out)
+	}
+	return nil
+}
+
+// Command returns the mkfs (or mkswap) command creating the filesystem.
+func (f Filesystem) Command() []string {
+	var cmd []string
+	labelFlag, forceFlag := "-L", ""
+	switch f.Type {
+	case "ext2", "ext3", "ext4":
+		forceFlag = "-F"
+	case "xfs", "btrfs", "swap":
+		forceFlag = "-f"
+	case "vfat":
+		labelFlag, forceFlag = "-n", "-I"
+	}
+	if f.Type == "swap" {
+		cmd = []string{"mkswap"}
+	} else {
+		cmd = []string{"mkfs." + f.Type}
+	}
+
+	if f.Overwrite && forceFlag != "" {
+		cmd = append(cmd, forceFlag)
+	}
+	if f.Label != "" {
+		cmd = append(cmd, labelFlag, f.Label)
+	}
+	cmd = append(cmd, f.ExtraOpts...)
+	return append(cmd, f.Device)
+}
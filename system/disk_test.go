@@ -0,0 +1,212 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestDiskScript(t *testing.T) {
+	// 10GiB in 512-byte sectors
+	const sectors = 20971520
+
+	for _, tt := range []struct {
+		disk config.Disk
+
+		script string
+	}{
+		{
+			disk:   config.Disk{Layout: config.Layout{{Size: 100}}},
+			script: "label: dos\ntype=83\n",
+		},
+		{
+			disk:   config.Disk{TableType: "gpt", Layout: config.Layout{{Size: 100}}},
+			script: "label: gpt\ntype=0FC63DAF-8483-4772-8E79-3D69D8477DE4\n",
+		},
+		{
+			disk:   config.Disk{TableType: "mbr", Layout: config.Layout{{Size: 25}, {Size: 25, Type: "82"}, {Size: 50}}},
+			script: "label: dos\nsize=5242880, type=83\nsize=5242880, type=82\ntype=83\n",
+		},
+		{
+			// Partitions are aligned to 1MiB and don't need to fill the disk.
+			disk:   config.Disk{TableType: "gpt", Layout: config.Layout{{Size: 33}, {Size: 33, Type: "8200"}}},
+			script: "label: gpt\nsize=6920192, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4\nsize=6920192, type=8200\n",
+		},
+	} {
+		d := Disk{Device: "/dev/sdb", Disk: tt.disk}
+		if script := d.Script(sectors); script != tt.script {
+			t.Errorf("bad script (%#v): want %q, got %q", tt.disk, tt.script, script)
+		}
+	}
+}
+
+func TestDiskCommand(t *testing.T) {
+	d := Disk{Device: "/dev/sdb", Disk: config.Disk{Layout: config.Layout{{Size: 100}}}}
+	want := []string{"sfdisk", "--wipe", "always", "--wipe-partitions", "always", "/dev/sdb"}
+	if cmd := d.Command(); !reflect.DeepEqual(want, cmd) {
+		t.Errorf("bad command: want %q, got %q", want, cmd)
+	}
+}
+
+func TestDiskPartitionSkipped(t *testing.T) {
+	for _, tt := range []struct {
+		disk  config.Disk
+		block BlockDevice
+		err   error
+	}{
+		{
+			// Nothing to partition.
+			disk: config.Disk{TableType: "gpt"},
+		},
+		{
+			// The partition table already matches.
+			disk:  config.Disk{TableType: "gpt", Layout: config.Layout{{Size: 50}, {Size: 50}}},
+			block: BlockDevice{PartitionTable: "gpt", Partitions: 2},
+		},
+		{
+			disk:  config.Disk{Layout: config.Layout{{Size: 100}}, Overwrite: true},
+			block: BlockDevice{PartitionTable: "dos", Partitions: 1},
+		},
+		{
+			// A different partition table is only replaced with overwrite.
+			disk:  config.Disk{TableType: "gpt", Layout: config.Layout{{Size: 100}}},
+			block: BlockDevice{PartitionTable: "dos", Partitions: 3},
+		},
+		{
+			disk:  config.Disk{Layout: config.Layout{{Size: 100}}},
+			block: BlockDevice{Filesystem: "ext4"},
+		},
+		{
+			disk: config.Disk{Layout: config.Layout{{Size: 100}}},
+			err:  errors.New("no such device"),
+		},
+	} {
+		probed := false
+		d := Disk{
+			Device: "/dev/sdb",
+			Probe: func(device string) (BlockDevice, error) {
+				probed = true
+				if device != "/dev/sdb" {
+					t.Errorf("bad device: want %q, got %q", "/dev/sdb", device)
+				}
+				return tt.block, tt.err
+			},
+			Disk: tt.disk,
+		}
+		if err := d.Partition(); err != tt.err {
+			t.Errorf("bad error (%#v, %#v): want %v, got %v", tt.disk, tt.block, tt.err, err)
+		}
+		if want := len(tt.disk.Layout) > 0; probed != want {
+			t.Errorf("bad probe (%#v): want %t, got %t", tt.disk, want, probed)
+		}
+	}
+}
+
+func TestFilesystemCommand(t *testing.T) {
+	for _, tt := range []struct {
+		fs config.Filesystem
+
+		command []string
+	}{
+		{
+			fs:      config.Filesystem{Device: "/dev/sdb1", Type: "ext4", Label: "data"},
+			command: []string{"mkfs.ext4", "-L", "data", "/dev/sdb1"},
+		},
+		{
+			fs:      config.Filesystem{Device: "/dev/sdb1", Type: "ext4", Overwrite: true, ExtraOpts: []string{"-m", "0"}},
+			command: []string{"mkfs.ext4", "-F", "-m", "0", "/dev/sdb1"},
+		},
+		{
+			fs:      config.Filesystem{Device: "/dev/sdb1", Type: "xfs", Label: "data", Overwrite: true},
+			command: []string{"mkfs.xfs", "-f", "-L", "data", "/dev/sdb1"},
+		},
+		{
+			fs:      config.Filesystem{Device: "/dev/sdb1", Type: "btrfs"},
+			command: []string{"mkfs.btrfs", "/dev/sdb1"},
+		},
+		{
+			fs:      config.Filesystem{Device: "/dev/sdb1", Type: "vfat", Label: "EFI", Overwrite: true},
+			command: []string{"mkfs.vfat", "-I", "-n", "EFI", "/dev/sdb1"},
+		},
+		{
+			fs:      config.Filesystem{Device: "/dev/sdb2", Type: "swap", Label: "swap", Overwrite: true},
+			command: []string{"mkswap", "-f", "-L", "swap", "/dev/sdb2"},
+		},
+	} {
+		if cmd := (Filesystem{Filesystem: tt.fs}).Command(); !reflect.DeepEqual(tt.command, cmd) {
+			t.Errorf("bad command (%#v): want %q, got %q", tt.fs, tt.command, cmd)
+		}
+	}
+}
+
+func TestFilesystemCreateSkipped(t *testing.T) {
+	for _, tt := range []struct {
+		fs    config.Filesystem
+		block BlockDevice
+	}{
+		{
+			// The filesystem already matches, even with overwrite.
+			fs:    config.Filesystem{Device: "/dev/sdb1", Type: "ext4", Label: "data", Overwrite: true},
+			block: BlockDevice{Filesystem: "ext4", Label: "data"},
+		},
+		{
+			// A different filesystem is only replaced with overwrite.
+			fs:    config.Filesystem{Device: "/dev/sdb1", Type: "ext4", Label: "data"},
+			block: BlockDevice{Filesystem: "xfs", Label: "data"},
+		},
+		{
+			fs:    config.Filesystem{Device: "/dev/sdb", Type: "ext4"},
+			block: BlockDevice{PartitionTable: "gpt"},
+		},
+	} {
+		fs := Filesystem{
+			Probe:      func(string) (BlockDevice, error) { return tt.block, nil },
+			Filesystem: tt.fs,
+		}
+		if err := fs.Create(); err != nil {
+			t.Errorf("bad error (%#v, %#v): want nil, got %v", tt.fs, tt.block, err)
+		}
+	}
+}
+
+func TestParseBlkid(t *testing.T) {
+	for _, tt := range []struct {
+		out string
+
+		block BlockDevice
+	}{
+		{
+			out:   "DEVNAME=/dev/sdb\nPTUUID=0b2f7c5e\nPTTYPE=gpt\n",
+			block: BlockDevice{PartitionTable: "gpt"},
+		},
+		{
+			out:   "DEVNAME=/dev/sdb1\nLABEL=data\nUUID=3e6be9de\nVERSION=1.0\nTYPE=ext4\nUSAGE=filesystem\n",
+			block: BlockDevice{Filesystem: "ext4", Label: "data"},
+		},
+		{
+			out: "",
+		},
+	} {
+		var bd BlockDevice
+		parseBlkid([]byte(tt.out), &bd)
+		if !reflect.DeepEqual(tt.block, bd) {
+			t.Errorf("bad block device (%q): want %#v, got %#v", tt.out, tt.block, bd)
+		}
+	}
+}
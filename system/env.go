@@ -42,8 +42,12 @@ func getEnvVars(e interface{}) []string {
 
 	vars := []string{}
 	for i := 0; i < et.NumField(); i++ {
+		key := et.Field(i).Tag.Get("env")
+		if key == "" {
+			// The option has no equivalent environment variable.
+			continue
+		}
 		if val := ev.Field(i).Interface(); !config.IsZero(val) {
-			key := et.Field(i).Tag.Get("env")
 			vars = append(vars, fmt.Sprintf("%s=%v", key, val))
 		}
 	}
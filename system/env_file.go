@@ -22,10 +22,15 @@ import (
 	"path"
 	"regexp"
 	"sort"
+	"strings"
 )
 
 type EnvFile struct {
 	Vars map[string]string
+	// Owned lists the prefixes of the variables managed through Vars.
+	// Existing variables with one of these prefixes which are missing from
+	// Vars are removed from the file.
+	Owned []string `json:"-" yaml:"-"`
 	// mask File.Content, it shouldn't be used.
 	Content interface{} `json:"-" yaml:"-"`
 	*File
@@ -40,7 +45,8 @@ var lineLexer = regexp.MustCompile(`(?m)^((?:([a-zA-Z0-9_]+)=)?.*?)\r?\n`)
 // mergeEnvContents: Update the existing file contents with new values,
 // preserving variable ordering and all content this code doesn't understand.
 // All new values are appended to the bottom of the old, sorted by key.
-func mergeEnvContents(old []byte, pending map[string]string) []byte {
+// Variables with one of the owned prefixes which are not pending are dropped.
+func mergeEnvContents(old []byte, pending map[string]string, owned []string) []byte {
 	var buf bytes.Buffer
 	var match [][]byte
 
@@ -54,6 +60,8 @@ func mergeEnvContents(old []byte, pending map[string]string) []byte {
 		if value, ok := pending[key]; ok {
 			fmt.Fprintf(&buf, "%s=%s\n", key, value)
 			delete(pending, key)
+		} else if hasOwnedPrefix(key, owned) {
+			continue
 		} else {
 			fmt.Fprintf(&buf, "%s\n", match[1])
 		}
@@ -70,7 +78,8 @@ func mergeEnvContents(old []byte, pending map[string]string) []byte {
 // WriteEnvFile updates an existing env `KEY=value` formated file with
 // new values provided in EnvFile.Vars; File.Content is ignored.
 // Existing ordering and any unknown formatting such as comments are
-// preserved. If no changes are required the file is untouched.
+// preserved. If no changes are required the file is untouched. Variables
+// matching EnvFile.Owned but absent from EnvFile.Vars are removed.
 func WriteEnvFile(ef *EnvFile, root string) error {
 	// validate new keys, mergeEnvContents uses pending to track writes
 	pending := make(map[string]string, len(ef.Vars))
@@ -81,20 +90,22 @@ func WriteEnvFile(ef *EnvFile, root string) error {
 		pending[key] = value
 	}
 
-	if len(pending) == 0 {
+	if len(pending) == 0 && len(ef.Owned) == 0 {
 		return nil
 	}
 
 	oldContent, err := ioutil.ReadFile(path.Join(root, ef.Path))
 	if err != nil {
-		if os.IsNotExist(err) {
+		if os.IsNotExist(err) && len(pending) == 0 {
+			return nil
+		} else if os.IsNotExist(err) {
 			oldContent = []byte{}
 		} else {
 			return err
 		}
 	}
 
-	newContent := mergeEnvContents(oldContent, pending)
+	newContent := mergeEnvContents(oldContent, pending, ef.Owned)
 	if bytes.Equal(oldContent, newContent) {
 		return nil
 	}
@@ -104,6 +115,16 @@ func WriteEnvFile(ef *EnvFile, root string) error {
 	return err
 }
 
+// hasOwnedPrefix reports whether key starts with one of the owned prefixes.
+func hasOwnedPrefix(key string, owned []string) bool {
+	for _, prefix := range owned {
+		if key != "" && strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // keys returns the keys of a map in sorted order
 func keys(m map[string]string) (s []string) {
 	for k := range m {
@@ -364,6 +364,93 @@ func TestWriteEnvFileEmpty(t *testing.T) {
 	}
 }
 
+func TestWriteEnvFileOwned(t *testing.T) {
+	for _, tt := range []struct {
+		base  string
+		vars  map[string]string
+		owned []string
+
+		expect string
+	}{
+		{
+			base:   "# a file\nFOO=base\nOLD_X=1\n\nBAR= hi there\nOLD_Y=2\n",
+			vars:   map[string]string{"FOO": "test", "OLD_Z": "3"},
+			owned:  []string{"FOO", "OLD_"},
+			expect: "# a file\nFOO=test\n\nBAR= hi there\nOLD_Z=3\n",
+		},
+		{
+			base:   "# a file\nFOO=base\n\nBAR= hi there\n",
+			vars:   valueEmpty,
+			owned:  []string{"FOO"},
+			expect: "# a file\n\nBAR= hi there\n",
+		},
+		{
+			base:   base,
+			vars:   valueUpdate,
+			owned:  []string{"BAZ_"},
+			expect: expectUpdate,
+		},
+	} {
+		dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+		if err != nil {
+			t.Fatalf("Unable to create tempdir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		name := "foo.conf"
+		fullPath := path.Join(dir, name)
+		ioutil.WriteFile(fullPath, []byte(tt.base), 0644)
+
+		ef := EnvFile{
+			File: &File{config.File{
+				Path: name,
+			}},
+			Vars:  tt.vars,
+			Owned: tt.owned,
+		}
+
+		if err := WriteEnvFile(&ef, dir); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		contents, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			t.Fatalf("Unable to read expected file: %v", err)
+		}
+
+		if string(contents) != tt.expect {
+			t.Errorf("File has incorrect contents (%v): want %q, got %q", tt.owned, tt.expect, contents)
+		}
+	}
+}
+
+func TestWriteEnvFileOwnedNoCreate(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := "foo.conf"
+	fullPath := path.Join(dir, name)
+
+	ef := EnvFile{
+		File: &File{config.File{
+			Path: name,
+		}},
+		Vars:  valueEmpty,
+		Owned: []string{"FOO"},
+	}
+
+	if err := WriteEnvFile(&ef, dir); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if _, err := os.Stat(fullPath); !os.IsNotExist(err) {
+		t.Fatalf("File was created: %v", err)
+	}
+}
+
 // no point in creating empty files
 func TestWriteEnvFileEmptyNoCreate(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
@@ -17,41 +17,132 @@ package system
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
 )
 
 const DefaultIpv4Address = "127.0.0.1"
 
+const (
+	etcHostsBegin = "# BEGIN coreos-cloudinit etc_hosts\n"
+	etcHostsEnd   = "# END coreos-cloudinit etc_hosts\n"
+)
+
+// EtcHosts generates /etc/hosts from manage_etc_hosts and the static entries
+// of etc_hosts. The entries are kept in a block delimited by markers, which
+// replaces the block written by a previous run. Unless manage_etc_hosts is
+// set, the rest of the existing /etc/hosts under Root is kept.
+//
+// Hostname is the hostname given by the cloud-config, if any. Since only the
+// short name of an FQDN is set as the hostname of the system (see
+// SetHostname), the FQDN is mapped to it in /etc/hosts.
 type EtcHosts struct {
 	config.EtcHosts
+	Entries  []config.EtcHostsEntry
+	Root     string
+	Hostname string
 }
 
+// generateEtcHosts maps the hostname either to DefaultIpv4Address (for
+// "localhost") or to the given IP address (e.g. the substituted value of
+// "$private_ipv4"), along with the short hostname.
 func (eh EtcHosts) generateEtcHosts() (out string, err error) {
-	if eh.EtcHosts != "localhost" {
+	ip := net.ParseIP(string(eh.EtcHosts))
+	if eh.EtcHosts != "localhost" && ip == nil {
 		return "", errors.New("Invalid option to manage_etc_hosts")
 	}
 
-	// use the operating system hostname
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "", err
+	// use the operating system hostname unless one was given
+	hostname := eh.Hostname
+	if hostname == "" {
+		if hostname, err = os.Hostname(); err != nil {
+			return "", err
+		}
+	}
+
+	short := ShortHostname(hostname)
+	if ip == nil {
+		if eh.Hostname != "" && short != hostname {
+			return fmt.Sprintf("%s %s %s\n", DefaultIpv4Address, hostname, short), nil
+		}
+		return fmt.Sprintf("%s %s\n", DefaultIpv4Address, hostname), nil
+	}
+	if short != hostname {
+		return fmt.Sprintf("%s %s %s\n", ip, hostname, short), nil
+	}
+	return fmt.Sprintf("%s %s\n", ip, hostname), nil
+}
+
+// entries returns the static entries of the block, which map an FQDN
+// Hostname to its short name unless manage_etc_hosts takes care of it.
+func (eh EtcHosts) entries() []config.EtcHostsEntry {
+	short := ShortHostname(eh.Hostname)
+	if eh.EtcHosts != "" || short == eh.Hostname {
+		return eh.Entries
 	}
+	fqdn := config.EtcHostsEntry{IP: DefaultIpv4Address, Hostnames: []string{eh.Hostname, short}}
+	return append([]config.EtcHostsEntry{fqdn}, eh.Entries...)
+}
 
-	return fmt.Sprintf("%s %s\n", DefaultIpv4Address, hostname), nil
+func (eh EtcHosts) generateEtcHostsBlock() (string, error) {
+	block := etcHostsBegin
+	for _, e := range eh.entries() {
+		if err := e.Check(); err != nil {
+			return "", err
+		}
+		block += fmt.Sprintf("%s %s\n", e.IP, strings.Join(e.Hostnames, " "))
+	}
+	return block + etcHostsEnd, nil
+}
 
+// removeEtcHostsBlock removes the block of entries written by a previous run
+// from the given content of /etc/hosts.
+func removeEtcHostsBlock(content string) string {
+	begin := strings.Index(content, etcHostsBegin)
+	if begin == -1 || (begin > 0 && content[begin-1] != '\n') {
+		return content
+	}
+	end := strings.Index(content[begin:], etcHostsEnd)
+	if end == -1 {
+		return content[:begin]
+	}
+	return content[:begin] + content[begin+end+len(etcHostsEnd):]
 }
 
 func (eh EtcHosts) File() (*File, error) {
-	if eh.EtcHosts == "" {
+	entries := eh.entries()
+	if eh.EtcHosts == "" && len(entries) == 0 {
 		return nil, nil
 	}
 
-	etcHosts, err := eh.generateEtcHosts()
-	if err != nil {
-		return nil, err
+	var etcHosts string
+	if eh.EtcHosts != "" {
+		var err error
+		if etcHosts, err = eh.generateEtcHosts(); err != nil {
+			return nil, err
+		}
+	} else {
+		content, err := ioutil.ReadFile(path.Join(eh.Root, "etc", "hosts"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		etcHosts = removeEtcHostsBlock(string(content))
+	}
+
+	if len(entries) > 0 {
+		block, err := eh.generateEtcHostsBlock()
+		if err != nil {
+			return nil, err
+		}
+		if etcHosts != "" && !strings.HasSuffix(etcHosts, "\n") {
+			etcHosts += "\n"
+		}
+		etcHosts += block
 	}
 
 	return &File{config.File{
@@ -15,9 +15,13 @@
 package system
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/config"
@@ -28,6 +32,10 @@ func TestEtcdHostsFile(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
+	hostnames := hostname
+	if short := strings.SplitN(hostname, ".", 2)[0]; short != hostname {
+		hostnames += " " + short
+	}
 
 	for _, tt := range []struct {
 		config config.EtcHosts
@@ -48,8 +56,31 @@ func TestEtcdHostsFile(t *testing.T) {
 			}},
 			nil,
 		},
+		{
+			"10.0.0.5",
+			&File{config.File{
+				Content:            fmt.Sprintf("10.0.0.5 %s\n", hostnames),
+				Path:               "etc/hosts",
+				RawFilePermissions: "0644",
+			}},
+			nil,
+		},
+		{
+			"fd00::5",
+			&File{config.File{
+				Content:            fmt.Sprintf("fd00::5 %s\n", hostnames),
+				Path:               "etc/hosts",
+				RawFilePermissions: "0644",
+			}},
+			nil,
+		},
+		{
+			"$private_ipv4",
+			nil,
+			fmt.Errorf("Invalid option to manage_etc_hosts"),
+		},
 	} {
-		file, err := EtcHosts{tt.config}.File()
+		file, err := EtcHosts{EtcHosts: tt.config}.File()
 		if !reflect.DeepEqual(tt.err, err) {
 			t.Errorf("bad error (%q): want %q, got %q", tt.config, tt.err, err)
 		}
@@ -58,3 +89,169 @@ func TestEtcdHostsFile(t *testing.T) {
 		}
 	}
 }
+
+func TestEtcHostsEntriesFile(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := []config.EtcHostsEntry{
+		{IP: "10.0.0.5", Hostnames: []string{"registry.internal", "registry"}},
+		{IP: "fd00::1", Hostnames: []string{"gateway"}},
+	}
+	block := "# BEGIN coreos-cloudinit etc_hosts\n" +
+		"10.0.0.5 registry.internal registry\n" +
+		"fd00::1 gateway\n" +
+		"# END coreos-cloudinit etc_hosts\n"
+
+	for _, tt := range []struct {
+		config  config.EtcHosts
+		entries []config.EtcHostsEntry
+		hosts   string
+
+		content string
+		err     error
+	}{
+		{
+			entries: entries,
+			content: block,
+		},
+		{
+			entries: entries,
+			hosts:   "127.0.0.1 localhost",
+			content: "127.0.0.1 localhost\n" + block,
+		},
+		{
+			entries: entries,
+			hosts:   "127.0.0.1 localhost\n" + block + "10.0.0.1 other\n",
+			content: "127.0.0.1 localhost\n10.0.0.1 other\n" + block,
+		},
+		{
+			entries: entries[:1],
+			hosts:   "127.0.0.1 localhost\n" + block,
+			content: "127.0.0.1 localhost\n" +
+				"# BEGIN coreos-cloudinit etc_hosts\n" +
+				"10.0.0.5 registry.internal registry\n" +
+				"# END coreos-cloudinit etc_hosts\n",
+		},
+		{
+			config:  "localhost",
+			entries: entries,
+			hosts:   "127.0.0.1 localhost\n",
+			content: fmt.Sprintf("127.0.0.1 %s\n", hostname) + block,
+		},
+		{
+			entries: []config.EtcHostsEntry{{IP: "10.0.0.256", Hostnames: []string{"registry"}}},
+			err:     errors.New(`invalid IP address "10.0.0.256" in etc_hosts`),
+		},
+		{
+			entries: []config.EtcHostsEntry{{IP: "10.0.0.5", Hostnames: []string{"bad_name"}}},
+			err:     errors.New(`invalid hostname "bad_name" in etc_hosts`),
+		},
+	} {
+		hosts := path.Join(dir, "etc", "hosts")
+		os.RemoveAll(path.Dir(hosts))
+		if tt.hosts != "" {
+			if err := os.MkdirAll(path.Dir(hosts), 0755); err != nil {
+				t.Fatalf("Unable to create etc: %v", err)
+			}
+			if err := ioutil.WriteFile(hosts, []byte(tt.hosts), 0644); err != nil {
+				t.Fatalf("Unable to write hosts: %v", err)
+			}
+		}
+
+		eh := EtcHosts{EtcHosts: tt.config, Entries: tt.entries, Root: dir}
+		file, err := eh.File()
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%q): want %v, got %v", tt.hosts, tt.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if file.Content != tt.content {
+			t.Errorf("bad content (%q): want %q, got %q", tt.hosts, tt.content, file.Content)
+		}
+
+		// Running again on the written file must not duplicate the block.
+		if _, err := WriteFile(file, dir); err != nil {
+			t.Fatalf("Unable to write file: %v", err)
+		}
+		if file, err = eh.File(); err != nil {
+			t.Fatalf("bad error on re-run (%q): %v", tt.hosts, err)
+		}
+		if file.Content != tt.content {
+			t.Errorf("bad content on re-run (%q): want %q, got %q", tt.hosts, tt.content, file.Content)
+		}
+	}
+}
+
+func TestEtcHostsFQDN(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tt := range []struct {
+		config   config.EtcHosts
+		entries  []config.EtcHostsEntry
+		hostname string
+
+		content string
+	}{
+		{
+			hostname: "node",
+		},
+		{
+			hostname: "node.example.com",
+			content: "# BEGIN coreos-cloudinit etc_hosts\n" +
+				"127.0.0.1 node.example.com node\n" +
+				"# END coreos-cloudinit etc_hosts\n",
+		},
+		{
+			hostname: "node.example.com",
+			entries:  []config.EtcHostsEntry{{IP: "10.0.0.5", Hostnames: []string{"registry"}}},
+			content: "# BEGIN coreos-cloudinit etc_hosts\n" +
+				"127.0.0.1 node.example.com node\n" +
+				"10.0.0.5 registry\n" +
+				"# END coreos-cloudinit etc_hosts\n",
+		},
+		{
+			config:   "localhost",
+			hostname: "node.example.com",
+			content:  "127.0.0.1 node.example.com node\n",
+		},
+		{
+			config:   "10.0.0.5",
+			hostname: "node.example.com",
+			content:  "10.0.0.5 node.example.com node\n",
+		},
+		{
+			config:   "10.0.0.5",
+			hostname: "node",
+			content:  "10.0.0.5 node\n",
+		},
+	} {
+		eh := EtcHosts{EtcHosts: tt.config, Entries: tt.entries, Root: dir, Hostname: tt.hostname}
+		file, err := eh.File()
+		if err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", tt.hostname, err)
+		}
+		if file == nil {
+			if tt.content != "" {
+				t.Errorf("no file (%q, %q): want %q", tt.config, tt.hostname, tt.content)
+			}
+			continue
+		}
+		if file.Content != tt.content {
+			t.Errorf("bad content (%q, %q): want %q, got %q", tt.config, tt.hostname, tt.content, file.Content)
+		}
+	}
+}
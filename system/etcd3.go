@@ -0,0 +1,73 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"log"
+	"reflect"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// Etcd3 is a top-level structure which embeds its underlying configuration,
+// config.Etcd3, and provides the system-specific Unit().
+type Etcd3 struct {
+	config.Etcd3
+}
+
+// Units creates a Unit file drop-in for etcd-member, using any configured
+// options.
+func (ee Etcd3) Units() []Unit {
+	return []Unit{{config.Unit{
+		Name:    "etcd-member.service",
+		Runtime: true,
+		DropIns: []config.UnitDropIn{{
+			Name:    "20-cloudinit.conf",
+			Content: serviceContents(ee.options()),
+		}},
+	}}}
+}
+
+// options maps the deprecated options onto their etcd3 replacements. The
+// options which have no replacement are reported and ignored.
+func (ee Etcd3) options() config.Etcd3 {
+	e := ee.Etcd3
+
+	et := reflect.TypeOf(e)
+	ev := reflect.ValueOf(e)
+	for i := 0; i < et.NumField(); i++ {
+		f := et.Field(i)
+		if msg := f.Tag.Get("deprecated"); msg != "" && !config.IsZero(ev.Field(i).Interface()) {
+			log.Printf("Deprecated etcd3 option %q (%s)\n", f.Tag.Get("yaml"), msg)
+		}
+	}
+
+	if e.CAFile != "" {
+		if e.TrustedCAFile == "" {
+			e.TrustedCAFile = e.CAFile
+		}
+		e.ClientCertAuth = true
+	}
+	if e.PeerCAFile != "" {
+		if e.PeerTrustedCAFile == "" {
+			e.PeerTrustedCAFile = e.PeerCAFile
+		}
+		e.PeerClientCertAuth = true
+	}
+	if e.Debug && e.LogLevel == "" {
+		e.LogLevel = "debug"
+	}
+	return e
+}
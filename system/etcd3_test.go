@@ -0,0 +1,132 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestEtcd3Units(t *testing.T) {
+	for _, tt := range []struct {
+		config config.Etcd3
+		units  []Unit
+	}{
+		{
+			config.Etcd3{},
+			[]Unit{{config.Unit{
+				Name:    "etcd-member.service",
+				Runtime: true,
+				DropIns: []config.UnitDropIn{{Name: "20-cloudinit.conf"}},
+			}}},
+		},
+		{
+			config.Etcd3{
+				Name:                     "node1",
+				AdvertiseClientURLs:      "https://10.0.0.1:2379",
+				InitialAdvertisePeerURLs: "https://10.0.0.1:2380",
+				ListenClientURLs:         "https://0.0.0.0:2379",
+				ListenPeerURLs:           "https://10.0.0.1:2380",
+				ListenMetricsURLs:        "http://0.0.0.0:2381",
+				InitialCluster:           "node1=https://10.0.0.1:2380,node2=https://10.0.0.2:2380",
+				InitialClusterState:      "new",
+				InitialClusterToken:      "cluster1",
+				AutoCompactionMode:       "periodic",
+				AutoCompactionRetention:  "1h",
+				QuotaBackendBytes:        8589934592,
+				CertFile:                 "/etc/ssl/etcd/server.crt",
+				KeyFile:                  "/etc/ssl/etcd/server.key",
+				TrustedCAFile:            "/etc/ssl/etcd/ca.crt",
+				ClientCertAuth:           true,
+			},
+			[]Unit{{config.Unit{
+				Name:    "etcd-member.service",
+				Runtime: true,
+				DropIns: []config.UnitDropIn{{
+					Name: "20-cloudinit.conf",
+					Content: `[Service]
+Environment="ETCD_ADVERTISE_CLIENT_URLS=https://10.0.0.1:2379"
+Environment="ETCD_AUTO_COMPACTION_MODE=periodic"
+Environment="ETCD_AUTO_COMPACTION_RETENTION=1h"
+Environment="ETCD_CERT_FILE=/etc/ssl/etcd/server.crt"
+Environment="ETCD_CLIENT_CERT_AUTH=true"
+Environment="ETCD_INITIAL_ADVERTISE_PEER_URLS=https://10.0.0.1:2380"
+Environment="ETCD_INITIAL_CLUSTER=node1=https://10.0.0.1:2380,node2=https://10.0.0.2:2380"
+Environment="ETCD_INITIAL_CLUSTER_STATE=new"
+Environment="ETCD_INITIAL_CLUSTER_TOKEN=cluster1"
+Environment="ETCD_KEY_FILE=/etc/ssl/etcd/server.key"
+Environment="ETCD_LISTEN_CLIENT_URLS=https://0.0.0.0:2379"
+Environment="ETCD_LISTEN_METRICS_URLS=http://0.0.0.0:2381"
+Environment="ETCD_LISTEN_PEER_URLS=https://10.0.0.1:2380"
+Environment="ETCD_NAME=node1"
+Environment="ETCD_QUOTA_BACKEND_BYTES=8589934592"
+Environment="ETCD_TRUSTED_CA_FILE=/etc/ssl/etcd/ca.crt"
+`,
+				}},
+			}}},
+		},
+		{
+			config.Etcd3{
+				Name:       "node1",
+				CAFile:     "/etc/ssl/etcd/ca.crt",
+				PeerCAFile: "/etc/ssl/etcd/peer-ca.crt",
+				Debug:      true,
+				Proxy:      "on",
+			},
+			[]Unit{{config.Unit{
+				Name:    "etcd-member.service",
+				Runtime: true,
+				DropIns: []config.UnitDropIn{{
+					Name: "20-cloudinit.conf",
+					Content: `[Service]
+Environment="ETCD_CLIENT_CERT_AUTH=true"
+Environment="ETCD_LOG_LEVEL=debug"
+Environment="ETCD_NAME=node1"
+Environment="ETCD_PEER_CLIENT_CERT_AUTH=true"
+Environment="ETCD_PEER_TRUSTED_CA_FILE=/etc/ssl/etcd/peer-ca.crt"
+Environment="ETCD_TRUSTED_CA_FILE=/etc/ssl/etcd/ca.crt"
+`,
+				}},
+			}}},
+		},
+		{
+			config.Etcd3{
+				CAFile:        "/etc/ssl/etcd/old-ca.crt",
+				TrustedCAFile: "/etc/ssl/etcd/ca.crt",
+				Debug:         true,
+				LogLevel:      "warn",
+			},
+			[]Unit{{config.Unit{
+				Name:    "etcd-member.service",
+				Runtime: true,
+				DropIns: []config.UnitDropIn{{
+					Name: "20-cloudinit.conf",
+					Content: `[Service]
+Environment="ETCD_CLIENT_CERT_AUTH=true"
+Environment="ETCD_LOG_LEVEL=warn"
+Environment="ETCD_TRUSTED_CA_FILE=/etc/ssl/etcd/ca.crt"
+`,
+				}},
+			}}},
+		},
+	} {
+		units := Etcd3{tt.config}.Units()
+		if !reflect.DeepEqual(tt.units, units) {
+			t.Errorf("bad units (%+v): want %#v, got %#v", tt.config, tt.units, units)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package system
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -22,6 +23,7 @@ import (
 	"os/exec"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
 )
@@ -65,6 +67,10 @@ func WriteFile(f *File, root string) (string, error) {
 		return "", err
 	}
 
+	if f.Append {
+		return appendFile(f, fullpath, content, perm)
+	}
+
 	var tmp *os.File
 	// Create a temporary file in the same directory to ensure it's on the same filesystem
 	if tmp, err = ioutil.TempFile(dir, "cloudinit-temp"); err != nil {
@@ -85,9 +91,7 @@ func WriteFile(f *File, root string) (string, error) {
 	}
 
 	if f.Owner != "" {
-		// We shell out since we don't have a way to look up unix groups natively
-		cmd := exec.Command("chown", f.Owner, tmp.Name())
-		if err := cmd.Run(); err != nil {
+		if err := chown(f.Owner, tmp.Name()); err != nil {
 			return "", err
 		}
 	}
@@ -96,10 +100,93 @@ func WriteFile(f *File, root string) (string, error) {
 		return "", err
 	}
 
+	if err := applySELinuxContext(f, fullpath); err != nil {
+		return "", err
+	}
+
 	log.Printf("Wrote file to %q", fullpath)
 	return fullpath, nil
 }
 
+// appendFile appends the content to the file at fullpath. The permissions,
+// owner and SELinux context are only applied if the file did not exist
+// beforehand. Since the config is applied again after every reboot, nothing is
+// appended if the file already contains the content.
+func appendFile(f *File, fullpath string, content []byte, perm os.FileMode) (string, error) {
+	created := true
+	fd, err := os.OpenFile(fullpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if os.IsExist(err) {
+		created = false
+		existing, rerr := ioutil.ReadFile(fullpath)
+		if rerr != nil {
+			return "", rerr
+		}
+		if bytes.Contains(existing, content) {
+			log.Printf("File %q already contains the content to append, skipping", fullpath)
+			return fullpath, nil
+		}
+		fd, err = os.OpenFile(fullpath, os.O_WRONLY|os.O_APPEND, 0)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := fd.Write(content); err != nil {
+		fd.Close()
+		return "", err
+	}
+
+	if err := fd.Close(); err != nil {
+		return "", err
+	}
+
+	if created {
+		// Ensure the permissions are as requested (since OpenFile is affected by the umask)
+		if err := os.Chmod(fullpath, perm); err != nil {
+			return "", err
+		}
+
+		if f.Owner != "" {
+			if err := chown(f.Owner, fullpath); err != nil {
+				return "", err
+			}
+		}
+
+		if err := applySELinuxContext(f, fullpath); err != nil {
+			return "", err
+		}
+	}
+
+	log.Printf("Appended to file %q", fullpath)
+	return fullpath, nil
+}
+
+func chown(owner, path string) error {
+	if uid, gid, ok := numericOwner(owner); ok {
+		return os.Chown(path, uid, gid)
+	}
+	// We shell out since we don't have a way to look up unix groups natively
+	return exec.Command("chown", owner, path).Run()
+}
+
+// numericOwner parses an owner given as "uid" or "uid:gid". The IDs needn't
+// exist in the passwd and group databases. If no gid is given, it is -1 (i.e.
+// the group is left unchanged).
+func numericOwner(owner string) (uid, gid int, ok bool) {
+	parts := strings.SplitN(owner, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil || uid < 0 {
+		return 0, 0, false
+	}
+	gid = -1
+	if len(parts) == 2 {
+		if gid, err = strconv.Atoi(parts[1]); err != nil || gid < 0 {
+			return 0, 0, false
+		}
+	}
+	return uid, gid, true
+}
+
 func EnsureDirectoryExists(dir string) error {
 	info, err := os.Stat(dir)
 	if err == nil {
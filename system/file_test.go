@@ -15,9 +15,11 @@
 package system
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"syscall"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/config"
@@ -251,3 +253,178 @@ func TestWriteFileUnknownEncodedContent(t *testing.T) {
 		t.Fatalf("Expected error to be raised when writing file with encoding")
 	}
 }
+
+func TestWriteFileAppendNew(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := "foo"
+	fullPath := path.Join(dir, fn)
+
+	wf := File{config.File{
+		Path:               fn,
+		Content:            "bar\n",
+		RawFilePermissions: "0600",
+		Append:             true,
+	}}
+
+	path, err := WriteFile(&wf, dir)
+	if err != nil {
+		t.Fatalf("Processing of WriteFile failed: %v", err)
+	} else if path != fullPath {
+		t.Fatalf("WriteFile returned bad path: want %s, got %s", fullPath, path)
+	}
+
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		t.Fatalf("Unable to stat file: %v", err)
+	}
+
+	if fi.Mode() != os.FileMode(0600) {
+		t.Errorf("File has incorrect mode: %v", fi.Mode())
+	}
+
+	contents, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		t.Fatalf("Unable to read expected file: %v", err)
+	}
+
+	if string(contents) != "bar\n" {
+		t.Fatalf("File has incorrect contents: '%s'", contents)
+	}
+}
+
+func TestWriteFileAppendExisting(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := "foo"
+	fullPath := path.Join(dir, fn)
+
+	if err := ioutil.WriteFile(fullPath, []byte("foo\n"), 0644); err != nil {
+		t.Fatalf("Unable to write existing file: %v", err)
+	}
+
+	wf := File{config.File{
+		Path:               fn,
+		Content:            "bar\n",
+		RawFilePermissions: "0600",
+		Append:             true,
+	}}
+
+	if _, err := WriteFile(&wf, dir); err != nil {
+		t.Fatalf("Processing of WriteFile failed: %v", err)
+	}
+
+	fi, err := os.Stat(fullPath)
+	if err != nil {
+		t.Fatalf("Unable to stat file: %v", err)
+	}
+
+	if fi.Mode() != os.FileMode(0644) {
+		t.Errorf("File has incorrect mode: %v", fi.Mode())
+	}
+
+	contents, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		t.Fatalf("Unable to read expected file: %v", err)
+	}
+
+	if string(contents) != "foo\nbar\n" {
+		t.Fatalf("File has incorrect contents: '%s'", contents)
+	}
+}
+
+func TestWriteFileAppendTwice(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := "hosts.allow"
+	fullPath := path.Join(dir, fn)
+
+	if err := ioutil.WriteFile(fullPath, []byte("ALL: LOCAL\n"), 0644); err != nil {
+		t.Fatalf("Unable to write existing file: %v", err)
+	}
+
+	// the config is applied again after every reboot
+	wf := File{config.File{
+		Path:    fn,
+		Content: "sshd: 10.0.0.0/8\n",
+		Append:  true,
+	}}
+	for i := 0; i < 2; i++ {
+		if _, err := WriteFile(&wf, dir); err != nil {
+			t.Fatalf("Processing of WriteFile failed: %v", err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		t.Fatalf("Unable to read expected file: %v", err)
+	}
+
+	if string(contents) != "ALL: LOCAL\nsshd: 10.0.0.0/8\n" {
+		t.Fatalf("File has incorrect contents: '%s'", contents)
+	}
+}
+
+func TestNumericOwner(t *testing.T) {
+	for _, tt := range []struct {
+		owner string
+
+		uid int
+		gid int
+		ok  bool
+	}{
+		{owner: "1000:1000", uid: 1000, gid: 1000, ok: true},
+		{owner: "0:10", uid: 0, gid: 10, ok: true},
+		{owner: "1000", uid: 1000, gid: -1, ok: true},
+		{owner: "core:core"},
+		{owner: "core"},
+		{owner: "1000:core"},
+		{owner: "core:1000"},
+		{owner: "-1:1000"},
+		{owner: ""},
+	} {
+		uid, gid, ok := numericOwner(tt.owner)
+		if uid != tt.uid || gid != tt.gid || ok != tt.ok {
+			t.Errorf("bad owner (%q): want %d, %d, %t, got %d, %d, %t", tt.owner, tt.uid, tt.gid, tt.ok, uid, gid, ok)
+		}
+	}
+}
+
+func TestWriteFileNumericOwner(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Changing the owner to ourselves is permitted without privileges.
+	wf := File{config.File{
+		Path:    "foo",
+		Content: "bar",
+		Owner:   fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}}
+	if _, err := WriteFile(&wf, dir); err != nil {
+		t.Fatalf("Processing of WriteFile failed: %v", err)
+	}
+
+	fi, err := os.Stat(path.Join(dir, "foo"))
+	if err != nil {
+		t.Fatalf("Unable to stat file: %v", err)
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid() {
+		t.Errorf("File has incorrect owner: want %d:%d, got %d:%d", os.Getuid(), os.Getgid(), st.Uid, st.Gid)
+	}
+}
@@ -15,12 +15,17 @@
 package system
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"path"
 	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
 )
 
+const defaultFlannelPrefix = "/coreos.com/network"
+
 // flannel is a top-level structure which embeds its underlying configuration,
 // config.Flannel, and provides the system-specific Unit().
 type Flannel struct {
@@ -32,6 +37,13 @@ func (fl Flannel) envVars() string {
 }
 
 func (fl Flannel) File() (*File, error) {
+	if err := config.AssertStructValid(fl.Backend); err != nil {
+		return nil, err
+	}
+	if fl.Network == "" && (fl.SubnetLen != 0 || !config.IsZero(fl.Backend)) {
+		return nil, errors.New("flannel subnet_len and backend require network")
+	}
+
 	vars := fl.envVars()
 	if vars == "" {
 		return nil, nil
@@ -42,3 +54,64 @@ func (fl Flannel) File() (*File, error) {
 		Content:            vars,
 	}}, nil
 }
+
+// Units creates a drop-in for flanneld which stores the network
+// configuration in etcd before flanneld starts, if a network is configured.
+func (fl Flannel) Units() []Unit {
+	if fl.Network == "" {
+		return nil
+	}
+	return []Unit{{config.Unit{
+		Name:    "flanneld.service",
+		Runtime: true,
+		DropIns: []config.UnitDropIn{{
+			Name:    "50-network-config.conf",
+			Content: fmt.Sprintf("[Service]\nExecStartPre=%s\n", fl.etcdctl()),
+		}},
+	}}}
+}
+
+type flannelNetwork struct {
+	Network   string          `json:"Network"`
+	SubnetLen int             `json:"SubnetLen,omitempty"`
+	Backend   *flannelBackend `json:"Backend,omitempty"`
+}
+
+type flannelBackend struct {
+	Type string `json:"Type,omitempty"`
+	VNI  int    `json:"VNI,omitempty"`
+	Port int    `json:"Port,omitempty"`
+}
+
+// networkConfig returns the JSON network configuration read by flanneld.
+func (fl Flannel) networkConfig() string {
+	n := flannelNetwork{Network: fl.Network, SubnetLen: fl.SubnetLen}
+	if !config.IsZero(fl.Backend) {
+		n.Backend = &flannelBackend{Type: fl.Backend.Type, VNI: fl.Backend.VNI, Port: fl.Backend.Port}
+	}
+	// Marshalling plain strings and ints can't fail.
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+// etcdctl returns the command which stores the network configuration using
+// the same etcd endpoints and credentials as flanneld.
+func (fl Flannel) etcdctl() string {
+	args := []string{"/usr/bin/etcdctl"}
+	for _, o := range []struct{ flag, value string }{
+		{"--endpoints", fl.EtcdEndpoints},
+		{"--ca-file", fl.EtcdCAFile},
+		{"--cert-file", fl.EtcdCertFile},
+		{"--key-file", fl.EtcdKeyFile},
+	} {
+		if o.value != "" {
+			args = append(args, o.flag+"="+o.value)
+		}
+	}
+	prefix := fl.EtcdPrefix
+	if prefix == "" {
+		prefix = defaultFlannelPrefix
+	}
+	args = append(args, "set", path.Join(prefix, "config"), "'"+fl.networkConfig()+"'")
+	return strings.Join(args, " ")
+}
@@ -38,6 +38,16 @@ func TestFlannelEnvVars(t *testing.T) {
 			`FLANNELD_ETCD_ENDPOINTS=http://12.34.56.78:4001
 FLANNELD_ETCD_PREFIX=/coreos.com/network/tenant1`,
 		},
+		{
+			config.Flannel{
+				EtcdEndpoints:          "http://12.34.56.78:2379",
+				SubnetLeaseRenewMargin: 120,
+				Network:                "10.1.0.0/16",
+				Backend:                config.FlannelBackend{Type: "vxlan"},
+			},
+			`FLANNELD_ETCD_ENDPOINTS=http://12.34.56.78:2379
+FLANNELD_SUBNET_LEASE_RENEW_MARGIN=120`,
+		},
 	} {
 		out := Flannel{tt.config}.envVars()
 		if out != tt.contents {
@@ -70,7 +80,72 @@ FLANNELD_ETCD_PREFIX=/coreos.com/network/tenant1`,
 	} {
 		file, _ := Flannel{tt.config}.File()
 		if !reflect.DeepEqual(tt.file, file) {
-			t.Errorf("bad units (%q): want %#v, got %#v", tt.config, tt.file, file)
+			t.Errorf("bad units (%+v): want %#v, got %#v", tt.config, tt.file, file)
+		}
+	}
+}
+
+func TestFlannelFileInvalid(t *testing.T) {
+	for _, tt := range []config.Flannel{
+		{Network: "10.1.0.0/16", Backend: config.FlannelBackend{Type: "bridge"}},
+		{Backend: config.FlannelBackend{Type: "vxlan"}},
+		{SubnetLen: 24},
+	} {
+		if _, err := (Flannel{tt}).File(); err == nil {
+			t.Errorf("bad error (%+v): want non-nil, got nil", tt)
+		}
+	}
+}
+
+func TestFlannelUnits(t *testing.T) {
+	for _, tt := range []struct {
+		config config.Flannel
+		units  []Unit
+	}{
+		{
+			config.Flannel{EtcdPrefix: "/coreos.com/network/tenant1"},
+			nil,
+		},
+		{
+			config.Flannel{
+				Network: "10.1.0.0/16",
+				Backend: config.FlannelBackend{Type: "host-gw"},
+			},
+			[]Unit{{config.Unit{
+				Name:    "flanneld.service",
+				Runtime: true,
+				DropIns: []config.UnitDropIn{{
+					Name: "50-network-config.conf",
+					Content: `[Service]
+ExecStartPre=/usr/bin/etcdctl set /coreos.com/network/config '{"Network":"10.1.0.0/16","Backend":{"Type":"host-gw"}}'
+`,
+				}},
+			}}},
+		},
+		{
+			config.Flannel{
+				EtcdEndpoints: "https://10.0.0.1:2379,https://10.0.0.2:2379",
+				EtcdCAFile:    "/etc/ssl/etcd/ca.pem",
+				EtcdPrefix:    "/coreos.com/network/tenant1",
+				Network:       "10.1.0.0/16",
+				SubnetLen:     24,
+				Backend:       config.FlannelBackend{Type: "vxlan", VNI: 2, Port: 8472},
+			},
+			[]Unit{{config.Unit{
+				Name:    "flanneld.service",
+				Runtime: true,
+				DropIns: []config.UnitDropIn{{
+					Name: "50-network-config.conf",
+					Content: `[Service]
+ExecStartPre=/usr/bin/etcdctl --endpoints=https://10.0.0.1:2379,https://10.0.0.2:2379 --ca-file=/etc/ssl/etcd/ca.pem set /coreos.com/network/tenant1/config '{"Network":"10.1.0.0/16","SubnetLen":24,"Backend":{"Type":"vxlan","VNI":2,"Port":8472}}'
+`,
+				}},
+			}}},
+		},
+	} {
+		units := Flannel{tt.config}.Units()
+		if !reflect.DeepEqual(tt.units, units) {
+			t.Errorf("bad units (%+v): want %#v, got %#v", tt.config, tt.units, units)
 		}
 	}
 }
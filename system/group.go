@@ -0,0 +1,112 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// GroupFile is the file listing the members of the local groups.
+const GroupFile = "/etc/group"
+
+func GroupExists(name string) bool {
+	_, err := user.LookupGroup(name)
+	return err == nil
+}
+
+func CreateGroup(g config.Group) error {
+	return groupadd([]string{g.Name})
+}
+
+func groupadd(args []string) error {
+	output, err := exec.Command("groupadd", args...).CombinedOutput()
+	if err != nil {
+		log.Printf("Command 'groupadd %s' failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return err
+}
+
+// MissingGroupMembers returns the members of the given group which are not
+// yet listed as members of the group in the given group file. A group which
+// is not in the file (e.g. because it is only in the read-only system
+// database) has no members yet.
+func MissingGroupMembers(g config.Group, path string) ([]string, error) {
+	current, err := groupMembers(g.Name, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, m := range g.Members {
+		if !contains(current, m) && !contains(missing, m) {
+			missing = append(missing, m)
+		}
+	}
+	return missing, nil
+}
+
+func groupMembers(name, path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) != 4 || fields[0] != name {
+			continue
+		}
+		if fields[3] == "" {
+			return nil, nil
+		}
+		return strings.Split(fields[3], ","), nil
+	}
+	return nil, scanner.Err()
+}
+
+// AddGroupMember adds the given user to the given group, keeping the user's
+// other groups.
+func AddGroupMember(group, member string) error {
+	args := addGroupMemberArgs(group, member)
+	output, err := exec.Command("usermod", args...).CombinedOutput()
+	if err != nil {
+		log.Printf("Command 'usermod %s' failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return err
+}
+
+func addGroupMemberArgs(group, member string) []string {
+	return []string{"--append", "--groups", group, member}
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestMissingGroupMembers(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	groups := path.Join(dir, "group")
+	if err := ioutil.WriteFile(groups, []byte("root:x:0:\nwheel:x:10:root,core\ndocker:x:233:core\n"), 0644); err != nil {
+		t.Fatalf("Unable to write group file: %v", err)
+	}
+
+	tests := []struct {
+		group config.Group
+		path  string
+
+		missing []string
+	}{
+		{
+			group:   config.Group{Name: "admins", Members: []string{"root", "core"}},
+			path:    groups,
+			missing: []string{"root", "core"},
+		},
+		{
+			group: config.Group{Name: "admins"},
+			path:  groups,
+		},
+		{
+			group:   config.Group{Name: "root", Members: []string{"core"}},
+			path:    groups,
+			missing: []string{"core"},
+		},
+		{
+			group:   config.Group{Name: "wheel", Members: []string{"core", "elroy", "root", "elroy"}},
+			path:    groups,
+			missing: []string{"elroy"},
+		},
+		{
+			group: config.Group{Name: "docker", Members: []string{"core"}},
+			path:  groups,
+		},
+		{
+			group:   config.Group{Name: "docker", Members: []string{"core"}},
+			path:    path.Join(dir, "missing"),
+			missing: []string{"core"},
+		},
+	}
+
+	for i, tt := range tests {
+		missing, err := MissingGroupMembers(tt.group, tt.path)
+		if err != nil {
+			t.Fatalf("bad error (%d): %v", i, err)
+		}
+		if !reflect.DeepEqual(tt.missing, missing) {
+			t.Errorf("bad members (%d): want %q, got %q", i, tt.missing, missing)
+		}
+	}
+}
+
+func TestAddGroupMemberArgs(t *testing.T) {
+	want := []string{"--append", "--groups", "admins", "core"}
+	if args := addGroupMemberArgs("admins", "core"); !reflect.DeepEqual(want, args) {
+		t.Errorf("bad args: want %q, got %q", want, args)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// GrowTarget is a partition which is grown, along with the disk it is on and
+// the mount point of its filesystem (if mounted).
+type GrowTarget struct {
+	Device     string
+	Disk       string
+	Number     int
+	MountPoint string
+}
+
+// Growpart is a top-level structure which embeds its underlying
+// configuration, config.Growpart, as well as the functions resolving the
+// devices to partitions (the default being ResolveGrowTarget), probing
+// block devices (ProbeBlockDevice) and running commands (ExecCommand).
+type Growpart struct {
+	Resolve func(device string) (GrowTarget, error)
+	Probe   func(device string) (BlockDevice, error)
+	Run     func(command []string) (string, error)
+	config.Growpart
+}
+
+// ExecCommand runs the given command and returns its combined output.
+func ExecCommand(command []string) (string, error) {
+	out, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	return string(out), err
+}
+
+// mountInfoPath lists the mounts of the process.
+var mountInfoPath = "/proc/self/mountinfo"
+
+// ResolveGrowTarget finds the partition given either by its path or by the
+// mount point of its filesystem, using /proc/self/mountinfo and sysfs.
+func ResolveGrowTarget(device string) (GrowTarget, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return GrowTarget{}, err
+	}
+	defer f.Close()
+	mounts, err := parseMountInfo(f)
+	if err != nil {
+		return GrowTarget{}, err
+	}
+
+	var t GrowTarget
+	if strings.HasPrefix(device, "/dev/") {
+		t.Device = device
+	} else if src, ok := mounts[path.Clean(device)]; ok {
+		t.Device, t.MountPoint = src, path.Clean(device)
+	} else {
+		return t, fmt.Errorf("%s is not a mount point", device)
+	}
+
+	resolved, err := filepath.EvalSymlinks(t.Device)
+	if err != nil {
+		return t, err
+	}
+	if t.MountPoint == "" {
+		for mp, src := range mounts {
+			if s, err := filepath.EvalSymlinks(src); err == nil && s == resolved {
+				t.MountPoint = mp
+				break
+			}
+		}
+	}
+
+	sys, err := filepath.EvalSymlinks(path.Join("/sys/class/block", path.Base(resolved)))
+	if err != nil {
+		return t, err
+	}
+	number, err := ioutil.ReadFile(path.Join(sys, "partition"))
+	if os.IsNotExist(err) {
+		return t, fmt.Errorf("%s is not a partition", t.Device)
+	} else if err != nil {
+		return t, err
+	}
+	if t.Number, err = strconv.Atoi(strings.TrimSpace(string(number))); err != nil {
+		return t, fmt.Errorf("invalid partition number of %s: %v", t.Device, err)
+	}
+	t.Disk = path.Join("/dev", path.Base(path.Dir(sys)))
+	return t, nil
+}
+
+// parseMountInfo returns the source of each mount point listed in the given
+// mountinfo file (see proc(5)). Mount points which are mounted over keep the
+// source of the last mount.
+func parseMountInfo(r io.Reader) (map[string]string, error) {
+	mounts := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// The optional fields are terminated by a single hyphen, which is
+		// followed by the filesystem type and the source.
+		sep := -1
+		for i, f := range fields {
+			if i > 5 && f == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || len(fields) < sep+3 {
+			continue
+		}
+		mounts[unescapeMountInfo(fields[4])] = unescapeMountInfo(fields[sep+2])
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountInfo replaces the octal escapes of whitespace and backslashes
+// in mountinfo fields.
+func unescapeMountInfo(s string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(s)
+}
+
+// ResizeCommand returns the command growing a filesystem of the given type
+// on the device to the size of the device. xfs and btrfs can only be grown
+// while mounted.
+func ResizeCommand(fstype string, t GrowTarget) ([]string, error) {
+	switch fstype {
+	case "ext2", "ext3", "ext4":
+		return []string{"resize2fs", t.Device}, nil
+	case "xfs", "btrfs":
+		if t.MountPoint == "" {
+			return nil, fmt.Errorf("%s filesystem on %s can only be grown while mounted", fstype, t.Device)
+		}
+		if fstype == "xfs" {
+			return []string{"xfs_growfs", t.MountPoint}, nil
+		}
+		return []string{"btrfs", "filesystem", "resize", "max", t.MountPoint}, nil
+	case "":
+		return nil, fmt.Errorf("no filesystem found on %s", t.Device)
+	default:
+		return nil, fmt.Errorf("growing %s filesystems (on %s) is not supported", fstype, t.Device)
+	}
+}
+
+// Grow grows each of the partitions with growpart and then its filesystem.
+// Partitions which already fill their disk are left alone.
+func (g Growpart) Grow() error {
+	for _, device := range g.Devices {
+		t, err := g.Resolve(device)
+		if err != nil {
+			return err
+		}
+
+		out, err := g.Run([]string{"growpart", t.Disk, strconv.Itoa(t.Number)})
+		if err != nil && strings.Contains(out, "NOCHANGE") {
+			log.Printf("Partition %s already fills %s, skipping growing it", t.Device, t.Disk)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("growpart %s %d failed with %v: %s", t.Disk, t.Number, err, out)
+		}
+
+		bd, err := g.Probe(t.Device)
+		if err != nil {
+			return err
+		}
+		resize, err := ResizeCommand(bd.Filesystem, t)
+		if err != nil {
+			return err
+		}
+		if out, err := g.Run(resize); err != nil {
+			return fmt.Errorf("%s failed with %v: %s", resize[0], err, out)
+		}
+		log.Printf("Grew partition %s and its %s filesystem", t.Device, bd.Filesystem)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+const testMountInfo = `22 28 0:21 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+28 1 253:9 / / rw,relatime shared:1 - ext4 /dev/vda9 rw
+45 28 253:3 / /usr ro,relatime shared:22 - ext4 /dev/mapper/usr ro
+60 28 253:6 / /mnt/my\040data rw,relatime - xfs /dev/vdb1 rw,attr2
+61 60 253:7 / /mnt/my\040data rw,relatime master:1 - xfs /dev/vdc1 rw,attr2
+`
+
+func TestParseMountInfo(t *testing.T) {
+	mounts, err := parseMountInfo(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	want := map[string]string{
+		"/sys":         "sysfs",
+		"/":            "/dev/vda9",
+		"/usr":         "/dev/mapper/usr",
+		"/mnt/my data": "/dev/vdc1",
+	}
+	if !reflect.DeepEqual(want, mounts) {
+		t.Errorf("bad mounts: want %q, got %q", want, mounts)
+	}
+}
+
+func TestResolveGrowTargetNotMounted(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(p string) { mountInfoPath = p }(mountInfoPath)
+	mountInfoPath = path.Join(dir, "mountinfo")
+	if err := ioutil.WriteFile(mountInfoPath, []byte(testMountInfo), 0644); err != nil {
+		t.Fatalf("Unable to write mountinfo: %v", err)
+	}
+
+	if _, err := ResolveGrowTarget("/var/lib/data"); err == nil || err.Error() != "/var/lib/data is not a mount point" {
+		t.Errorf("bad error: want %q, got %v", "/var/lib/data is not a mount point", err)
+	}
+}
+
+func TestResizeCommand(t *testing.T) {
+	mounted := GrowTarget{Device: "/dev/vda9", Disk: "/dev/vda", Number: 9, MountPoint: "/"}
+	unmounted := GrowTarget{Device: "/dev/vdb1", Disk: "/dev/vdb", Number: 1}
+	for _, tt := range []struct {
+		fstype string
+		target GrowTarget
+
+		command []string
+		err     bool
+	}{
+		{fstype: "ext4", target: mounted, command: []string{"resize2fs", "/dev/vda9"}},
+		{fstype: "ext3", target: unmounted, command: []string{"resize2fs", "/dev/vdb1"}},
+		{fstype: "xfs", target: mounted, command: []string{"xfs_growfs", "/"}},
+		{fstype: "xfs", target: unmounted, err: true},
+		{fstype: "btrfs", target: mounted, command: []string{"btrfs", "filesystem", "resize", "max", "/"}},
+		{fstype: "vfat", target: mounted, err: true},
+		{fstype: "", target: unmounted, err: true},
+	} {
+		command, err := ResizeCommand(tt.fstype, tt.target)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q, %+v): want %t, got %v", tt.fstype, tt.target, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.command, command) {
+			t.Errorf("bad command (%q, %+v): want %q, got %q", tt.fstype, tt.target, tt.command, command)
+		}
+	}
+}
+
+func TestGrowpartGrow(t *testing.T) {
+	targets := map[string]GrowTarget{
+		"/":         {Device: "/dev/vda9", Disk: "/dev/vda", Number: 9, MountPoint: "/"},
+		"/dev/vdb1": {Device: "/dev/vdb1", Disk: "/dev/vdb", Number: 1, MountPoint: "/var/lib/data"},
+	}
+	filesystems := map[string]string{"/dev/vda9": "ext4", "/dev/vdb1": "xfs"}
+
+	for _, tt := range []struct {
+		devices []string
+		full    bool
+		failing string
+
+		commands []string
+		err      bool
+	}{
+		{
+			devices:  []string{"/", "/dev/vdb1"},
+			commands: []string{"growpart /dev/vda 9", "resize2fs /dev/vda9", "growpart /dev/vdb 1", "xfs_growfs /var/lib/data"},
+		},
+		{
+			// Partitions which already fill the disk are left alone.
+			devices:  []string{"/"},
+			full:     true,
+			commands: []string{"growpart /dev/vda 9"},
+		},
+		{
+			devices:  []string{"/", "/dev/vdb1"},
+			failing:  "growpart",
+			commands: []string{"growpart /dev/vda 9"},
+			err:      true,
+		},
+		{
+			devices:  []string{"/"},
+			failing:  "resize2fs",
+			commands: []string{"growpart /dev/vda 9", "resize2fs /dev/vda9"},
+			err:      true,
+		},
+		{
+			devices: []string{"/srv"},
+			err:     true,
+		},
+	} {
+		var commands []string
+		g := Growpart{
+			Resolve: func(device string) (GrowTarget, error) {
+				t, ok := targets[device]
+				if !ok {
+					return t, errors.New("not a mount point")
+				}
+				return t, nil
+			},
+			Probe: func(device string) (BlockDevice, error) {
+				return BlockDevice{Filesystem: filesystems[device]}, nil
+			},
+			Run: func(command []string) (string, error) {
+				commands = append(commands, strings.Join(command, " "))
+				if command[0] == "growpart" && tt.full {
+					return "NOCHANGE: partition 9 is size 16775135. it cannot be grown\n", errors.New("exit status 1")
+				}
+				if command[0] == tt.failing {
+					return "failed\n", errors.New("exit status 2")
+				}
+				return "", nil
+			},
+			Growpart: config.Growpart{Devices: tt.devices},
+		}
+		if err := g.Grow(); tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.devices, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.commands, commands) {
+			t.Errorf("bad commands (%q): want %q, got %q", tt.devices, tt.commands, commands)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+const localeDir = "/usr/lib/locale"
+
+var (
+	localeName = regexp.MustCompile(`^[a-zA-Z0-9_]+(\.[a-zA-Z0-9_-]+)?(@[a-zA-Z0-9_]+)?$`)
+
+	// ErrLocaleUnknown is returned by LocaleGenerated if the locales which
+	// have been generated on the image cannot be determined.
+	ErrLocaleUnknown = errors.New("unable to determine the generated locales")
+)
+
+// SetLocale writes /etc/locale.conf (beneath root) setting LANG to the given
+// locale.
+func SetLocale(locale, root string) error {
+	if !localeName.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q", locale)
+	}
+
+	_, err := WriteFile(&File{config.File{
+		Path:               path.Join("etc", "locale.conf"),
+		RawFilePermissions: "0644",
+		Content:            fmt.Sprintf("LANG=%s\n", locale),
+	}}, root)
+	return err
+}
+
+// LocaleGenerated returns whether the given locale has been generated on the
+// image beneath root, either as a directory in /usr/lib/locale or (if root is
+// "/") in the locale archive. ErrLocaleUnknown is returned if neither can be
+// checked.
+func LocaleGenerated(locale, root string) (bool, error) {
+	name := normalizeLocale(locale)
+	switch name {
+	case "C", "POSIX", "C.utf8":
+		return true, nil
+	}
+
+	dir := path.Join(root, localeDir)
+	if _, err := os.Stat(path.Join(dir, name)); err == nil {
+		return true, nil
+	}
+
+	// The locale archive can only be listed for the running system.
+	if _, err := os.Stat(path.Join(dir, "locale-archive")); os.IsNotExist(err) {
+		if _, err := os.Stat(dir); err == nil {
+			return false, nil
+		}
+		return false, ErrLocaleUnknown
+	} else if err != nil || path.Clean(root) != "/" {
+		return false, ErrLocaleUnknown
+	}
+
+	out, err := exec.Command("localedef", "--list-archive").Output()
+	if err != nil {
+		return false, ErrLocaleUnknown
+	}
+	for _, l := range strings.Fields(string(out)) {
+		if normalizeLocale(l) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// normalizeLocale normalizes the codeset of the locale the way glibc does
+// (e.g. en_US.UTF-8 becomes en_US.utf8).
+func normalizeLocale(locale string) string {
+	i := strings.Index(locale, ".")
+	if i < 0 {
+		return locale
+	}
+	j := strings.Index(locale, "@")
+	if j < i {
+		j = len(locale)
+	}
+
+	codeset := strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, locale[i+1:j])
+	return locale[:i+1] + codeset + locale[j:]
+}
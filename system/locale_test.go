@@ -0,0 +1,104 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSetLocale(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, locale := range []string{"", "en_US.UTF-8\nLC_ALL=C", "../en_US", "en US"} {
+		if err := SetLocale(locale, dir); err == nil {
+			t.Errorf("bad locale (%q): want error, got nil", locale)
+		}
+	}
+
+	if err := SetLocale("de_DE.UTF-8@euro", dir); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+	if content, err := ioutil.ReadFile(path.Join(dir, "etc", "locale.conf")); err != nil {
+		t.Fatalf("Unable to read /etc/locale.conf: %v", err)
+	} else if string(content) != "LANG=de_DE.UTF-8@euro\n" {
+		t.Fatalf("bad /etc/locale.conf: want %q, got %q", "LANG=de_DE.UTF-8@euro\n", content)
+	}
+}
+
+func TestLocaleGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := LocaleGenerated("en_US.UTF-8", dir); err != ErrLocaleUnknown {
+		t.Errorf("bad error without locales: want %v, got %v", ErrLocaleUnknown, err)
+	}
+
+	if err := os.MkdirAll(path.Join(dir, "usr", "lib", "locale", "en_US.utf8"), 0755); err != nil {
+		t.Fatalf("Unable to create locale directory: %v", err)
+	}
+
+	for _, tt := range []struct {
+		locale    string
+		generated bool
+	}{
+		{"C", true},
+		{"C.UTF-8", true},
+		{"en_US.UTF-8", true},
+		{"en_US.utf8", true},
+		{"de_DE.UTF-8", false},
+		{"en_US", false},
+	} {
+		generated, err := LocaleGenerated(tt.locale, dir)
+		if err != nil {
+			t.Errorf("bad error (%q): want nil, got %v", tt.locale, err)
+		}
+		if generated != tt.generated {
+			t.Errorf("bad generated (%q): want %t, got %t", tt.locale, tt.generated, generated)
+		}
+	}
+
+	if err := ioutil.WriteFile(path.Join(dir, "usr", "lib", "locale", "locale-archive"), nil, 0644); err != nil {
+		t.Fatalf("Unable to write locale archive: %v", err)
+	}
+	if _, err := LocaleGenerated("de_DE.UTF-8", dir); err != ErrLocaleUnknown {
+		t.Errorf("bad error with locale archive: want %v, got %v", ErrLocaleUnknown, err)
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	for _, tt := range []struct {
+		locale     string
+		normalized string
+	}{
+		{"C", "C"},
+		{"en_US.UTF-8", "en_US.utf8"},
+		{"de_DE.ISO-8859-15@euro", "de_DE.iso885915@euro"},
+		{"sr_RS@latin", "sr_RS@latin"},
+	} {
+		if normalized := normalizeLocale(tt.locale); normalized != tt.normalized {
+			t.Errorf("bad locale (%q): want %q, got %q", tt.locale, tt.normalized, normalized)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// Modules is a top-level structure which embeds its underlying
+// configuration, config.Modules, as well as a function for loading a module
+// (the default implementation calling modprobe), and provides the
+// system-specific Files() and Load().
+type Modules struct {
+	Modprobe func(name string) error
+	config.Modules
+}
+
+// Modprobe loads the given kernel module.
+func Modprobe(name string) error {
+	if out, err := exec.Command("modprobe", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("modprobe %s failed with %v: %s", name, err, out)
+	}
+	return nil
+}
+
+// Files generates a modules-load.d file listing the modules and, if any of
+// the modules have options, a modprobe.d file setting them.
+func (m Modules) Files() ([]File, error) {
+	modules, err := m.Deduped()
+	if err != nil || len(modules) == 0 {
+		return nil, err
+	}
+
+	load := ""
+	options := ""
+	for _, module := range modules {
+		load += module.Name + "\n"
+		if module.Options != "" {
+			options += fmt.Sprintf("options %s %s\n", module.Name, module.Options)
+		}
+	}
+
+	files := []File{{config.File{
+		Path:               path.Join("etc", "modules-load.d", "cloudinit.conf"),
+		RawFilePermissions: "0644",
+		Content:            load,
+	}}}
+	if options != "" {
+		files = append(files, File{config.File{
+			Path:               path.Join("etc", "modprobe.d", "cloudinit.conf"),
+			RawFilePermissions: "0644",
+			Content:            options,
+		}})
+	}
+	return files, nil
+}
+
+// Load loads each of the modules so that they are available without a
+// reboot. A module failing to load doesn't prevent the others from being
+// loaded; the errors of all of the failed modules are returned.
+func (m Modules) Load() []error {
+	modules, err := m.Deduped()
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, module := range modules {
+		if err := m.Modprobe(module.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
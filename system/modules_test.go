@@ -0,0 +1,89 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestModulesFiles(t *testing.T) {
+	for _, tt := range []struct {
+		config config.Modules
+		files  []File
+		err    bool
+	}{
+		{},
+		{
+			config: config.Modules{{Name: "overlay"}, {Name: "br_netfilter"}, {Name: "overlay"}},
+			files: []File{{config.File{
+				Path:               "etc/modules-load.d/cloudinit.conf",
+				RawFilePermissions: "0644",
+				Content:            "overlay\nbr_netfilter\n",
+			}}},
+		},
+		{
+			config: config.Modules{{Name: "overlay"}, {Name: "bonding", Options: "mode=4 miimon=100"}},
+			files: []File{
+				{config.File{
+					Path:               "etc/modules-load.d/cloudinit.conf",
+					RawFilePermissions: "0644",
+					Content:            "overlay\nbonding\n",
+				}},
+				{config.File{
+					Path:               "etc/modprobe.d/cloudinit.conf",
+					RawFilePermissions: "0644",
+					Content:            "options bonding mode=4 miimon=100\n",
+				}},
+			},
+		},
+		{
+			config: config.Modules{{Name: "bad name"}},
+			err:    true,
+		},
+	} {
+		files, err := Modules{Modules: tt.config}.Files()
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want %t, got %v", tt.config, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.files, files) {
+			t.Errorf("bad files (%+v): want %#v, got %#v", tt.config, tt.files, files)
+		}
+	}
+}
+
+func TestModulesLoad(t *testing.T) {
+	var loaded []string
+	errs := Modules{
+		Modules: config.Modules{{Name: "overlay"}, {Name: "missing"}, {Name: "br_netfilter"}, {Name: "overlay"}},
+		Modprobe: func(name string) error {
+			loaded = append(loaded, name)
+			if name == "missing" {
+				return errors.New("module not found")
+			}
+			return nil
+		},
+	}.Load()
+
+	if want := []string{"overlay", "missing", "br_netfilter"}; !reflect.DeepEqual(want, loaded) {
+		t.Errorf("bad loaded modules: want %q, got %q", want, loaded)
+	}
+	if len(errs) != 1 || errs[0].Error() != "module not found" {
+		t.Errorf("bad errors: want [module not found], got %v", errs)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// networkFilesystems are the filesystem types which are ordered against
+// remote-fs.target rather than local-fs.target.
+var networkFilesystems = map[string]bool{
+	"cifs":      true,
+	"glusterfs": true,
+	"nfs":       true,
+	"nfs4":      true,
+	"smbfs":     true,
+}
+
+type Mount struct {
+	config.Mount
+}
+
+// Units returns the .mount unit for the mount, named after its (escaped)
+// mount point. The type defaults to "auto" and the options to "defaults".
+func (m Mount) Units() []Unit {
+	if m.Where == "" {
+		return nil
+	}
+
+	typ := m.Type
+	if typ == "" {
+		typ = "auto"
+	}
+	options := m.Options
+	if options == "" {
+		options = "defaults"
+	}
+	target := "local-fs.target"
+	if networkFilesystems[typ] {
+		target = "remote-fs.target"
+	}
+
+	where := path.Clean(m.Where)
+	content := fmt.Sprintf("[Mount]\nWhat=%s\nWhere=%s\nType=%s\nOptions=%s\n\n[Install]\nWantedBy=%s\n", m.What, where, typ, options, target)
+
+	return []Unit{{config.Unit{
+		Name:    EscapePath(where) + ".mount",
+		Content: content,
+		Enable:  true,
+		Command: "start",
+	}}}
+}
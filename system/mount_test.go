@@ -0,0 +1,66 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestMountUnits(t *testing.T) {
+	for _, tt := range []struct {
+		config config.Mount
+		units  []Unit
+	}{
+		{
+			config.Mount{},
+			nil,
+		},
+		{
+			config.Mount{What: "/dev/sdb1", Where: "/var/lib/docker"},
+			[]Unit{{config.Unit{
+				Name:    "var-lib-docker.mount",
+				Content: "[Mount]\nWhat=/dev/sdb1\nWhere=/var/lib/docker\nType=auto\nOptions=defaults\n\n[Install]\nWantedBy=local-fs.target\n",
+				Enable:  true,
+				Command: "start",
+			}}},
+		},
+		{
+			config.Mount{What: "LABEL=data", Where: "/mnt/data-1/", Type: "ext4", Options: "noatime,ro"},
+			[]Unit{{config.Unit{
+				Name:    "mnt-data\\x2d1.mount",
+				Content: "[Mount]\nWhat=LABEL=data\nWhere=/mnt/data-1\nType=ext4\nOptions=noatime,ro\n\n[Install]\nWantedBy=local-fs.target\n",
+				Enable:  true,
+				Command: "start",
+			}}},
+		},
+		{
+			config.Mount{What: "server:/export", Where: "/mnt/nfs", Type: "nfs"},
+			[]Unit{{config.Unit{
+				Name:    "mnt-nfs.mount",
+				Content: "[Mount]\nWhat=server:/export\nWhere=/mnt/nfs\nType=nfs\nOptions=defaults\n\n[Install]\nWantedBy=remote-fs.target\n",
+				Enable:  true,
+				Command: "start",
+			}}},
+		},
+	} {
+		units := Mount{tt.config}.Units()
+		if !reflect.DeepEqual(tt.units, units) {
+			t.Errorf("bad units (%+v): want %#v, got %#v", tt.config, tt.units, units)
+		}
+	}
+}
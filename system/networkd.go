@@ -15,6 +15,7 @@
 package system
 
 import (
+	"fmt"
 	"log"
 	"net"
 	"os/exec"
@@ -87,6 +88,16 @@ func maybeProbeBonding(interfaces []network.InterfaceGenerator) error {
 	return nil
 }
 
+// ApplyNetplan generates the backend configuration from the netplan config
+// and applies it.
+func ApplyNetplan() error {
+	log.Printf("Applying netplan config\n")
+	if out, err := exec.Command("netplan", "apply").CombinedOutput(); err != nil {
+		return fmt.Errorf("netplan apply failed with %v: %s", err, out)
+	}
+	return nil
+}
+
 func restartNetworkd() error {
 	log.Printf("Restarting networkd.service\n")
 	networkd := Unit{config.Unit{Name: "systemd-networkd.service"}}
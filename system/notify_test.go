@@ -0,0 +1,94 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// listenNotify creates a fake notify socket in dir and points $NOTIFY_SOCKET
+// at it. The returned function restores the environment.
+func listenNotify(t *testing.T, dir string) (*net.UnixConn, func()) {
+	socket := path.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Unable to listen on %q: %v", socket, err)
+	}
+	old, ok := os.LookupEnv("NOTIFY_SOCKET")
+	os.Setenv("NOTIFY_SOCKET", socket)
+	return conn, func() {
+		if ok {
+			os.Setenv("NOTIFY_SOCKET", old)
+		} else {
+			os.Unsetenv("NOTIFY_SOCKET")
+		}
+		conn.Close()
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conn, restore := listenNotify(t, dir)
+	defer restore()
+
+	for _, state := range []string{"STATUS=Fetching user-data", "READY=1\nSTATUS=Done"} {
+		if err := SdNotify(state); err != nil {
+			t.Fatalf("bad error (%q): want nil, got %v", state, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Unable to read notification: %v", err)
+		}
+		if got := string(buf[:n]); got != state {
+			t.Errorf("bad notification: want %q, got %q", state, got)
+		}
+	}
+}
+
+func TestSdNotifyUnset(t *testing.T) {
+	if old, ok := os.LookupEnv("NOTIFY_SOCKET"); ok {
+		defer os.Setenv("NOTIFY_SOCKET", old)
+	}
+	os.Unsetenv("NOTIFY_SOCKET")
+
+	if err := SdNotify("READY=1"); err != nil {
+		t.Errorf("bad error: want nil, got %v", err)
+	}
+}
+
+func TestSdNotifyMissingSocket(t *testing.T) {
+	if old, ok := os.LookupEnv("NOTIFY_SOCKET"); ok {
+		defer os.Setenv("NOTIFY_SOCKET", old)
+	} else {
+		defer os.Unsetenv("NOTIFY_SOCKET")
+	}
+	os.Setenv("NOTIFY_SOCKET", "/nonexistent/notify")
+
+	if err := SdNotify("READY=1"); err == nil {
+		t.Errorf("bad error: want non-nil, got nil")
+	}
+}
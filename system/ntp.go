@@ -0,0 +1,70 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+const timesyncdUnit = "systemd-timesyncd.service"
+
+// NTP is a top-level structure which embeds its underlying configuration,
+// config.NTP, and provides the system-specific File() and Units().
+type NTP struct {
+	config.NTP
+}
+
+func (n NTP) configured() bool {
+	return len(n.Servers) > 0 || len(n.FallbackServers) > 0
+}
+
+// File generates a drop-in for timesyncd.conf with the configured servers.
+func (n NTP) File() (*File, error) {
+	if !n.configured() {
+		return nil, nil
+	}
+	if err := n.CheckServers(); err != nil {
+		return nil, err
+	}
+
+	content := "[Time]\n"
+	if len(n.Servers) > 0 {
+		content += fmt.Sprintf("NTP=%s\n", strings.Join(n.Servers, " "))
+	}
+	if len(n.FallbackServers) > 0 {
+		content += fmt.Sprintf("FallbackNTP=%s\n", strings.Join(n.FallbackServers, " "))
+	}
+
+	return &File{config.File{
+		Path:               path.Join("etc", "systemd", "timesyncd.conf.d", "10-cloudinit.conf"),
+		RawFilePermissions: "0644",
+		Content:            content,
+	}}, nil
+}
+
+// Units restarts systemd-timesyncd so that it picks up the new servers.
+func (n NTP) Units() []Unit {
+	if !n.configured() {
+		return nil
+	}
+	return []Unit{{config.Unit{
+		Name:    timesyncdUnit,
+		Command: "restart",
+	}}}
+}
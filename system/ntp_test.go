@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestNTPFile(t *testing.T) {
+	for _, tt := range []struct {
+		config config.NTP
+		file   *File
+		err    bool
+	}{
+		{
+			config: config.NTP{},
+		},
+		{
+			config: config.NTP{
+				Servers:         []string{"ntp1.example.com", "10.0.0.1"},
+				FallbackServers: []string{"0.pool.ntp.org"},
+			},
+			file: &File{config.File{
+				Path:               "etc/systemd/timesyncd.conf.d/10-cloudinit.conf",
+				RawFilePermissions: "0644",
+				Content:            "[Time]\nNTP=ntp1.example.com 10.0.0.1\nFallbackNTP=0.pool.ntp.org\n",
+			}},
+		},
+		{
+			config: config.NTP{FallbackServers: []string{"0.pool.ntp.org"}},
+			file: &File{config.File{
+				Path:               "etc/systemd/timesyncd.conf.d/10-cloudinit.conf",
+				RawFilePermissions: "0644",
+				Content:            "[Time]\nFallbackNTP=0.pool.ntp.org\n",
+			}},
+		},
+		{
+			config: config.NTP{Servers: []string{"not a host"}},
+			err:    true,
+		},
+	} {
+		file, err := NTP{tt.config}.File()
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want %t, got %v", tt.config, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.file, file) {
+			t.Errorf("bad file (%+v): want %#v, got %#v", tt.config, tt.file, file)
+		}
+	}
+}
+
+func TestNTPUnits(t *testing.T) {
+	for _, tt := range []struct {
+		config config.NTP
+		units  []Unit
+	}{
+		{
+			config: config.NTP{},
+		},
+		{
+			config: config.NTP{Servers: []string{"ntp1.example.com"}},
+			units: []Unit{{config.Unit{
+				Name:    "systemd-timesyncd.service",
+				Command: "restart",
+			}}},
+		},
+	} {
+		if units := (NTP{tt.config}).Units(); !reflect.DeepEqual(tt.units, units) {
+			t.Errorf("bad units (%+v): want %#v, got %#v", tt.config, tt.units, units)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+const (
+	packagesUnit  = "coreos-cloudinit-packages.service"
+	packagesStamp = "packages-layered"
+)
+
+// ErrNoRpmOstree is returned when packages cannot be layered because
+// rpm-ostree is not available (e.g. on classic CoreOS).
+var ErrNoRpmOstree = errors.New("rpm-ostree is not available")
+
+// Packages is a top-level structure which embeds its underlying
+// configuration, config.Packages, as well as a function returning the
+// packages which are already layered (the default implementation querying
+// rpm-ostree) and the workspace in which the unit leaves its stamp, and
+// provides the system-specific Units().
+type Packages struct {
+	Layered   func() ([]string, error)
+	Workspace string
+	config.Packages
+}
+
+// LayeredPackages returns the packages requested in any of the deployments
+// known to rpm-ostree.
+func LayeredPackages() ([]string, error) {
+	if _, err := exec.LookPath("rpm-ostree"); err != nil {
+		return nil, ErrNoRpmOstree
+	}
+
+	out, err := exec.Command("rpm-ostree", "status", "--json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed querying rpm-ostree status: %v", err)
+	}
+	return parseLayeredPackages(out)
+}
+
+func parseLayeredPackages(status []byte) ([]string, error) {
+	var s struct {
+		Deployments []struct {
+			RequestedPackages []string `json:"requested-packages"`
+		} `json:"deployments"`
+	}
+	if err := json.Unmarshal(status, &s); err != nil {
+		return nil, fmt.Errorf("failed parsing rpm-ostree status: %v", err)
+	}
+
+	var layered []string
+	for _, d := range s.Deployments {
+		layered = append(layered, d.RequestedPackages...)
+	}
+	return layered, nil
+}
+
+// Units generates a oneshot unit which layers the packages not yet layered
+// and reboots into the new deployment. The unit only ever runs once, so that
+// a failing package can't cause a reboot loop. If rpm-ostree isn't available,
+// no units are generated.
+func (p Packages) Units() []Unit {
+	if len(p.Packages) == 0 {
+		return nil
+	}
+
+	layered, err := p.Layered()
+	if err != nil {
+		log.Printf("Not layering packages %v: %v", []string(p.Packages), err)
+		return nil
+	}
+
+	skip := map[string]bool{}
+	for _, name := range layered {
+		skip[name] = true
+	}
+	var pkgs []string
+	for _, name := range p.Packages {
+		if !skip[name] {
+			pkgs = append(pkgs, name)
+			skip[name] = true
+		}
+	}
+	if len(pkgs) == 0 {
+		log.Printf("Packages %v are already layered", []string(p.Packages))
+		return nil
+	}
+
+	content := fmt.Sprintf(`[Unit]
+Description=Layer packages requested by cloud-config
+Wants=network-online.target
+After=network-online.target
+ConditionPathExists=!%[1]s
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStartPre=/usr/bin/mkdir -p %[2]s
+ExecStartPre=/usr/bin/touch %[1]s
+ExecStart=/usr/bin/rpm-ostree install --idempotent %[3]s
+ExecStartPost=/usr/bin/systemctl --no-block reboot
+`, path.Join(p.Workspace, packagesStamp), p.Workspace, strings.Join(pkgs, " "))
+
+	return []Unit{{config.Unit{
+		Name:    packagesUnit,
+		Content: content,
+		Command: "start",
+	}}}
+}
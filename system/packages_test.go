@@ -0,0 +1,102 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestParseLayeredPackages(t *testing.T) {
+	for _, tt := range []struct {
+		status  string
+		layered []string
+		err     bool
+	}{
+		{
+			status: `{"deployments": []}`,
+		},
+		{
+			status:  `{"deployments": [{"booted": true, "requested-packages": ["htop"]}, {"requested-packages": ["htop", "vim"]}]}`,
+			layered: []string{"htop", "htop", "vim"},
+		},
+		{
+			status: `not json`,
+			err:    true,
+		},
+	} {
+		layered, err := parseLayeredPackages([]byte(tt.status))
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.status, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.layered, layered) {
+			t.Errorf("bad packages (%q): want %q, got %q", tt.status, tt.layered, layered)
+		}
+	}
+}
+
+func TestPackagesUnits(t *testing.T) {
+	for _, tt := range []struct {
+		packages config.Packages
+		layered  []string
+		err      error
+
+		install string
+	}{
+		{},
+		{
+			packages: config.Packages{"htop", "vim"},
+			err:      ErrNoRpmOstree,
+		},
+		{
+			packages: config.Packages{"htop", "vim"},
+			layered:  []string{"htop", "vim"},
+		},
+		{
+			packages: config.Packages{"htop", "vim", "htop", "tmux"},
+			layered:  []string{"vim"},
+			install:  "ExecStart=/usr/bin/rpm-ostree install --idempotent htop tmux\n",
+		},
+	} {
+		units := Packages{
+			Packages:  tt.packages,
+			Layered:   func() ([]string, error) { return tt.layered, tt.err },
+			Workspace: "/tmp/workspace",
+		}.Units()
+
+		if tt.install == "" {
+			if units != nil {
+				t.Errorf("bad units (%q): want nil, got %#v", tt.packages, units)
+			}
+			continue
+		}
+		if len(units) != 1 || units[0].Name != "coreos-cloudinit-packages.service" || units[0].Command != "start" {
+			t.Errorf("bad units (%q): got %#v", tt.packages, units)
+			continue
+		}
+		if !strings.Contains(units[0].Content, tt.install) {
+			t.Errorf("bad unit content (%q): want %q in %q", tt.packages, tt.install, units[0].Content)
+		}
+		if !strings.Contains(units[0].Content, "ConditionPathExists=!/tmp/workspace/packages-layered\n") {
+			t.Errorf("bad unit content (%q): missing reboot guard in %q", tt.packages, units[0].Content)
+		}
+		if !strings.Contains(units[0].Content, "ExecStartPre=/usr/bin/touch /tmp/workspace/packages-layered\n") {
+			t.Errorf("bad unit content (%q): missing stamp in %q", tt.packages, units[0].Content)
+		}
+	}
+}
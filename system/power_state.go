@@ -0,0 +1,87 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// PowerState is a top-level structure which embeds its underlying
+// configuration, config.PowerState, and provides the command performing the
+// power transition.
+type PowerState struct {
+	config.PowerState
+}
+
+var powerStateFlags = map[string]string{
+	"reboot":   "--reboot",
+	"poweroff": "--poweroff",
+	"halt":     "--halt",
+}
+
+// Command returns the shutdown command which schedules the power transition,
+// or nil if there is none. The delay is given in minutes and defaults to
+// "now".
+func (ps PowerState) Command() ([]string, error) {
+	if ps.Mode == "" {
+		return nil, nil
+	}
+	if err := config.AssertStructValid(ps.PowerState); err != nil {
+		return nil, err
+	}
+
+	delay := ps.Delay
+	if delay == "" {
+		delay = "now"
+	} else if delay != "now" && !strings.HasPrefix(delay, "+") {
+		delay = "+" + delay
+	}
+
+	command := []string{"shutdown", powerStateFlags[ps.Mode], delay}
+	if ps.Message != "" {
+		command = append(command, ps.Message)
+	}
+	return command, nil
+}
+
+// ConditionMet reports whether the power transition should be performed: if
+// a condition is given, it is run by the shell and has to exit with status 0.
+func (ps PowerState) ConditionMet() bool {
+	if ps.Condition == "" {
+		return true
+	}
+	if output, err := exec.Command("/bin/sh", "-c", ps.Condition).CombinedOutput(); err != nil {
+		log.Printf("Condition %q of power_state not met: %v\n%s", ps.Condition, err, output)
+		return false
+	}
+	return true
+}
+
+// Apply schedules the power transition.
+func (ps PowerState) Apply() error {
+	command, err := ps.Command()
+	if err != nil || command == nil {
+		return err
+	}
+	output, err := exec.Command(command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		log.Printf("Command '%s' failed: %v\n%s", strings.Join(command, " "), err, output)
+	}
+	return err
+}
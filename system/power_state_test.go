@@ -0,0 +1,84 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestPowerStateCommand(t *testing.T) {
+	for _, tt := range []struct {
+		config config.PowerState
+
+		command []string
+		err     error
+	}{
+		{
+			config: config.PowerState{},
+		},
+		{
+			config:  config.PowerState{Mode: "reboot"},
+			command: []string{"shutdown", "--reboot", "now"},
+		},
+		{
+			config:  config.PowerState{Mode: "poweroff", Delay: "now"},
+			command: []string{"shutdown", "--poweroff", "now"},
+		},
+		{
+			config:  config.PowerState{Mode: "halt", Delay: "5"},
+			command: []string{"shutdown", "--halt", "+5"},
+		},
+		{
+			config:  config.PowerState{Mode: "reboot", Delay: "+30", Message: "Rebooting to apply the kernel arguments"},
+			command: []string{"shutdown", "--reboot", "+30", "Rebooting to apply the kernel arguments"},
+		},
+		{
+			config: config.PowerState{Mode: "restart"},
+			err:    &config.ErrorValid{Value: "restart", Valid: "^(reboot|poweroff|halt)$", Field: "Mode"},
+		},
+		{
+			config: config.PowerState{Mode: "reboot", Delay: "soon"},
+			err:    &config.ErrorValid{Value: "soon", Valid: "^(now|\\+?[0-9]+)$", Field: "Delay"},
+		},
+	} {
+		command, err := PowerState{tt.config}.Command()
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%+v): want %v, got %v", tt.config, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.command, command) {
+			t.Errorf("bad command (%+v): want %q, got %q", tt.config, tt.command, command)
+		}
+	}
+}
+
+func TestPowerStateConditionMet(t *testing.T) {
+	for _, tt := range []struct {
+		condition string
+		met       bool
+	}{
+		{condition: "", met: true},
+		{condition: "true", met: true},
+		{condition: "test -d /", met: true},
+		{condition: "false", met: false},
+		{condition: "exit 3", met: false},
+	} {
+		if met := (PowerState{config.PowerState{Mode: "reboot", Condition: tt.condition}}).ConditionMet(); met != tt.met {
+			t.Errorf("bad condition (%q): want %t, got %t", tt.condition, tt.met, met)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// RunCommand runs the given command of runcmd and returns its combined
+// output. Commands given as a string are run by /bin/sh, those given as a
+// list of arguments are executed directly.
+func RunCommand(c config.Command) (string, error) {
+	if err := c.Check(); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", c.Shell)
+	if c.Args != nil {
+		cmd = exec.Command(c.Args[0], c.Args[1:]...)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("command %s failed with %v", c, err)
+	}
+	return string(output), nil
+}
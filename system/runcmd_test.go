@@ -0,0 +1,61 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestRunCommand(t *testing.T) {
+	for _, tt := range []struct {
+		cmd config.Command
+
+		output string
+		err    bool
+	}{
+		{
+			cmd:    config.Command{Shell: "echo hello; echo world >&2"},
+			output: "hello\nworld\n",
+		},
+		{
+			// The arguments aren't interpreted by a shell.
+			cmd:    config.Command{Args: []string{"echo", "$HOME", "a;b", ">", "x"}},
+			output: "$HOME a;b > x\n",
+		},
+		{
+			cmd:    config.Command{Shell: "echo failed; exit 3"},
+			output: "failed\n",
+			err:    true,
+		},
+		{
+			cmd: config.Command{Args: []string{"/nonexistent/command"}},
+			err: true,
+		},
+		{
+			cmd: config.Command{},
+			err: true,
+		},
+	} {
+		output, err := RunCommand(tt.cmd)
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%#v): want %t, got %v", tt.cmd, tt.err, err)
+		}
+		if output != tt.output {
+			t.Errorf("bad output (%#v): want %q, got %q", tt.cmd, tt.output, output)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// selinuxXattr is the extended attribute which holds the SELinux context of
+// a file.
+const selinuxXattr = "security.selinux"
+
+// selinuxEnabled reports whether SELinux is enabled on the running system,
+// i.e. whether selinuxfs is mounted.
+var selinuxEnabled = func() bool {
+	_, err := os.Stat("/sys/fs/selinux/enforce")
+	return err == nil
+}
+
+// setFileCon sets the SELinux context of the file at path, like libselinux's
+// setfilecon().
+var setFileCon = func(path, context string) error {
+	return syscall.Setxattr(path, selinuxXattr, selinuxXattrValue(context), 0)
+}
+
+// restorecon resets the SELinux context of the file at path to the default
+// of the loaded policy.
+var restorecon = func(path string) error {
+	return exec.Command("restorecon", restoreconArgs(path)...).Run()
+}
+
+// selinuxXattrValue returns the value of the extended attribute for the
+// given context. Like setfilecon(), it includes the terminating NUL.
+func selinuxXattrValue(context string) []byte {
+	return append([]byte(context), 0)
+}
+
+func restoreconArgs(path string) []string {
+	return []string{"-F", path}
+}
+
+// applySELinuxContext labels the file at path with the SELinux context of f.
+// If the context can't be set, the default context of the policy is
+// restored instead. The context is ignored if SELinux isn't enabled.
+func applySELinuxContext(f *File, path string) error {
+	if f.SELinuxContext == "" {
+		return nil
+	}
+	if !selinuxEnabled() {
+		log.Printf("SELinux is not enabled, ignoring context %q of %q", f.SELinuxContext, path)
+		return nil
+	}
+
+	err := setFileCon(path, f.SELinuxContext)
+	if err == nil {
+		return nil
+	}
+	log.Printf("Failed to set SELinux context %q of %q, restoring the default context: %v", f.SELinuxContext, path, err)
+	if err := restorecon(path); err != nil {
+		return fmt.Errorf("Unable to label %q (%v)", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestSELinuxArgs(t *testing.T) {
+	if v := selinuxXattrValue("system_u:object_r:etc_t:s0"); string(v) != "system_u:object_r:etc_t:s0\x00" {
+		t.Errorf("bad xattr value: want %q, got %q", "system_u:object_r:etc_t:s0\x00", v)
+	}
+	if args := restoreconArgs("/etc/motd"); !reflect.DeepEqual([]string{"-F", "/etc/motd"}, args) {
+		t.Errorf("bad restorecon args: want %v, got %v", []string{"-F", "/etc/motd"}, args)
+	}
+}
+
+func TestApplySELinuxContext(t *testing.T) {
+	defer func(e func() bool, s func(string, string) error, r func(string) error) {
+		selinuxEnabled, setFileCon, restorecon = e, s, r
+	}(selinuxEnabled, setFileCon, restorecon)
+
+	for _, tt := range []struct {
+		context      string
+		enabled      bool
+		setErr       error
+		restoreErr   error
+		setCalls     []string
+		restoreCalls []string
+		err          bool
+	}{
+		{enabled: true},
+		{context: "system_u:object_r:etc_t:s0"},
+		{
+			context:  "system_u:object_r:etc_t:s0",
+			enabled:  true,
+			setCalls: []string{"/etc/motd system_u:object_r:etc_t:s0"},
+		},
+		{
+			context:      "system_u:object_r:etc_t:s0",
+			enabled:      true,
+			setErr:       errors.New("operation not supported"),
+			setCalls:     []string{"/etc/motd system_u:object_r:etc_t:s0"},
+			restoreCalls: []string{"/etc/motd"},
+		},
+		{
+			context:      "system_u:object_r:etc_t:s0",
+			enabled:      true,
+			setErr:       errors.New("operation not supported"),
+			restoreErr:   errors.New("exit status 1"),
+			setCalls:     []string{"/etc/motd system_u:object_r:etc_t:s0"},
+			restoreCalls: []string{"/etc/motd"},
+			err:          true,
+		},
+	} {
+		var setCalls, restoreCalls []string
+		selinuxEnabled = func() bool { return tt.enabled }
+		setFileCon = func(path, context string) error {
+			setCalls = append(setCalls, path+" "+context)
+			return tt.setErr
+		}
+		restorecon = func(path string) error {
+			restoreCalls = append(restoreCalls, path)
+			return tt.restoreErr
+		}
+
+		err := applySELinuxContext(&File{config.File{SELinuxContext: tt.context}}, "/etc/motd")
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%+v): want %t, got %v", tt, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.setCalls, setCalls) {
+			t.Errorf("bad setfilecon calls (%+v): want %v, got %v", tt, tt.setCalls, setCalls)
+		}
+		if !reflect.DeepEqual(tt.restoreCalls, restoreCalls) {
+			t.Errorf("bad restorecon calls (%+v): want %v, got %v", tt, tt.restoreCalls, restoreCalls)
+		}
+	}
+}
+
+func TestWriteFileSELinuxContext(t *testing.T) {
+	defer func(e func() bool, s func(string, string) error) {
+		selinuxEnabled, setFileCon = e, s
+	}(selinuxEnabled, setFileCon)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var calls []string
+	selinuxEnabled = func() bool { return true }
+	setFileCon = func(path, context string) error {
+		calls = append(calls, path+" "+context)
+		return nil
+	}
+
+	for _, f := range []config.File{
+		{Path: "foo", Content: "bar", SELinuxContext: "system_u:object_r:etc_t:s0"},
+		{Path: "baz", Content: "bar", Append: true, SELinuxContext: "system_u:object_r:etc_t:s0"},
+		{Path: "baz", Content: "bar", Append: true, SELinuxContext: "system_u:object_r:etc_t:s0"},
+	} {
+		if _, err := WriteFile(&File{f}, dir); err != nil {
+			t.Fatalf("Processing of WriteFile failed: %v", err)
+		}
+	}
+
+	want := []string{
+		path.Join(dir, "foo") + " system_u:object_r:etc_t:s0",
+		path.Join(dir, "baz") + " system_u:object_r:etc_t:s0",
+	}
+	if !reflect.DeepEqual(want, calls) {
+		t.Errorf("bad setfilecon calls: want %v, got %v", want, calls)
+	}
+}
@@ -19,21 +19,102 @@ import (
 	"io"
 	"io/ioutil"
 	"os/exec"
+	osuser "os/user"
+	"path"
 	"strings"
 )
 
+// SSHKeyBlob returns the base64 encoded data of the given public key, which
+// identifies the key regardless of its options and comment. If the key type
+// cannot be found, the whole (trimmed) key is returned.
+func SSHKeyBlob(key string) string {
+	fields := strings.Fields(key)
+	for i := 0; i+1 < len(fields); i++ {
+		if f := fields[i]; strings.HasPrefix(f, "ssh-") || strings.HasPrefix(f, "ecdsa-") || strings.HasPrefix(f, "sk-") {
+			return fields[i+1]
+		}
+	}
+	return strings.TrimSpace(key)
+}
+
+// dedupeSSHKeys trims the given keys and drops the empty ones as well as
+// those whose blob has been seen before, preserving the order of the keys.
+func dedupeSSHKeys(keys []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		blob := SSHKeyBlob(key)
+		if seen[blob] {
+			continue
+		}
+		seen[blob] = true
+		unique = append(unique, key)
+	}
+	return unique
+}
+
 // Add the provide SSH public key to the core user's list of
 // authorized keys
 func AuthorizeSSHKeys(user string, keysName string, keys []string) error {
-	for i, key := range keys {
-		keys[i] = strings.TrimSpace(key)
-	}
+	keys = dedupeSSHKeys(keys)
 
 	// join all keys with newlines, ensuring the resulting string
 	// also ends with a newline
 	joined := fmt.Sprintf("%s\n", strings.Join(keys, "\n"))
 
-	cmd := exec.Command("update-ssh-keys", "-u", user, "-a", keysName)
+	return updateSSHKeys(joined, "-u", user, "-a", keysName)
+}
+
+// ReplaceSSHKeys makes the given keys the only ones authorized for the user
+// by coreos-cloudinit: every other key file managed under keysName (i.e.
+// named keysName or starting with "keysName-") is removed. Key files
+// installed by anything else are left untouched. An error is returned if the
+// user can't be looked up, since the old keys couldn't be removed.
+func ReplaceSSHKeys(user string, keysName string, keys []string) error {
+	u, err := osuser.Lookup(user)
+	if err != nil {
+		return err
+	}
+	for _, name := range managedSSHKeyNames(path.Join(u.HomeDir, ".ssh"), keysName) {
+		if len(keys) > 0 && name == keysName {
+			continue
+		}
+		if err := updateSSHKeys("", "-u", user, "-d", name); err != nil {
+			return err
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return AuthorizeSSHKeys(user, keysName, keys)
+}
+
+// managedSSHKeyNames returns the names of the key files in the given .ssh
+// directory which belong to keysName.
+func managedSSHKeyNames(sshDir, keysName string) []string {
+	infos, err := ioutil.ReadDir(path.Join(sshDir, "authorized_keys.d"))
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, info := range infos {
+		if name := info.Name(); name == keysName || strings.HasPrefix(name, keysName+"-") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// updateSSHKeys runs update-ssh-keys with the given arguments, passing input
+// on its stdin.
+func updateSSHKeys(input string, args ...string) error {
+	cmd := exec.Command("update-ssh-keys", args...)
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return err
@@ -55,7 +136,7 @@ func AuthorizeSSHKeys(user string, keysName string, keys []string) error {
 		return err
 	}
 
-	_, err = io.WriteString(stdin, joined)
+	_, err = io.WriteString(stdin, input)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,104 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestSSHKeyBlob(t *testing.T) {
+	for _, tt := range []struct {
+		key  string
+		blob string
+	}{
+		{"ssh-rsa AAAA1", "AAAA1"},
+		{"ssh-rsa AAAA1 user@host", "AAAA1"},
+		{"ecdsa-sha2-nistp256 AAAA2 user@host", "AAAA2"},
+		{`no-pty,command="/bin/true" ssh-ed25519 AAAA3 user@host`, "AAAA3"},
+		{"  garbage  ", "garbage"},
+		{"ssh-rsa", "ssh-rsa"},
+		{"", ""},
+	} {
+		if blob := SSHKeyBlob(tt.key); blob != tt.blob {
+			t.Errorf("bad blob (%q): want %q, got %q", tt.key, tt.blob, blob)
+		}
+	}
+}
+
+func TestDedupeSSHKeys(t *testing.T) {
+	for _, tt := range []struct {
+		keys   []string
+		unique []string
+	}{
+		{
+			keys:   nil,
+			unique: []string{},
+		},
+		{
+			keys: []string{
+				"ssh-rsa AAAA1 from-metadata",
+				" ssh-rsa AAAA2 user@host\n",
+				"ssh-rsa AAAA1 from-cloud-config",
+				"",
+				`no-pty ssh-rsa AAAA2 restricted`,
+			},
+			unique: []string{
+				"ssh-rsa AAAA1 from-metadata",
+				"ssh-rsa AAAA2 user@host",
+			},
+		},
+	} {
+		if unique := dedupeSSHKeys(tt.keys); !reflect.DeepEqual(tt.unique, unique) {
+			t.Errorf("bad keys (%q): want %q, got %q", tt.keys, tt.unique, unique)
+		}
+	}
+}
+
+func TestManagedSSHKeyNames(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if names := managedSSHKeyNames(dir, "coreos-cloudinit"); names != nil {
+		t.Errorf("bad names without authorized_keys.d: want nil, got %q", names)
+	}
+
+	keysDir := path.Join(dir, "authorized_keys.d")
+	if err := os.Mkdir(keysDir, 0700); err != nil {
+		t.Fatalf("Unable to create %s: %v", keysDir, err)
+	}
+	for _, name := range []string{"coreos-cloudinit", "coreos-cloudinit-core", "coreos-cloudinitx", "github-foo", "oem"} {
+		if err := ioutil.WriteFile(path.Join(keysDir, name), []byte("ssh-rsa AAAA\n"), 0600); err != nil {
+			t.Fatalf("Unable to write key file %s: %v", name, err)
+		}
+	}
+
+	want := []string{"coreos-cloudinit", "coreos-cloudinit-core"}
+	if names := managedSSHKeyNames(dir, "coreos-cloudinit"); !reflect.DeepEqual(want, names) {
+		t.Errorf("bad names: want %q, got %q", want, names)
+	}
+}
+
+func TestReplaceSSHKeysUnknownUser(t *testing.T) {
+	if err := ReplaceSSHKeys("coreos-cloudinit-no-such-user", "coreos-cloudinit", nil); err == nil {
+		t.Errorf("replacing the keys of an unknown user didn't fail")
+	}
+}
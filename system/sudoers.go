@@ -0,0 +1,94 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// SudoersFile returns the sudoers fragment holding the given rules for the
+// user, after checking each of the rules. sudo skips files in sudoers.d whose
+// names contain a '.', so dots in the user name are replaced.
+func SudoersFile(user string, rules config.SudoRules) (*File, error) {
+	if err := rules.CheckUser(user); err != nil {
+		return nil, err
+	}
+	if err := rules.CheckRules(); err != nil {
+		return nil, fmt.Errorf("%v for user %q", err, user)
+	}
+
+	content := "# Created by coreos-cloudinit\n"
+	for _, rule := range rules {
+		content += fmt.Sprintf("%s %s\n", user, rule)
+	}
+	return &File{config.File{
+		Path:               path.Join("etc", "sudoers.d", strings.Replace(user, ".", "_", -1)),
+		RawFilePermissions: "0440",
+		Content:            content,
+	}}, nil
+}
+
+// WriteSudoers writes the sudoers fragment for the user. If visudo is
+// available, the fragment is checked with it first so that a broken fragment
+// never ends up in sudoers.d.
+func WriteSudoers(user string, rules config.SudoRules, root string) (string, error) {
+	f, err := SudoersFile(user, rules)
+	if err != nil {
+		return "", err
+	}
+	if err := visudoCheck(f.Content); err != nil {
+		return "", fmt.Errorf("invalid sudo rules for user %q: %v", user, err)
+	}
+	return WriteFile(f, root)
+}
+
+// visudoCheck checks the syntax of the given sudoers fragment with visudo. It
+// is skipped if visudo isn't installed.
+func visudoCheck(content string) error {
+	visudo, err := exec.LookPath("visudo")
+	if err != nil {
+		return nil
+	}
+
+	tmp, err := ioutil.TempFile("", "cloudinit-sudoers")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if output, err := exec.Command(visudo, "-c", "-q", "-f", tmp.Name()).CombinedOutput(); err != nil {
+		log.Printf("Command 'visudo -c -q -f %s' failed: %v\n%s", tmp.Name(), err, output)
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestWriteSudoers(t *testing.T) {
+	for _, tt := range []struct {
+		user  string
+		rules config.SudoRules
+
+		path    string
+		content string
+		err     string
+	}{
+		{
+			user:    "core",
+			rules:   config.SudoRules{"ALL=(ALL) NOPASSWD:ALL"},
+			path:    "etc/sudoers.d/core",
+			content: "# Created by coreos-cloudinit\ncore ALL=(ALL) NOPASSWD:ALL\n",
+		},
+		{
+			user:    "john.doe",
+			rules:   config.SudoRules{"ALL=(root) /usr/bin/journalctl", "ALL=(ALL) NOPASSWD:/usr/bin/systemctl"},
+			path:    "etc/sudoers.d/john_doe",
+			content: "# Created by coreos-cloudinit\njohn.doe ALL=(root) /usr/bin/journalctl\njohn.doe ALL=(ALL) NOPASSWD:/usr/bin/systemctl\n",
+		},
+		{
+			user:  "elroy",
+			rules: config.SudoRules{"ALL=(ALL) NOPASSWD:ALL", "NOPASSWD ALL"},
+			path:  "etc/sudoers.d/elroy",
+			err:   `invalid sudo rule "NOPASSWD ALL" for user "elroy"`,
+		},
+		{
+			user:  "bad user",
+			rules: config.SudoRules{"ALL=(ALL) ALL"},
+			path:  "etc/sudoers.d/bad user",
+			err:   `invalid user name "bad user" for sudo rules`,
+		},
+	} {
+		func() {
+			dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+			if err != nil {
+				t.Fatalf("Unable to create tempdir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			fullPath, err := WriteSudoers(tt.user, tt.rules, dir)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("bad error (%q): want %q, got %v", tt.user, tt.err, err)
+				}
+				if _, err := os.Stat(path.Join(dir, tt.path)); !os.IsNotExist(err) {
+					t.Errorf("bad sudoers file (%q): want none, got %v", tt.user, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("bad error (%q): want nil, got %v", tt.user, err)
+			}
+			if want := path.Join(dir, tt.path); fullPath != want {
+				t.Errorf("bad path (%q): want %q, got %q", tt.user, want, fullPath)
+			}
+
+			fi, err := os.Stat(fullPath)
+			if err != nil {
+				t.Fatalf("Unable to stat file: %v", err)
+			}
+			if fi.Mode() != os.FileMode(0440) {
+				t.Errorf("bad permissions (%q): want %v, got %v", tt.user, os.FileMode(0440), fi.Mode())
+			}
+			contents, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				t.Fatalf("Unable to read file: %v", err)
+			}
+			if string(contents) != tt.content {
+				t.Errorf("bad contents (%q): want %q, got %q", tt.user, tt.content, contents)
+			}
+		}()
+	}
+}
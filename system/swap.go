@@ -0,0 +1,126 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+// swapSignature is written by mkswap at the end of the first page of a
+// swap area.
+const swapSignature = "SWAPSPACE2"
+
+var ErrFallocateUnsupported = errors.New("filesystem does not support fallocate")
+
+type Swap struct {
+	config.Swap
+}
+
+// Create allocates and formats the swap file beneath root. If the file
+// already carries a swap signature, it is left untouched; any other existing
+// file is refused. A file created by Create is removed again if it couldn't be
+// set up.
+func (s Swap) Create(root string) error {
+	if s.Size == "" {
+		return fmt.Errorf("no size given for swap file %q", s.Path)
+	}
+	if err := config.AssertStructValid(s.Swap); err != nil {
+		return err
+	}
+
+	fullpath := path.Join(root, s.Path)
+	if ok, err := hasSwapSignature(fullpath); err != nil && !os.IsNotExist(err) {
+		return err
+	} else if ok {
+		log.Printf("%q is already a swap file, skipping creation", fullpath)
+		return nil
+	} else if err == nil {
+		return fmt.Errorf("%q already exists and is not a swap file", fullpath)
+	}
+
+	if err := EnsureDirectoryExists(path.Dir(fullpath)); err != nil {
+		return err
+	}
+
+	log.Printf("Allocating %s swap file at %q", s.Size, fullpath)
+	if err := createSwapFile(fullpath, s.Size); err != nil {
+		os.Remove(fullpath)
+		return err
+	}
+	return nil
+}
+
+// createSwapFile allocates and formats the (not yet existing) swap file at
+// fullpath.
+func createSwapFile(fullpath, size string) error {
+	if output, err := exec.Command("fallocate", "-l", size, fullpath).CombinedOutput(); err != nil {
+		if strings.Contains(string(output), "not supported") {
+			return ErrFallocateUnsupported
+		}
+		return fmt.Errorf("Call to fallocate failed with %v: %s", err, output)
+	}
+
+	if err := os.Chmod(fullpath, 0600); err != nil {
+		return err
+	}
+
+	if output, err := exec.Command("mkswap", fullpath).CombinedOutput(); err != nil {
+		return fmt.Errorf("Call to mkswap failed with %v: %s", err, output)
+	}
+	return nil
+}
+
+func (s Swap) Units() []Unit {
+	if s.Path == "" {
+		return nil
+	}
+
+	content := fmt.Sprintf("[Swap]\nWhat=%s\n", s.Path)
+	if s.Priority != 0 {
+		content += fmt.Sprintf("Priority=%d\n", s.Priority)
+	}
+	content += "\n[Install]\nWantedBy=swap.target\n"
+
+	return []Unit{{config.Unit{
+		Name:    EscapePath(s.Path) + ".swap",
+		Content: content,
+		Enable:  true,
+		Command: "start",
+	}}}
+}
+
+func hasSwapSignature(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	offset := int64(os.Getpagesize() - len(swapSignature))
+	sig := make([]byte, len(swapSignature))
+	if n, _ := f.ReadAt(sig, offset); n != len(sig) {
+		return false, nil
+	}
+	return bytes.Equal(sig, []byte(swapSignature)), nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestSwapUnits(t *testing.T) {
+	for _, tt := range []struct {
+		config config.Swap
+		units  []Unit
+	}{
+		{
+			config.Swap{},
+			nil,
+		},
+		{
+			config.Swap{Path: "/var/swapfile", Size: "512M"},
+			[]Unit{{config.Unit{
+				Name:    "var-swapfile.swap",
+				Content: "[Swap]\nWhat=/var/swapfile\n\n[Install]\nWantedBy=swap.target\n",
+				Enable:  true,
+				Command: "start",
+			}}},
+		},
+		{
+			config.Swap{Path: "/var/lib/swap-1", Size: "2G", Priority: 10},
+			[]Unit{{config.Unit{
+				Name:    "var-lib-swap\\x2d1.swap",
+				Content: "[Swap]\nWhat=/var/lib/swap-1\nPriority=10\n\n[Install]\nWantedBy=swap.target\n",
+				Enable:  true,
+				Command: "start",
+			}}},
+		},
+	} {
+		units := Swap{tt.config}.Units()
+		if !reflect.DeepEqual(tt.units, units) {
+			t.Errorf("bad units (%+v): want %#v, got %#v", tt.config, tt.units, units)
+		}
+	}
+}
+
+func TestSwapCreateInvalid(t *testing.T) {
+	for _, tt := range []config.Swap{
+		{Path: "/swapfile"},
+		{Path: "/swapfile", Size: "lots"},
+		{Path: "/swapfile", Size: "2GB"},
+	} {
+		if err := (Swap{tt}).Create("/nonexistent"); err == nil {
+			t.Errorf("bad swap (%+v): want error, got nil", tt)
+		}
+	}
+}
+
+func TestSwapCreateExisting(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := make([]byte, os.Getpagesize())
+	copy(content[len(content)-len(swapSignature):], swapSignature)
+	if err := ioutil.WriteFile(path.Join(dir, "swapfile"), content, 0600); err != nil {
+		t.Fatalf("Unable to write swap file: %v", err)
+	}
+
+	// fallocate and mkswap must not be invoked for an existing swap file
+	if err := (Swap{config.Swap{Path: "/swapfile", Size: "1M"}}).Create(dir); err != nil {
+		t.Fatalf("bad error: want nil, got %v", err)
+	}
+}
+
+func TestSwapCreateExistingFile(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := path.Join(dir, "swapfile")
+	if err := ioutil.WriteFile(p, []byte("precious"), 0644); err != nil {
+		t.Fatalf("Unable to write file: %v", err)
+	}
+
+	// an existing file without a swap signature must be neither formatted
+	// nor removed
+	if err := (Swap{config.Swap{Path: "/swapfile", Size: "1M"}}).Create(dir); err == nil {
+		t.Fatalf("bad error: want non-nil, got nil")
+	}
+	if content, err := ioutil.ReadFile(p); err != nil || string(content) != "precious" {
+		t.Errorf("existing file was modified: %q, %v", content, err)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+const sysctlUnit = "systemd-sysctl.service"
+
+// Sysctl is a top-level structure which embeds its underlying configuration,
+// config.Sysctl, and provides the system-specific File() and Units().
+type Sysctl struct {
+	config.Sysctl
+}
+
+// File generates a sysctl.d file setting the parameters in sorted order.
+func (s Sysctl) File() (*File, error) {
+	if len(s.Sysctl) == 0 {
+		return nil, nil
+	}
+
+	params, err := s.Normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	content := ""
+	for _, key := range keys {
+		content += fmt.Sprintf("%s = %s\n", key, params[key])
+	}
+
+	return &File{config.File{
+		Path:               path.Join("etc", "sysctl.d", "60-cloudinit.conf"),
+		RawFilePermissions: "0644",
+		Content:            content,
+	}}, nil
+}
+
+// Units restarts systemd-sysctl so that the parameters are applied
+// immediately.
+func (s Sysctl) Units() []Unit {
+	if len(s.Sysctl) == 0 {
+		return nil
+	}
+	return []Unit{{config.Unit{
+		Name:    sysctlUnit,
+		Command: "restart",
+	}}}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestSysctlFile(t *testing.T) {
+	for _, tt := range []struct {
+		config config.Sysctl
+		file   *File
+		err    bool
+	}{
+		{
+			config: config.Sysctl{},
+		},
+		{
+			config: config.Sysctl{
+				"vm.swappiness":       "10",
+				"net/ipv4/ip_forward": "1",
+				"kernel.panic":        "60",
+			},
+			file: &File{config.File{
+				Path:               "etc/sysctl.d/60-cloudinit.conf",
+				RawFilePermissions: "0644",
+				Content:            "kernel.panic = 60\nnet.ipv4.ip_forward = 1\nvm.swappiness = 10\n",
+			}},
+		},
+		{
+			config: config.Sysctl{"net.ipv4.ip_forward": "1", "net/ipv4/ip_forward": "0"},
+			err:    true,
+		},
+	} {
+		file, err := Sysctl{tt.config}.File()
+		if tt.err != (err != nil) {
+			t.Errorf("bad error (%q): want %t, got %v", tt.config, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.file, file) {
+			t.Errorf("bad file (%q): want %#v, got %#v", tt.config, tt.file, file)
+		}
+	}
+}
+
+func TestSysctlUnits(t *testing.T) {
+	for _, tt := range []struct {
+		config config.Sysctl
+		units  []Unit
+	}{
+		{
+			config: config.Sysctl{},
+		},
+		{
+			config: config.Sysctl{"vm.swappiness": "10"},
+			units: []Unit{{config.Unit{
+				Name:    "systemd-sysctl.service",
+				Command: "restart",
+			}}},
+		},
+	} {
+		if units := (Sysctl{tt.config}).Units(); !reflect.DeepEqual(tt.units, units) {
+			t.Errorf("bad units (%q): want %#v, got %#v", tt.config, tt.units, units)
+		}
+	}
+}
@@ -21,10 +21,13 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
 	"strings"
+	"syscall"
 
 	"github.com/coreos/coreos-cloudinit/config"
 	"github.com/coreos/go-systemd/dbus"
+	godbus "github.com/guelfey/go.dbus"
 )
 
 func NewUnitManager(root string) UnitManager {
@@ -102,7 +105,20 @@ func (s *systemd) RunUnitCommand(u Unit, c string) (string, error) {
 		return "", fmt.Errorf("Unsupported systemd command %q", c)
 	}
 
-	return fn(u.Name, "replace")
+	res, err := fn(u.Name, "replace")
+	if c != "reload" {
+		return res, err
+	}
+
+	// Unlike reload-or-restart, there is no fallback if the unit can't be
+	// reloaded, so make sure that doesn't go unnoticed.
+	if err != nil {
+		return res, fmt.Errorf("failed to reload %q: %v", u.Name, err)
+	}
+	if res != "done" {
+		return res, fmt.Errorf("failed to reload %q: job %s", u.Name, res)
+	}
+	return res, nil
 }
 
 func (s *systemd) DaemonReload() error {
@@ -115,37 +131,56 @@ func (s *systemd) DaemonReload() error {
 }
 
 // MaskUnit masks the given Unit by symlinking its unit file to
-// /dev/null, analogous to `systemctl mask`.
+// /dev/null, analogous to `systemctl mask`, and verifies that the symlink is
+// in place. Units which are already masked are left alone.
 // N.B.: Unlike `systemctl mask`, this function will *remove any existing unit
 // file at the location*, to ensure that the mask will succeed.
-func (s *systemd) MaskUnit(u Unit) error {
+func (s *systemd) MaskUnit(u Unit) (bool, error) {
 	masked := u.Destination(s.root)
-	if _, err := os.Stat(masked); os.IsNotExist(err) {
+	if target, err := os.Readlink(masked); err == nil && target == "/dev/null" {
+		return false, nil
+	}
+	if _, err := os.Lstat(masked); os.IsNotExist(err) {
 		if err := os.MkdirAll(path.Dir(masked), os.FileMode(0755)); err != nil {
-			return err
+			return false, err
 		}
 	} else if err := os.Remove(masked); err != nil {
-		return err
+		return false, err
 	}
-	return os.Symlink("/dev/null", masked)
+	if err := os.Symlink("/dev/null", masked); err != nil {
+		return false, err
+	}
+	if target, err := os.Readlink(masked); err != nil || target != "/dev/null" {
+		return true, fmt.Errorf("failed to mask %s: %s is not a symlink to /dev/null", u.Name, masked)
+	}
+	return true, nil
 }
 
 // UnmaskUnit is analogous to systemd's unit_file_unmask. If the file
 // associated with the given Unit is empty or appears to be a symlink to
 // /dev/null, it is removed.
-func (s *systemd) UnmaskUnit(u Unit) error {
-	masked := u.Destination(s.root)
-	ne, err := nullOrEmpty(masked)
-	if os.IsNotExist(err) {
-		return nil
-	} else if err != nil {
-		return err
+func (s *systemd) UnmaskUnit(u Unit) (bool, error) {
+	masked, err := UnitMasked(u, s.root)
+	if err != nil || !masked {
+		return false, err
+	}
+	dst := u.Destination(s.root)
+	if err := os.Remove(dst); err != nil {
+		return false, err
 	}
-	if !ne {
-		log.Printf("%s is not null or empty, refusing to unmask", masked)
-		return nil
+	return true, nil
+}
+
+// UnitMasked reports whether the file associated with the given Unit beneath
+// root is empty or appears to be a symlink to /dev/null, i.e. whether the
+// unit is masked.
+func UnitMasked(u Unit, root string) (bool, error) {
+	dst := u.Destination(root)
+	ne, err := nullOrEmpty(dst)
+	if os.IsNotExist(err) {
+		return false, nil
 	}
-	return os.Remove(masked)
+	return ne, err
 }
 
 // nullOrEmpty checks whether a given path appears to be an empty regular file
@@ -165,28 +200,154 @@ func nullOrEmpty(path string) (bool, error) {
 	return false, nil
 }
 
-func ExecuteScript(scriptPath string) (string, error) {
-	props := []dbus.Property{
-		dbus.PropDescription("Unit generated and executed by coreos-cloudinit on behalf of user"),
-		dbus.PropExecStart([]string{"/bin/bash", scriptPath}, false),
+// ErrScriptFailed is returned by ExecuteScript if the script didn't exit
+// successfully.
+type ErrScriptFailed struct {
+	Path   string
+	Unit   string
+	Result string
+	Status int
+}
+
+func (e ErrScriptFailed) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("script %s (%s) exited with status %d", e.Path, e.Unit, e.Status)
+	}
+	return fmt.Sprintf("script %s (%s) failed: %s", e.Path, e.Unit, e.Result)
+}
+
+// scriptConn is the subset of the systemd D-Bus connection which is needed to
+// run a script and get its exit status.
+type scriptConn interface {
+	StartTransientUnit(name string, mode string, properties ...dbus.Property) (string, error)
+	GetUnitTypeProperty(unit string, unitType string, propertyName string) (*dbus.Property, error)
+}
+
+// ExecuteScript runs the script at the given path with the given interpreter
+// (and its arguments) in a transient systemd unit, whose name is returned.
+// The output of the script is sent to the journal with the identifier
+// "coreos-cloudinit-script". ExecuteScript waits for the script to exit and
+// returns an ErrScriptFailed if it didn't exit successfully.
+func ExecuteScript(scriptPath string, interpreter []string) (string, error) {
+	conn, err := dbus.New()
+	if err != nil {
+		return "", err
 	}
+	return executeScript(conn, scriptPath, interpreter)
+}
 
+func executeScript(conn scriptConn, scriptPath string, interpreter []string) (string, error) {
 	base := path.Base(scriptPath)
 	name := fmt.Sprintf("coreos-cloudinit-%s.service", base)
+	props := scriptProperties(scriptPath, interpreter)
 
-	log.Printf("Creating transient systemd unit '%s'", name)
+	log.Printf("Creating transient systemd unit '%s' running '%s'", name, strings.Join(scriptCommand(scriptPath, interpreter), " "))
 
-	conn, err := dbus.New()
+	result, err := conn.StartTransientUnit(name, "replace", props...)
 	if err != nil {
-		return "", err
+		return name, err
+	}
+	if result == "done" {
+		log.Printf("Script '%s' exited successfully", scriptPath)
+		return name, nil
+	}
+
+	status := 0
+	if prop, err := conn.GetUnitTypeProperty(name, "Service", "ExecMainStatus"); err == nil {
+		if s, ok := prop.Value.Value().(int32); ok {
+			status = int(s)
+		}
+	}
+	return name, ErrScriptFailed{Path: scriptPath, Unit: name, Result: result, Status: status}
+}
+
+func scriptProperties(scriptPath string, interpreter []string) []dbus.Property {
+	return []dbus.Property{
+		dbus.PropDescription("Unit generated and executed by coreos-cloudinit on behalf of user"),
+		dbus.PropExecStart(scriptCommand(scriptPath, interpreter), false),
+		// The start job only finishes once the script has exited, and the
+		// unit is kept around so that its exit status can be read.
+		{Name: "Type", Value: godbus.MakeVariant("oneshot")},
+		dbus.PropRemainAfterExit(true),
+		{Name: "StandardOutput", Value: godbus.MakeVariant("journal")},
+		{Name: "StandardError", Value: godbus.MakeVariant("journal")},
+		{Name: "SyslogIdentifier", Value: godbus.MakeVariant("coreos-cloudinit-script")},
+	}
+}
+
+func scriptCommand(scriptPath string, interpreter []string) []string {
+	if len(interpreter) == 0 {
+		interpreter = []string{"/bin/bash"}
+	}
+	return append(append([]string{}, interpreter...), scriptPath)
+}
+
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// IsValidHostname reports whether hostname is a valid RFC 1123 hostname.
+func IsValidHostname(hostname string) bool {
+	if len(hostname) == 0 || len(hostname) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if !hostnameLabel.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxHostnameLength is the length limit of the kernel hostname.
+const MaxHostnameLength = 64
+
+// ShortHostname returns the short name of hostname, i.e. its first label.
+func ShortHostname(hostname string) string {
+	return strings.SplitN(hostname, ".", 2)[0]
+}
+
+// The ways of setting the hostname. They are variables so that they can be
+// replaced in tests.
+var (
+	// hostnamedAvailable reports whether the hostname can be set through
+	// systemd-hostnamed, i.e. whether hostnamectl is installed and systemd
+	// is running.
+	hostnamedAvailable = func() bool {
+		if _, err := exec.LookPath("hostnamectl"); err != nil {
+			return false
+		}
+		_, err := os.Stat("/run/systemd/system")
+		return err == nil
 	}
+	hostnamectlSetHostname = func(hostname string) error {
+		return exec.Command("hostnamectl", "set-hostname", hostname).Run()
+	}
+	sethostname  = syscall.Sethostname
+	hostnamePath = "/etc/hostname"
+)
 
-	_, err = conn.StartTransientUnit(name, "replace", props...)
-	return name, err
+// setKernelHostname sets the hostname through systemd-hostnamed, so that it
+// takes effect immediately for everything watching it, if it is available.
+// Otherwise the hostname is written to /etc/hostname and set with
+// sethostname(2).
+func setKernelHostname(hostname string) error {
+	if hostnamedAvailable() {
+		return hostnamectlSetHostname(hostname)
+	}
+	log.Printf("systemd-hostnamed is not available, writing %s", hostnamePath)
+	if err := ioutil.WriteFile(hostnamePath, []byte(hostname+"\n"), 0644); err != nil {
+		return err
+	}
+	return sethostname([]byte(hostname))
 }
 
+// SetHostname sets the hostname of the system. Given an FQDN, only its short
+// name is set as the hostname; EtcHosts records the FQDN in /etc/hosts.
 func SetHostname(hostname string) error {
-	return exec.Command("hostnamectl", "set-hostname", hostname).Run()
+	short := ShortHostname(hostname)
+	if len(short) > MaxHostnameLength {
+		return fmt.Errorf("hostname %q is longer than %d bytes", short, MaxHostnameLength)
+	}
+	return setKernelHostname(short)
 }
 
 func Hostname() (string, error) {
@@ -19,9 +19,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/config"
+	"github.com/coreos/go-systemd/dbus"
+	godbus "github.com/guelfey/go.dbus"
 )
 
 func TestPlaceUnit(t *testing.T) {
@@ -145,6 +149,62 @@ func TestMachineID(t *testing.T) {
 	}
 }
 
+func TestPlaceUnitDirectories(t *testing.T) {
+	defer func(unit, runtime, dropIn string) {
+		UnitDirectory, RuntimeUnitDirectory, DropInDirectory = unit, runtime, dropIn
+	}(UnitDirectory, RuntimeUnitDirectory, DropInDirectory)
+	UnitDirectory = "/usr/local/lib/systemd"
+	RuntimeUnitDirectory = "/var/run/systemd"
+	DropInDirectory = "/usr/local/etc/systemd"
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sd := &systemd{dir}
+	for _, tt := range []struct {
+		unit config.Unit
+
+		unitPath   string
+		dropInPath string
+	}{
+		{
+			unit:       config.Unit{Name: "foo.service"},
+			unitPath:   "usr/local/lib/systemd/system/foo.service",
+			dropInPath: "usr/local/etc/systemd/system/foo.service.d/10-foo.conf",
+		},
+		{
+			unit:       config.Unit{Name: "foo.network"},
+			unitPath:   "usr/local/lib/systemd/network/foo.network",
+			dropInPath: "usr/local/etc/systemd/network/foo.network.d/10-foo.conf",
+		},
+		{
+			unit:       config.Unit{Name: "bar.service", Runtime: true},
+			unitPath:   "var/run/systemd/system/bar.service",
+			dropInPath: "var/run/systemd/system/bar.service.d/10-foo.conf",
+		},
+	} {
+		tt.unit.Content = "[Unit]"
+		u := Unit{tt.unit}
+		if err := sd.PlaceUnit(u); err != nil {
+			t.Fatalf("PlaceUnit(%q) failed: %v", u.Name, err)
+		}
+		if err := sd.PlaceUnitDropIn(u, config.UnitDropIn{Name: "10-foo.conf", Content: "[Service]"}); err != nil {
+			t.Fatalf("PlaceUnitDropIn(%q) failed: %v", u.Name, err)
+		}
+		for p, content := range map[string]string{tt.unitPath: "[Unit]", tt.dropInPath: "[Service]"} {
+			got, err := ioutil.ReadFile(path.Join(dir, p))
+			if err != nil {
+				t.Errorf("unable to read %q: %v", p, err)
+			} else if string(got) != content {
+				t.Errorf("bad contents of %q: want %q, got %q", p, content, got)
+			}
+		}
+	}
+}
+
 func TestMaskUnit(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
 	if err != nil {
@@ -156,8 +216,8 @@ func TestMaskUnit(t *testing.T) {
 
 	// Ensure mask works with units that do not currently exist
 	uf := Unit{config.Unit{Name: "foo.service"}}
-	if err := sd.MaskUnit(uf); err != nil {
-		t.Fatalf("Unable to mask new unit: %v", err)
+	if changed, err := sd.MaskUnit(uf); err != nil || !changed {
+		t.Fatalf("Unable to mask new unit: %t, %v", changed, err)
 	}
 	fooPath := path.Join(dir, "etc", "systemd", "system", "foo.service")
 	fooTgt, err := os.Readlink(fooPath)
@@ -174,8 +234,8 @@ func TestMaskUnit(t *testing.T) {
 	if _, err := os.Create(barPath); err != nil {
 		t.Fatalf("Error creating new unit file: %v", err)
 	}
-	if err := sd.MaskUnit(ub); err != nil {
-		t.Fatalf("Unable to mask existing unit: %v", err)
+	if changed, err := sd.MaskUnit(ub); err != nil || !changed {
+		t.Fatalf("Unable to mask existing unit: %t, %v", changed, err)
 	}
 	barTgt, err := os.Readlink(barPath)
 	if err != nil {
@@ -196,8 +256,8 @@ func TestUnmaskUnit(t *testing.T) {
 	sd := &systemd{dir}
 
 	nilUnit := Unit{config.Unit{Name: "null.service"}}
-	if err := sd.UnmaskUnit(nilUnit); err != nil {
-		t.Errorf("unexpected error from unmasking nonexistent unit: %v", err)
+	if changed, err := sd.UnmaskUnit(nilUnit); err != nil || changed {
+		t.Errorf("unexpected result from unmasking nonexistent unit: %t, %v", changed, err)
 	}
 
 	uf := Unit{config.Unit{Name: "foo.service", Content: "[Service]\nExecStart=/bin/true"}}
@@ -212,8 +272,8 @@ func TestUnmaskUnit(t *testing.T) {
 	if err := ioutil.WriteFile(dst, []byte(uf.Content), 700); err != nil {
 		t.Fatalf("Unable to write unit file: %v", err)
 	}
-	if err := sd.UnmaskUnit(uf); err != nil {
-		t.Errorf("unmask of non-empty unit returned unexpected error: %v", err)
+	if changed, err := sd.UnmaskUnit(uf); err != nil || changed {
+		t.Errorf("unmask of non-empty unit returned unexpected result: %t, %v", changed, err)
 	}
 	got, _ := ioutil.ReadFile(dst)
 	if string(got) != uf.Content {
@@ -225,14 +285,57 @@ func TestUnmaskUnit(t *testing.T) {
 	if err := os.Symlink("/dev/null", dst); err != nil {
 		t.Fatalf("Unable to create masked unit: %v", err)
 	}
-	if err := sd.UnmaskUnit(ub); err != nil {
-		t.Errorf("unmask of unit returned unexpected error: %v", err)
+	if changed, err := sd.UnmaskUnit(ub); err != nil || !changed {
+		t.Errorf("unmask of unit returned unexpected result: %t, %v", changed, err)
 	}
 	if _, err := os.Stat(dst); !os.IsNotExist(err) {
 		t.Errorf("expected %s to not exist after unmask, but got err: %s", dst, err)
 	}
 }
 
+func TestMaskUnmaskUnit(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sd := &systemd{dir}
+	u := Unit{config.Unit{Name: "foo.service", Content: "[Service]\nExecStart=/bin/true"}}
+
+	if changed, err := sd.MaskUnit(u); err != nil || !changed {
+		t.Fatalf("bad mask: want true, nil, got %t, %v", changed, err)
+	}
+	if masked, err := UnitMasked(u, dir); err != nil || !masked {
+		t.Fatalf("unit not masked: %t, %v", masked, err)
+	}
+	if changed, err := sd.MaskUnit(u); err != nil || changed {
+		t.Fatalf("bad mask of masked unit: want false, nil, got %t, %v", changed, err)
+	}
+
+	if changed, err := sd.UnmaskUnit(u); err != nil || !changed {
+		t.Fatalf("bad unmask: want true, nil, got %t, %v", changed, err)
+	}
+	if _, err := os.Lstat(u.Destination(dir)); !os.IsNotExist(err) {
+		t.Fatalf("expected unit to be removed after unmask, got %v", err)
+	}
+
+	// The unit is runnable again once its contents have been placed.
+	if err := sd.PlaceUnit(u); err != nil {
+		t.Fatalf("Unable to place unit: %v", err)
+	}
+	if masked, err := UnitMasked(u, dir); err != nil || masked {
+		t.Fatalf("unit still masked: %t, %v", masked, err)
+	}
+	if changed, err := sd.UnmaskUnit(u); err != nil || changed {
+		t.Fatalf("bad unmask of unmasked unit: want false, nil, got %t, %v", changed, err)
+	}
+	got, err := ioutil.ReadFile(u.Destination(dir))
+	if err != nil || string(got) != u.Content {
+		t.Fatalf("bad unit contents: want %q, got %q (%v)", u.Content, got, err)
+	}
+}
+
 func TestNullOrEmpty(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
 	if err != nil {
@@ -278,3 +381,210 @@ func TestNullOrEmpty(t *testing.T) {
 	}
 
 }
+
+func TestIsValidHostname(t *testing.T) {
+	for _, tt := range []struct {
+		hostname string
+
+		valid bool
+	}{
+		{"coreos1", true},
+		{"web-10.0.0.1", true},
+		{"node.example.com", true},
+		{"1y", true},
+		{"", false},
+		{"-web", false},
+		{"web-", false},
+		{"web_1", false},
+		{"web$1", false},
+		{"node..example.com", false},
+		{strings.Repeat("a", 63), true},
+		{strings.Repeat("a", 64), false},
+		{strings.Repeat("a.", 127) + "a", false},
+	} {
+		if valid := IsValidHostname(tt.hostname); tt.valid != valid {
+			t.Errorf("bad validity (%q): want %t, got %t", tt.hostname, tt.valid, valid)
+		}
+	}
+}
+
+func TestSetHostname(t *testing.T) {
+	defer func(f func() bool, g func(string) error) {
+		hostnamedAvailable, hostnamectlSetHostname = f, g
+	}(hostnamedAvailable, hostnamectlSetHostname)
+	hostnamedAvailable = func() bool { return true }
+
+	for _, tt := range []struct {
+		hostname string
+
+		set string
+		err error
+	}{
+		{hostname: "node", set: "node"},
+		{hostname: "node.example.com", set: "node"},
+		{
+			hostname: strings.Repeat("a", 65),
+			err:      fmt.Errorf("hostname %q is longer than 64 bytes", strings.Repeat("a", 65)),
+		},
+		{
+			hostname: strings.Repeat("a", 65) + ".example.com",
+			err:      fmt.Errorf("hostname %q is longer than 64 bytes", strings.Repeat("a", 65)),
+		},
+	} {
+		var set string
+		hostnamectlSetHostname = func(hostname string) error {
+			set = hostname
+			return nil
+		}
+		if err := SetHostname(tt.hostname); !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%q): want %v, got %v", tt.hostname, tt.err, err)
+		}
+		if set != tt.set {
+			t.Errorf("bad kernel hostname (%q): want %q, got %q", tt.hostname, tt.set, set)
+		}
+	}
+}
+
+func TestSetHostnameFallback(t *testing.T) {
+	defer func(f func() bool, g func(string) error, h func([]byte) error, p string) {
+		hostnamedAvailable, hostnamectlSetHostname, sethostname, hostnamePath = f, g, h, p
+	}(hostnamedAvailable, hostnamectlSetHostname, sethostname, hostnamePath)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	hostnamePath = path.Join(dir, "hostname")
+
+	for _, available := range []bool{true, false} {
+		os.Remove(hostnamePath)
+		var hostnamectl, kernel string
+		hostnamedAvailable = func() bool { return available }
+		hostnamectlSetHostname = func(hostname string) error {
+			hostnamectl = hostname
+			return nil
+		}
+		sethostname = func(hostname []byte) error {
+			kernel = string(hostname)
+			return nil
+		}
+
+		if err := SetHostname("node.example.com"); err != nil {
+			t.Fatalf("bad error (%t): want nil, got %v", available, err)
+		}
+		contents, err := ioutil.ReadFile(hostnamePath)
+		if available {
+			if hostnamectl != "node" || kernel != "" || !os.IsNotExist(err) {
+				t.Errorf("hostname not set through hostnamed: hostnamectl %q, sethostname %q, %s: %q", hostnamectl, kernel, hostnamePath, contents)
+			}
+		} else {
+			if hostnamectl != "" || kernel != "node" || string(contents) != "node\n" {
+				t.Errorf("hostname not set directly: hostnamectl %q, sethostname %q, %s: %q (%v)", hostnamectl, kernel, hostnamePath, contents, err)
+			}
+		}
+	}
+}
+
+func TestScriptProperties(t *testing.T) {
+	for _, tt := range []struct {
+		interpreter []string
+
+		command []string
+	}{
+		{
+			interpreter: nil,
+			command:     []string{"/bin/bash", "/var/lib/coreos-cloudinit/scripts/123"},
+		},
+		{
+			interpreter: []string{"/bin/sh"},
+			command:     []string{"/bin/sh", "/var/lib/coreos-cloudinit/scripts/123"},
+		},
+		{
+			interpreter: []string{"/usr/bin/env", "python3"},
+			command:     []string{"/usr/bin/env", "python3", "/var/lib/coreos-cloudinit/scripts/123"},
+		},
+		{
+			interpreter: []string{"/usr/bin/python3", "-u", "-B"},
+			command:     []string{"/usr/bin/python3", "-u", "-B", "/var/lib/coreos-cloudinit/scripts/123"},
+		},
+	} {
+		props := scriptProperties("/var/lib/coreos-cloudinit/scripts/123", tt.interpreter)
+		want := []dbus.Property{
+			dbus.PropDescription("Unit generated and executed by coreos-cloudinit on behalf of user"),
+			dbus.PropExecStart(tt.command, false),
+			{Name: "Type", Value: godbus.MakeVariant("oneshot")},
+			dbus.PropRemainAfterExit(true),
+			{Name: "StandardOutput", Value: godbus.MakeVariant("journal")},
+			{Name: "StandardError", Value: godbus.MakeVariant("journal")},
+			{Name: "SyslogIdentifier", Value: godbus.MakeVariant("coreos-cloudinit-script")},
+		}
+		if !reflect.DeepEqual(want, props) {
+			t.Errorf("bad properties (%q): want %#v, got %#v", tt.interpreter, want, props)
+		}
+	}
+}
+
+type fakeScriptConn struct {
+	result string
+	status int32
+
+	started []string
+}
+
+func (c *fakeScriptConn) StartTransientUnit(name string, mode string, properties ...dbus.Property) (string, error) {
+	c.started = append(c.started, name)
+	return c.result, nil
+}
+
+func (c *fakeScriptConn) GetUnitTypeProperty(unit string, unitType string, propertyName string) (*dbus.Property, error) {
+	if unitType != "Service" || propertyName != "ExecMainStatus" {
+		return nil, fmt.Errorf("unexpected property %s.%s", unitType, propertyName)
+	}
+	return &dbus.Property{Name: propertyName, Value: godbus.MakeVariant(c.status)}, nil
+}
+
+func TestExecuteScript(t *testing.T) {
+	for _, tt := range []struct {
+		result string
+		status int32
+
+		err error
+	}{
+		{
+			result: "done",
+		},
+		{
+			result: "failed",
+			status: 3,
+			err: ErrScriptFailed{
+				Path:   "/var/lib/coreos-cloudinit/scripts/123",
+				Unit:   "coreos-cloudinit-123.service",
+				Result: "failed",
+				Status: 3,
+			},
+		},
+		{
+			result: "timeout",
+			err: ErrScriptFailed{
+				Path:   "/var/lib/coreos-cloudinit/scripts/123",
+				Unit:   "coreos-cloudinit-123.service",
+				Result: "timeout",
+			},
+		},
+	} {
+		conn := &fakeScriptConn{result: tt.result, status: tt.status}
+		name, err := executeScript(conn, "/var/lib/coreos-cloudinit/scripts/123", []string{"/bin/sh"})
+		if name != "coreos-cloudinit-123.service" || !reflect.DeepEqual([]string{name}, conn.started) {
+			t.Errorf("bad unit (%s): got %q, started %q", tt.result, name, conn.started)
+		}
+		if !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%s): want %v, got %v", tt.result, tt.err, err)
+		}
+	}
+
+	err := ErrScriptFailed{Path: "/var/lib/coreos-cloudinit/scripts/123", Unit: "coreos-cloudinit-123.service", Result: "failed", Status: 3}
+	if want := "script /var/lib/coreos-cloudinit/scripts/123 (coreos-cloudinit-123.service) exited with status 3"; err.Error() != want {
+		t.Errorf("bad error message: want %q, got %q", want, err.Error())
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+const zoneinfoDir = "/usr/share/zoneinfo"
+
+// SetTimezone points /etc/localtime (beneath root) at the zoneinfo file for
+// the given zone and records the zone name in /etc/timezone.
+func SetTimezone(zone, root string) error {
+	zonefile := path.Join(zoneinfoDir, zone)
+	if zone == "" || strings.HasPrefix(zone, "/") || !strings.HasPrefix(zonefile, zoneinfoDir+"/") {
+		return fmt.Errorf("invalid timezone %q", zone)
+	}
+	if info, err := os.Stat(path.Join(root, zonefile)); err != nil || info.IsDir() {
+		return fmt.Errorf("unknown timezone %q: %s does not exist", zone, zonefile)
+	}
+
+	localtime := path.Join(root, "etc", "localtime")
+	if err := EnsureDirectoryExists(path.Dir(localtime)); err != nil {
+		return err
+	}
+	if err := os.Remove(localtime); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(zonefile, localtime); err != nil {
+		return err
+	}
+
+	_, err := WriteFile(&File{config.File{
+		Path:               path.Join("etc", "timezone"),
+		RawFilePermissions: "0644",
+		Content:            zone + "\n",
+	}}, root)
+	return err
+}
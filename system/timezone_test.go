@@ -0,0 +1,63 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSetTimezone(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "coreos-cloudinit-")
+	if err != nil {
+		t.Fatalf("Unable to create tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	zonefile := path.Join(dir, "usr", "share", "zoneinfo", "Europe", "Berlin")
+	if err := os.MkdirAll(path.Dir(zonefile), 0755); err != nil {
+		t.Fatalf("Unable to create zoneinfo directory: %v", err)
+	}
+	if err := ioutil.WriteFile(zonefile, []byte("TZif"), 0644); err != nil {
+		t.Fatalf("Unable to write zoneinfo file: %v", err)
+	}
+
+	for _, zone := range []string{"", "America/Nowhere", "Europe", "../../../etc/passwd", "/Europe/Berlin"} {
+		if err := SetTimezone(zone, dir); err == nil {
+			t.Errorf("bad timezone (%q): want error, got nil", zone)
+		}
+	}
+
+	// run twice to make sure an existing /etc/localtime is replaced
+	for i := 0; i < 2; i++ {
+		if err := SetTimezone("Europe/Berlin", dir); err != nil {
+			t.Fatalf("bad error: want nil, got %v", err)
+		}
+	}
+
+	if target, err := os.Readlink(path.Join(dir, "etc", "localtime")); err != nil {
+		t.Fatalf("Unable to read /etc/localtime: %v", err)
+	} else if target != "/usr/share/zoneinfo/Europe/Berlin" {
+		t.Fatalf("bad /etc/localtime target: want %q, got %q", "/usr/share/zoneinfo/Europe/Berlin", target)
+	}
+
+	if content, err := ioutil.ReadFile(path.Join(dir, "etc", "timezone")); err != nil {
+		t.Fatalf("Unable to read /etc/timezone: %v", err)
+	} else if string(content) != "Europe/Berlin\n" {
+		t.Fatalf("bad /etc/timezone: want %q, got %q", "Europe/Berlin\n", content)
+	}
+}
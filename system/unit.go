@@ -15,6 +15,7 @@
 package system
 
 import (
+	"bytes"
 	"fmt"
 	"path"
 	"path/filepath"
@@ -28,11 +29,28 @@ type UnitManager interface {
 	PlaceUnitDropIn(unit Unit, dropIn config.UnitDropIn) error
 	EnableUnitFile(unit Unit) error
 	RunUnitCommand(unit Unit, command string) (string, error)
-	MaskUnit(unit Unit) error
-	UnmaskUnit(unit Unit) error
+	// MaskUnit and UnmaskUnit report whether the unit was actually masked
+	// or unmasked, i.e. whether systemd needs to be reloaded.
+	MaskUnit(unit Unit) (bool, error)
+	UnmaskUnit(unit Unit) (bool, error)
 	DaemonReload() error
 }
 
+// The directories, beneath the root of the system, into which the units are
+// written. They can be changed for images which keep their systemd
+// configuration elsewhere.
+var (
+	// UnitDirectory holds the persistent units, in its "system" and
+	// "network" subdirectories.
+	UnitDirectory = "/etc/systemd"
+	// RuntimeUnitDirectory holds the runtime units, in its "system" and
+	// "network" subdirectories.
+	RuntimeUnitDirectory = "/run/systemd"
+	// DropInDirectory holds the drop-ins of the persistent units. If it is
+	// empty, they are written to UnitDirectory alongside their units.
+	DropInDirectory = ""
+)
+
 // Unit is a top-level structure which embeds its underlying configuration,
 // config.Unit, and provides the system-specific Destination(), Type(), and
 // Group().
@@ -70,13 +88,53 @@ func (u Unit) Destination(root string) string {
 // system (similar to a chroot) and the dropIn argument is the UnitDropIn for
 // which the destination is being calculated.
 func (u Unit) DropInDestination(root string, dropIn config.UnitDropIn) string {
-	return path.Join(u.prefix(root), fmt.Sprintf("%s.d", u.Name), dropIn.Name)
+	prefix := u.prefix(root)
+	if DropInDirectory != "" && !u.Runtime {
+		prefix = path.Join(root, DropInDirectory, u.Group())
+	}
+	return path.Join(prefix, fmt.Sprintf("%s.d", u.Name), dropIn.Name)
+}
+
+// Instance returns the instance of the template Unit with the given name
+// (e.g. foo@bar.service for foo@.service and bar). The instance is not
+// written to disk itself, so it carries no content, drop-ins or mask.
+func (u Unit) Instance(name string) Unit {
+	i := strings.LastIndex(u.Name, "@") + 1
+	return Unit{config.Unit{
+		Name:    u.Name[:i] + name + u.Name[i:],
+		Enable:  true,
+		Runtime: u.Runtime,
+		Command: u.Command,
+	}}
 }
 
 func (u Unit) prefix(root string) string {
-	dir := "etc"
+	dir := UnitDirectory
 	if u.Runtime {
-		dir = "run"
+		dir = RuntimeUnitDirectory
+	}
+	return path.Join(root, dir, u.Group())
+}
+
+// EscapePath converts an absolute path into the form systemd expects in the
+// names of .mount, .swap and .automount units (see systemd-escape --path).
+func EscapePath(p string) string {
+	p = strings.Trim(path.Clean(p), "/")
+	if p == "" {
+		return "-"
+	}
+
+	var out bytes.Buffer
+	for i, c := range []byte(p) {
+		switch {
+		case c == '/':
+			out.WriteByte('-')
+		case c == '.' && i == 0,
+			!(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == ':' || c == '_' || c == '.'):
+			fmt.Fprintf(&out, "\\x%02x", c)
+		default:
+			out.WriteByte(c)
+		}
 	}
-	return path.Join(root, dir, "systemd", u.Group())
+	return out.String()
 }
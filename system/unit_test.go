@@ -15,6 +15,7 @@
 package system
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/coreos/coreos-cloudinit/config"
@@ -134,3 +135,48 @@ func TestDropInDestination(t *testing.T) {
 		}
 	}
 }
+
+func TestInstance(t *testing.T) {
+	tests := []struct {
+		unit     config.Unit
+		instance string
+
+		expect config.Unit
+	}{
+		{
+			unit:     config.Unit{Name: "foo@.service", Content: "[Service]", Command: "start"},
+			instance: "bar",
+			expect:   config.Unit{Name: "foo@bar.service", Enable: true, Command: "start"},
+		},
+		{
+			unit:     config.Unit{Name: "foo@.socket", Runtime: true},
+			instance: "8080",
+			expect:   config.Unit{Name: "foo@8080.socket", Enable: true, Runtime: true},
+		},
+	}
+
+	for _, tt := range tests {
+		if i := (Unit{tt.unit}).Instance(tt.instance); !reflect.DeepEqual(tt.expect, i.Unit) {
+			t.Errorf("bad instance (%+v, %q): want %+v, got %+v", tt.unit, tt.instance, tt.expect, i.Unit)
+		}
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+
+		escaped string
+	}{
+		{"/", "-"},
+		{"/media/state", "media-state"},
+		{"/media//state/", "media-state"},
+		{"/var/lib/my-app", "var-lib-my\\x2dapp"},
+		{"/.hidden/dir", "\\x2ehidden-dir"},
+		{"/mnt/with space", "mnt-with\\x20space"},
+	} {
+		if escaped := EscapePath(tt.path); tt.escaped != escaped {
+			t.Errorf("bad escaped path (%q): want %q, got %q", tt.path, tt.escaped, escaped)
+		}
+	}
+}
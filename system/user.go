@@ -19,6 +19,7 @@ import (
 	"log"
 	"os/exec"
 	"os/user"
+	"strconv"
 	"strings"
 
 	"github.com/coreos/coreos-cloudinit/config"
@@ -30,13 +31,99 @@ func UserExists(u *config.User) bool {
 }
 
 func CreateUser(u *config.User) error {
+	if err := config.AssertStructValid(*u); err != nil {
+		return err
+	}
+	if err := checkUID(u, user.LookupId); err != nil {
+		return err
+	}
+
+	if args := primaryGroupArgs(u, primaryGroupExists); args != nil {
+		log.Printf("Creating primary group '%s' of user '%s'", primaryGroup(u), u.Name)
+		if err := groupadd(args); err != nil {
+			return err
+		}
+	}
+
+	args := createUserArgs(u)
+	output, err := exec.Command("useradd", args...).CombinedOutput()
+	if err != nil {
+		log.Printf("Command 'useradd %s' failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return err
+}
+
+// primaryGroupArgs returns the arguments to groupadd for creating the primary
+// group of the given user, or nil if the group doesn't need to be created.
+// A numeric primary group is taken as the GID of a new group named after the
+// user.
+func primaryGroupArgs(u *config.User, exists func(group string) bool) []string {
+	group := primaryGroup(u)
+	if group == "" || u.NoUserGroup || exists(group) {
+		return nil
+	}
+	if isGID(group) {
+		return []string{"--gid", group, u.Name}
+	}
+	return []string{group}
+}
+
+// primaryGroup returns the name or GID of the primary group of the given
+// user, if any. The primary group takes precedence over the GID.
+func primaryGroup(u *config.User) string {
+	if u.PrimaryGroup != "" {
+		return u.PrimaryGroup
+	}
+	if u.GID != 0 {
+		return strconv.Itoa(u.GID)
+	}
+	return ""
+}
+
+// checkUID verifies that the UID of the given user (if any) isn't already
+// taken by a different user, since useradd would fail on it anyway.
+func checkUID(u *config.User, lookupID func(uid string) (*user.User, error)) error {
+	if u.UID == 0 {
+		return nil
+	}
+	other, err := lookupID(strconv.Itoa(u.UID))
+	if err != nil {
+		return nil
+	}
+	if other.Username != u.Name {
+		return fmt.Errorf("UID %d of user %q is already taken by user %q", u.UID, u.Name, other.Username)
+	}
+	return nil
+}
+
+func primaryGroupExists(group string) bool {
+	if isGID(group) {
+		_, err := user.LookupGroupId(group)
+		return err == nil
+	}
+	return GroupExists(group)
+}
+
+func isGID(group string) bool {
+	_, err := strconv.ParseUint(group, 10, 32)
+	return err == nil
+}
+
+// createUserArgs returns the arguments to useradd for creating the given
+// user. A user without a password hash gets an unusable password. If the
+// password is to be locked, it is locked right away the same way usermod
+// --lock would; a plaintext password has to be set (and locked) afterwards.
+func createUserArgs(u *config.User) []string {
 	args := []string{}
 
+	password := "*"
 	if u.PasswordHash != "" {
-		args = append(args, "--password", u.PasswordHash)
-	} else {
-		args = append(args, "--password", "*")
+		password = u.PasswordHash
+	}
+	if u.LockPasswd {
+		password = "!" + password
 	}
+	args = append(args, "--password", password)
 
 	if u.GECOS != "" {
 		args = append(args, "--comment", fmt.Sprintf("%q", u.GECOS))
@@ -52,8 +139,12 @@ func CreateUser(u *config.User) error {
 		args = append(args, "--create-home")
 	}
 
-	if u.PrimaryGroup != "" {
-		args = append(args, "--gid", u.PrimaryGroup)
+	if u.UID != 0 {
+		args = append(args, "--uid", strconv.Itoa(u.UID))
+	}
+
+	if group := primaryGroup(u); group != "" {
+		args = append(args, "--gid", group)
 	}
 
 	if len(u.Groups) > 0 {
@@ -76,17 +167,46 @@ func CreateUser(u *config.User) error {
 		args = append(args, "--shell", u.Shell)
 	}
 
+	if u.ExpireDate != "" {
+		args = append(args, "--expiredate", u.ExpireDate)
+	}
+
+	if u.Inactive != "" {
+		args = append(args, "--inactive", u.Inactive)
+	}
+
 	args = append(args, u.Name)
+	return args
+}
 
-	output, err := exec.Command("useradd", args...).CombinedOutput()
+// LockUserPassword disables password login for the given user. The password
+// hash is kept, so the password can be unlocked again later.
+func LockUserPassword(user string) error {
+	args := lockUserArgs(user)
+	output, err := exec.Command("usermod", args...).CombinedOutput()
 	if err != nil {
-		log.Printf("Command 'useradd %s' failed: %v\n%s", strings.Join(args, " "), err, output)
+		log.Printf("Command 'usermod %s' failed: %v\n%s", strings.Join(args, " "), err, output)
 	}
 	return err
 }
 
+func lockUserArgs(user string) []string {
+	return []string{"--lock", user}
+}
+
+// SetUserPassword sets the password of the given user to the given hash.
 func SetUserPassword(user, hash string) error {
-	cmd := exec.Command("/usr/sbin/chpasswd", "-e")
+	return chpasswd(user, hash, "-e")
+}
+
+// SetUserPlainTextPassword sets the password of the given user to the given
+// plaintext password, which is hashed by chpasswd.
+func SetUserPlainTextPassword(user, password string) error {
+	return chpasswd(user, password)
+}
+
+func chpasswd(user, password string, args ...string) error {
+	cmd := exec.Command("/usr/sbin/chpasswd", args...)
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -98,7 +218,7 @@ func SetUserPassword(user, hash string) error {
 		log.Fatal(err)
 	}
 
-	arg := fmt.Sprintf("%s:%s", user, hash)
+	arg := fmt.Sprintf("%s:%s", user, password)
 	_, err = stdin.Write([]byte(arg))
 	if err != nil {
 		return err
@@ -0,0 +1,167 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package system
+
+import (
+	"errors"
+	"os/user"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-cloudinit/config"
+)
+
+func TestCreateUserArgs(t *testing.T) {
+	tests := []struct {
+		user config.User
+
+		args []string
+	}{
+		{
+			user: config.User{Name: "core"},
+			args: []string{"--password", "*", "--create-home", "core"},
+		},
+		{
+			user: config.User{Name: "core", PasswordHash: "$6$salt$hash"},
+			args: []string{"--password", "$6$salt$hash", "--create-home", "core"},
+		},
+		{
+			user: config.User{Name: "core", PlainTextPasswd: "secret"},
+			args: []string{"--password", "*", "--create-home", "core"},
+		},
+		{
+			user: config.User{
+				Name:              "core",
+				LockPasswd:        true,
+				SSHAuthorizedKeys: []string{"ssh-rsa AAAA"},
+				Groups:            []string{"sudo", "docker"},
+				Shell:             "/bin/bash",
+			},
+			args: []string{"--password", "!*", "--create-home", "--groups", "sudo,docker", "--shell", "/bin/bash", "core"},
+		},
+		{
+			user: config.User{Name: "core", PasswordHash: "$6$salt$hash", LockPasswd: true},
+			args: []string{"--password", "!$6$salt$hash", "--create-home", "core"},
+		},
+		{
+			user: config.User{Name: "core", LockPasswd: true, ExpireDate: "2020-12-31", Inactive: "0"},
+			args: []string{"--password", "!*", "--create-home", "--expiredate", "2020-12-31", "--inactive", "0", "core"},
+		},
+		{
+			user: config.User{Name: "core", UID: 1500, GID: 1600},
+			args: []string{"--password", "*", "--create-home", "--uid", "1500", "--gid", "1600", "core"},
+		},
+		{
+			user: config.User{Name: "core", UID: 1500, GID: 1600, PrimaryGroup: "users"},
+			args: []string{"--password", "*", "--create-home", "--uid", "1500", "--gid", "users", "core"},
+		},
+		{
+			user: config.User{Name: "core", System: true, NoCreateHome: true, NoUserGroup: true, NoLogInit: true, PrimaryGroup: "users", Homedir: "/var/core", GECOS: "Core User"},
+			args: []string{"--password", "*", "--comment", `"Core User"`, "--home-dir", "/var/core", "--no-create-home", "--gid", "users", "--no-user-group", "--system", "--no-log-init", "core"},
+		},
+	}
+
+	for i, tt := range tests {
+		if args := createUserArgs(&tt.user); !reflect.DeepEqual(tt.args, args) {
+			t.Errorf("bad args (%d): want %q, got %q", i, tt.args, args)
+		}
+	}
+}
+
+func TestLockUserArgs(t *testing.T) {
+	if args := lockUserArgs("core"); !reflect.DeepEqual([]string{"--lock", "core"}, args) {
+		t.Errorf("bad args: want %q, got %q", []string{"--lock", "core"}, args)
+	}
+}
+
+func TestPrimaryGroupArgs(t *testing.T) {
+	groups := map[string]bool{"core": true, "500": true}
+	exists := func(group string) bool { return groups[group] }
+
+	tests := []struct {
+		user config.User
+
+		args []string
+	}{
+		{
+			user: config.User{Name: "elroy"},
+		},
+		{
+			user: config.User{Name: "elroy", PrimaryGroup: "core"},
+		},
+		{
+			user: config.User{Name: "elroy", PrimaryGroup: "500"},
+		},
+		{
+			user: config.User{Name: "elroy", PrimaryGroup: "jetsons"},
+			args: []string{"jetsons"},
+		},
+		{
+			user: config.User{Name: "elroy", PrimaryGroup: "1042"},
+			args: []string{"--gid", "1042", "elroy"},
+		},
+		{
+			user: config.User{Name: "elroy", PrimaryGroup: "jetsons", NoUserGroup: true},
+		},
+		{
+			user: config.User{Name: "elroy", GID: 1042},
+			args: []string{"--gid", "1042", "elroy"},
+		},
+		{
+			user: config.User{Name: "elroy", GID: 500},
+		},
+	}
+
+	for i, tt := range tests {
+		if args := primaryGroupArgs(&tt.user, exists); !reflect.DeepEqual(tt.args, args) {
+			t.Errorf("bad args (%d): want %q, got %q", i, tt.args, args)
+		}
+	}
+}
+
+func TestCheckUID(t *testing.T) {
+	lookupID := func(uid string) (*user.User, error) {
+		if uid == "500" {
+			return &user.User{Uid: uid, Username: "core"}, nil
+		}
+		return nil, errors.New("unknown user")
+	}
+
+	tests := []struct {
+		user config.User
+
+		err error
+	}{
+		{
+			user: config.User{Name: "elroy"},
+		},
+		{
+			user: config.User{Name: "elroy", UID: 1500},
+		},
+		{
+			user: config.User{Name: "core", UID: 500},
+		},
+		{
+			user: config.User{Name: "elroy", UID: 500},
+			err:  errors.New(`UID 500 of user "elroy" is already taken by user "core"`),
+		},
+	}
+
+	for i, tt := range tests {
+		if err := checkUID(&tt.user, lookupID); !reflect.DeepEqual(tt.err, err) {
+			t.Errorf("bad error (%d): want %v, got %v", i, tt.err, err)
+		}
+	}
+}